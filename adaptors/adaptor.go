@@ -16,8 +16,184 @@
 
 package adaptors
 
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+)
+
+// Adaptor verifies token signatures. Adaptors that also implement
+// ConfigDecoder are called through it; Decode is only called on adaptors
+// that do not.
 type Adaptor interface {
 	New() Adaptor
 	GetKey(jwkUri string)
 	Decode(jwt string, jwkUri string) (interface{}, error)
 }
+
+// DecodeConfig is what the verifier has resolved for decoding a token.
+type DecodeConfig struct {
+	// JWKSURI is the jwks_uri from the issuer's discovery document, or
+	// where the verifier's local key set was read from.
+	JWKSURI string
+
+	// KeyID is the kid from the token's header, or "" if it has none or
+	// it is not a string.
+	KeyID string
+
+	// HTTPClient, RequestTimeout and Cache are the verifier's, for fetching
+	// and caching the key set. They are nil or zero where the verifier
+	// uses the defaults. An adaptor's own settings should take precedence
+	// over them.
+	HTTPClient     *http.Client
+	RequestTimeout time.Duration
+	Cache          cache.Cache
+
+	// Algorithms are the signing algorithms the verifier accepts. The
+	// verifier has already checked the token's alg against them.
+	Algorithms []string
+
+	// Algorithm is the alg from the token's header.
+	Algorithm string
+
+	// Segments are the token's header, payload and signature, still
+	// encoded, as the verifier split them, so that adaptors need not split
+	// and scan the token again. NonCompliantBase64 is set when a segment is
+	// standard rather than URL base64. Segments are "" where the verifier
+	// has not split the token.
+	Segments           [3]string
+	NonCompliantBase64 bool
+}
+
+// ConfigDecoder is implemented by adaptors that decode a token with the
+// configuration the verifier resolved. ctx carries the caller's values,
+// such as a trace span, and its cancellation, which the adaptor may
+// honor. The claims are returned as decoded from the token's payload.
+type ConfigDecoder interface {
+	DecodeWithConfig(ctx context.Context, jwt string, config DecodeConfig) (map[string]interface{}, error)
+}
+
+// Decoder returns adaptor as a ConfigDecoder: adaptor itself if it
+// implements ConfigDecoder and, for adaptors written before it, a wrapper
+// calling DecodeWithKeyIDContext, DecodeWithKeyID or Decode, whichever the
+// adaptor has, with only the JWKSURI and KeyID. Such adaptors keep working
+// unchanged, but should move to ConfigDecoder.
+func Decoder(adaptor Adaptor) ConfigDecoder {
+	if decoder, ok := adaptor.(ConfigDecoder); ok {
+		return decoder
+	}
+	return legacyDecoder{adaptor}
+}
+
+type legacyDecoder struct {
+	adaptor Adaptor
+}
+
+func (l legacyDecoder) DecodeWithConfig(ctx context.Context, jwt string, config DecodeConfig) (map[string]interface{}, error) {
+	// Without a kid, the adaptor parses the header itself.
+	var decoded interface{}
+	var err error
+	contextDecoder, hasContext := l.adaptor.(ContextKeyIDDecoder)
+	keyIDDecoder, hasKeyID := l.adaptor.(KeyIDDecoder)
+	switch {
+	case config.KeyID != "" && hasContext:
+		decoded, err = contextDecoder.DecodeWithKeyIDContext(ctx, jwt, config.JWKSURI, config.KeyID)
+	case config.KeyID != "" && hasKeyID:
+		decoded, err = keyIDDecoder.DecodeWithKeyID(jwt, config.JWKSURI, config.KeyID)
+	default:
+		decoded, err = l.adaptor.Decode(jwt, config.JWKSURI)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the token's payload is not a JSON object")
+	}
+	return claims, nil
+}
+
+// Refresher is implemented by adaptors that can fetch a key set ahead of
+// need. Refresh replaces the cached key set for jwkUri; if the fetch fails
+// the cached key set is kept.
+type Refresher interface {
+	Refresh(jwkUri string) error
+}
+
+// HTTPClientSetter is implemented by adaptors that fetch key sets over HTTP.
+// SetHTTPClient returns a copy of the adaptor that uses client, so the
+// verifier can hand its own client, and with it any TLS configuration, to
+// the adaptor.
+type HTTPClientSetter interface {
+	SetHTTPClient(client *http.Client) Adaptor
+}
+
+// KeyIDDecoder is implemented by adaptors that can decode a token using the
+// kid the verifier has already read from its header, instead of parsing the
+// header again.
+//
+// Deprecated: implement ConfigDecoder, whose DecodeConfig has the kid.
+type KeyIDDecoder interface {
+	DecodeWithKeyID(jwt string, jwkUri string, kid string) (interface{}, error)
+}
+
+// ContextKeyIDDecoder is implemented by adaptors that can carry a context,
+// and with it a trace span, into the key set fetch DecodeWithKeyID may
+// make. The context's cancellation does not abort the fetch.
+//
+// Deprecated: implement ConfigDecoder.
+type ContextKeyIDDecoder interface {
+	DecodeWithKeyIDContext(ctx context.Context, jwt string, jwkUri string, kid string) (interface{}, error)
+}
+
+// Primer is implemented by adaptors that can load a key set ahead of need.
+// Prime fetches the key set for jwkUri unless it is already cached, and
+// reports an error if it cannot be fetched or has no usable keys.
+type Primer interface {
+	Prime(jwkUri string) error
+}
+
+// KeySetInfo summarizes a key set for hooks that approve key set changes.
+type KeySetInfo struct {
+	// URL is the jwks_uri the key set was fetched from.
+	URL string
+
+	// KeyIDs are the kids of the keys in the set, sorted.
+	KeyIDs []string
+
+	// Keys describes each key in the set, in the order of KeyIDs.
+	Keys []KeyInfo
+}
+
+// KeyInfo describes a key in a key set and the cost of verifying
+// signatures with it, for capacity planning.
+type KeyInfo struct {
+	KeyID string
+
+	// Type is the key's kty, e.g. "RSA", and Algorithm its alg, if set.
+	Type      string
+	Algorithm string
+
+	// Size is the key size in bits: the modulus size of RSA keys and the
+	// curve size of EC keys. It is 0 for keys that cannot verify
+	// signatures.
+	Size int
+
+	// Verifications counts the signatures checked with the key, and
+	// AverageVerifyDuration is the mean time each check took. They are
+	// counted from when the key set was loaded, and are zero for a key
+	// that has not been used.
+	Verifications         uint64
+	AverageVerifyDuration time.Duration
+}
+
+// KeySetInspector is implemented by adaptors that can describe the key set
+// they hold for jwkUri. KeySetInfo reports false if the key set is not
+// loaded; it never fetches it.
+type KeySetInspector interface {
+	KeySetInfo(jwkUri string) (KeySetInfo, bool)
+}
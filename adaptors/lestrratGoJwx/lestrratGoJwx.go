@@ -17,39 +17,547 @@
 package lestrratGoJwx
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jws/verify"
 	"github.com/okta/okta-jwt-verifier-golang/adaptors"
-	"github.com/patrickmn/go-cache"
-	"sync"
-	"time"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/fetch"
+	"github.com/okta/okta-jwt-verifier-golang/internal/memo"
+	"github.com/okta/okta-jwt-verifier-golang/internal/segment"
+	"github.com/okta/okta-jwt-verifier-golang/logger"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
 )
 
-var jwkSetCache *cache.Cache = cache.New(5*time.Minute, 10*time.Minute)
+// DefaultMinRefreshInterval bounds how often an unknown kid may force the
+// key set for a jwks_uri to be fetched again.
+const DefaultMinRefreshInterval = 30 * time.Second
+
+// keySetLifetime is how long fetched key sets are cached when the response
+// has neither a Cache-Control max-age nor an Expires header.
+const keySetLifetime = 5 * time.Minute
+
+// maxStale bounds how long after the last successful fetch a failing
+// Refresh keeps extending the cached key set.
+const maxStale = 15 * time.Minute
+
 var jwkSetMu = &sync.Mutex{}
+var jwkSetRefreshed = map[string]time.Time{}
+var jwkSetDecoded = &memo.Memo{}
+var jwkSetFetched sync.Map
+
+// vetoedKeySetLifetime is how long the previous key set is cached after
+// OnKeySetChange vetoes a change, and so how soon the change is proposed
+// again.
+const vetoedKeySetLifetime = time.Minute
+
+// trustedKeySets holds the last key set accepted for each jwkUri.
+var trustedKeySets sync.Map
+
+type trustedKeySet struct {
+	info adaptors.KeySetInfo
+	body []byte
+}
+
+// getJwkSetWithKeyId returns a key set containing kid, fetching the key set
+// again if the cached one does not contain it. Forced fetches happen at most
+// once per minInterval for each jwkUri; callers waiting on the lock while a
+// fetch is in flight pick up its result instead of fetching again.
+func (lgj LestrratGoJwx) getJwkSetWithKeyId(ctx context.Context, jwkUri string, kid string, minInterval time.Duration) (*keySet, error) {
+	log := logger.OrNoOp(lgj.Logger)
+
+	if lgj.LocalKeys != nil {
+		return lgj.LocalKeys.current(log), nil
+	}
 
-func getJwkSet(jwkUri string) (*jwk.Set, error) {
 	jwkSetMu.Lock()
 	defer jwkSetMu.Unlock()
 
-	if x, found := jwkSetCache.Get(jwkUri); found {
-		return x.(*jwk.Set), nil
+	if body, found := cache.OrDefault(lgj.Cache).Get(cache.KeySetKey(jwkUri)); found {
+		jwkSet, err := decodeJwkSet(jwkUri, body)
+		if err != nil {
+			log.Warn("cached key set is malformed", "url", jwkUri, "error", err.Error())
+			return lgj.fetchJwkSet(ctx, jwkUri)
+		}
+
+		if kid == "" || jwkSet.hasKeyID(kid) {
+			log.Debug("key set cache hit", "url", jwkUri)
+			return jwkSet, nil
+		}
+
+		if time.Since(jwkSetRefreshed[jwkUri]) < minInterval {
+			log.Debug("kid not in key set, refresh rate limited", "url", jwkUri, "kid", kid)
+			return jwkSet, nil
+		}
+
+		log.Debug("kid not in key set, refreshing", "url", jwkUri, "kid", kid)
+		jwkSetRefreshed[jwkUri] = time.Now()
+
+		// If the refresh fails, the cached key set still stands, and the
+		// token fails for its unknown kid rather than for an outage.
+		refreshed, err := lgj.fetchJwkSet(ctx, jwkUri)
+		if err != nil {
+			log.Warn("could not refresh the key set for an unknown kid, keeping the cached key set",
+				"url", jwkUri, "kid", kid, "error", err.Error())
+			return jwkSet, nil
+		}
+		return refreshed, nil
+	}
+
+	return lgj.fetchJwkSet(ctx, jwkUri)
+}
+
+func (lgj LestrratGoJwx) fetchJwkSet(ctx context.Context, jwkUri string) (_ *keySet, err error) {
+	log := logger.OrNoOp(lgj.Logger)
+
+	if lgj.Tracer != nil {
+		var span tracing.Span
+		ctx, span = lgj.Tracer.Start(ctx, tracing.SpanFetchKeySet)
+		span.SetAttribute(tracing.AttributeURL, tracing.URL(jwkUri))
+		defer func() { span.End(err) }()
 	}
 
-	jwkSet, err := jwk.FetchHTTP(jwkUri)
+	log.Debug("fetching key set", "url", jwkUri)
+	resp, err := fetch.GetResponse(ctx, fetch.Config{
+		Client:  lgj.HTTPClient,
+		Retry:   fetch.Retry{Attempts: lgj.RetryAttempts, BaseDelay: lgj.RetryBaseDelay, Rand: lgj.RetryRand},
+		Timeout: lgj.RequestTimeout,
+		Header:  lgj.RequestHeaders,
+		Breaker: lgj.CircuitBreaker,
+	}, jwkUri)
 
 	if err != nil {
-		return nil, err
+		log.Warn("key set request failed", "url", jwkUri, "error", err.Error())
+		return nil, errors.KeysUnavailableError(err)
+	}
+	body := resp.Body
+
+	jwkSet, err := decodeJwkSet(jwkUri, body)
+
+	if err != nil {
+		log.Warn("key set is malformed", "url", jwkUri, "error", err.Error())
+		return nil, errors.KeysUnavailableError(err)
+	}
+
+	jwkSetFetched.Store(jwkUri, time.Now())
+
+	info := jwkSet.info(jwkUri)
+	if previous, ok := trustedKeySets.Load(jwkUri); ok && lgj.OnKeySetChange != nil {
+		trusted := previous.(trustedKeySet)
+		if !sameKeyIDs(trusted.info.KeyIDs, info.KeyIDs) && !lgj.OnKeySetChange(trusted.info, info) {
+			log.Warn("key set change vetoed, keeping the previous key set", "url", jwkUri,
+				"kids", strings.Join(trusted.info.KeyIDs, ","), "proposed", strings.Join(info.KeyIDs, ","))
+			cache.OrDefault(lgj.Cache).Set(cache.KeySetKey(jwkUri), trusted.body, vetoedKeySetLifetime)
+			return decodeJwkSet(jwkUri, trusted.body)
+		}
 	}
+	trustedKeySets.Store(jwkUri, trustedKeySet{info: info, body: body})
 
-	jwkSetCache.SetDefault(jwkUri, jwkSet)
+	lifetime := resp.Lifetime(keySetLifetime, lgj.minCacheLifetime(), lgj.maxCacheLifetime())
+	log.Debug("caching key set", "url", jwkUri, "lifetime", lifetime.String())
+	cache.OrDefault(lgj.Cache).Set(cache.KeySetKey(jwkUri), body, lifetime)
 
 	return jwkSet, nil
 }
 
+func (lgj LestrratGoJwx) minCacheLifetime() time.Duration {
+	if lgj.MinCacheLifetime > 0 {
+		return lgj.MinCacheLifetime
+	}
+	return cache.DefaultMinLifetime
+}
+
+func (lgj LestrratGoJwx) maxCacheLifetime() time.Duration {
+	if lgj.MaxCacheLifetime > 0 {
+		return lgj.MaxCacheLifetime
+	}
+	return cache.DefaultMaxLifetime
+}
+
+func sameKeyIDs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// keySet is a parsed key set with the public key and verifier of each key
+// prepared, so that verifications do not repeat that work.
+type keySet struct {
+	keys []preparedKey
+}
+
+type preparedKey struct {
+	kid string
+	kty string
+	alg string
+
+	// size is the key size in bits, or 0 if unknown.
+	size int
+
+	// thumbprint is the key's RFC 7638 SHA-256 thumbprint, base64url
+	// encoded.
+	thumbprint string
+
+	// raw and verifier are nil for keys that cannot verify signatures.
+	raw      interface{}
+	verifier verify.Verifier
+
+	// x5c is nil for keys without an x5c certificate chain.
+	x5c *x5cChain
+
+	cost *verifyCost
+}
+
+// verifyCost accumulates how long signature checks with a key take.
+type verifyCost struct {
+	count uint64
+	nanos uint64
+}
+
+func (c *verifyCost) record(d time.Duration) {
+	atomic.AddUint64(&c.count, 1)
+	atomic.AddUint64(&c.nanos, uint64(d))
+}
+
+func (c *verifyCost) average() (uint64, time.Duration) {
+	count := atomic.LoadUint64(&c.count)
+	if count == 0 {
+		return 0, 0
+	}
+	return count, time.Duration(atomic.LoadUint64(&c.nanos) / count)
+}
+
+// decodeJwkSet parses a key set. Key sets are parsed once and the result
+// shared, so it must not be modified.
+func decodeJwkSet(jwkUri string, body []byte) (*keySet, error) {
+	ks, err := jwkSetDecoded.Decode(jwkUri, body, func(body []byte) (interface{}, error) {
+		jwkSet, err := jwk.ParseBytes(body)
+		if err != nil {
+			return nil, errors.DiscoveryMalformedError(jwkUri, fetch.Snippet(body), err.Error())
+		}
+		return prepareKeySet(jwkSet), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ks.(*keySet), nil
+}
+
+// prepareKeySet materializes each key usable for verification and creates
+// a verifier for its alg, as jws.VerifyWithJWK would on every call.
+func prepareKeySet(jwkSet *jwk.Set) *keySet {
+	ks := &keySet{keys: make([]preparedKey, 0, len(jwkSet.Keys))}
+	for _, key := range jwkSet.Keys {
+		pk := preparedKey{
+			kid:  key.KeyID(),
+			kty:  string(key.KeyType()),
+			alg:  key.Algorithm(),
+			cost: &verifyCost{},
+			x5c:  newX5CChain(key.X509CertChain()),
+		}
+		if thumbprint, err := key.Thumbprint(crypto.SHA256); err == nil {
+			pk.thumbprint = base64.RawURLEncoding.EncodeToString(thumbprint)
+		}
+		if usableForVerification(key) {
+			var raw interface{}
+			if err := key.Raw(&raw); err == nil {
+				if verifier, err := verify.New(jwa.SignatureAlgorithm(key.Algorithm())); err == nil {
+					pk.raw = raw
+					pk.verifier = verifier
+					pk.size = keySize(raw)
+				}
+			}
+		}
+		ks.keys = append(ks.keys, pk)
+	}
+	return ks
+}
+
+// keySize returns the size in bits of a public key, or 0 if unknown.
+func keySize(raw interface{}) int {
+	switch key := raw.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	}
+	return 0
+}
+
+func (ks *keySet) info(jwkUri string) adaptors.KeySetInfo {
+	keys := make([]adaptors.KeyInfo, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		count, average := key.cost.average()
+		keys = append(keys, adaptors.KeyInfo{
+			KeyID:     key.kid,
+			Type:      key.kty,
+			Algorithm: key.alg,
+			Size:      key.size,
+
+			Verifications:         count,
+			AverageVerifyDuration: average,
+		})
+	}
+	sort.SliceStable(keys, func(a, b int) bool { return keys[a].KeyID < keys[b].KeyID })
+
+	kids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		kids = append(kids, key.KeyID)
+	}
+	return adaptors.KeySetInfo{URL: jwkUri, KeyIDs: kids, Keys: keys}
+}
+
+// keyIDs returns the kids of the keys, in key set order.
+func (ks *keySet) keyIDs() []string {
+	kids := make([]string, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		kids = append(kids, key.kid)
+	}
+	return kids
+}
+
+func (ks *keySet) hasKeyID(kid string) bool {
+	for _, key := range ks.keys {
+		if key.kid == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// keyPins restricts the keys in a key set that tokens may be verified
+// with. Empty lists allow every key.
+type keyPins struct {
+	kids        []string
+	thumbprints []string
+
+	// x5cRoots, if set, are the roots keys' x5c chains must verify
+	// against.
+	x5cRoots *x509.CertPool
+
+	// algorithms, if not empty, are the only algs of keys that may be
+	// used.
+	algorithms []string
+}
+
+func (lgj LestrratGoJwx) pins() keyPins {
+	return keyPins{
+		kids:        lgj.AllowedKIDs,
+		thumbprints: lgj.AllowedKeyThumbprints,
+		x5cRoots:    lgj.X5CRoots,
+		algorithms:  lgj.algorithms,
+	}
+}
+
+// allowsX5C checks key's x5c chain, if x5cRoots is set.
+func (p keyPins) allowsX5C(key preparedKey) error {
+	if p.x5cRoots == nil {
+		return nil
+	}
+	return key.checkX5C(p.x5cRoots, time.Now())
+}
+
+// allowsKid reports whether tokens with kid may be verified. It is checked
+// before the key set is fetched.
+func (p keyPins) allowsKid(kid string) error {
+	if len(p.kids) > 0 && !contains(p.kids, kid) {
+		return errors.KeyNotPinnedError(fmt.Sprintf("kid %q is not allowed", kid))
+	}
+	return nil
+}
+
+// verify checks signature over signingInput with the keys for kid, or every
+// key if kid is empty. Keys pins does not allow are not tried.
+func (ks *keySet) verify(signingInput []byte, signature []byte, kid string, pins keyPins) error {
+	if kid != "" && !ks.hasKeyID(kid) {
+		return errors.KeyNotFoundError(kid, ks.keyIDs())
+	}
+
+	tried := false
+	var unpinned []string
+	var untrusted error
+	for _, key := range ks.keys {
+		if (kid != "" && key.kid != kid) || key.verifier == nil {
+			continue
+		}
+		if len(pins.kids) > 0 && !contains(pins.kids, key.kid) {
+			continue
+		}
+		if len(pins.algorithms) > 0 && !contains(pins.algorithms, key.alg) {
+			continue
+		}
+		if len(pins.thumbprints) > 0 && !contains(pins.thumbprints, key.thumbprint) {
+			unpinned = append(unpinned, key.thumbprint)
+			continue
+		}
+		if err := pins.allowsX5C(key); err != nil {
+			untrusted = err
+			continue
+		}
+		tried = true
+		start := time.Now()
+		err := key.verifier.Verify(signingInput, signature, key.raw)
+		key.cost.record(time.Since(start))
+		if err == nil {
+			return nil
+		}
+	}
+	if !tried && len(unpinned) > 0 {
+		return errors.KeyNotPinnedError(fmt.Sprintf("key thumbprint %s is not allowed", strings.Join(unpinned, ", ")))
+	}
+	if !tried && untrusted != nil {
+		return untrusted
+	}
+	return fmt.Errorf("failed to verify with any of the keys")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// usableForVerification accepts keys intended for verifying signatures. A
+// key qualifies through `use` ("sig", or absent) or through `key_ops`
+// (containing "verify"). RFC 7517 says the two should not both be present,
+// and when they are and disagree, e.g. use "enc" with key_ops ["verify"],
+// the key is not used.
+func usableForVerification(key jwk.Key) bool {
+	use := key.KeyUsage()
+	if use != "" && use != string(jwk.ForSignature) {
+		return false
+	}
+
+	ops := key.KeyOps()
+	if len(ops) == 0 {
+		return true
+	}
+
+	for _, op := range ops {
+		if op == jwk.KeyOpVerify {
+			return true
+		}
+	}
+	return false
+}
+
 type LestrratGoJwx struct {
 	JWKSet jwk.Set
+
+	// MinRefreshInterval overrides DefaultMinRefreshInterval when set.
+	MinRefreshInterval time.Duration
+
+	// HTTPClient fetches the key set. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Cache holds fetched key sets. It defaults to cache.Default().
+	Cache cache.Cache
+
+	// RetryAttempts is how many times the key set is requested when the
+	// request fails with a network error, 429 or 5xx. It defaults to 3.
+	RetryAttempts int
+
+	// RetryBaseDelay is the delay before the first retry, doubled for each
+	// one after that and jittered. It defaults to 100ms.
+	RetryBaseDelay time.Duration
+
+	// RetryRand jitters the delays between retries. It must be safe for
+	// concurrent use, and defaults to a source seeded from crypto/rand.
+	RetryRand interface{ Int63n(n int64) int64 }
+
+	// RequestTimeout bounds each key set fetch, retries included. It
+	// defaults to 30 seconds.
+	RequestTimeout time.Duration
+
+	// RequestHeaders are added to every key set request, e.g. an API key
+	// for a gateway in front of the issuer. Their values are never logged.
+	RequestHeaders map[string]string
+
+	// MinCacheLifetime and MaxCacheLifetime bound how long a key set is
+	// cached for. Within them, the lifetime is taken from the response's
+	// Cache-Control max-age or Expires header, or is five minutes if it has
+	// neither. They default to cache.DefaultMinLifetime and
+	// cache.DefaultMaxLifetime.
+	MinCacheLifetime time.Duration
+	MaxCacheLifetime time.Duration
+
+	// AllowNonCompliantBase64 accepts tokens with segments in standard
+	// base64 instead of base64url. The signature is checked over the
+	// segments as they appear in the token.
+	AllowNonCompliantBase64 bool
+
+	// AllowedKIDs, if not empty, are the kids of the only keys in the key
+	// set tokens may be verified with, whatever else the issuer serves. A
+	// token with any other kid, or none, fails with errors.KeyNotPinned
+	// before the key set is fetched.
+	AllowedKIDs []string
+
+	// AllowedKeyThumbprints, if not empty, are the RFC 7638 SHA-256
+	// thumbprints, base64url encoded, of the only keys tokens may be signed
+	// with. Other keys in the key set are never tried, and a token whose kid
+	// names only such keys fails with errors.KeyNotPinned.
+	AllowedKeyThumbprints []string
+
+	// X5CRoots, if set, are the roots the x5c certificate chain of a key
+	// must verify against before the key is used, and the chain's leaf
+	// certificate must be for the key. Keys without x5c are never tried. A
+	// token whose kid names only such keys fails with errors.X5CInvalid.
+	X5CRoots *x509.CertPool
+
+	// OnKeySetChange, if set, is called when a fetched key set has
+	// different kids from the last one accepted for the same jwkUri. If it
+	// returns false the previous key set stays in use and the change is
+	// proposed again by a fetch within a minute. The first key set fetched
+	// for a jwkUri is always accepted. It is called synchronously, while
+	// verifications that need the key set wait.
+	OnKeySetChange func(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool
+
+	// Tracer, if set, traces each key set fetch as a
+	// tracing.SpanFetchKeySet span, a child of any span in the context
+	// passed to DecodeWithKeyIDContext.
+	Tracer tracing.Tracer
+
+	// LocalKeys, if set, is the key set tokens are verified with, instead
+	// of the one at the jwkUri, which is then never fetched.
+	LocalKeys *LocalKeySet
+
+	// CircuitBreaker, if set, guards key set fetches: while it is open they
+	// fail at once with errors.ErrCircuitOpen, wrapped in
+	// errors.KeysUnavailable.
+	CircuitBreaker *circuit.Breaker
+
+	Logger logger.Logger
+
+	// algorithms are the verifier's accepted algorithms, set by
+	// DecodeWithConfig.
+	algorithms []string
 }
 
 func (lgj LestrratGoJwx) New() adaptors.Adaptor {
@@ -60,23 +568,270 @@ func (lgj LestrratGoJwx) GetKey(jwkUri string) {
 	return
 }
 
+// SetHTTPClient returns a copy of the adaptor that fetches key sets with
+// client.
+func (lgj LestrratGoJwx) SetHTTPClient(client *http.Client) adaptors.Adaptor {
+	lgj.HTTPClient = client
+	return lgj.New()
+}
+
+// Prime loads the key set for jwkUri into the cache, fetching it only if it
+// is not cached, and checks that it has a key that can verify signatures
+// and, with AllowedKIDs, has an allowed kid and, with X5CRoots, a trusted
+// certificate chain.
+func (lgj LestrratGoJwx) Prime(jwkUri string) error {
+	jwkSet, err := lgj.getJwkSetWithKeyId(context.Background(), jwkUri, "", 0)
+	if err != nil {
+		return err
+	}
+
+	pins := lgj.pins()
+	for _, key := range jwkSet.keys {
+		if key.verifier != nil && pins.allowsKid(key.kid) == nil && pins.allowsX5C(key) == nil {
+			return nil
+		}
+	}
+	if len(pins.kids) > 0 {
+		return fmt.Errorf("the key set at %s has no keys with an allowed kid that can verify signatures", jwkUri)
+	}
+	if pins.x5cRoots != nil {
+		return fmt.Errorf("the key set at %s has no keys with a trusted x5c certificate chain that can verify signatures", jwkUri)
+	}
+	return fmt.Errorf("the key set at %s has no keys that can verify signatures", jwkUri)
+}
+
+// Refresh fetches the key set for jwkUri and replaces the cached one. When
+// the fetch fails the cached key set is kept for another cache lifetime, so
+// verification keeps working through a short outage, but not once the last
+// successful fetch is more than 15 minutes old.
+//
+// With LocalKeys, Refresh reads the local key set again instead.
+func (lgj LestrratGoJwx) Refresh(jwkUri string) error {
+	if lgj.LocalKeys != nil {
+		return lgj.LocalKeys.Reload()
+	}
+
+	_, err := lgj.fetchJwkSet(context.Background(), jwkUri)
+	if err != nil {
+		fetched, ok := jwkSetFetched.Load(jwkUri)
+		if !ok || time.Since(fetched.(time.Time)) >= maxStale {
+			return err
+		}
+
+		c := cache.OrDefault(lgj.Cache)
+		if body, found := c.Get(cache.KeySetKey(jwkUri)); found {
+			c.Set(cache.KeySetKey(jwkUri), body, keySetLifetime)
+		}
+		return err
+	}
+	return nil
+}
+
+// KeySetInfo describes the key set cached for jwkUri, or LocalKeys, with
+// the cost of verifying with each key.
+func (lgj LestrratGoJwx) KeySetInfo(jwkUri string) (adaptors.KeySetInfo, bool) {
+	if lgj.LocalKeys != nil {
+		return lgj.LocalKeys.loaded().info(lgj.LocalKeys.Source()), true
+	}
+
+	body, found := cache.OrDefault(lgj.Cache).Get(cache.KeySetKey(jwkUri))
+	if !found {
+		return adaptors.KeySetInfo{}, false
+	}
+	jwkSet, err := decodeJwkSet(jwkUri, body)
+	if err != nil {
+		return adaptors.KeySetInfo{}, false
+	}
+	return jwkSet.info(jwkUri), true
+}
+
 func (lgj LestrratGoJwx) Decode(jwt string, jwkUri string) (interface{}, error) {
-	jwkSet, err := getJwkSet(jwkUri)
+	return lgj.decodeContext(context.Background(), jwt, jwkUri)
+}
+
+// decodeContext is Decode with a context for the key set fetch.
+func (lgj LestrratGoJwx) decodeContext(ctx context.Context, jwt string, jwkUri string) (interface{}, error) {
+	if lgj.AllowNonCompliantBase64 && strings.ContainsAny(jwt, "+/=") {
+		return lgj.decodeNonCompliant(ctx, jwt, jwkUri)
+	}
+
+	msg, err := jws.ParseString(jwt)
 
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := jws.VerifyWithJWKSet([]byte(jwt), jwkSet, nil)
+	var kid string
+	if signatures := msg.Signatures(); len(signatures) > 0 {
+		kid = signatures[0].ProtectedHeaders().KeyID()
+	}
+
+	return lgj.DecodeWithKeyIDContext(ctx, jwt, jwkUri, kid)
+}
+
+// DecodeWithKeyID is Decode for a token whose header has already been
+// parsed, with kid taken from it.
+func (lgj LestrratGoJwx) DecodeWithKeyID(jwt string, jwkUri string, kid string) (interface{}, error) {
+	return lgj.DecodeWithKeyIDContext(context.Background(), jwt, jwkUri, kid)
+}
+
+// DecodeWithKeyIDContext is DecodeWithKeyID with a context for the key set
+// fetch, if one is needed.
+func (lgj LestrratGoJwx) DecodeWithKeyIDContext(ctx context.Context, jwt string, jwkUri string, kid string) (interface{}, error) {
+	if lgj.AllowNonCompliantBase64 && strings.ContainsAny(jwt, "+/=") {
+		return lgj.decodeNonCompliant(ctx, jwt, jwkUri)
+	}
+
+	dot := strings.LastIndexByte(jwt, '.')
+	firstDot := strings.IndexByte(jwt, '.')
+	if firstDot < 0 || dot == firstDot {
+		return nil, fmt.Errorf("token must contain exactly 3 parts separated by periods ('.')")
+	}
+
+	return lgj.decodeSegments(ctx, jwkUri, kid, [3]string{jwt[:firstDot], jwt[firstDot+1 : dot], jwt[dot+1:]})
+}
+
+// decodeSegments verifies a token split into its segments, with the keys
+// for kid.
+func (lgj LestrratGoJwx) decodeSegments(ctx context.Context, jwkUri string, kid string, parts [3]string) (interface{}, error) {
+	if err := lgj.pins().allowsKid(kid); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
 
+	jwkSet, err := lgj.getJwkSetWithKeyId(ctx, jwkUri, kid, lgj.minRefreshInterval())
 	if err != nil {
 		return nil, err
 	}
 
+	if err := jwkSet.verify(signingInput(parts), signature, kid, lgj.pins()); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("message verified, failed to decode payload: %w", err)
+	}
+
 	var claims interface{}
 
-	json.Unmarshal(token, &claims)
+	json.Unmarshal(payload, &claims)
+
+	return claims, nil
+}
+
+// DecodeWithConfig is DecodeWithKeyIDContext with the verifier's
+// configuration. The HTTP client, timeout and cache are used where the
+// adaptor does not set its own, and keys whose alg is not among the
+// algorithms are not tried. The token is not split again if the verifier
+// passed its segments. As for DecodeWithKeyIDContext, ctx's cancellation
+// does not abort the key set fetch, whose result other verifications
+// share.
+func (lgj LestrratGoJwx) DecodeWithConfig(ctx context.Context, jwt string, config adaptors.DecodeConfig) (map[string]interface{}, error) {
+	if lgj.HTTPClient == nil {
+		lgj.HTTPClient = config.HTTPClient
+	}
+	if lgj.RequestTimeout == 0 {
+		lgj.RequestTimeout = config.RequestTimeout
+	}
+	if lgj.Cache == nil {
+		lgj.Cache = config.Cache
+	}
+	lgj.algorithms = config.Algorithms
+
+	var decoded interface{}
+	var err error
+	switch {
+	case config.KeyID == "":
+		decoded, err = lgj.decodeContext(ctx, jwt, config.JWKSURI)
+	case config.Segments == [3]string{}:
+		decoded, err = lgj.DecodeWithKeyIDContext(ctx, jwt, config.JWKSURI, config.KeyID)
+	case lgj.AllowNonCompliantBase64 && config.NonCompliantBase64:
+		decoded, err = lgj.decodeNonCompliantSegments(ctx, config.JWKSURI, config.KeyID, config.Segments)
+	default:
+		decoded, err = lgj.decodeSegments(ctx, config.JWKSURI, config.KeyID, config.Segments)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the token's payload is not a JSON object")
+	}
+	return claims, nil
+}
+
+func (lgj LestrratGoJwx) minRefreshInterval() time.Duration {
+	if lgj.MinRefreshInterval == 0 {
+		return DefaultMinRefreshInterval
+	}
+	return lgj.MinRefreshInterval
+}
+
+// decodeNonCompliant verifies a token with standard base64 segments, which
+// jws cannot parse. As for other tokens, the signature is checked over the
+// header and payload segments exactly as they appear in the token.
+func (lgj LestrratGoJwx) decodeNonCompliant(ctx context.Context, jwt string, jwkUri string) (interface{}, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token must contain exactly 3 parts separated by periods ('.')")
+	}
+
+	decoded, _, err := segment.DecodeLenient(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode token segment %d: %w", 0, err)
+	}
+
+	var header struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(decoded, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse JOSE headers: %w", err)
+	}
+
+	return lgj.decodeNonCompliantSegments(ctx, jwkUri, header.Kid, [3]string{parts[0], parts[1], parts[2]})
+}
+
+// decodeNonCompliantSegments is decodeSegments for segments that may be
+// standard base64.
+func (lgj LestrratGoJwx) decodeNonCompliantSegments(ctx context.Context, jwkUri string, kid string, parts [3]string) (interface{}, error) {
+	var decoded [3][]byte
+	for i := 1; i < len(parts); i++ {
+		b, _, err := segment.DecodeLenient(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode token segment %d: %w", i, err)
+		}
+		decoded[i] = b
+	}
+
+	if err := lgj.pins().allowsKid(kid); err != nil {
+		return nil, err
+	}
+
+	jwkSet, err := lgj.getJwkSetWithKeyId(ctx, jwkUri, kid, lgj.minRefreshInterval())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := jwkSet.verify(signingInput(parts), decoded[2], kid, lgj.pins()); err != nil {
+		return nil, err
+	}
 
+	var claims interface{}
+	json.Unmarshal(decoded[1], &claims)
 	return claims, nil
+}
 
+// signingInput returns the header and payload segments joined as they
+// were signed, which is as they appear in the token.
+func signingInput(parts [3]string) []byte {
+	b := make([]byte, 0, len(parts[0])+1+len(parts[1]))
+	b = append(b, parts[0]...)
+	b = append(b, '.')
+	return append(b, parts[1]...)
 }
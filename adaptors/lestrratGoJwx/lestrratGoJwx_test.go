@@ -0,0 +1,334 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package lestrratGoJwx
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_unknown_kid_refreshes_the_key_set_once(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	jwksUri := issuer.URL + "/v1/keys"
+
+	adaptor := LestrratGoJwx{}
+
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), jwksUri); err != nil {
+		t.Fatalf("could not decode token: %s", err)
+	}
+
+	if issuer.JWKSRequests() != 1 {
+		t.Fatalf("expected 1 JWKS request, got %d", issuer.JWKSRequests())
+	}
+
+	issuer.Rotate()
+	rotated := issuer.Sign(issuer.Claims("api://default"))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := adaptor.Decode(rotated, jwksUri)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("could not decode token signed with a rotated key: %s", err)
+		}
+	}
+
+	if issuer.JWKSRequests() != 2 {
+		t.Errorf("expected exactly 1 extra JWKS request after rotation, got %d", issuer.JWKSRequests()-1)
+	}
+}
+
+func Test_unknown_kid_refreshes_are_rate_limited(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	jwksUri := issuer.URL + "/v1/keys"
+
+	adaptor := LestrratGoJwx{MinRefreshInterval: time.Hour}
+
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), jwksUri); err != nil {
+		t.Fatalf("could not decode token: %s", err)
+	}
+
+	forged := issuer.SignWithHeader(map[string]interface{}{
+		"alg": "RS256",
+		"kid": "unknown",
+	}, issuer.Claims("api://default"))
+
+	for i := 0; i < 5; i++ {
+		if _, err := adaptor.Decode(forged, jwksUri); err == nil {
+			t.Fatalf("expected an error for a token with an unknown kid")
+		}
+	}
+
+	// The first unknown kid forces a refresh, the rest fall inside the interval.
+	if issuer.JWKSRequests() != 2 {
+		t.Errorf("expected a single forced refresh for repeated unknown kids, got %d requests",
+			issuer.JWKSRequests())
+	}
+}
+
+func Test_keys_are_selected_by_use_and_key_ops(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		usable bool
+	}{
+		{"use sig", nil, true},
+		{"no use or key_ops", map[string]interface{}{"use": nil}, true},
+		{"key_ops verify", map[string]interface{}{"use": nil, "key_ops": []string{"verify"}}, true},
+		{"key_ops sign and verify", map[string]interface{}{"use": nil, "key_ops": []string{"sign", "verify"}}, true},
+		{"key_ops encrypt only", map[string]interface{}{"use": nil, "key_ops": []string{"encrypt"}}, false},
+		{"use enc", map[string]interface{}{"use": "enc"}, false},
+		{"use sig and key_ops verify", map[string]interface{}{"key_ops": []string{"verify"}}, true},
+		{"use enc conflicting with key_ops verify", map[string]interface{}{"use": "enc", "key_ops": []string{"verify"}}, false},
+		{"use sig conflicting with key_ops encrypt", map[string]interface{}{"key_ops": []string{"encrypt"}}, false},
+	}
+
+	for _, test := range tests {
+		issuer := testissuer.New()
+		issuer.SetKeyParams(test.params)
+
+		_, err := LestrratGoJwx{}.Decode(issuer.Sign(issuer.Claims("api://default")), issuer.URL+"/v1/keys")
+		if test.usable && err != nil {
+			t.Errorf("%s: expected the key to verify the token: %s", test.name, err)
+		}
+		if !test.usable && err == nil {
+			t.Errorf("%s: expected the key to be rejected", test.name)
+		}
+
+		issuer.Close()
+	}
+}
+
+func Test_the_first_key_set_is_not_subject_to_the_change_hook(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	jwksUri := issuer.URL + "/v1/keys"
+	trustedKeySets.Delete(jwksUri)
+
+	calls := 0
+	adaptor := LestrratGoJwx{
+		Cache:          cache.NewMemory(),
+		OnKeySetChange: func(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool { calls++; return false },
+	}
+
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), jwksUri); err != nil {
+		t.Fatalf("could not decode token: %s", err)
+	}
+
+	if calls != 0 {
+		t.Errorf("expected the hook not to be called for the first key set, got %d calls", calls)
+	}
+}
+
+func Test_key_set_changes_can_be_accepted_or_vetoed(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	jwksUri := issuer.URL + "/v1/keys"
+	trustedKeySets.Delete(jwksUri)
+
+	var proposals []adaptors.KeySetInfo
+	accept := false
+	adaptor := LestrratGoJwx{
+		MinRefreshInterval: time.Nanosecond,
+		Cache:              cache.NewMemory(),
+		OnKeySetChange: func(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool {
+			if !reflect.DeepEqual(old.KeyIDs, []string{"key1"}) {
+				t.Errorf("expected the old kids to be [key1], got %v", old.KeyIDs)
+			}
+			proposals = append(proposals, new)
+			return accept
+		},
+	}
+
+	original := issuer.Sign(issuer.Claims("api://default"))
+	if _, err := adaptor.Decode(original, jwksUri); err != nil {
+		t.Fatalf("could not decode token: %s", err)
+	}
+
+	issuer.Rotate()
+	rotated := issuer.Sign(issuer.Claims("api://default"))
+
+	if _, err := adaptor.Decode(rotated, jwksUri); err == nil {
+		t.Errorf("expected a token signed with a vetoed key to be rejected")
+	}
+	if _, err := adaptor.Decode(original, jwksUri); err != nil {
+		t.Errorf("expected the previous key set to stay in use after a veto: %s", err)
+	}
+
+	accept = true
+	if _, err := adaptor.Decode(rotated, jwksUri); err != nil {
+		t.Errorf("expected the change to be accepted when proposed again: %s", err)
+	}
+
+	if len(proposals) != 2 {
+		t.Fatalf("expected the change to be proposed twice, got %d", len(proposals))
+	}
+	if proposals[1].URL != jwksUri || !reflect.DeepEqual(proposals[1].KeyIDs, []string{"key1", "key2"}) {
+		t.Errorf("unexpected proposal %+v", proposals[1])
+	}
+}
+
+func Test_only_allowed_kids_are_trusted(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	jwksUri := issuer.URL + "/v1/keys"
+
+	allowed := issuer.KeyID()
+	adaptor := LestrratGoJwx{Cache: cache.NewMemory(), AllowedKIDs: []string{allowed, "key-next"}}
+
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), jwksUri); err != nil {
+		t.Fatalf("expected a token with an allowed kid to verify: %s", err)
+	}
+	if err := adaptor.Prime(jwksUri); err != nil {
+		t.Errorf("expected the key set to have an allowed key: %s", err)
+	}
+
+	// The issuer now also serves a key that is not allowed.
+	issuer.Rotate()
+	requests := issuer.JWKSRequests()
+	var notPinned *errors.KeyNotPinned
+	for _, token := range []string{
+		issuer.Sign(issuer.Claims("api://default")),
+		issuer.SignWithHeader(map[string]interface{}{"alg": "RS256"}, issuer.Claims("api://default")),
+	} {
+		if _, err := adaptor.Decode(token, jwksUri); !goerrors.As(err, &notPinned) {
+			t.Errorf("expected a KeyNotPinned error, got %v", err)
+		}
+	}
+	if issuer.JWKSRequests() != requests {
+		t.Errorf("expected tokens with other kids to be rejected without fetching the key set")
+	}
+
+	// An allowed kid the issuer does not serve yet.
+	next := issuer.SignWithHeader(map[string]interface{}{"alg": "RS256", "kid": "key-next"}, issuer.Claims("api://default"))
+	if _, err := adaptor.Decode(next, jwksUri); err == nil || goerrors.As(err, &notPinned) {
+		t.Errorf("expected an allowed kid missing from the key set to fail to verify, got %v", err)
+	}
+
+	only := LestrratGoJwx{Cache: cache.NewMemory(), AllowedKIDs: []string{"key-next"}}
+	if err := only.Prime(jwksUri); err == nil {
+		t.Errorf("expected Prime to fail without a key with an allowed kid")
+	}
+}
+
+func Test_decode_with_config_fills_in_unset_settings(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	c := cache.NewMemory()
+	config := adaptors.DecodeConfig{
+		JWKSURI:    issuer.URL + "/v1/keys",
+		KeyID:      issuer.KeyID(),
+		Cache:      c,
+		Algorithms: []string{"ES256"},
+	}
+	if _, err := (LestrratGoJwx{}).DecodeWithConfig(context.Background(), token, config); err == nil {
+		t.Errorf("expected an RS256 key to be skipped when only ES256 is accepted")
+	}
+	if _, found := c.Get(cache.KeySetKey(config.JWKSURI)); !found {
+		t.Errorf("the key set was not cached in the verifier's cache")
+	}
+
+	config.Algorithms = []string{"RS256"}
+	claims, err := LestrratGoJwx{}.DecodeWithConfig(context.Background(), token, config)
+	if err != nil {
+		t.Fatalf("could not decode token: %s", err)
+	}
+	if claims["sub"] != "user@example.com" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+
+	config.KeyID = ""
+	if _, err := (LestrratGoJwx{}).DecodeWithConfig(context.Background(), token, config); err != nil {
+		t.Errorf("could not decode token without a kid in the config: %s", err)
+	}
+}
+
+func Test_decode_with_config_verifies_the_verifiers_segments(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []byte(fmt.Sprintf(`{"alg":"RS256","kid":%q}`, issuer.KeyID()))
+
+	tests := []struct {
+		name         string
+		encoding     *base64.Encoding
+		nonCompliant bool
+	}{
+		{"base64url", base64.RawURLEncoding, false},
+		{"standard base64", base64.StdEncoding, true},
+	}
+
+	for _, test := range tests {
+		token := issuer.SignRaw(header, body, test.encoding)
+		parts := strings.Split(token, ".")
+		config := adaptors.DecodeConfig{
+			JWKSURI:            issuer.URL + "/v1/keys",
+			KeyID:              issuer.KeyID(),
+			Cache:              cache.NewMemory(),
+			Algorithm:          "RS256",
+			Segments:           [3]string{parts[0], parts[1], parts[2]},
+			NonCompliantBase64: test.nonCompliant,
+		}
+		lgj := LestrratGoJwx{AllowNonCompliantBase64: true}
+
+		decoded, err := lgj.DecodeWithConfig(context.Background(), token, config)
+		if err != nil {
+			t.Fatalf("%s: could not decode token: %s", test.name, err)
+		}
+		if decoded["sub"] != claims["sub"] {
+			t.Errorf("%s: unexpected claims %v", test.name, decoded)
+		}
+
+		// The segments are what is verified, not the token split again.
+		config.Segments[1] = test.encoding.EncodeToString([]byte(`{"sub":"someone else"}`))
+		if _, err := lgj.DecodeWithConfig(context.Background(), token, config); err == nil {
+			t.Errorf("%s: expected a payload segment that was not signed to fail", test.name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package lestrratGoJwx
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/fetch"
+	"github.com/okta/okta-jwt-verifier-golang/logger"
+)
+
+// fileCheckInterval is how often a LocalKeySet read from a file checks
+// whether the file has changed.
+var fileCheckInterval = time.Second
+
+// LocalKeySet is a key set in the standard JWKS format, read from a local
+// file or a reader instead of fetched from the issuer. It is safe for
+// concurrent use.
+type LocalKeySet struct {
+	path string
+
+	mu      sync.Mutex
+	keys    *keySet
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// NewLocalKeySetFromFile reads the key set in the file at path. The file is
+// read again when its modification time or size changes, which is checked
+// at most once a second, or when Reload is called.
+func NewLocalKeySetFromFile(path string) (*LocalKeySet, error) {
+	s := &LocalKeySet{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewLocalKeySetFromReader reads the key set from r. Call ReloadFrom to
+// replace it.
+func NewLocalKeySetFromReader(r io.Reader) (*LocalKeySet, error) {
+	s := &LocalKeySet{}
+	if err := s.ReloadFrom(r); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Source describes where the key set was read from, e.g.
+// "file:///etc/okta/jwks.json". It takes the place of the jwks_uri in
+// errors and logs.
+func (s *LocalKeySet) Source() string {
+	if s.path == "" {
+		return "local key set"
+	}
+	return "file://" + s.path
+}
+
+// Reload reads the file again, whether or not it has changed. If the file
+// cannot be read or parsed, the keys read before stay in use and the error
+// is returned. For a key set read from a reader it does nothing.
+func (s *LocalKeySet) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return errors.KeysUnavailableError(err)
+	}
+	body, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return errors.KeysUnavailableError(err)
+	}
+	keys, err := s.parse(body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.checked = time.Now()
+	return nil
+}
+
+// ReloadFrom replaces the key set with the one read from r. If r cannot be
+// read or parsed, the keys read before stay in use and the error is
+// returned.
+func (s *LocalKeySet) ReloadFrom(r io.Reader) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.KeysUnavailableError(err)
+	}
+	keys, err := s.parse(body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	return nil
+}
+
+func (s *LocalKeySet) parse(body []byte) (*keySet, error) {
+	jwkSet, err := jwk.ParseBytes(body)
+	if err != nil {
+		return nil, errors.KeysUnavailableError(
+			errors.DiscoveryMalformedError(s.Source(), fetch.Snippet(body), err.Error()))
+	}
+	return prepareKeySet(jwkSet), nil
+}
+
+// current returns the key set, first reading the file again if it has
+// changed. A change that cannot be read is logged and the keys read before
+// are returned.
+func (s *LocalKeySet) current(log logger.Logger) *keySet {
+	s.mu.Lock()
+	if s.path == "" || time.Since(s.checked) < fileCheckInterval {
+		keys := s.keys
+		s.mu.Unlock()
+		return keys
+	}
+	s.checked = time.Now()
+	modTime, size := s.modTime, s.size
+	s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err == nil && info.ModTime().Equal(modTime) && info.Size() == size {
+		return s.loaded()
+	}
+	if err == nil {
+		log.Debug("local key set changed, reloading", "url", s.Source())
+		err = s.Reload()
+	}
+	if err != nil {
+		log.Warn("could not reload the local key set, keeping the previous keys", "url", s.Source(), "error", err.Error())
+	}
+	return s.loaded()
+}
+
+func (s *LocalKeySet) loaded() *keySet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys
+}
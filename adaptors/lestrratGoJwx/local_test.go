@@ -0,0 +1,146 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package lestrratGoJwx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func writeJWKS(t *testing.T, path string, jwks []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_local_key_set_is_read_again_when_the_file_changes(t *testing.T) {
+	defer func(interval time.Duration) { fileCheckInterval = interval }(fileCheckInterval)
+	fileCheckInterval = 0
+
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetUnavailable(true)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	start := time.Now().Add(-time.Hour)
+	writeJWKS(t, path, issuer.JWKS(), start)
+
+	keys, err := NewLocalKeySetFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adaptor := LestrratGoJwx{LocalKeys: keys}
+
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), "unused"); err != nil {
+		t.Fatalf("could not decode token with the local key set: %s", err)
+	}
+
+	issuer.Rotate()
+	rotated := issuer.Sign(issuer.Claims("api://default"))
+	if _, err := adaptor.Decode(rotated, "unused"); err == nil {
+		t.Fatalf("expected a token signed with a key not in the file to be rejected")
+	}
+
+	writeJWKS(t, path, []byte("not json"), start.Add(time.Minute))
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), "unused"); err == nil {
+		t.Fatalf("expected the previous keys to be kept when the file is malformed")
+	}
+
+	writeJWKS(t, path, issuer.JWKS(), start.Add(2*time.Minute))
+	if _, err := adaptor.Decode(rotated, "unused"); err != nil {
+		t.Errorf("the changed file was not read again: %s", err)
+	}
+
+	if issuer.JWKSRequests() != 0 || issuer.MetadataRequests() != 0 {
+		t.Errorf("expected no requests to the issuer, got %d and %d", issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+}
+
+func Test_local_key_set_is_read_again_on_reload(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeJWKS(t, path, issuer.JWKS(), modTime)
+
+	keys, err := NewLocalKeySetFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Source() != "file://"+path {
+		t.Errorf("unexpected source %q", keys.Source())
+	}
+	adaptor := LestrratGoJwx{LocalKeys: keys}
+
+	issuer.Rotate()
+	rotated := issuer.Sign(issuer.Claims("api://default"))
+
+	// The same modification time hides the change from the check.
+	writeJWKS(t, path, issuer.JWKS(), modTime)
+	if err := adaptor.Refresh("unused"); err != nil {
+		t.Fatalf("could not reload the local key set: %s", err)
+	}
+	if _, err := adaptor.Decode(rotated, "unused"); err != nil {
+		t.Errorf("the file was not read again on Refresh: %s", err)
+	}
+
+	writeJWKS(t, path, []byte(`{"keys": [`), modTime)
+	if err := keys.Reload(); err == nil || !strings.Contains(err.Error(), "file://"+path) {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+	if _, err := adaptor.Decode(rotated, "unused"); err != nil {
+		t.Errorf("the previous keys were not kept after a failed reload: %s", err)
+	}
+}
+
+func Test_local_key_set_from_a_reader(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	keys, err := NewLocalKeySetFromReader(bytes.NewReader(issuer.JWKS()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	adaptor := LestrratGoJwx{LocalKeys: keys}
+
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), "unused"); err != nil {
+		t.Fatalf("could not decode token with the local key set: %s", err)
+	}
+
+	issuer.Rotate()
+	if err := keys.ReloadFrom(bytes.NewReader(issuer.JWKS())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), "unused"); err != nil {
+		t.Errorf("the key set was not replaced: %s", err)
+	}
+
+	if _, err := NewLocalKeySetFromReader(strings.NewReader("{")); err == nil {
+		t.Errorf("expected an error for a malformed key set")
+	}
+}
@@ -0,0 +1,91 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package lestrratGoJwx
+
+import (
+	"crypto"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+// x5cChain is a key's x5c certificate chain, leaf first, with the time
+// until which it is known to chain to each pool of roots it was verified
+// against.
+type x5cChain struct {
+	certs []*x509.Certificate
+
+	mu       sync.Mutex
+	verified map[*x509.CertPool]time.Time
+}
+
+func newX5CChain(certs []*x509.Certificate) *x5cChain {
+	if len(certs) == 0 {
+		return nil
+	}
+	return &x5cChain{certs: certs, verified: map[*x509.CertPool]time.Time{}}
+}
+
+// checkX5C reports whether key's x5c chain verifies against roots at now,
+// and its leaf certificate is for key. A verified chain is remembered until
+// the first of its certificates expires.
+func (key preparedKey) checkX5C(roots *x509.CertPool, now time.Time) error {
+	if key.x5c == nil {
+		return errors.X5CInvalidError(key.kid, errors.X5CMissing, "")
+	}
+	return key.x5c.check(key.kid, key.raw, roots, now)
+}
+
+func (c *x5cChain) check(kid string, raw interface{}, roots *x509.CertPool, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if until, ok := c.verified[roots]; ok && now.Before(until) {
+		return nil
+	}
+
+	leaf := c.certs[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range c.certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return errors.X5CInvalidError(kid, errors.X5CChainInvalid, err.Error())
+	}
+
+	public, ok := raw.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(leaf.PublicKey) {
+		return errors.X5CInvalidError(kid, errors.X5CKeyMismatch, "")
+	}
+
+	until := leaf.NotAfter
+	for _, cert := range chains[0] {
+		if cert.NotAfter.Before(until) {
+			until = cert.NotAfter
+		}
+	}
+	c.verified[roots] = until
+	return nil
+}
@@ -0,0 +1,159 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package lestrratGoJwx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	goerrors "errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// certify returns an x5c chain with a leaf certificate for key, valid until
+// notAfter.
+func (ca testCA) certify(t *testing.T, key crypto.PublicKey, notAfter time.Time) []string {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Token Signing"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{base64.StdEncoding.EncodeToString(der), base64.StdEncoding.EncodeToString(ca.cert.Raw)}
+}
+
+func Test_x5c_chains_are_validated_against_the_roots(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		x5c    func(issuer *testissuer.Issuer) interface{}
+		reason errors.X5CReason
+	}{
+		{"trusted chain", func(issuer *testissuer.Issuer) interface{} {
+			return ca.certify(t, issuer.PublicKey(), time.Now().Add(time.Hour))
+		}, ""},
+		{"no x5c", func(*testissuer.Issuer) interface{} { return nil }, errors.X5CMissing},
+		{"untrusted root", func(issuer *testissuer.Issuer) interface{} {
+			return otherCA.certify(t, issuer.PublicKey(), time.Now().Add(time.Hour))
+		}, errors.X5CChainInvalid},
+		{"expired leaf", func(issuer *testissuer.Issuer) interface{} {
+			return ca.certify(t, issuer.PublicKey(), time.Now().Add(-time.Minute))
+		}, errors.X5CChainInvalid},
+		{"leaf for another key", func(*testissuer.Issuer) interface{} {
+			return ca.certify(t, &otherKey.PublicKey, time.Now().Add(time.Hour))
+		}, errors.X5CKeyMismatch},
+	}
+
+	for _, test := range tests {
+		issuer := testissuer.New()
+		issuer.SetKeyParams(map[string]interface{}{"x5c": test.x5c(issuer)})
+		adaptor := LestrratGoJwx{Cache: cache.NewMemory(), X5CRoots: ca.roots()}
+
+		_, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), issuer.URL+"/v1/keys")
+		var invalid *errors.X5CInvalid
+		switch {
+		case test.reason == "" && err != nil:
+			t.Errorf("%s: could not decode token: %s", test.name, err)
+		case test.reason != "" && !goerrors.As(err, &invalid):
+			t.Errorf("%s: expected an X5CInvalid error, got %v", test.name, err)
+		case test.reason != "" && invalid.Reason != test.reason:
+			t.Errorf("%s: expected the reason %q, got %q: %s", test.name, test.reason, invalid.Reason, err)
+		}
+
+		issuer.Close()
+	}
+}
+
+func Test_x5c_is_ignored_without_roots(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetKeyParams(map[string]interface{}{
+		"x5c": newTestCA(t).certify(t, issuer.PublicKey(), time.Now().Add(-time.Minute)),
+	})
+
+	adaptor := LestrratGoJwx{Cache: cache.NewMemory()}
+	if _, err := adaptor.Decode(issuer.Sign(issuer.Claims("api://default")), issuer.URL+"/v1/keys"); err != nil {
+		t.Errorf("an expired x5c chain failed verification without x5c validation: %s", err)
+	}
+}
+
+func Test_prime_fails_without_a_trusted_x5c_chain(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	adaptor := LestrratGoJwx{Cache: cache.NewMemory(), X5CRoots: newTestCA(t).roots()}
+	if err := adaptor.Prime(issuer.URL + "/v1/keys"); err == nil {
+		t.Errorf("expected Prime to fail for a key set without x5c")
+	}
+}
@@ -0,0 +1,308 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+// DefaultAttestationTTL is how long an attestation is valid when
+// AttestationTTL is zero.
+const DefaultAttestationTTL = 30 * time.Second
+
+// minAttestationSecret is the shortest HMAC secret an AttestationKey may
+// have, in bytes.
+const minAttestationSecret = 32
+
+// AttestationKey signs and checks signature attestations. For HMAC-SHA256,
+// set Secret, shared by the gateway and the services. For Ed25519, set
+// PrivateKey on the gateway and PublicKey on the services.
+type AttestationKey struct {
+	// ID names the key in the attestations it signs, so that keys can be
+	// rotated. It must not be empty or contain a newline.
+	ID string
+
+	// Secret is an HMAC-SHA256 key of at least 32 bytes.
+	Secret []byte
+
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+func (k AttestationKey) validate() error {
+	switch {
+	case k.ID == "" || strings.ContainsRune(k.ID, '\n'):
+		return fmt.Errorf("attestation key %q: the ID must not be empty or contain a newline", k.ID)
+	case k.Secret != nil && (k.PrivateKey != nil || k.PublicKey != nil):
+		return fmt.Errorf("attestation key %q: set either Secret or an Ed25519 key, not both", k.ID)
+	case k.Secret != nil:
+		if len(k.Secret) < minAttestationSecret {
+			return fmt.Errorf("attestation key %q: the secret must be at least %d bytes, got %d", k.ID, minAttestationSecret, len(k.Secret))
+		}
+	case k.PrivateKey != nil:
+		if len(k.PrivateKey) != ed25519.PrivateKeySize {
+			return fmt.Errorf("attestation key %q: the private key is not an Ed25519 key", k.ID)
+		}
+		if k.PublicKey != nil && !k.PublicKey.Equal(k.PrivateKey.Public()) {
+			return fmt.Errorf("attestation key %q: the public key does not match the private key", k.ID)
+		}
+	case k.PublicKey != nil:
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("attestation key %q: the public key is not an Ed25519 key", k.ID)
+		}
+	default:
+		return fmt.Errorf("attestation key %q: it has no Secret or Ed25519 key", k.ID)
+	}
+	return nil
+}
+
+// canSign reports whether the key can sign attestations, rather than
+// only check them.
+func (k AttestationKey) canSign() bool {
+	return k.Secret != nil || k.PrivateKey != nil
+}
+
+func (k AttestationKey) sign(message []byte) []byte {
+	if k.Secret != nil {
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(message)
+		return mac.Sum(nil)
+	}
+	return ed25519.Sign(k.PrivateKey, message)
+}
+
+func (k AttestationKey) verify(message []byte, signature []byte) bool {
+	if k.Secret != nil {
+		return hmac.Equal(k.sign(message), signature)
+	}
+	public := k.PublicKey
+	if public == nil {
+		public = k.PrivateKey.Public().(ed25519.PublicKey)
+	}
+	return ed25519.Verify(public, message, signature)
+}
+
+// Attestation vouches that a gateway verified a token's signature. It
+// signs a hash of the token, the token's kid and the attestation's expiry,
+// so it cannot be used with another token or after it expires.
+type Attestation struct {
+	// KeyID is the ID of the AttestationKey that signed it.
+	KeyID string
+
+	ExpiresAt time.Time
+
+	Signature []byte
+}
+
+// String encodes the attestation for an HTTP header: its key ID, its
+// expiry in Unix seconds and its signature, separated by periods, with the
+// key ID and signature base64url encoded. ParseAttestation decodes it.
+func (a Attestation) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(a.KeyID)) + "." +
+		strconv.FormatInt(a.ExpiresAt.Unix(), 10) + "." +
+		base64.RawURLEncoding.EncodeToString(a.Signature)
+}
+
+// ParseAttestation decodes an attestation encoded by Attestation.String.
+// It does not check the attestation; VerifyWithAttestation does.
+func ParseAttestation(s string) (Attestation, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Attestation{}, fmt.Errorf("the attestation must contain exactly 3 parts separated by periods ('.')")
+	}
+
+	keyID, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Attestation{}, fmt.Errorf("the attestation's key ID is not base64url encoded")
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Attestation{}, fmt.Errorf("the attestation's expiry is not a number")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Attestation{}, fmt.Errorf("the attestation's signature is not base64url encoded")
+	}
+
+	return Attestation{KeyID: string(keyID), ExpiresAt: time.Unix(expiresAt, 0), Signature: signature}, nil
+}
+
+// attestationMessage is what an attestation signs. The key ID must not
+// contain a newline, and the token hash has a fixed length, so the fields
+// cannot run into each other.
+func attestationMessage(keyID string, jwt string, kid string, expiresAt time.Time) []byte {
+	return []byte(strings.Join([]string{
+		"jwtverifier-attestation-v1",
+		keyID,
+		tokenHash(jwt),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+		kid,
+	}, "\n"))
+}
+
+// AttestSignature verifies a token's signature, as VerifyAccessToken does,
+// and returns an attestation that it did, signed with the first of the
+// verifier's AttestationKeys. A gateway passes the attestation on with the
+// token, so the services behind it can call VerifyWithAttestation instead
+// of verifying the signature again.
+//
+// Only the token's structure, header and signature are checked, not its
+// claims. The attestation expires after AttestationTTL, or at the token's
+// exp if that is sooner.
+func (j *JwtVerifier) AttestSignature(ctx context.Context, jwt string) (Attestation, error) {
+	if err := ctx.Err(); err != nil {
+		return Attestation{}, err
+	}
+
+	att, err := j.attestSignature(ctx, jwt)
+	if err != nil {
+		j.log().Debug("signature attestation failed", "error", err.Error())
+	}
+	return att, err
+}
+
+func (j *JwtVerifier) attestSignature(ctx context.Context, jwt string) (Attestation, error) {
+	if len(j.AttestationKeys) == 0 {
+		return Attestation{}, fmt.Errorf("attestations are not enabled: the verifier has no AttestationKeys")
+	}
+	key := j.AttestationKeys[0]
+	if err := key.validate(); err != nil {
+		return Attestation{}, err
+	}
+	if !key.canSign() {
+		return Attestation{}, fmt.Errorf("attestation key %q cannot sign: it only has a public key", key.ID)
+	}
+
+	header, err := j.parseAccessToken(jwt)
+	if err != nil {
+		return Attestation{}, err
+	}
+
+	resp, _, err := j.decodeJwt(ctx, jwt, header)
+	if err != nil {
+		return Attestation{}, err
+	}
+
+	ttl := j.AttestationTTL
+	if ttl <= 0 {
+		ttl = DefaultAttestationTTL
+	}
+	expiresAt := j.now().Add(ttl).Truncate(time.Second)
+	if exp, err := (&Jwt{Claims: resp.(map[string]interface{})}).Expiry(); err == nil && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+
+	kid, _ := header.kid.(string)
+	return Attestation{
+		KeyID:     key.ID,
+		ExpiresAt: expiresAt,
+		Signature: key.sign(attestationMessage(key.ID, jwt, kid, expiresAt)),
+	}, nil
+}
+
+// VerifyWithAttestation verifies an access token whose signature a gateway
+// verified with AttestSignature. The attestation is checked instead of the
+// token's signature, and then the token's claims as EvaluatePolicies
+// checks them: every check VerifyAccessToken makes other than the
+// verifier's audience, client ID, scope, group and claim requirements, and
+// the requirements of policy. Every failing check is reported, joined in
+// one error. A policy without an Audience requires the verifier's aud, and
+// one that has neither is an error.
+//
+// Attestations signed with a key that is not among the verifier's
+// AttestationKeys, not made for this token, or expired fail with
+// errors.AttestationInvalid. The expiry is checked without leeway.
+func (j *JwtVerifier) VerifyWithAttestation(ctx context.Context, jwt string, att Attestation, policy Policy) (*Jwt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ctx, end := j.startVerification(ctx, tracing.SpanVerifyAccessToken, "VerifyWithAttestation")
+	token, err := j.verifyWithAttestation(ctx, jwt, att, policy)
+	end(token, err)
+	j.recordVerification(err)
+	if err != nil {
+		j.log().Debug("attested access token verification failed", "error", err.Error())
+	}
+	return token, err
+}
+
+func (j *JwtVerifier) verifyWithAttestation(ctx context.Context, jwt string, att Attestation, policy Policy) (*Jwt, error) {
+	if len(j.AttestationKeys) == 0 {
+		return nil, fmt.Errorf("attestations are not enabled: the verifier has no AttestationKeys")
+	}
+
+	policy, err := j.resolvePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := j.parseAccessToken(jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := j.checkAttestation(jwt, header, att); err != nil {
+		return nil, failedWith(FailureSignature, "could not verify the attestation: %w", err)
+	}
+
+	claims, err := unverifiedClaims(header)
+	if err != nil {
+		return nil, failedWith(FailureMalformed, "token is not valid: %w", err)
+	}
+
+	return j.validateAccessTokenClaims(ctx, jwt, header, claims, verifyCall{policies: true, policy: &policy})
+}
+
+// checkAttestation checks that att was signed with one of the verifier's
+// AttestationKeys for this token, and has not expired.
+func (j *JwtVerifier) checkAttestation(jwt string, header jwtHeader, att Attestation) error {
+	var key *AttestationKey
+	for i := range j.AttestationKeys {
+		if j.AttestationKeys[i].ID == att.KeyID {
+			key = &j.AttestationKeys[i]
+			break
+		}
+	}
+	if key == nil {
+		return errors.AttestationInvalidError(att.KeyID, errors.AttestationUnknownKey)
+	}
+	if err := key.validate(); err != nil {
+		return err
+	}
+
+	kid, _ := header.kid.(string)
+	if !key.verify(attestationMessage(att.KeyID, jwt, kid, att.ExpiresAt), att.Signature) {
+		return errors.AttestationInvalidError(att.KeyID, errors.AttestationForged)
+	}
+
+	if !j.now().Before(att.ExpiresAt) {
+		return errors.AttestationInvalidError(att.KeyID, errors.AttestationExpired)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	goerrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+var attestationSecret = bytes.Repeat([]byte("s"), 32)
+
+var attestationPolicy = Policy{Audience: "api://default"}
+
+func attestationVerifier(t *testing.T, issuer *testissuer.Issuer, opts ...Option) *JwtVerifier {
+	t.Helper()
+	jv, err := NewVerifier(issuer.URL, append([]Option{WithCache(cache.NewMemory())}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jv
+}
+
+func expectAttestationInvalid(t *testing.T, name string, err error, reason errors.AttestationReason) {
+	t.Helper()
+	var invalid *errors.AttestationInvalid
+	if !goerrors.As(err, &invalid) || invalid.Reason != reason {
+		t.Errorf("%s: expected an attestation failure for %s, got %v", name, reason, err)
+	}
+}
+
+func Test_services_verify_attested_tokens_without_the_key_set(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		gateway AttestationKey
+		service AttestationKey
+	}{
+		{"hmac", AttestationKey{ID: "gateway-1", Secret: attestationSecret}, AttestationKey{ID: "gateway-1", Secret: attestationSecret}},
+		{"ed25519", AttestationKey{ID: "gateway-1", PrivateKey: private}, AttestationKey{ID: "gateway-1", PublicKey: public}},
+	}
+
+	policy := Policy{Audience: "api://default"}
+	for _, test := range tests {
+		gateway := attestationVerifier(t, issuer, WithAttestationKeys(test.gateway))
+		service := attestationVerifier(t, issuer, WithAttestationKeys(test.service))
+
+		token := issuer.Sign(issuer.Claims("api://default"))
+		att, err := gateway.AttestSignature(context.Background(), token)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		// The attestation travels to the service in a header.
+		att, err = ParseAttestation(att.String())
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		requests := issuer.JWKSRequests()
+		jwt, err := service.VerifyWithAttestation(context.Background(), token, att, policy)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if jwt.Claims["sub"] != "user@example.com" {
+			t.Errorf("%s: unexpected claims %v", test.name, jwt.Claims)
+		}
+		if issuer.JWKSRequests() != requests {
+			t.Errorf("%s: the service fetched the key set", test.name)
+		}
+
+		_, err = service.VerifyWithAttestation(context.Background(), token, att, Policy{Audience: "api://other"})
+		if err == nil || !strings.Contains(err.Error(), "the `Policy` was not satisfied") {
+			t.Errorf("%s: expected the policy to fail, got %v", test.name, err)
+		}
+	}
+}
+
+func Test_forged_attestations_are_refused(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	key := AttestationKey{ID: "gateway-1", Secret: attestationSecret}
+	gateway := attestationVerifier(t, issuer, WithAttestationKeys(key))
+	service := attestationVerifier(t, issuer, WithAttestationKeys(key))
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	att, err := gateway.AttestSignature(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["scp"] = []string{"admin"}
+	another := issuer.Sign(claims)
+
+	tampered := att
+	tampered.Signature = append([]byte(nil), att.Signature...)
+	tampered.Signature[0] ^= 1
+
+	extended := att
+	extended.ExpiresAt = att.ExpiresAt.Add(time.Hour)
+
+	other := AttestationKey{ID: "gateway-1", Secret: bytes.Repeat([]byte("x"), 32)}
+	forger := attestationVerifier(t, issuer, WithAttestationKeys(other))
+	forged, err := forger.AttestSignature(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		att   Attestation
+	}{
+		{"tampered signature", token, tampered},
+		{"extended expiry", token, extended},
+		{"another token", another, att},
+		{"another key", token, forged},
+	}
+
+	for _, test := range tests {
+		_, err := service.VerifyWithAttestation(context.Background(), test.token, test.att, attestationPolicy)
+		expectAttestationInvalid(t, test.name, err, errors.AttestationForged)
+	}
+
+	untrusted := testissuer.New()
+	defer untrusted.Close()
+	if _, err := gateway.AttestSignature(context.Background(), untrusted.Sign(untrusted.Claims("api://default"))); err == nil {
+		t.Errorf("a token signed with another issuer's key was attested")
+	}
+}
+
+func Test_attestations_expire(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+	key := AttestationKey{ID: "gateway-1", Secret: attestationSecret}
+	gateway := attestationVerifier(t, issuer, WithAttestationKeys(key), WithAttestationTTL(10*time.Second), WithClock(clock))
+	service := attestationVerifier(t, issuer, WithAttestationKeys(key), WithClock(clock))
+
+	claims := issuer.Claims("api://default")
+	token := issuer.Sign(claims)
+	att, err := gateway.AttestSignature(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if att.ExpiresAt.After(now.Add(10 * time.Second)) {
+		t.Errorf("the attestation expires at %s, after its TTL", att.ExpiresAt)
+	}
+
+	if _, err := service.VerifyWithAttestation(context.Background(), token, att, attestationPolicy); err != nil {
+		t.Errorf("a fresh attestation was refused: %s", err)
+	}
+
+	now = now.Add(11 * time.Second)
+	_, err = service.VerifyWithAttestation(context.Background(), token, att, attestationPolicy)
+	expectAttestationInvalid(t, "expired", err, errors.AttestationExpired)
+
+	claims["exp"] = now.Add(3 * time.Second).Unix()
+	short := issuer.Sign(claims)
+	att, err = gateway.AttestSignature(context.Background(), short)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !att.ExpiresAt.Equal(time.Unix(now.Add(3*time.Second).Unix(), 0)) {
+		t.Errorf("the attestation outlives the token: %s", att.ExpiresAt)
+	}
+}
+
+func Test_attestation_keys_can_be_rotated(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	old := AttestationKey{ID: "gateway-1", Secret: attestationSecret}
+	next := AttestationKey{ID: "gateway-2", Secret: bytes.Repeat([]byte("n"), 32)}
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	attest := func(keys ...AttestationKey) Attestation {
+		att, err := attestationVerifier(t, issuer, WithAttestationKeys(keys...)).AttestSignature(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return att
+	}
+	oldAtt := attest(old)
+	nextAtt := attest(next, old)
+	if nextAtt.KeyID != "gateway-2" {
+		t.Errorf("the gateway signed with %q, not its first key", nextAtt.KeyID)
+	}
+
+	before := attestationVerifier(t, issuer, WithAttestationKeys(old))
+	_, err := before.VerifyWithAttestation(context.Background(), token, nextAtt, attestationPolicy)
+	expectAttestationInvalid(t, "new key before rollout", err, errors.AttestationUnknownKey)
+
+	during := attestationVerifier(t, issuer, WithAttestationKeys(old, next))
+	for _, att := range []Attestation{oldAtt, nextAtt} {
+		if _, err := during.VerifyWithAttestation(context.Background(), token, att, attestationPolicy); err != nil {
+			t.Errorf("an attestation signed with %q was refused during the rotation: %s", att.KeyID, err)
+		}
+	}
+
+	after := attestationVerifier(t, issuer, WithAttestationKeys(next))
+	_, err = after.VerifyWithAttestation(context.Background(), token, oldAtt, attestationPolicy)
+	expectAttestationInvalid(t, "old key after rotation", err, errors.AttestationUnknownKey)
+}
+
+func Test_attestations_are_opt_in(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv := attestationVerifier(t, issuer)
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	if _, err := jv.AttestSignature(context.Background(), token); err == nil {
+		t.Errorf("a verifier without attestation keys signed an attestation")
+	}
+	if _, err := jv.VerifyWithAttestation(context.Background(), token, Attestation{KeyID: "gateway-1"}, attestationPolicy); err == nil {
+		t.Errorf("a verifier without attestation keys accepted an attestation")
+	}
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicOnly := attestationVerifier(t, issuer, WithAttestationKeys(AttestationKey{ID: "gateway-1", PublicKey: public}))
+	if _, err := publicOnly.AttestSignature(context.Background(), token); err == nil {
+		t.Errorf("a verifier with only a public key signed an attestation")
+	}
+
+	invalid := [][]AttestationKey{
+		{{ID: "gateway-1", Secret: []byte("short")}},
+		{{ID: "", Secret: attestationSecret}},
+		{{ID: "gateway-1"}},
+		{{ID: "gateway-1", Secret: attestationSecret}, {ID: "gateway-1", PublicKey: public}},
+	}
+	for _, keys := range invalid {
+		if _, err := NewVerifier(issuer.URL, WithAttestationKeys(keys...)); err == nil {
+			t.Errorf("the attestation keys %v were accepted", keys)
+		}
+	}
+}
+
+func Test_attested_tokens_get_the_access_token_checks(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var events []VerificationEvent
+	key := AttestationKey{ID: "gateway-1", Secret: attestationSecret}
+	gateway := attestationVerifier(t, issuer, WithAttestationKeys(key))
+	service := attestationVerifier(t, issuer, WithAttestationKeys(key),
+		WithHooks(Hooks{OnVerification: func(e VerificationEvent) {
+			events = append(events, e)
+		}}))
+
+	token := issuer.Sign(issuer.Claims("api://other"))
+	att, err := gateway.AttestSignature(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.VerifyWithAttestation(context.Background(), token, att, Policy{}); err == nil {
+		t.Errorf("a policy without any audience was accepted")
+	}
+
+	defaulted := attestationVerifier(t, issuer, WithAttestationKeys(key), WithClaimToValidate("aud", "api://default"))
+	_, err = defaulted.VerifyWithAttestation(context.Background(), token, att, Policy{})
+	if err == nil || !strings.Contains(err.Error(), "aud") {
+		t.Errorf("expected the verifier's aud to be required, got %v", err)
+	}
+
+	if len(events) != 1 || events[0].Method != "VerifyWithAttestation" || events[0].Success {
+		t.Errorf("expected a verification event for the attested token, got %+v", events)
+	}
+	if stats := service.Stats(); stats.Rejected != 1 {
+		t.Errorf("expected the attested token to be counted, got %+v", stats)
+	}
+}
+
+func Test_attested_org_authorization_server_tokens_are_refused(t *testing.T) {
+	issuer := testissuer.NewOrg()
+	defer issuer.Close()
+
+	key := AttestationKey{ID: "gateway-1", Secret: attestationSecret}
+	service := attestationVerifier(t, issuer, WithAttestationKeys(key))
+
+	token := issuer.Sign(issuer.Claims("client123"))
+	_, err := service.VerifyWithAttestation(context.Background(), token, Attestation{KeyID: "gateway-1"}, Policy{Audience: "client123"})
+	var org *errors.OrgAccessToken
+	if !goerrors.As(err, &org) {
+		t.Errorf("expected an OrgAccessToken error, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+// Package cache defines where the discovery documents and key sets fetched
+// from an issuer are kept between verifications.
+package cache
+
+import (
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// Cache stores documents fetched from an issuer. It must be safe for
+// concurrent use.
+//
+// Entries are stored under the keys returned by MetadataKey and KeySetKey.
+// Values are the JSON documents exactly as the issuer served them, with any
+// leading byte order mark and whitespace removed. Both formats are stable
+// across releases, so a shared cache can serve processes running different
+// versions.
+//
+// A Cache cannot fail a verification: implementations should report errors
+// as a miss from Get and drop values they fail to Set, and the verifier
+// fetches the document directly instead.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+const (
+	// DefaultMinLifetime is the shortest time a document is cached for,
+	// whatever its Cache-Control or Expires header says, unless configured
+	// otherwise. It keeps an issuer that sends no-store from being asked
+	// for the document on every verification.
+	DefaultMinLifetime = time.Minute
+
+	// DefaultMaxLifetime is the longest time a document is cached for
+	// unless configured otherwise.
+	DefaultMaxLifetime = 24 * time.Hour
+)
+
+// MetadataKey is the key for the discovery document at url.
+func MetadataKey(url string) string {
+	return "jwtverifier:metadata:" + url
+}
+
+// KeySetKey is the key for the key set at url.
+func KeySetKey(url string) string {
+	return "jwtverifier:jwks:" + url
+}
+
+type memory struct {
+	c *gocache.Cache
+}
+
+// NewMemory returns an in-process Cache.
+func NewMemory() Cache {
+	return &memory{c: gocache.New(5*time.Minute, 10*time.Minute)}
+}
+
+func (m *memory) Get(key string) ([]byte, bool) {
+	if x, found := m.c.Get(key); found {
+		return x.([]byte), true
+	}
+	return nil, false
+}
+
+func (m *memory) Set(key string, value []byte, ttl time.Duration) {
+	m.c.Set(key, value, ttl)
+}
+
+var shared = NewMemory()
+
+// Default returns the in-process Cache shared by every verifier and adaptor
+// that is not given one.
+func Default() Cache {
+	return shared
+}
+
+// OrDefault returns c, or Default if c is nil.
+func OrDefault(c Cache) Cache {
+	if c == nil {
+		return shared
+	}
+	return c
+}
@@ -0,0 +1,52 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_memory_cache_stores_values_until_they_expire(t *testing.T) {
+	c := NewMemory()
+
+	if _, found := c.Get("missing"); found {
+		t.Errorf("Get() found a value that was never set")
+	}
+
+	c.Set("key", []byte("value"), time.Hour)
+	if value, found := c.Get("key"); !found || string(value) != "value" {
+		t.Errorf("Get() returned %q, %v", value, found)
+	}
+
+	c.Set("short", []byte("value"), time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if _, found := c.Get("short"); found {
+		t.Errorf("Get() returned an expired value")
+	}
+}
+
+func Test_keys_are_stable(t *testing.T) {
+	if key := MetadataKey("https://golang.oktapreview.com/.well-known/openid-configuration"); key !=
+		"jwtverifier:metadata:https://golang.oktapreview.com/.well-known/openid-configuration" {
+		t.Errorf("unexpected metadata key %s", key)
+	}
+
+	if key := KeySetKey("https://golang.oktapreview.com/v1/keys"); key != "jwtverifier:jwks:https://golang.oktapreview.com/v1/keys" {
+		t.Errorf("unexpected key set key %s", key)
+	}
+}
@@ -0,0 +1,199 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	ttls    map[string]time.Duration
+	broken  bool
+}
+
+func (c *mapCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken {
+		return nil, false
+	}
+	value, found := c.entries[key]
+	return value, found
+}
+
+func (c *mapCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.broken {
+		c.entries[key] = value
+		if c.ttls != nil {
+			c.ttls[key] = ttl
+		}
+	}
+}
+
+func (c *mapCache) set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+}
+
+func Test_a_custom_cache_holds_the_raw_documents(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	c := &mapCache{entries: map[string][]byte{}}
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.VerifyAccessToken(token); err != nil {
+			t.Fatalf("could not verify access_token: %s", err)
+		}
+	}
+
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("expected the documents to be fetched once, got %d and %d",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+
+	md, found := c.Get(cache.MetadataKey(issuer.URL + "/.well-known/openid-configuration"))
+	var decoded map[string]interface{}
+	if !found || json.Unmarshal(md, &decoded) != nil || decoded["jwks_uri"] != issuer.URL+"/v1/keys" {
+		t.Errorf("the discovery document was not cached as JSON: %s", md)
+	}
+
+	jwks, found := c.Get(cache.KeySetKey(issuer.URL + "/v1/keys"))
+	if !found || json.Unmarshal(jwks, &decoded) != nil || decoded["keys"] == nil {
+		t.Errorf("the key set was not cached as JSON: %s", jwks)
+	}
+}
+
+func Test_cache_failures_fall_back_to_fetching(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	c := &mapCache{entries: map[string][]byte{}, broken: true}
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.VerifyAccessToken(token); err != nil {
+			t.Fatalf("could not verify access_token with a failing cache: %s", err)
+		}
+	}
+
+	if issuer.JWKSRequests() != 2 {
+		t.Errorf("expected a fetch for each verification, got %d", issuer.JWKSRequests())
+	}
+}
+
+func Test_corrupt_cache_entries_are_refetched(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	c := &mapCache{entries: map[string][]byte{}}
+	c.set(cache.MetadataKey(issuer.URL+"/.well-known/openid-configuration"), []byte("not json"))
+	c.set(cache.KeySetKey(issuer.URL+"/v1/keys"), []byte("{\"keys\": 42}"))
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatalf("could not verify access_token with corrupt cache entries: %s", err)
+	}
+
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("expected the corrupt entries to be refetched, got %d and %d",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+}
+
+func Test_cache_lifetimes_follow_the_response_headers(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   [2]string
+		options  []jwtverifier.Option
+		expected time.Duration
+	}{
+		{"no headers", [2]string{}, nil, 5 * time.Minute},
+		{"max-age", [2]string{"Cache-Control", "max-age=3600"}, nil, time.Hour},
+		{"max-age=0", [2]string{"Cache-Control", "max-age=0"}, nil, cache.DefaultMinLifetime},
+		{"no-store", [2]string{"Cache-Control", "no-store"}, nil, cache.DefaultMinLifetime},
+		{"expires", [2]string{"Expires", time.Now().Add(2 * time.Hour).UTC().Format(http.TimeFormat)}, nil, 2 * time.Hour},
+		{"max-age above the default maximum", [2]string{"Cache-Control", "max-age=604800"}, nil, cache.DefaultMaxLifetime},
+		{"max-age above a configured maximum", [2]string{"Cache-Control", "max-age=3600"},
+			[]jwtverifier.Option{jwtverifier.WithCacheLifetimeBounds(10*time.Second, 30*time.Minute)}, 30 * time.Minute},
+		{"no-store with a configured minimum", [2]string{"Cache-Control", "no-store"},
+			[]jwtverifier.Option{jwtverifier.WithCacheLifetimeBounds(10*time.Second, 30*time.Minute)}, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		issuer := testissuer.New()
+		if test.header[0] != "" {
+			issuer.SetResponseHeader(test.header[0], test.header[1])
+		}
+
+		c := &mapCache{entries: map[string][]byte{}, ttls: map[string]time.Duration{}}
+		options := append([]jwtverifier.Option{
+			jwtverifier.WithClaimToValidate("aud", "api://default"),
+			jwtverifier.WithCache(c),
+		}, test.options...)
+		verifier, err := jwtverifier.NewVerifier(issuer.URL, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+			t.Fatalf("%s: could not verify access_token: %s", test.name, err)
+		}
+		issuer.Close()
+
+		for _, key := range []string{
+			cache.MetadataKey(issuer.URL + "/.well-known/openid-configuration"),
+			cache.KeySetKey(issuer.URL + "/v1/keys"),
+		} {
+			// Expires is relative to the clock, so allow for the time the test takes.
+			if got := c.ttls[key]; got > test.expected || got < test.expected-5*time.Second {
+				t.Errorf("%s: expected %s to be cached for %s, got %s", test.name, key, test.expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+)
+
+// documentCache is the verifier's Cache, recording the size of each
+// document the verifier stores in it, so that MaxCacheBytes can account
+// for them. Documents are never evicted from it: the verifier has one per
+// URL, and needs them all to verify.
+type documentCache struct {
+	cache.Cache
+
+	mu    sync.Mutex
+	sizes map[string]int64
+}
+
+func newDocumentCache(c cache.Cache) *documentCache {
+	return &documentCache{Cache: cache.OrDefault(c), sizes: map[string]int64{}}
+}
+
+func (c *documentCache) Set(key string, value []byte, ttl time.Duration) {
+	c.Cache.Set(key, value, ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sizes[key] = int64(len(value))
+}
+
+// bytes returns the size of the documents last stored under each key.
+func (c *documentCache) bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for _, size := range c.sizes {
+		total += size
+	}
+	return total
+}
+
+// documents returns the verifier's Cache, accounting for the documents it
+// stores when the verifier was made with New.
+func (j *JwtVerifier) documents() cache.Cache {
+	if j.documentCache == nil {
+		return cache.OrDefault(j.Cache)
+	}
+	return j.documentCache
+}
+
+// tokenCacheBudget returns how many bytes of MaxCacheBytes the documents
+// leave to the verified-token cache, or -1 without MaxCacheBytes.
+func (j *JwtVerifier) tokenCacheBudget() int64 {
+	if j.MaxCacheBytes <= 0 {
+		return -1
+	}
+	budget := j.MaxCacheBytes
+	if j.documentCache != nil {
+		budget -= j.documentCache.bytes()
+	}
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// cacheToken caches the claims of a verified token, evicting cached tokens
+// first when the caches are over MaxCacheBytes. A token's size is
+// estimated from its length.
+func (j *JwtVerifier) cacheToken(key [sha256.Size]byte, jwt string, claims interface{}, source *KeySource) {
+	expires := j.tokenCacheExpiry(claims.(map[string]interface{}))
+	evicted := j.tokens.put(key, claims, source, j.now(), expires, int64(len(jwt)), j.tokenCacheBudget())
+	if evicted > 0 {
+		j.recordTokenCacheEvictions(evicted)
+	}
+}
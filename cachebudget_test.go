@@ -0,0 +1,113 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_max_cache_bytes_evicts_cached_tokens_before_documents(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTokenCache(100, time.Minute),
+		WithMaxCacheBytes(1<<20),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := make([]string, 10)
+	for i := range tokens {
+		claims := issuer.Claims("api://default")
+		claims["sub"] = fmt.Sprintf("user%02d@example.com", i)
+		tokens[i] = issuer.Sign(claims)
+	}
+	if _, err := jv.VerifyAccessToken(tokens[0]); err != nil {
+		t.Fatal(err)
+	}
+	documents := jv.Stats().DocumentBytes
+	if documents == 0 {
+		t.Fatal("expected the discovery document and key set to be accounted for")
+	}
+
+	// Leave room for three tokens beside the documents.
+	jv.MaxCacheBytes = int64(documents) + 3*int64(len(tokens[0]))
+	for _, token := range tokens {
+		if _, err := jv.VerifyAccessToken(token); err != nil {
+			t.Fatalf("could not verify a token under cache pressure: %s", err)
+		}
+	}
+
+	stats := jv.Stats()
+	if stats.TokenCacheEntries != 3 || stats.TokenCacheBytes != 3*uint64(len(tokens[0])) {
+		t.Errorf("expected 3 cached tokens, got %d of %d bytes", stats.TokenCacheEntries, stats.TokenCacheBytes)
+	}
+	if stats.TokenCacheEvictions != 7 {
+		t.Errorf("expected 7 tokens to be evicted, got %d", stats.TokenCacheEvictions)
+	}
+	if stats.DocumentBytes != documents || issuer.JWKSRequests() != 1 || issuer.MetadataRequests() != 1 {
+		t.Errorf("expected the documents to stay cached, got %d bytes after %d key set and %d metadata requests",
+			stats.DocumentBytes, issuer.JWKSRequests(), issuer.MetadataRequests())
+	}
+
+	// The most recent tokens are answered from the cache, evicted ones are
+	// verified again.
+	verifications := func() uint64 {
+		info, err := jv.KeySetInfo(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range info.Keys {
+			if key.KeyID == issuer.KeyID() {
+				return key.Verifications
+			}
+		}
+		return 0
+	}
+	before := verifications()
+	if _, err := jv.VerifyAccessToken(tokens[9]); err != nil {
+		t.Fatal(err)
+	}
+	if verifications() != before {
+		t.Errorf("expected the most recent token to be answered from the cache")
+	}
+	if _, err := jv.VerifyAccessToken(tokens[0]); err != nil {
+		t.Fatal(err)
+	}
+	if verifications() != before+1 {
+		t.Errorf("expected an evicted token to be verified again")
+	}
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://other"))); err == nil {
+		t.Errorf("verified a token for another audience under cache pressure")
+	}
+}
+
+func Test_max_cache_bytes_must_be_positive(t *testing.T) {
+	if _, err := NewVerifier("https://example.okta.com", WithMaxCacheBytes(0)); err == nil {
+		t.Errorf("accepted a maximum of 0 cache bytes")
+	}
+}
@@ -0,0 +1,253 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package checker checks that issuers still behave as a verifier expects:
+// their discovery document is reachable and for the right issuer, their
+// key set has keys, they sign with an algorithm the verifier accepts, and
+// a canary token verifies end to end. It is the library behind
+// cmd/verifier-check, for running the checks on a schedule to catch
+// configuration drift.
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+)
+
+// The checks, in the order they run.
+const (
+	CheckDiscovery  = "discovery"
+	CheckIssuer     = "issuer"
+	CheckKeySet     = "jwks"
+	CheckAlgorithms = "algorithms"
+	CheckCanary     = "canary"
+)
+
+type Status string
+
+const (
+	Pass Status = "pass"
+	Fail Status = "fail"
+
+	// Skip is a check that could not run, because a check it depends on
+	// failed or, for the canary, because no token is configured. It is not
+	// a failure.
+	Skip Status = "skip"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Check  string `json:"check"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// IssuerReport is the outcome of the checks of one issuer.
+type IssuerReport struct {
+	Name    string   `json:"name"`
+	Issuer  string   `json:"issuer"`
+	OK      bool     `json:"ok"`
+	Results []Result `json:"results"`
+}
+
+// Report is the outcome of a run. OK is false if any check failed.
+type Report struct {
+	OK      bool           `json:"ok"`
+	Issuers []IssuerReport `json:"issuers"`
+}
+
+// Run checks every issuer in config, one after another.
+func Run(ctx context.Context, config Config) Report {
+	report := Report{OK: true}
+	for _, issuer := range config.Issuers {
+		issuerReport := RunIssuer(ctx, issuer, config.timeout())
+		report.OK = report.OK && issuerReport.OK
+		report.Issuers = append(report.Issuers, issuerReport)
+	}
+	return report
+}
+
+func (c Config) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// RunIssuer runs every check of one issuer within timeout, with a
+// verifier of its own that shares no cache with others.
+func RunIssuer(ctx context.Context, config IssuerConfig, timeout time.Duration) IssuerReport {
+	report := IssuerReport{Name: config.Name, Issuer: config.Issuer}
+	if report.Name == "" {
+		report.Name = config.Issuer
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opts := []jwtverifier.Option{
+		jwtverifier.WithCache(cache.NewMemory()),
+		jwtverifier.WithRequestTimeout(timeout),
+	}
+	if config.Audience != "" {
+		opts = append(opts, jwtverifier.WithClaimToValidate("aud", config.Audience))
+	}
+	if len(config.AllowedAlgorithms) > 0 {
+		opts = append(opts, jwtverifier.WithAllowedAlgorithms(config.AllowedAlgorithms...))
+	}
+	jv, err := jwtverifier.NewVerifier(config.Issuer, opts...)
+	if err != nil {
+		report.Results = []Result{{Check: CheckDiscovery, Status: Fail, Detail: err.Error()}}
+		return report
+	}
+	defer jv.Close()
+
+	report.Results = ValidateSetup(ctx, jv)
+
+	token, err := config.canaryToken()
+	switch {
+	case err != nil:
+		report.Results = append(report.Results, Result{Check: CheckCanary, Status: Fail, Detail: err.Error()})
+	case token == "":
+		report.Results = append(report.Results, Result{Check: CheckCanary, Status: Skip, Detail: "no canary token is configured"})
+	default:
+		report.Results = append(report.Results, VerifyOnce(ctx, jv, token))
+	}
+
+	report.OK = true
+	for _, result := range report.Results {
+		if result.Status == Fail {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+func (c IssuerConfig) canaryToken() (string, error) {
+	switch {
+	case c.CanaryTokenEnv != "":
+		token := strings.TrimSpace(os.Getenv(c.CanaryTokenEnv))
+		if token == "" {
+			return "", fmt.Errorf("the environment variable %s is empty", c.CanaryTokenEnv)
+		}
+		return token, nil
+	case c.CanaryTokenFile != "":
+		b, err := ioutil.ReadFile(c.CanaryTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read the canary token: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", nil
+}
+
+// ValidateSetup checks that jv's issuer serves a discovery document for
+// itself, a key set with keys, and signs with an algorithm jv accepts. A
+// check that depends on one that failed is skipped.
+func ValidateSetup(ctx context.Context, jv *jwtverifier.JwtVerifier) []Result {
+	md, err := jv.Metadata(ctx)
+	if err != nil {
+		return []Result{
+			{Check: CheckDiscovery, Status: Fail, Detail: err.Error()},
+			skipped(CheckIssuer, CheckDiscovery),
+			skipped(CheckKeySet, CheckDiscovery),
+			skipped(CheckAlgorithms, CheckDiscovery),
+		}
+	}
+	results := []Result{{Check: CheckDiscovery, Status: Pass}}
+
+	issuer, _ := md["issuer"].(string)
+	if strings.TrimRight(issuer, "/") != strings.TrimRight(jv.Issuer, "/") {
+		return append(results,
+			Result{Check: CheckIssuer, Status: Fail, Detail: fmt.Sprintf("the discovery document is for %q", issuer)},
+			skipped(CheckKeySet, CheckIssuer),
+			skipped(CheckAlgorithms, CheckIssuer))
+	}
+	results = append(results, Result{Check: CheckIssuer, Status: Pass})
+
+	var keyAlgorithms []string
+	if err := jv.Prime(ctx); err != nil {
+		results = append(results, Result{Check: CheckKeySet, Status: Fail, Detail: err.Error()})
+	} else if info, err := jv.KeySetInfo(ctx); err != nil {
+		results = append(results, Result{Check: CheckKeySet, Status: Fail, Detail: err.Error()})
+	} else if len(info.Keys) == 0 {
+		results = append(results, Result{Check: CheckKeySet, Status: Fail, Detail: "the key set has no keys"})
+	} else {
+		for _, key := range info.Keys {
+			if key.Algorithm != "" {
+				keyAlgorithms = append(keyAlgorithms, key.Algorithm)
+			}
+		}
+		results = append(results, Result{Check: CheckKeySet, Status: Pass, Detail: fmt.Sprintf("%d keys", len(info.Keys))})
+	}
+
+	return append(results, checkAlgorithms(md, keyAlgorithms, jv.DescribeConfig().AllowedAlgorithms))
+}
+
+// checkAlgorithms compares the algorithms the discovery document
+// advertises or, if it advertises none, those of the keys, with allowed.
+func checkAlgorithms(md map[string]interface{}, keyAlgorithms []string, allowed []string) Result {
+	var advertised []string
+	if values, ok := md["id_token_signing_alg_values_supported"].([]interface{}); ok {
+		for _, value := range values {
+			if alg, ok := value.(string); ok {
+				advertised = append(advertised, alg)
+			}
+		}
+	}
+	if len(advertised) == 0 {
+		advertised = keyAlgorithms
+	}
+	if len(advertised) == 0 {
+		return Result{Check: CheckAlgorithms, Status: Skip, Detail: "the issuer advertises no signing algorithms"}
+	}
+
+	var common []string
+	for _, alg := range advertised {
+		for _, a := range allowed {
+			if alg == a {
+				common = append(common, alg)
+			}
+		}
+	}
+	if len(common) == 0 {
+		return Result{Check: CheckAlgorithms, Status: Fail, Detail: fmt.Sprintf("the issuer signs with %s, none of the allowed %s",
+			strings.Join(advertised, ", "), strings.Join(allowed, ", "))}
+	}
+	sort.Strings(common)
+	return Result{Check: CheckAlgorithms, Status: Pass, Detail: strings.Join(common, ", ")}
+}
+
+// VerifyOnce verifies token, a canary access token minted for the check,
+// with jv.
+func VerifyOnce(ctx context.Context, jv *jwtverifier.JwtVerifier, token string) Result {
+	if _, err := jv.VerifyAccessTokenContext(ctx, token); err != nil {
+		return Result{Check: CheckCanary, Status: Fail, Detail: err.Error()}
+	}
+	return Result{Check: CheckCanary, Status: Pass}
+}
+
+func skipped(check string, failed string) Result {
+	return Result{Check: check, Status: Skip, Detail: fmt.Sprintf("the %s check failed", failed)}
+}
@@ -0,0 +1,178 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package checker
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func statuses(report IssuerReport) map[string]Status {
+	got := make(map[string]Status, len(report.Results))
+	for _, result := range report.Results {
+		got[result.Check] = result.Status
+	}
+	return got
+}
+
+func Test_a_conforming_issuer_passes(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "canary")
+	if err := ioutil.WriteFile(tokenFile, []byte(issuer.Sign(issuer.Claims("api://default"))+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report := Run(context.Background(), Config{Issuers: []IssuerConfig{{
+		Name:            "default",
+		Issuer:          issuer.URL,
+		Audience:        "api://default",
+		CanaryTokenFile: tokenFile,
+	}}})
+
+	if !report.OK {
+		t.Fatalf("expected the issuer to pass, got %+v", report.Issuers[0].Results)
+	}
+	for check, status := range statuses(report.Issuers[0]) {
+		if status != Pass {
+			t.Errorf("expected the %s check to pass, got %s", check, status)
+		}
+	}
+}
+
+func Test_each_kind_of_drift_fails_its_check(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(issuer *testissuer.Issuer, config *IssuerConfig)
+		expected map[string]Status
+	}{
+		{"unavailable", func(issuer *testissuer.Issuer, _ *IssuerConfig) {
+			issuer.SetUnavailable(true)
+		}, map[string]Status{CheckDiscovery: Fail, CheckIssuer: Skip, CheckKeySet: Skip, CheckAlgorithms: Skip}},
+		{"other issuer", func(issuer *testissuer.Issuer, _ *IssuerConfig) {
+			issuer.SetBodyRewrite(func(path string, body []byte) []byte {
+				return bytes.Replace(body, []byte("/oauth2/default\""), []byte("/oauth2/other\""), 1)
+			})
+		}, map[string]Status{CheckDiscovery: Pass, CheckIssuer: Fail, CheckKeySet: Skip}},
+		{"empty key set", func(issuer *testissuer.Issuer, _ *IssuerConfig) {
+			issuer.SetBodyRewrite(func(path string, body []byte) []byte {
+				if strings.HasSuffix(path, "/v1/keys") {
+					return []byte(`{"keys":[]}`)
+				}
+				return body
+			})
+		}, map[string]Status{CheckIssuer: Pass, CheckKeySet: Fail, CheckAlgorithms: Pass}},
+		{"algorithm", func(_ *testissuer.Issuer, config *IssuerConfig) {
+			config.AllowedAlgorithms = []string{"ES256"}
+		}, map[string]Status{CheckKeySet: Pass, CheckAlgorithms: Fail}},
+		{"canary audience", func(_ *testissuer.Issuer, config *IssuerConfig) {
+			config.Audience = "api://other"
+		}, map[string]Status{CheckAlgorithms: Pass, CheckCanary: Fail}},
+	}
+
+	for _, test := range tests {
+		issuer := testissuer.New()
+		config := IssuerConfig{Issuer: issuer.URL, Audience: "api://default", CanaryTokenEnv: "CHECKER_TEST_CANARY"}
+		t.Setenv("CHECKER_TEST_CANARY", issuer.Sign(issuer.Claims("api://default")))
+		test.setup(issuer, &config)
+
+		report := RunIssuer(context.Background(), config, 5*time.Second)
+		issuer.Close()
+
+		if report.OK {
+			t.Errorf("%s: expected the issuer to fail", test.name)
+		}
+		got := statuses(report)
+		for check, status := range test.expected {
+			if got[check] != status {
+				t.Errorf("%s: expected the %s check to %s, got %s", test.name, check, status, got[check])
+			}
+		}
+	}
+}
+
+func Test_the_canary_is_skipped_without_a_token(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	report := RunIssuer(context.Background(), IssuerConfig{Issuer: issuer.URL}, 5*time.Second)
+	if !report.OK || statuses(report)[CheckCanary] != Skip {
+		t.Errorf("expected a passing report with the canary skipped, got %+v", report)
+	}
+}
+
+func Test_load_config_checks_the_configuration(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{"issuers": [{"issuer": "https://example.okta.com"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Timeout != DefaultTimeout || config.Issuers[0].Name != "https://example.okta.com" {
+		t.Errorf("the defaults were not applied: %+v", config)
+	}
+
+	invalid := []string{
+		`{"issuers": []}`,
+		`{"issuers": [{"name": "no url"}]}`,
+		`{"timeout": "soon", "issuers": [{"issuer": "https://example.okta.com"}]}`,
+		`{"issuers": [{"issuer": "https://example.okta.com", "audiance": "api://default"}]}`,
+		`{"issuers": [{"issuer": "https://example.okta.com", "canaryTokenFile": "a", "canaryTokenEnv": "B"}]}`,
+	}
+	for _, raw := range invalid {
+		if _, err := LoadConfig(strings.NewReader(raw)); err == nil {
+			t.Errorf("expected an error for %s", raw)
+		}
+	}
+}
+
+// opaqueAdaptor hides every interface of the adaptor it wraps beyond
+// adaptors.Adaptor.
+type opaqueAdaptor struct {
+	adaptors.Adaptor
+}
+
+func Test_key_set_errors_are_reported_as_they_are(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithAdaptor(opaqueAdaptor{lestrratGoJwx.LestrratGoJwx{}.New()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range ValidateSetup(context.Background(), jv) {
+		if result.Check != CheckKeySet {
+			continue
+		}
+		if result.Status != Fail || !strings.Contains(result.Detail, "cannot describe its key set") {
+			t.Errorf("expected the adaptor's limitation to be reported, got %+v", result)
+		}
+		return
+	}
+	t.Errorf("the key set was not checked")
+}
@@ -0,0 +1,120 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package checker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// DefaultTimeout bounds the checks of each issuer when the configuration
+// does not set a timeout.
+const DefaultTimeout = 10 * time.Second
+
+// Config lists the issuers to check.
+type Config struct {
+	// Timeout bounds all the checks of one issuer, requests included.
+	Timeout time.Duration
+
+	Issuers []IssuerConfig
+}
+
+// IssuerConfig is an issuer and what is expected of it.
+type IssuerConfig struct {
+	// Name identifies the issuer in the report. It defaults to Issuer.
+	Name string `json:"name"`
+
+	Issuer string `json:"issuer"`
+
+	// Audience, if set, is the aud the canary token must have.
+	Audience string `json:"audience"`
+
+	// AllowedAlgorithms are the signing algorithms the issuer must
+	// support at least one of. They default to the verifier's defaults.
+	AllowedAlgorithms []string `json:"allowedAlgorithms"`
+
+	// CanaryTokenFile and CanaryTokenEnv name the file or environment
+	// variable holding a token, minted for the check by a service account,
+	// that must verify. Without either the canary check is skipped.
+	CanaryTokenFile string `json:"canaryTokenFile"`
+	CanaryTokenEnv  string `json:"canaryTokenEnv"`
+}
+
+// LoadConfigFile reads a JSON configuration file. See LoadConfig.
+func LoadConfigFile(path string) (Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("could not read the configuration: %w", err)
+	}
+	return LoadConfig(bytes.NewReader(b))
+}
+
+// LoadConfig reads a JSON configuration such as
+//
+//	{
+//	  "timeout": "10s",
+//	  "issuers": [{
+//	    "name": "default",
+//	    "issuer": "https://example.okta.com/oauth2/default",
+//	    "audience": "api://default",
+//	    "allowedAlgorithms": ["RS256"],
+//	    "canaryTokenEnv": "DEFAULT_CANARY_TOKEN"
+//	  }]
+//	}
+//
+// Unknown fields are rejected, so that a misspelt expectation is not
+// silently ignored.
+func LoadConfig(r io.Reader) (Config, error) {
+	var raw struct {
+		Timeout string         `json:"timeout"`
+		Issuers []IssuerConfig `json:"issuers"`
+	}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return Config{}, fmt.Errorf("could not parse the configuration: %w", err)
+	}
+
+	config := Config{Timeout: DefaultTimeout, Issuers: raw.Issuers}
+	if raw.Timeout != "" {
+		timeout, err := time.ParseDuration(raw.Timeout)
+		if err != nil || timeout <= 0 {
+			return Config{}, fmt.Errorf("the timeout %q is not a positive duration", raw.Timeout)
+		}
+		config.Timeout = timeout
+	}
+
+	if len(config.Issuers) == 0 {
+		return Config{}, fmt.Errorf("the configuration lists no issuers")
+	}
+	for i, issuer := range config.Issuers {
+		if issuer.Issuer == "" {
+			return Config{}, fmt.Errorf("issuer %d has no issuer URL", i+1)
+		}
+		if issuer.CanaryTokenFile != "" && issuer.CanaryTokenEnv != "" {
+			return Config{}, fmt.Errorf("issuer %s sets both canaryTokenFile and canaryTokenEnv", issuer.Issuer)
+		}
+		if issuer.Name == "" {
+			config.Issuers[i].Name = issuer.Issuer
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,227 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package circuit provides the circuit breaker the verifier and the
+// default adaptor put around their requests to the issuer, so that while
+// the issuer is down verifications fail fast instead of each waiting for a
+// request to time out.
+package circuit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+// State is the state of a Breaker.
+type State string
+
+const (
+	// Closed lets requests through, counting their failures.
+	Closed State = "closed"
+
+	// Open rejects requests with errors.ErrCircuitOpen until the
+	// Cooldown has passed.
+	Open State = "open"
+
+	// HalfOpen lets a single probe request through. If it succeeds the
+	// breaker closes; if it fails the breaker opens again.
+	HalfOpen State = "half-open"
+)
+
+const (
+	DefaultThreshold = 5
+	DefaultWindow    = 30 * time.Second
+	DefaultCooldown  = 10 * time.Second
+)
+
+// Breaker opens after Threshold requests fail within Window, and then
+// rejects requests until Cooldown has passed, when it lets a probe
+// through. A request fails if the issuer could not be reached or answered
+// with 429 or a 5xx status; other responses show that the issuer is up.
+//
+// The zero value is a closed breaker with the default settings. A Breaker
+// is safe for concurrent use, and may be shared by verifiers for the same
+// issuer; its settings must not be changed once it is in use.
+type Breaker struct {
+	// Threshold is how many failures within Window open the breaker. It
+	// defaults to DefaultThreshold.
+	Threshold int
+
+	// Window is how far back failures are counted. It defaults to
+	// DefaultWindow.
+	Window time.Duration
+
+	// Cooldown is how long the breaker stays open before a probe. It
+	// defaults to DefaultCooldown.
+	Cooldown time.Duration
+
+	// Now returns the current time. It defaults to time.Now; tests can
+	// fake it.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	state     State
+	failures  []time.Time
+	openedAt  time.Time
+	probing   bool
+	listeners []func(from State, to State)
+}
+
+// New returns a breaker with the given settings.
+func New(threshold int, window time.Duration, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Window: window, Cooldown: cooldown}
+}
+
+// Notify calls f, synchronously, whenever the breaker changes state.
+func (b *Breaker) Notify(f func(from State, to State)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, f)
+}
+
+// State returns the breaker's state. An open breaker whose Cooldown has
+// passed is reported as open until a request probes the issuer.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current()
+}
+
+// Allow reports whether a request may be made, returning
+// errors.ErrCircuitOpen if not. Every request allowed must be followed by
+// a call to Done with its outcome.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	switch b.current() {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cooldown() {
+			b.mu.Unlock()
+			return errors.ErrCircuitOpen
+		}
+		b.probing = true
+		b.unlockAfter(b.transition(HalfOpen))
+		return nil
+	case HalfOpen:
+		if b.probing {
+			b.mu.Unlock()
+			return errors.ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// Done records the outcome of a request Allow let through.
+func (b *Breaker) Done(failed bool) {
+	b.mu.Lock()
+	now := b.now()
+
+	if b.current() == HalfOpen {
+		b.probing = false
+		if failed {
+			b.openedAt = now
+			b.unlockAfter(b.transition(Open))
+		} else {
+			b.failures = nil
+			b.unlockAfter(b.transition(Closed))
+		}
+		return
+	}
+
+	if !failed {
+		b.mu.Unlock()
+		return
+	}
+
+	// Failures of requests made before the breaker opened are not counted
+	// again.
+	if b.current() == Open {
+		b.mu.Unlock()
+		return
+	}
+
+	recent := b.failures[:0]
+	for _, failure := range b.failures {
+		if now.Sub(failure) < b.window() {
+			recent = append(recent, failure)
+		}
+	}
+	b.failures = append(recent, now)
+
+	if len(b.failures) < b.threshold() {
+		b.mu.Unlock()
+		return
+	}
+	b.failures = nil
+	b.openedAt = now
+	b.unlockAfter(b.transition(Open))
+}
+
+func (b *Breaker) current() State {
+	if b.state == "" {
+		return Closed
+	}
+	return b.state
+}
+
+// transition changes the state and returns the listeners to call, once
+// the lock is released.
+func (b *Breaker) transition(to State) func() {
+	from := b.current()
+	b.state = to
+	listeners := append([]func(State, State){}, b.listeners...)
+	return func() {
+		for _, f := range listeners {
+			f(from, to)
+		}
+	}
+}
+
+func (b *Breaker) unlockAfter(notify func()) {
+	b.mu.Unlock()
+	notify()
+}
+
+func (b *Breaker) now() time.Time {
+	if b.Now == nil {
+		return time.Now()
+	}
+	return b.Now()
+}
+
+func (b *Breaker) threshold() int {
+	if b.Threshold <= 0 {
+		return DefaultThreshold
+	}
+	return b.Threshold
+}
+
+func (b *Breaker) window() time.Duration {
+	if b.Window <= 0 {
+		return DefaultWindow
+	}
+	return b.Window
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return DefaultCooldown
+	}
+	return b.Cooldown
+}
@@ -0,0 +1,176 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package circuit
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestBreaker() (*Breaker, *clock, *[]string) {
+	c := &clock{now: time.Unix(1600000000, 0)}
+	b := New(3, time.Minute, 10*time.Second)
+	b.Now = c.Now
+
+	var changes []string
+	b.Notify(func(from State, to State) {
+		changes = append(changes, string(from)+"->"+string(to))
+	})
+	return b, c, &changes
+}
+
+func fail(t *testing.T, b *Breaker) {
+	t.Helper()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow() refused a request: %s", err)
+	}
+	b.Done(true)
+}
+
+func Test_the_zero_breaker_is_closed(t *testing.T) {
+	var b Breaker
+	if b.State() != Closed {
+		t.Errorf("expected a closed breaker, got %s", b.State())
+	}
+	for i := 0; i < DefaultThreshold-1; i++ {
+		fail(t, &b)
+	}
+	if b.State() != Closed {
+		t.Errorf("the breaker opened before the default threshold")
+	}
+	fail(t, &b)
+	if b.State() != Open {
+		t.Errorf("the breaker did not open at the default threshold")
+	}
+}
+
+func Test_the_breaker_opens_after_threshold_failures_within_the_window(t *testing.T) {
+	b, c, changes := newTestBreaker()
+
+	fail(t, b)
+	fail(t, b)
+	c.advance(2 * time.Minute)
+	fail(t, b)
+	if b.State() != Closed {
+		t.Fatalf("failures outside the window opened the breaker")
+	}
+
+	fail(t, b)
+	b.Allow()
+	b.Done(false)
+	fail(t, b)
+	if b.State() != Open {
+		t.Fatalf("expected the breaker to open, got %s", b.State())
+	}
+	if err := b.Allow(); err != errors.ErrCircuitOpen {
+		t.Errorf("an open breaker returned %v", err)
+	}
+	if len(*changes) != 1 || (*changes)[0] != "closed->open" {
+		t.Errorf("unexpected state changes %v", *changes)
+	}
+}
+
+func Test_a_successful_probe_closes_the_breaker(t *testing.T) {
+	b, c, changes := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		fail(t, b)
+	}
+
+	c.advance(9 * time.Second)
+	if err := b.Allow(); err == nil {
+		t.Fatalf("the breaker allowed a request during the cooldown")
+	}
+
+	c.advance(time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("the breaker refused the probe: %s", err)
+	}
+	if b.State() != HalfOpen {
+		t.Errorf("expected a half-open breaker during the probe, got %s", b.State())
+	}
+	if err := b.Allow(); err != errors.ErrCircuitOpen {
+		t.Errorf("the breaker allowed a second request during the probe")
+	}
+
+	b.Done(false)
+	if b.State() != Closed {
+		t.Errorf("the probe's success did not close the breaker")
+	}
+	expected := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(*changes) != len(expected) {
+		t.Fatalf("unexpected state changes %v", *changes)
+	}
+	for i := range expected {
+		if (*changes)[i] != expected[i] {
+			t.Errorf("unexpected state changes %v", *changes)
+		}
+	}
+}
+
+func Test_a_failed_probe_opens_the_breaker_again(t *testing.T) {
+	b, c, _ := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		fail(t, b)
+	}
+
+	c.advance(10 * time.Second)
+	fail(t, b)
+	if b.State() != Open {
+		t.Fatalf("the probe's failure did not open the breaker, got %s", b.State())
+	}
+
+	c.advance(5 * time.Second)
+	if err := b.Allow(); err == nil {
+		t.Errorf("the cooldown did not restart after the failed probe")
+	}
+}
+
+func Test_only_one_concurrent_request_probes(t *testing.T) {
+	b, c, _ := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		fail(t, b)
+	}
+	c.advance(10 * time.Second)
+
+	var allowed int32
+	done := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		go func() {
+			if b.Allow() == nil {
+				atomic.AddInt32(&allowed, 1)
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		<-done
+	}
+	if allowed != 1 {
+		t.Errorf("expected one probe, %d requests were allowed", allowed)
+	}
+}
@@ -0,0 +1,135 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_the_circuit_breaker_fails_fast_and_probes_after_its_cooldown(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetUnavailable(true)
+
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	var events []CircuitEvent
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithRetry(1, time.Millisecond),
+		WithInitProfile(Lazy()),
+		WithClock(clock),
+		WithCircuitBreaker(2, time.Minute, 10*time.Second),
+		WithHooks(Hooks{OnCircuitStateChange: func(e CircuitEvent) { events = append(events, e) }}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	for i := 0; i < 2; i++ {
+		if _, err := jv.VerifyAccessToken(token); err == nil || goerrors.Is(err, errors.ErrCircuitOpen) {
+			t.Fatalf("expected the unavailable issuer to fail verification %d, got %v", i, err)
+		}
+	}
+	if got := jv.Stats().CircuitState; got != circuit.Open {
+		t.Fatalf("expected the breaker to open, got %q", got)
+	}
+
+	requests := issuer.MetadataRequests()
+	_, err = jv.VerifyAccessToken(token)
+	var unavailable *errors.KeysUnavailable
+	if !goerrors.Is(err, errors.ErrCircuitOpen) || !goerrors.As(err, &unavailable) {
+		t.Errorf("expected the open breaker to fail fast, got %v", err)
+	}
+	if issuer.MetadataRequests() != requests {
+		t.Errorf("the open breaker let a request through")
+	}
+
+	// A failed probe opens the breaker for another cooldown.
+	advance(10 * time.Second)
+	if _, err := jv.VerifyAccessToken(token); err == nil || goerrors.Is(err, errors.ErrCircuitOpen) {
+		t.Fatalf("expected the probe to reach the issuer, got %v", err)
+	}
+	if got := jv.Stats().CircuitState; got != circuit.Open {
+		t.Fatalf("expected the failed probe to open the breaker, got %q", got)
+	}
+
+	issuer.SetUnavailable(false)
+	if _, err := jv.VerifyAccessToken(token); !goerrors.Is(err, errors.ErrCircuitOpen) {
+		t.Errorf("expected the breaker to stay open until the cooldown, got %v", err)
+	}
+
+	advance(10 * time.Second)
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify access_token after the issuer recovered: %s", err)
+	}
+
+	stats := jv.Stats()
+	if stats.CircuitState != circuit.Closed || stats.CircuitOpens != 2 {
+		t.Errorf("expected a closed breaker opened twice, got %q and %d", stats.CircuitState, stats.CircuitOpens)
+	}
+
+	expected := []CircuitEvent{
+		{circuit.Closed, circuit.Open},
+		{circuit.Open, circuit.HalfOpen},
+		{circuit.HalfOpen, circuit.Open},
+		{circuit.Open, circuit.HalfOpen},
+		{circuit.HalfOpen, circuit.Closed},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected state changes %v", events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("unexpected state changes %v", events)
+			break
+		}
+	}
+}
+
+func Test_circuit_breaker_settings_are_validated(t *testing.T) {
+	for _, opt := range []Option{
+		WithCircuitBreaker(0, time.Minute, time.Second),
+		WithCircuitBreaker(5, 0, time.Second),
+		WithCircuitBreaker(5, time.Minute, -time.Second),
+	} {
+		if _, err := NewVerifier("https://golang.oktapreview.com", opt, WithInitProfile(Lazy())); err == nil {
+			t.Errorf("expected an error for invalid circuit breaker settings")
+		}
+	}
+}
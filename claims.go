@@ -0,0 +1,96 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/verify"
+)
+
+// Claims are the decoded claims of a token.
+type Claims = verify.Claims
+
+// temporalClaims are the NumericDate claims the verifier validates.
+var temporalClaims = []string{"exp", "iat", "nbf"}
+
+// canonicalizeTemporalClaims rewrites temporal claims that an adaptor
+// returned as a time.Time, an integer, a json.Number or a numeric string as
+// float64 seconds since the epoch, the form the default adaptor returns.
+// Sub-second precision is truncated. Values that cannot be converted are
+// left in place for the validators to reject as malformed.
+func canonicalizeTemporalClaims(claims map[string]interface{}) {
+	for _, claim := range temporalClaims {
+		v, ok := claims[claim]
+		if !ok || v == nil {
+			continue
+		}
+		if seconds, ok := numericDate(v); ok {
+			claims[claim] = seconds
+		}
+	}
+}
+
+// numericDate converts a temporal claim to whole seconds since the epoch.
+func numericDate(v interface{}) (float64, bool) {
+	var seconds float64
+	switch t := v.(type) {
+	case time.Time:
+		return float64(t.Unix()), true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return 0, false
+		}
+		seconds = f
+	default:
+		f, err := numericValue(v)
+		if err != nil {
+			return 0, false
+		}
+		seconds = f
+	}
+
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, false
+	}
+	return math.Trunc(seconds), true
+}
+
+// The range of float64 values that convert to an int64. Converting values
+// outside it is implementation-specific, and differs between architectures.
+const (
+	minUnixSeconds = -1 << 63
+	maxUnixSeconds = 1 << 63
+)
+
+// unixSeconds returns a canonicalized temporal claim as whole seconds since
+// the epoch. The validators compare these with the current time in int64
+// seconds, without any floating point arithmetic.
+func unixSeconds(claim string, v interface{}) (int64, error) {
+	seconds, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s: malformed, %T is not a numeric date", claim, v)
+	}
+	if !(seconds >= minUnixSeconds && seconds < maxUnixSeconds) {
+		return 0, fmt.Errorf("%s: malformed, %v is out of range", claim, seconds)
+	}
+	return int64(seconds), nil
+}
@@ -0,0 +1,152 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_numeric_dates_are_canonicalized(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected float64
+	}{
+		{float64(1600000000), 1600000000},
+		{1600000000.75, 1600000000},
+		{int64(1600000000), 1600000000},
+		{int(1600000000), 1600000000},
+		{json.Number("1600000000"), 1600000000},
+		{json.Number("1600000000.999"), 1600000000},
+		{time.Unix(1600000000, 999999999), 1600000000},
+		{time.Unix(1600000000, 0).In(time.FixedZone("UTC+2", 7200)), 1600000000},
+		{"1600000000", 1600000000},
+		{"1600000000.5", 1600000000},
+	}
+
+	for _, test := range tests {
+		claims := map[string]interface{}{"exp": test.value, "iat": test.value, "nbf": test.value}
+		canonicalizeTemporalClaims(claims)
+		for _, claim := range temporalClaims {
+			if got, ok := claims[claim].(float64); !ok || got != test.expected {
+				t.Errorf("%s %#v was canonicalized to %#v, expected %v", claim, test.value, claims[claim], test.expected)
+			}
+		}
+	}
+}
+
+func Test_malformed_numeric_dates_are_left_in_place(t *testing.T) {
+	for _, value := range []interface{}{
+		"2020-09-13T12:26:40Z", "", "NaN", "+Inf", true, []interface{}{1.0}, map[string]interface{}{},
+	} {
+		claims := map[string]interface{}{"exp": value}
+		canonicalizeTemporalClaims(claims)
+		if !reflect.DeepEqual(claims["exp"], value) {
+			t.Errorf("%#v was changed to %#v", value, claims["exp"])
+		}
+	}
+
+	claims := map[string]interface{}{"sub": "user@example.com"}
+	canonicalizeTemporalClaims(claims)
+	if _, ok := claims["exp"]; ok {
+		t.Errorf("a missing exp was added")
+	}
+}
+
+// claimsAdaptor skips signature verification and returns a copy of claims
+// with exp and iat replaced.
+type claimsAdaptor struct {
+	claims   map[string]interface{}
+	exp, iat interface{}
+}
+
+func (a claimsAdaptor) New() adaptors.Adaptor { return a }
+
+func (a claimsAdaptor) GetKey(jwkUri string) {}
+
+func (a claimsAdaptor) Decode(jwt string, jwkUri string) (interface{}, error) {
+	claims := map[string]interface{}{}
+	for claim, value := range a.claims {
+		claims[claim] = value
+	}
+	claims["exp"] = a.exp
+	claims["iat"] = a.iat
+	return claims, nil
+}
+
+func Test_adaptors_may_return_numeric_dates_in_other_forms(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	token := issuer.Sign(claims)
+	now := time.Now()
+
+	tests := []struct {
+		exp, iat interface{}
+		err      string
+	}{
+		{now.Add(time.Hour), now, ""},
+		{now.Add(time.Hour).Unix(), json.Number(fmt.Sprint(now.Unix())), ""},
+		{fmt.Sprint(now.Add(time.Hour).Unix()), now.Unix(), ""},
+		{now.Add(-time.Hour), now, "the token is expired"},
+		{now.Add(time.Hour), now.Add(time.Hour), "issued in the future"},
+		{now.Add(time.Hour).Format(time.RFC3339), now, "exp: malformed, string is not a numeric date"},
+		{now.Add(time.Hour), true, "iat: malformed, bool is not a numeric date"},
+		{nil, now, "exp: missing"},
+	}
+
+	for _, test := range tests {
+		jvs := JwtVerifier{
+			Issuer:           issuer.URL,
+			ClaimsToValidate: map[string]string{"aud": "api://default"},
+			Adaptor:          claimsAdaptor{claims: claims, exp: test.exp, iat: test.iat},
+		}
+		jv := jvs.New()
+
+		for name, verify := range map[string]func(string) (*Jwt, error){
+			"access": jv.VerifyAccessToken,
+			"id":     jv.VerifyIdToken,
+		} {
+			jwt, err := verify(token)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("%s token with exp %#v, iat %#v: %s", name, test.exp, test.iat, err)
+					continue
+				}
+				if _, ok := jwt.Claims["exp"].(float64); !ok {
+					t.Errorf("%s token: exp is exposed as %T, expected float64", name, jwt.Claims["exp"])
+				}
+				if _, ok := jwt.Claims["iat"].(float64); !ok {
+					t.Errorf("%s token: iat is exposed as %T, expected float64", name, jwt.Claims["iat"])
+				}
+				continue
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s token with exp %#v, iat %#v: expected an error containing %q, got %v",
+					name, test.exp, test.iat, test.err, err)
+			}
+		}
+	}
+}
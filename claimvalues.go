@@ -0,0 +1,191 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// validateClaimValues checks that claims has each of the expected values,
+// except those of claims marked Advisory in strictness. Claims are checked
+// in name order, and the first mismatch is returned.
+func validateClaimValues(expectedValues map[string]interface{}, claims map[string]interface{}, strictness map[string]Strictness) error {
+	names := make([]string, 0, len(expectedValues))
+	for name := range expectedValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strictness[name] == Advisory {
+			continue
+		}
+		if err := validateClaimValue(name, expectedValues[name], claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateClaimValue(name string, expected interface{}, claims map[string]interface{}) error {
+	actual, ok := claims[name]
+	if !ok {
+		return fmt.Errorf("%s: missing", name)
+	}
+	if !claimValuesEqual(expected, actual) {
+		return fmt.Errorf("%s: %s does not match %s", name, describeClaimValue(actual), describeClaimValue(expected))
+	}
+	return nil
+}
+
+// claimValuesEqual compares two JSON-like values. Numbers are compared by
+// value whatever their Go type, and slices as sets, ignoring order and
+// duplicates. Values of different JSON types are never equal.
+func claimValuesEqual(a interface{}, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if x, ok := claimNumber(a); ok {
+		y, ok := claimNumber(b)
+		return ok && x.Cmp(y) == 0
+	}
+
+	switch x := a.(type) {
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isList(va) && isList(vb):
+		return containsAll(va, vb) && containsAll(vb, va)
+	case isObject(va) && isObject(vb):
+		if va.Len() != vb.Len() {
+			return false
+		}
+		for _, key := range va.MapKeys() {
+			other := vb.MapIndex(reflect.ValueOf(key.String()).Convert(vb.Type().Key()))
+			if !other.IsValid() || !claimValuesEqual(va.MapIndex(key).Interface(), other.Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// containsAll reports whether every element of a is equal to an element of
+// b.
+func containsAll(a reflect.Value, b reflect.Value) bool {
+	for i := 0; i < a.Len(); i++ {
+		found := false
+		for k := 0; k < b.Len() && !found; k++ {
+			found = claimValuesEqual(a.Index(i).Interface(), b.Index(k).Interface())
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func isList(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+}
+
+func isObject(v reflect.Value) bool {
+	return v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String
+}
+
+// claimNumber returns v as an exact number, if it is one. NaN and the
+// infinities are not numbers in JSON.
+func claimNumber(v interface{}) (*big.Float, bool) {
+	if n, ok := v.(json.Number); ok {
+		f, _, err := big.ParseFloat(n.String(), 10, 256, big.ToNearestEven)
+		return f, err == nil
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Float).SetInt64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Float).SetUint64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := value.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return big.NewFloat(f), true
+	}
+	return nil, false
+}
+
+// checkClaimValue returns an error if v cannot be the value of a claim.
+func checkClaimValue(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	switch v.(type) {
+	case bool, string:
+		return nil
+	}
+	if _, ok := claimNumber(v); ok {
+		return nil
+	}
+
+	value := reflect.ValueOf(v)
+	switch {
+	case isList(value):
+		for i := 0; i < value.Len(); i++ {
+			if err := checkClaimValue(value.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case isObject(value):
+		for _, key := range value.MapKeys() {
+			if err := checkClaimValue(value.MapIndex(key).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not a JSON value", describeClaimValue(v))
+}
+
+// describeClaimValue shows a value along with its Go type, so that a 42
+// that is a string can be told from one that is a number.
+func describeClaimValue(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q (string)", s)
+	}
+	return fmt.Sprintf("%v (%T)", v, v)
+}
@@ -0,0 +1,122 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_claim_values_are_compared_by_type(t *testing.T) {
+	tests := []struct {
+		a, b  interface{}
+		equal bool
+	}{
+		{42, 42.0, true},
+		{int64(42), json.Number("42"), true},
+		{uint8(42), float32(42), true},
+		{json.Number("9007199254740993"), json.Number("9007199254740993.0"), true},
+		{json.Number("9007199254740993"), json.Number("9007199254740992"), false},
+		{42, 42.5, false},
+		{42, "42", false},
+		{math.NaN(), math.NaN(), false},
+		{true, true, true},
+		{true, "true", false},
+		{false, nil, false},
+		{nil, nil, true},
+		{"a", "a", true},
+		{[]string{"a", "b"}, []interface{}{"b", "a"}, true},
+		{[]string{"a", "b"}, []interface{}{"a", "b", "b"}, true},
+		{[]string{"a", "b"}, []interface{}{"a"}, false},
+		{[]int{1, 2}, []interface{}{2.0, 1.0}, true},
+		{[]string{"a"}, "a", false},
+		{map[string]interface{}{"id": 9}, map[string]interface{}{"id": 9.0}, true},
+		{map[string]int{"id": 9}, map[string]interface{}{"id": 9.0, "x": 1.0}, false},
+		{map[string]int{"id": 9}, map[string]interface{}{"di": 9.0}, false},
+	}
+
+	for _, test := range tests {
+		if got := claimValuesEqual(test.a, test.b); got != test.equal {
+			t.Errorf("claimValuesEqual(%#v, %#v) returned %v", test.a, test.b, got)
+		}
+		if got := claimValuesEqual(test.b, test.a); got != test.equal {
+			t.Errorf("claimValuesEqual(%#v, %#v) returned %v", test.b, test.a, got)
+		}
+	}
+}
+
+func Test_typed_claims_are_validated(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTypedClaimToValidate("tenant_id", 42),
+		WithTypedClaimToValidate("email_verified", true),
+		WithTypedClaimToValidate("regions", []string{"eu", "us"}),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["tenant_id"] = 42
+	claims["email_verified"] = true
+	claims["regions"] = []string{"us", "eu"}
+	if _, err := jv.VerifyAccessToken(issuer.Sign(claims)); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+	if _, err := jv.VerifyIdToken(issuer.Sign(claims)); err != nil {
+		t.Fatalf("could not verify id_token: %s", err)
+	}
+
+	claims["tenant_id"] = "42"
+	_, err = jv.VerifyAccessToken(issuer.Sign(claims))
+	if err == nil || !strings.Contains(err.Error(), `tenant_id: "42" (string) does not match 42 (int)`) {
+		t.Errorf("expected a tenant_id mismatch, got %v", err)
+	}
+
+	delete(claims, "email_verified")
+	claims["tenant_id"] = 42
+	_, err = jv.VerifyIdToken(issuer.Sign(claims))
+	if err == nil || !strings.Contains(err.Error(), "email_verified: missing") {
+		t.Errorf("expected email_verified to be missing, got %v", err)
+	}
+}
+
+func Test_typed_claim_options_reject_invalid_values(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithTypedClaimToValidate("tenant_id", struct{}{})},
+		{WithTypedClaimToValidate("tenant_id", []interface{}{math.Inf(1)})},
+		{WithTypedClaimToValidate("tenant_id", 42), WithTypedClaimToValidate("tenant_id", 43)},
+	} {
+		if _, err := NewVerifier("https://golang.oktapreview.com", opts...); err == nil {
+			t.Errorf("expected an error for %d options", len(opts))
+		}
+	}
+
+	if _, err := NewVerifier("https://golang.oktapreview.com",
+		WithTypedClaimToValidate("tenant_id", 42),
+		WithTypedClaimToValidate("tenant_id", 42.0)); err != nil {
+		t.Errorf("setting a claim twice to the same number returned an error: %s", err)
+	}
+}
@@ -0,0 +1,54 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import "time"
+
+// The Acceptable functions are the verifier's checks of the exp, iat and nbf
+// claims, for code that wants to apply the same rules to other timestamps.
+//
+// Times are compared in whole seconds, as JWT numeric dates are: each time
+// is truncated to the second it falls in (t.Unix()), and leeway to whole
+// seconds. A negative leeway is treated as zero. The boundaries are
+// inclusive, so with no leeway a token is still accepted during the second
+// its exp names, and is already accepted during the second its iat or nbf
+// names.
+
+// AcceptableExpiry reports whether a token expiring at exp is still valid
+// at now: exp is no earlier than leeway before now.
+func AcceptableExpiry(exp time.Time, now time.Time, leeway time.Duration) bool {
+	return exp.Unix() >= now.Unix()-leewaySeconds(leeway)
+}
+
+// AcceptableIssuedAt reports whether a token issued at iat may be used at
+// now: iat is no later than leeway after now.
+func AcceptableIssuedAt(iat time.Time, now time.Time, leeway time.Duration) bool {
+	return iat.Unix() <= now.Unix()+leewaySeconds(leeway)
+}
+
+// AcceptableNotBefore reports whether a token not valid before nbf may be
+// used at now. It is the same check as AcceptableIssuedAt.
+func AcceptableNotBefore(nbf time.Time, now time.Time, leeway time.Duration) bool {
+	return AcceptableIssuedAt(nbf, now, leeway)
+}
+
+func leewaySeconds(leeway time.Duration) int64 {
+	if leeway < 0 {
+		return 0
+	}
+	return int64(leeway / time.Second)
+}
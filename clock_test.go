@@ -0,0 +1,275 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+var fixedNow = time.Unix(1600000000, 0)
+
+func fixedClockVerifier() *JwtVerifier {
+	return clockVerifier(fixedNow)
+}
+
+func clockVerifier(now time.Time) *JwtVerifier {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+		Now:    func() time.Time { return now },
+	}
+	return jvs.New()
+}
+
+func Test_exp_boundaries(t *testing.T) {
+	jv := fixedClockVerifier()
+	now, leeway := fixedNow.Unix(), jv.leeway
+
+	tests := []struct {
+		name  string
+		exp   int64
+		valid bool
+	}{
+		{"exp in the future", now + 1, true},
+		{"exp == now", now, true},
+		{"exp == now - leeway", now - leeway, true},
+		{"exp == now - leeway - 1", now - leeway - 1, false},
+	}
+
+	for _, test := range tests {
+		err := jv.validateExp(float64(test.exp), jv.now())
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid=%v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func Test_iat_boundaries(t *testing.T) {
+	jv := fixedClockVerifier()
+	now, leeway := fixedNow.Unix(), jv.leeway
+
+	tests := []struct {
+		name  string
+		iat   int64
+		valid bool
+	}{
+		{"iat in the past", now - 1, true},
+		{"iat == now", now, true},
+		{"iat == now + leeway", now + leeway, true},
+		{"iat == now + leeway + 1", now + leeway + 1, false},
+	}
+
+	for _, test := range tests {
+		err := jv.validateIat(float64(test.iat), jv.now())
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid=%v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func Test_max_token_age_boundaries(t *testing.T) {
+	jv := fixedClockVerifier()
+	jv.MaxTokenAge = 15 * time.Minute
+	now, maxAge := fixedNow.Unix(), int64(15*60)+jv.leeway
+
+	tests := []struct {
+		name  string
+		iat   interface{}
+		valid bool
+	}{
+		{"iat == now", float64(now), true},
+		{"iat == now - max age - leeway", float64(now - maxAge), true},
+		{"iat == now - max age - leeway - 1", float64(now - maxAge - 1), false},
+		{"missing iat", nil, true},
+	}
+
+	for _, test := range tests {
+		err := jv.validateMaxAge(test.iat, jv.MaxTokenAge, jv.now())
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid=%v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func Test_zero_leeway_boundaries(t *testing.T) {
+	jv := fixedClockVerifier()
+	jv.SetLeeway("0s")
+	now := fixedNow.Unix()
+
+	if err := jv.validateExp(float64(now), jv.now()); err != nil {
+		t.Errorf("exp == now must be valid without leeway: %s", err)
+	}
+	if err := jv.validateExp(float64(now-1), jv.now()); err == nil {
+		t.Errorf("exp == now - 1 must be expired without leeway")
+	}
+	if err := jv.validateIat(float64(now+1), jv.now()); err == nil {
+		t.Errorf("iat == now + 1 must be in the future without leeway")
+	}
+}
+
+// Temporal validation is done in int64 seconds, so it must not change
+// around the limits of int32 or of float64 precision, whatever GOARCH is.
+// The test values are int64 by construction and given to the validators
+// as float64 and json.Number, as adaptors return them.
+func Test_temporal_boundaries_are_exact_on_every_architecture(t *testing.T) {
+	instants := []int64{
+		math.MaxInt32 - 1,
+		math.MaxInt32,
+		math.MaxInt32 + 1, // 2038-01-19T03:14:08Z
+		math.MaxUint32,
+		time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC).Unix(),
+		1 << 40,
+	}
+
+	for _, now := range instants {
+		jv := clockVerifier(time.Unix(now, 0))
+		leeway := jv.leeway
+
+		tests := []struct {
+			name     string
+			validate func(interface{}, time.Time) error
+			value    int64
+			valid    bool
+		}{
+			{"exp == now - leeway", jv.validateExp, now - leeway, true},
+			{"exp == now - leeway - 1", jv.validateExp, now - leeway - 1, false},
+			{"iat == now + leeway", jv.validateIat, now + leeway, true},
+			{"iat == now + leeway + 1", jv.validateIat, now + leeway + 1, false},
+			{"nbf == now + leeway", jv.validateNbf, now + leeway, true},
+			{"nbf == now + leeway + 1", jv.validateNbf, now + leeway + 1, false},
+		}
+
+		for _, test := range tests {
+			for _, value := range []interface{}{
+				float64(test.value),
+				json.Number(strconv.FormatInt(test.value, 10)),
+				time.Unix(test.value, 999999999),
+			} {
+				claims := map[string]interface{}{"exp": value}
+				canonicalizeTemporalClaims(claims)
+
+				err := test.validate(claims["exp"], jv.now())
+				if (err == nil) != test.valid {
+					t.Errorf("now %d, %s, as %T: expected valid=%v, got %v", now, test.name, value, test.valid, err)
+				}
+			}
+		}
+	}
+}
+
+func Test_numeric_dates_outside_int64_are_malformed(t *testing.T) {
+	jv := fixedClockVerifier()
+
+	for _, value := range []float64{1e19, -1e19, math.MaxInt64} {
+		err := jv.validateExp(value, jv.now())
+		if err == nil || !strings.Contains(err.Error(), "exp: malformed") {
+			t.Errorf("exp %v: expected a malformed error, got %v", value, err)
+		}
+	}
+
+	if err := jv.validateExp(float64(1<<62), jv.now()); err != nil {
+		t.Errorf("exp 2^62 is in range, got %v", err)
+	}
+}
+
+func Test_the_clock_drives_verification(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var events []NearExpiryEvent
+	now := time.Now()
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithLeeway(0),
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jv.NearExpiryThreshold = time.Minute
+	jv.Hooks.OnNearExpiry = func(e NearExpiryEvent) { events = append(events, e) }
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	now = now.Add(59 * time.Minute)
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify access_token before it expired: %s", err)
+	}
+	if len(events) != 1 || events[0].Remaining > time.Minute {
+		t.Errorf("expected a near expiry event from the injected clock, got %v", events)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := jv.VerifyAccessToken(token); err == nil {
+		t.Errorf("verified an access_token the clock says has expired")
+	}
+}
+
+func Test_acceptable_boundaries_are_symmetric(t *testing.T) {
+	property := func(nowSeconds int32, leewaySeconds uint16) bool {
+		now := time.Unix(int64(nowSeconds), 0)
+		leeway := time.Duration(leewaySeconds) * time.Second
+		earliest := now.Add(-leeway)
+		latest := now.Add(leeway)
+
+		return AcceptableExpiry(earliest, now, leeway) &&
+			!AcceptableExpiry(earliest.Add(-time.Second), now, leeway) &&
+			AcceptableIssuedAt(latest, now, leeway) &&
+			!AcceptableIssuedAt(latest.Add(time.Second), now, leeway) &&
+			AcceptableNotBefore(latest, now, leeway) &&
+			!AcceptableNotBefore(latest.Add(time.Second), now, leeway)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_acceptable_is_monotonic_in_leeway(t *testing.T) {
+	property := func(nowSeconds int32, offset int32, leeway uint16, extra uint16) bool {
+		now := time.Unix(int64(nowSeconds), 0)
+		at := now.Add(time.Duration(offset) * time.Millisecond)
+		small := time.Duration(leeway) * time.Millisecond
+		large := small + time.Duration(extra)*time.Millisecond
+
+		return (!AcceptableExpiry(at, now, small) || AcceptableExpiry(at, now, large)) &&
+			(!AcceptableIssuedAt(at, now, small) || AcceptableIssuedAt(at, now, large)) &&
+			(!AcceptableNotBefore(at, now, small) || AcceptableNotBefore(at, now, large))
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_acceptable_compares_whole_seconds(t *testing.T) {
+	now := fixedNow.Add(900 * time.Millisecond)
+
+	if !AcceptableExpiry(fixedNow, now, 0) || !AcceptableIssuedAt(now.Add(50*time.Millisecond), now, 0) {
+		t.Errorf("expected times within the same second as now to be acceptable")
+	}
+	if AcceptableExpiry(fixedNow.Add(-time.Millisecond), now, 999*time.Millisecond) {
+		t.Errorf("expected a sub-second leeway to be truncated to zero")
+	}
+	if !AcceptableExpiry(fixedNow, now, -time.Hour) || AcceptableExpiry(fixedNow.Add(-time.Second), now, -time.Hour) {
+		t.Errorf("expected a negative leeway to be treated as zero")
+	}
+}
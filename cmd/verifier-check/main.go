@@ -0,0 +1,56 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Command verifier-check checks that the issuers listed in a configuration
+// file still behave as the verifier expects, and prints a JSON report. It
+// exits with 1 if a check failed and 2 if the configuration is invalid, so
+// that it can run on a schedule and alert on drift.
+//
+//	verifier-check -config verifier-check.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/okta/okta-jwt-verifier-golang/checker"
+)
+
+func main() {
+	configPath := flag.String("config", "verifier-check.json", "the JSON configuration file")
+	flag.Parse()
+
+	config, err := checker.LoadConfigFile(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "verifier-check:", err)
+		os.Exit(2)
+	}
+
+	report := checker.Run(context.Background(), config)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintln(os.Stderr, "verifier-check:", err)
+		os.Exit(2)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
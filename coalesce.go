@@ -0,0 +1,89 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// decodeGroup coalesces concurrent decodes of the same token so that only
+// one of them performs the signature verification.
+type decodeGroup struct {
+	mu    sync.Mutex
+	calls map[[sha256.Size]byte]*decodeCall
+}
+
+type decodeCall struct {
+	wg      sync.WaitGroup
+	waiters int
+	claims  interface{}
+	err     error
+}
+
+func newDecodeGroup() *decodeGroup {
+	return &decodeGroup{calls: map[[sha256.Size]byte]*decodeCall{}}
+}
+
+// do runs decode for the token unless a decode of the same token is already
+// in flight, in which case it waits for and shares that result. Claim maps
+// are copied when shared, so callers cannot observe each other's changes.
+func (g *decodeGroup) do(jwt string, decode func() (interface{}, error)) (interface{}, error) {
+	key := sha256.Sum256([]byte(jwt))
+
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		g.mu.Unlock()
+		call.wg.Wait()
+		return copyClaims(call.claims), call.err
+	}
+	call := &decodeCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.claims, call.err = decode()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	shared := call.waiters > 0
+	g.mu.Unlock()
+
+	// Once the call is removed no more waiters can join, so without any
+	// the result is not shared and needs no copy. The copy is made before
+	// Done, while no waiter can read the claims yet.
+	claims := call.claims
+	if shared {
+		claims = copyClaims(call.claims)
+	}
+	call.wg.Done()
+
+	return claims, call.err
+}
+
+func tokenHash(jwt string) string {
+	sum := sha256.Sum256([]byte(jwt))
+	return hex.EncodeToString(sum[:])
+}
+
+// copyClaims deep copies claims, so that verifications sharing a decode
+// share no maps or slices.
+func copyClaims(claims interface{}) interface{} {
+	return copyValue(claims)
+}
@@ -0,0 +1,113 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+type countingAdaptor struct {
+	calls   *int32
+	release chan struct{}
+	claims  map[string]interface{}
+}
+
+func (a countingAdaptor) New() adaptors.Adaptor {
+	return a
+}
+
+func (a countingAdaptor) GetKey(jwkUri string) {}
+
+func (a countingAdaptor) Decode(jwt string, jwkUri string) (interface{}, error) {
+	atomic.AddInt32(a.calls, 1)
+	<-a.release
+	return a.claims, nil
+}
+
+func Test_concurrent_verifications_of_the_same_token_share_one_decode(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["exp"] = float64(time.Now().Add(time.Hour).Unix())
+	claims["iat"] = float64(time.Now().Unix())
+	token := issuer.Sign(claims)
+
+	var calls int32
+	adaptor := countingAdaptor{calls: &calls, release: make(chan struct{}), claims: claims}
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Adaptor:          adaptor,
+	}
+
+	jv := jvs.New()
+
+	// Warm the metadata cache so every goroutine reaches the decode step.
+	if _, err := jv.getMetaData(context.Background()); err != nil {
+		t.Fatalf("could not fetch metadata: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan *Jwt, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jwt, err := jv.VerifyAccessToken(token)
+			if err != nil {
+				t.Errorf("could not verify access_token: %s", err)
+			}
+			results <- jwt
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(adaptor.release)
+	wg.Wait()
+	close(results)
+
+	if calls != 1 {
+		t.Errorf("expected 1 decode for 20 concurrent verifications, got %d", calls)
+	}
+
+	// Each caller receives its own claims map.
+	for jwt := range results {
+		if jwt != nil {
+			jwt.Claims["sub"] = "changed"
+		}
+	}
+	if claims["sub"] == "changed" {
+		t.Errorf("callers share the decoded claims map")
+	}
+
+	// Once the first decode completes, later verifications decode again.
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Errorf("could not verify access_token: %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected a new decode after the first completed, got %d decodes", calls)
+	}
+}
@@ -0,0 +1,229 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier_test
+
+// The tests in this file pin the 1.x API exactly as existing services use
+// it: a JwtVerifier struct literal, New(), SetLeeway() and the Verify
+// methods, along with the error prefixes and the *Jwt returned alongside
+// claim validation errors. Changes that break them break our users.
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_compat_access_token_verifies_through_the_struct_literal_api(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["cid"] = "client123"
+	token := issuer.Sign(claims)
+
+	toValidate := map[string]string{}
+	toValidate["aud"] = "api://default"
+	toValidate["cid"] = "client123"
+
+	jwtVerifierSetup := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: toValidate,
+	}
+
+	verifier := jwtVerifierSetup.New()
+
+	jwt, err := verifier.VerifyAccessToken(token)
+	if err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	if jwt.Claims["iss"] != issuer.URL {
+		t.Errorf("expected iss claim %s, got %v", issuer.URL, jwt.Claims["iss"])
+	}
+
+	if _, ok := jwt.Claims["exp"].(float64); !ok {
+		t.Errorf("expected exp claim to be a float64, got %T", jwt.Claims["exp"])
+	}
+
+	var field interface{} = jwt.Claims
+	if _, ok := field.(map[string]interface{}); !ok {
+		t.Errorf("expected Claims to be a map[string]interface{}, got %T", jwt.Claims)
+	}
+}
+
+func Test_compat_access_token_verifies_without_cid(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	toValidate := map[string]string{}
+	toValidate["aud"] = "api://default"
+
+	jv := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: toValidate,
+	}
+
+	if _, err := jv.New().VerifyAccessToken(token); err != nil {
+		t.Errorf("could not verify access_token: %s", err)
+	}
+}
+
+func Test_compat_id_token_verifies_with_nonce(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("client123")
+	claims["nonce"] = "abc123"
+	token := issuer.Sign(claims)
+
+	toValidate := map[string]string{}
+	toValidate["aud"] = "client123"
+	toValidate["nonce"] = "abc123"
+
+	jv := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: toValidate,
+	}
+
+	jwt, err := jv.New().VerifyIdToken(token)
+	if err != nil {
+		t.Fatalf("could not verify id_token: %s", err)
+	}
+
+	if jwt.Claims["nonce"] != "abc123" {
+		t.Errorf("expected nonce claim abc123, got %v", jwt.Claims["nonce"])
+	}
+}
+
+func Test_compat_claim_errors_return_the_decoded_jwt(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	token := issuer.Sign(issuer.Claims("api://other"))
+
+	toValidate := map[string]string{}
+	toValidate["aud"] = "api://default"
+
+	jv := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: toValidate,
+	}
+
+	jwt, err := jv.New().VerifyAccessToken(token)
+	if err == nil {
+		t.Fatalf("expected an audience error")
+	}
+
+	if !strings.HasPrefix(err.Error(), "the `Audience` was not able to be validated.") {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if jwt == nil || jwt.Claims["aud"] != "api://other" {
+		t.Errorf("expected the decoded token to be returned alongside the error, got %v", jwt)
+	}
+
+	jwt, err = jv.New().VerifyIdToken(token)
+	if err == nil || !strings.HasPrefix(err.Error(), "the `Audience` was not able to be validated.") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if jwt == nil {
+		t.Errorf("expected the decoded id token to be returned alongside the error")
+	}
+}
+
+func Test_compat_expired_tokens_respect_set_leeway(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["exp"] = time.Now().Unix() - 60
+	token := issuer.Sign(claims)
+
+	toValidate := map[string]string{}
+	toValidate["aud"] = "api://default"
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: toValidate,
+	}
+
+	verifier := jvs.New()
+
+	// The default two minute leeway accepts a token that expired a minute ago.
+	if _, err := verifier.VerifyAccessToken(token); err != nil {
+		t.Errorf("expected token to be accepted within the default leeway: %s", err)
+	}
+
+	verifier.SetLeeway("0s")
+
+	jwt, err := verifier.VerifyAccessToken(token)
+	if err == nil || !strings.HasPrefix(err.Error(), "the `Expiration` was not able to be validated.") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if jwt == nil {
+		t.Errorf("expected the decoded token to be returned alongside the error")
+	}
+}
+
+func Test_compat_malformed_tokens_return_nil_jwt(t *testing.T) {
+	jvs := jwtverifier.JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+	}
+
+	jwt, err := jvs.New().VerifyAccessToken("aa")
+	if err == nil || !strings.HasPrefix(err.Error(), "token is not valid: ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if jwt != nil {
+		t.Errorf("expected a nil Jwt for a malformed token")
+	}
+
+	_, err = jvs.New().VerifyAccessToken("")
+	if err == nil || err.Error() != "token is not valid: you must provide a jwt to verify" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_compat_signature_errors_return_nil_jwt(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))
+
+	jv := jwtverifier.JwtVerifier{
+		Issuer: issuer.URL,
+	}
+
+	jwt, err := jv.New().VerifyAccessToken(tampered)
+	if err == nil || !strings.HasPrefix(err.Error(), "could not decode token: ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if jwt != nil {
+		t.Errorf("expected a nil Jwt for a token with an invalid signature")
+	}
+}
@@ -0,0 +1,81 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+// Run with -race to check the concurrency contract documented on JwtVerifier.
+func Test_a_single_verifier_can_be_used_from_many_goroutines(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["nonce"] = "abc123"
+	valid := issuer.Sign(claims)
+	wrongAudience := issuer.Sign(issuer.Claims("api://other"))
+
+	toValidate := map[string]string{"aud": "api://default", "nonce": "abc123"}
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: toValidate,
+	}
+
+	jv := jvs.New()
+
+	// Changing the caller's map after New must not affect the verifier.
+	toValidate["aud"] = "api://other"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 300)
+	for i := 0; i < 100; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := jv.VerifyAccessToken(valid)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := jv.VerifyIdToken(valid)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := jv.VerifyAccessToken(wrongAudience); err == nil {
+				t.Errorf("a token for the wrong audience was accepted")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("verification failed under concurrent use: %s", err)
+		}
+	}
+
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("expected the metadata and keys to be fetched once, got %d and %d",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+}
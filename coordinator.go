@@ -0,0 +1,68 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DistributedCoordinator lets verifiers in many processes agree on which of
+// them refreshes the discovery document and key set, so an issuer is not
+// hit by every process at once. It is consulted before each background
+// refresh; a verifier that does not acquire the key skips the refresh and
+// reads the copy the winner stores in the shared Cache.
+//
+// A coordinator is only useful together with a Cache shared by the same
+// processes. Without one, the processes that skip refreshing keep their own
+// copies until they expire and are then fetched on demand.
+type DistributedCoordinator interface {
+	// TryAcquire reports whether the caller holds key for ttl. An error is
+	// treated as acquired, so that refreshes continue when the coordinator
+	// is down.
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// MemoryCoordinator is an in-process DistributedCoordinator, for tests and
+// for several verifiers in one process sharing a Cache.
+type MemoryCoordinator struct {
+	mu   sync.Mutex
+	held map[string]time.Time
+}
+
+func NewMemoryCoordinator() *MemoryCoordinator {
+	return &MemoryCoordinator{held: map[string]time.Time{}}
+}
+
+func (c *MemoryCoordinator) TryAcquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := c.held[key]; ok && now.Before(until) {
+		return false, nil
+	}
+	c.held[key] = now.Add(ttl)
+	return true, nil
+}
+
+// refreshLockKey is the coordinator key for refreshing the issuer whose
+// discovery document is at metaDataUrl.
+func refreshLockKey(metaDataUrl string) string {
+	return "jwtverifier:refresh:" + metaDataUrl
+}
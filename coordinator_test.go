@@ -0,0 +1,114 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+type failingCoordinator struct{}
+
+func (failingCoordinator) TryAcquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return false, goerrors.New("coordinator unreachable")
+}
+
+func Test_only_the_coordinator_winner_refreshes(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	shared := cache.NewMemory()
+	coordinator := NewMemoryCoordinator()
+
+	newVerifier := func() *JwtVerifier {
+		jv, err := NewVerifier(issuer.URL,
+			WithClaimToValidate("aud", "api://default"),
+			WithCache(shared),
+			WithCoordinator(coordinator))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return jv
+	}
+	a, b := newVerifier(), newVerifier()
+
+	a.refresh(time.Hour)
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Fatalf("expected the first verifier to refresh, got %d metadata and %d JWKS requests",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+
+	b.refresh(time.Hour)
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("the second verifier refreshed while the first held the lock")
+	}
+
+	if _, err := b.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("the second verifier did not use the shared cache")
+	}
+}
+
+func Test_refresh_continues_when_the_coordinator_fails(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	log := &recordingLogger{}
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithCoordinator(failingCoordinator{}),
+		WithLogger(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jv.refresh(time.Hour)
+	if issuer.MetadataRequests() != 1 {
+		t.Errorf("expected a refresh despite the coordinator error")
+	}
+	if !log.contains("coordinator unreachable") {
+		t.Errorf("the coordinator error was not logged")
+	}
+}
+
+func Test_memory_coordinator_releases_after_ttl(t *testing.T) {
+	c := NewMemoryCoordinator()
+	ctx := context.Background()
+
+	if ok, _ := c.TryAcquire(ctx, "k", 20*time.Millisecond); !ok {
+		t.Fatalf("could not acquire a free key")
+	}
+	if ok, _ := c.TryAcquire(ctx, "k", 20*time.Millisecond); ok {
+		t.Errorf("acquired a key that was already held")
+	}
+	if ok, _ := c.TryAcquire(ctx, "other", 20*time.Millisecond); !ok {
+		t.Errorf("could not acquire a different key")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := c.TryAcquire(ctx, "k", 20*time.Millisecond); !ok {
+		t.Errorf("the key was not released after its ttl")
+	}
+}
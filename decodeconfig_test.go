@@ -0,0 +1,113 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+// configAdaptor records the DecodeConfig it is called with.
+type configAdaptor struct {
+	config *adaptors.DecodeConfig
+	claims map[string]interface{}
+}
+
+func (a configAdaptor) New() adaptors.Adaptor { return a }
+
+func (a configAdaptor) GetKey(jwkUri string) {}
+
+func (a configAdaptor) Decode(jwt string, jwkUri string) (interface{}, error) {
+	panic("Decode was called on an adaptor implementing ConfigDecoder")
+}
+
+func (a configAdaptor) DecodeWithConfig(ctx context.Context, jwt string, config adaptors.DecodeConfig) (map[string]interface{}, error) {
+	*a.config = config
+	return a.claims, nil
+}
+
+// payloadAdaptor is an adaptor written before ConfigDecoder that returns
+// whatever payload it is given.
+type payloadAdaptor struct {
+	payload interface{}
+}
+
+func (a payloadAdaptor) New() adaptors.Adaptor { return a }
+
+func (a payloadAdaptor) GetKey(jwkUri string) {}
+
+func (a payloadAdaptor) Decode(jwt string, jwkUri string) (interface{}, error) {
+	return a.payload, nil
+}
+
+func Test_config_decoders_receive_the_resolved_configuration(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	c := cache.NewMemory()
+	var config adaptors.DecodeConfig
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Adaptor:          configAdaptor{config: &config, claims: claims},
+		Cache:            c,
+		RequestTimeout:   5 * time.Second,
+	}
+	jv := jvs.New()
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(claims)); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	if config.JWKSURI != issuer.URL+"/v1/keys" || config.KeyID != issuer.KeyID() {
+		t.Errorf("unexpected jwks_uri %q and kid %q", config.JWKSURI, config.KeyID)
+	}
+	if config.Cache != c || config.RequestTimeout != 5*time.Second {
+		t.Errorf("the verifier's cache and timeout were not passed on")
+	}
+	if !reflect.DeepEqual(config.Algorithms, DefaultAllowedAlgorithms) {
+		t.Errorf("expected the default algorithms, got %v", config.Algorithms)
+	}
+}
+
+func Test_legacy_adaptors_must_return_an_object(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Adaptor:          payloadAdaptor{payload: claims},
+		Cache:            cache.NewMemory(),
+	}
+	if _, err := jvs.New().VerifyAccessToken(issuer.Sign(claims)); err != nil {
+		t.Fatalf("could not verify access_token with a legacy adaptor: %s", err)
+	}
+
+	jvs.Adaptor = payloadAdaptor{payload: []interface{}{"not", "claims"}}
+	if _, err := jvs.New().VerifyAccessToken(issuer.Sign(claims)); err == nil {
+		t.Errorf("expected an error for a payload that is not an object")
+	}
+}
@@ -0,0 +1,149 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/segment"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+// DegradedReason explains why VerifyDegraded returned unverified claims.
+type DegradedReason string
+
+const (
+	// NotDegraded means the token was fully verified.
+	NotDegraded DegradedReason = ""
+
+	// DegradedKeysUnavailable means the issuer's discovery document or key
+	// set could not be fetched, so the signature was not checked.
+	DegradedKeysUnavailable DegradedReason = "keys_unavailable"
+)
+
+// VerifyDegraded verifies an access token like VerifyAccessToken. If that
+// fails only because the issuer's keys cannot be fetched, and the verifier
+// was built with EnableDegradedMode, it instead returns the token's claims
+// without checking the signature. The claims are still validated, and the
+// returned Jwt has Unverified set and the reason is DegradedKeysUnavailable.
+//
+// Unverified claims can be forged by anyone. They must only be used where
+// that is acceptable, such as read-only access during an issuer outage.
+// Invalid signatures, unknown keys and claim failures are never degraded,
+// and neither is any token while the issuer's key set is cached: a kid
+// that is not in the cached key set fails with errors.KeyNotFound even if
+// the key set cannot be refreshed.
+//
+// Hooks.OnVerification reports a token returned unverified as a failure
+// with Degraded set, and Stats counts it as Rejected and Degraded.
+func (j *JwtVerifier) VerifyDegraded(ctx context.Context, jwt string) (*Jwt, DegradedReason, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, NotDegraded, err
+	}
+
+	ctx, end := j.startVerification(ctx, tracing.SpanVerifyAccessToken, "VerifyDegraded")
+	myJwt, err := j.verifyAccessToken(ctx, jwt, verifyCall{})
+	myJwt, reason, err := j.degrade(ctx, jwt, myJwt, err)
+	end(myJwt, err)
+	j.recordVerification(err)
+
+	if reason != NotDegraded {
+		j.recordDegraded()
+		j.log().Warn("returning unverified claims", "reason", string(reason), "error", err.Error())
+		return myJwt, reason, nil
+	}
+	if err != nil {
+		j.log().Debug("access token verification failed", "error", err.Error())
+	}
+	return myJwt, NotDegraded, err
+}
+
+// degrade returns the unverified claims of a token whose verification
+// failed with err only because the keys are unavailable, along with err
+// and the reason. Otherwise it returns myJwt and err, or the claims
+// failure.
+func (j *JwtVerifier) degrade(ctx context.Context, jwt string, myJwt *Jwt, err error) (*Jwt, DegradedReason, error) {
+	var unavailable *errors.KeysUnavailable
+	if err == nil || !j.EnableDegradedMode || !goerrors.As(err, &unavailable) {
+		return myJwt, NotDegraded, err
+	}
+
+	// Adaptors other than the default may report a failed refresh for an
+	// unknown kid as an outage. With a key set at hand, the token could have
+	// been checked, so it is not let through.
+	if j.keySetCached() {
+		return nil, NotDegraded, err
+	}
+
+	// The header passed parseJwt in verifyAccessToken.
+	header, _ := j.parseJwt(jwt)
+
+	token, claimsErr := unverifiedClaims(header)
+	if claimsErr != nil {
+		return nil, NotDegraded, err
+	}
+
+	degraded, claimsErr := j.validateAccessTokenClaims(ctx, jwt, header, token, verifyCall{})
+	if claimsErr != nil {
+		return degraded, NotDegraded, claimsErr
+	}
+
+	degraded.Unverified = true
+	return degraded, DegradedKeysUnavailable, err
+}
+
+// keySetCached reports whether the issuer's key set, or a local key set,
+// is available without fetching anything.
+func (j *JwtVerifier) keySetCached() bool {
+	if j.LocalKeys != nil {
+		return true
+	}
+
+	c := j.documents()
+	body, found := c.Get(cache.MetadataKey(j.metaDataUrl()))
+	if !found {
+		return false
+	}
+	md, err := decodeMetaData(j.metaDataUrl(), body)
+	if err != nil {
+		return false
+	}
+	jwksUri, _ := md["jwks_uri"].(string)
+	_, found = c.Get(cache.KeySetKey(jwksUri))
+	return found
+}
+
+// unverifiedClaims decodes the payload of a token that has passed
+// parseJwt, without verifying it.
+func unverifiedClaims(header jwtHeader) (map[string]interface{}, error) {
+	payload, _, err := segment.DecodeLenient(header.segments[1])
+	if err != nil {
+		return nil, fmt.Errorf("the tokens payload does not appear to be a base64 encoded string")
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims == nil {
+		return nil, fmt.Errorf("the tokens payload is not a json object")
+	}
+
+	return claims, nil
+}
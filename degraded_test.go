@@ -0,0 +1,264 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier_test
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func degradedVerifier(issuer *testissuer.Issuer, enabled bool) *jwtverifier.JwtVerifier {
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:             issuer.URL,
+		ClaimsToValidate:   map[string]string{"aud": "api://default"},
+		EnableDegradedMode: enabled,
+	}
+	return jvs.New()
+}
+
+func Test_degraded_mode_is_not_reached_when_keys_are_available(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	valid := issuer.Sign(issuer.Claims("api://default"))
+
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))
+
+	unknownKid := issuer.SignWithHeader(map[string]interface{}{
+		"alg": "RS256",
+		"kid": "unknown",
+	}, issuer.Claims("api://default"))
+
+	expiredClaims := issuer.Claims("api://default")
+	expiredClaims["exp"] = time.Now().Unix() - 3600
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"invalid signature", tampered, true},
+		{"unknown kid", unknownKid, true},
+		{"wrong audience", issuer.Sign(issuer.Claims("api://other")), true},
+		{"expired", issuer.Sign(expiredClaims), true},
+		{"malformed", "aa.aa", true},
+	}
+
+	jv := degradedVerifier(issuer, true)
+
+	for _, test := range tests {
+		jwt, reason, err := jv.VerifyDegraded(context.Background(), test.token)
+		if reason != jwtverifier.NotDegraded {
+			t.Errorf("%s: expected no degradation, got %q", test.name, reason)
+		}
+		if jwt != nil && jwt.Unverified {
+			t.Errorf("%s: the token was marked unverified", test.name)
+		}
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+	}
+}
+
+func Test_degraded_mode_returns_unverified_claims_when_keys_are_unavailable(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetJWKSUnavailable(true)
+
+	jv := degradedVerifier(issuer, true)
+
+	jwt, reason, err := jv.VerifyDegraded(context.Background(), issuer.Sign(issuer.Claims("api://default")))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if reason != jwtverifier.DegradedKeysUnavailable || !jwt.Unverified {
+		t.Errorf("expected an unverified token, got reason %q and Unverified %v", reason, jwt.Unverified)
+	}
+
+	if sub, _ := jwt.Subject(); sub != "user@example.com" {
+		t.Errorf("expected the subject to be returned, got %q", sub)
+	}
+}
+
+func Test_degraded_mode_still_validates_claims(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetJWKSUnavailable(true)
+
+	expired := issuer.Claims("api://default")
+	expired["exp"] = time.Now().Unix() - 3600
+
+	jv := degradedVerifier(issuer, true)
+
+	for name, token := range map[string]string{
+		"expired":        issuer.Sign(expired),
+		"wrong audience": issuer.Sign(issuer.Claims("api://other")),
+	} {
+		jwt, reason, err := jv.VerifyDegraded(context.Background(), token)
+		if err == nil || reason != jwtverifier.NotDegraded {
+			t.Errorf("%s: expected the token to be rejected, got reason %q and error %v", name, reason, err)
+		}
+		if jwt != nil && jwt.Unverified {
+			t.Errorf("%s: a rejected token was marked unverified", name)
+		}
+	}
+}
+
+func Test_degraded_mode_requires_opt_in(t *testing.T) {
+	issuer := testissuer.New()
+	issuer.Close()
+
+	jv := degradedVerifier(issuer, false)
+
+	jwt, reason, err := jv.VerifyDegraded(context.Background(), issuer.Sign(issuer.Claims("api://default")))
+	if err == nil || jwt != nil || reason != jwtverifier.NotDegraded {
+		t.Errorf("expected an error without degraded mode, got %v, %q, %v", jwt, reason, err)
+	}
+
+	jv = degradedVerifier(issuer, true)
+
+	_, reason, err = jv.VerifyDegraded(context.Background(), issuer.Sign(issuer.Claims("api://default")))
+	if err != nil || reason != jwtverifier.DegradedKeysUnavailable {
+		t.Errorf("expected degradation when discovery is down, got %q, %v", reason, err)
+	}
+}
+
+func Test_degraded_mode_rejects_unknown_kids_while_the_key_set_is_cached(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:             issuer.URL,
+		ClaimsToValidate:   map[string]string{"aud": "api://default"},
+		EnableDegradedMode: true,
+		Cache:              cache.NewMemory(),
+	}
+	jv := jvs.New()
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	issuer.SetJWKSUnavailable(true)
+
+	forged := issuer.SignWithHeader(map[string]interface{}{
+		"alg": "RS256",
+		"kid": "attacker",
+	}, issuer.Claims("api://default"))
+
+	jwt, reason, err := jv.VerifyDegraded(context.Background(), forged)
+	var notFound *errors.KeyNotFound
+	if !goerrors.As(err, &notFound) {
+		t.Errorf("expected a KeyNotFound error, got %v", err)
+	}
+	if jwt != nil || reason != jwtverifier.NotDegraded {
+		t.Errorf("expected no claims for a token with an unknown kid, got %v and reason %q", jwt, reason)
+	}
+}
+
+// outageAdaptor reports every decode as an outage, as an adaptor might for
+// a failed refresh.
+type outageAdaptor struct{}
+
+func (outageAdaptor) New() adaptors.Adaptor { return outageAdaptor{} }
+
+func (outageAdaptor) GetKey(jwkUri string) {}
+
+func (outageAdaptor) Decode(jwt string, jwkUri string) (interface{}, error) {
+	return nil, errors.KeysUnavailableError(fmt.Errorf("key set request failed"))
+}
+
+func Test_degraded_mode_is_not_reached_while_the_key_set_is_cached(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	c := cache.NewMemory()
+	warm := jwtverifier.JwtVerifier{Issuer: issuer.URL, Cache: c}
+	if err := warm.New().Prime(context.Background()); err != nil {
+		t.Fatalf("could not prime the cache: %s", err)
+	}
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:             issuer.URL,
+		ClaimsToValidate:   map[string]string{"aud": "api://default"},
+		EnableDegradedMode: true,
+		Cache:              c,
+		Adaptor:            outageAdaptor{},
+	}
+	jv := jvs.New()
+
+	jwt, reason, err := jv.VerifyDegraded(context.Background(), issuer.Sign(issuer.Claims("api://default")))
+	if err == nil || jwt != nil || reason != jwtverifier.NotDegraded {
+		t.Errorf("expected no degradation with a cached key set, got %v, %q, %v", jwt, reason, err)
+	}
+}
+
+func Test_degraded_verifications_are_reported_apart_from_rejections(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetJWKSUnavailable(true)
+
+	var events []jwtverifier.VerificationEvent
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:             issuer.URL,
+		ClaimsToValidate:   map[string]string{"aud": "api://default"},
+		EnableDegradedMode: true,
+		Cache:              cache.NewMemory(),
+		Hooks: jwtverifier.Hooks{OnVerification: func(e jwtverifier.VerificationEvent) {
+			events = append(events, e)
+		}},
+	}
+	jv := jvs.New()
+
+	if _, reason, err := jv.VerifyDegraded(context.Background(), issuer.Sign(issuer.Claims("api://default"))); err != nil || reason != jwtverifier.DegradedKeysUnavailable {
+		t.Fatalf("expected an unverified token, got %q, %v", reason, err)
+	}
+	if _, _, err := jv.VerifyDegraded(context.Background(), issuer.Sign(issuer.Claims("api://other"))); err == nil {
+		t.Fatal("a token for another audience was returned")
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected one event per call, got %+v", events)
+	}
+	served, rejected := events[0], events[1]
+	if served.Method != "VerifyDegraded" || served.Success || !served.Degraded || served.Failure != jwtverifier.FailureKeysUnavailable {
+		t.Errorf("expected a degraded keys_unavailable failure, got %+v", served)
+	}
+	if rejected.Success || rejected.Degraded || rejected.Failure != jwtverifier.FailureAudience {
+		t.Errorf("expected an audience failure, got %+v", rejected)
+	}
+
+	if stats := jv.Stats(); stats.Rejected != 2 || stats.Degraded != 1 {
+		t.Errorf("expected 2 rejected tokens, 1 of them degraded, got %d and %d", stats.Rejected, stats.Degraded)
+	}
+}
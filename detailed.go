@@ -0,0 +1,252 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+// WarningCode names a soft problem with a verification that succeeded. The
+// values are stable and never renamed, so they can be used as label values.
+type WarningCode string
+
+const (
+	// WarningNearExpiry is a token that expires within the verifier's
+	// NearExpiryThreshold; the client should refresh it.
+	WarningNearExpiry WarningCode = "near_expiry"
+
+	// WarningLeewayUsed is a token accepted only thanks to the leeway: it
+	// has expired, or its iat or nbf is in the future, by the verifier's
+	// clock. Many of them point to clock skew.
+	WarningLeewayUsed WarningCode = "leeway_used"
+
+	// WarningColdDiscovery is a verification that had to fetch the
+	// discovery document.
+	WarningColdDiscovery WarningCode = "cold_discovery"
+
+	// WarningColdKeySet is a verification that had to fetch the key set.
+	WarningColdKeySet WarningCode = "cold_key_set"
+
+	// WarningNonCompliantBase64 is a token accepted only because
+	// AllowNonCompliantBase64 is set.
+	WarningNonCompliantBase64 WarningCode = "non_compliant_base64"
+
+	// WarningAdvisoryFailure is a failed check of a claim marked Advisory.
+	// There is one for each such claim.
+	WarningAdvisoryFailure WarningCode = "advisory_failure"
+)
+
+type Warning struct {
+	Code WarningCode
+
+	// Message describes the problem for people, e.g. "the token expires
+	// in 42s".
+	Message string
+}
+
+// StageDurations is how long each stage of a verification took. A stage
+// that did not run is zero.
+type StageDurations struct {
+	// Discovery is the time taken to find the jwks_uri, fetching the
+	// discovery document if it was not cached.
+	Discovery time.Duration
+
+	// KeyFetch is the time spent fetching the key set. It is only measured
+	// with the default adaptor; a custom adaptor's fetches count toward
+	// Signature.
+	KeyFetch time.Duration
+
+	// Signature is the time the adaptor took to verify the signature,
+	// without KeyFetch.
+	Signature time.Duration
+
+	// Claims is the time taken to check the claims.
+	Claims time.Duration
+}
+
+// VerificationResult describes a verification in more detail than the
+// *Jwt and error VerifyAccessTokenContext returns.
+type VerificationResult struct {
+	// Token is the verified token. When the verification failed it is
+	// what VerifyAccessTokenContext returned: nil, or the token whose
+	// claims did not validate.
+	Token *Jwt
+
+	// Warnings are the soft problems with the verification, if any. Only
+	// the cold cache warnings are reported for a failed verification.
+	Warnings []Warning
+
+	Durations StageDurations
+
+	// Duration is how long the whole verification took.
+	Duration time.Duration
+
+	// KeyID is the kid of the token's header, if it got as far as the
+	// signature check.
+	KeyID string
+}
+
+// HasWarning reports whether the result has a warning with code.
+func (r *VerificationResult) HasWarning(code WarningCode) bool {
+	for _, w := range r.Warnings {
+		if w.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyAccessTokenDetailed is VerifyAccessTokenContext, returning the
+// verification's warnings and the time spent in each stage along with the
+// token. The result is never nil, even when the verification fails.
+func (j *JwtVerifier) VerifyAccessTokenDetailed(ctx context.Context, jwt string, opts ...VerifyOption) (*VerificationResult, error) {
+	detail := &verificationDetail{}
+	start := time.Now()
+	token, err := j.VerifyAccessTokenContext(context.WithValue(ctx, detailKey{}, detail), jwt, opts...)
+
+	result := &VerificationResult{
+		Token:     token,
+		Durations: detail.stageDurations(),
+		Duration:  time.Since(start),
+		KeyID:     detail.keyID,
+	}
+	if detail.metadataFetched.Load() {
+		result.Warnings = append(result.Warnings, Warning{WarningColdDiscovery, "the discovery document was fetched"})
+	}
+	if detail.keySetFetched.Load() {
+		result.Warnings = append(result.Warnings, Warning{WarningColdKeySet, "the key set was fetched"})
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.Warnings = append(result.Warnings, j.tokenWarnings(token)...)
+	return result, nil
+}
+
+// tokenWarnings returns the warnings about a verified token.
+func (j *JwtVerifier) tokenWarnings(token *Jwt) []Warning {
+	var warnings []Warning
+	now := j.now()
+
+	if exp, err := token.Expiry(); err == nil {
+		if !AcceptableExpiry(exp, now, 0) {
+			warnings = append(warnings, Warning{WarningLeewayUsed,
+				fmt.Sprintf("the token expired %s ago", now.Sub(exp).Truncate(time.Second))})
+		} else if remaining := exp.Sub(now); j.NearExpiryThreshold > 0 && remaining < j.NearExpiryThreshold {
+			warnings = append(warnings, Warning{WarningNearExpiry,
+				fmt.Sprintf("the token expires in %s", remaining.Truncate(time.Second))})
+		}
+	}
+	if iat, err := token.IssuedAt(); err == nil && !AcceptableIssuedAt(iat, now, 0) {
+		warnings = append(warnings, Warning{WarningLeewayUsed,
+			fmt.Sprintf("the token was issued %s in the future", iat.Sub(now).Truncate(time.Second))})
+	}
+	if nbf, err := token.TimeClaim("nbf"); err == nil && !AcceptableNotBefore(nbf, now, 0) {
+		warnings = append(warnings, Warning{WarningLeewayUsed,
+			fmt.Sprintf("the token is not valid for another %s", nbf.Sub(now).Truncate(time.Second))})
+	}
+
+	if token.Info.NonCompliantBase64 {
+		warnings = append(warnings, Warning{WarningNonCompliantBase64, "the token is not base64url encoded as RFC 7515 requires"})
+	}
+	for _, failure := range token.Info.AdvisoryFailures {
+		warnings = append(warnings, Warning{WarningAdvisoryFailure, failure.Err.Error()})
+	}
+	return warnings
+}
+
+type detailKey struct{}
+
+// stage is a timed stage of a verification. The key fetch is timed
+// separately, within stageDecode.
+type stage int
+
+const (
+	stageDiscovery stage = iota
+	stageDecode
+	stageClaims
+	stageCount
+)
+
+// verificationDetail collects what VerifyAccessTokenDetailed reports while
+// the verification runs. The stage durations are written by the verifying
+// goroutine; fetches may be noted from others.
+type verificationDetail struct {
+	stages [stageCount]time.Duration
+	keyID  string
+
+	keyFetch        atomic.Int64
+	metadataFetched atomic.Bool
+	keySetFetched   atomic.Bool
+}
+
+// detailFrom returns the verificationDetail in ctx, or nil if the
+// verification is not detailed. Its methods do nothing on nil.
+func detailFrom(ctx context.Context) *verificationDetail {
+	detail, _ := ctx.Value(detailKey{}).(*verificationDetail)
+	return detail
+}
+
+// since adds the time since start to s.
+func (d *verificationDetail) since(s stage, start time.Time) {
+	if d != nil {
+		d.stages[s] += time.Since(start)
+	}
+}
+
+func (d *verificationDetail) setKeyID(kid string) {
+	if d != nil {
+		d.keyID = kid
+	}
+}
+
+// noteFetch notes the start of the fetch named name, one of the fetch
+// span names, and returns the function that notes its end.
+func (d *verificationDetail) noteFetch(name string) func() {
+	if d == nil {
+		return func() {}
+	}
+	switch name {
+	case tracing.SpanFetchMetadata:
+		d.metadataFetched.Store(true)
+	case tracing.SpanFetchKeySet:
+		d.keySetFetched.Store(true)
+		start := time.Now()
+		return func() { d.keyFetch.Add(int64(time.Since(start))) }
+	}
+	return func() {}
+}
+
+func (d *verificationDetail) stageDurations() StageDurations {
+	keyFetch := time.Duration(d.keyFetch.Load())
+	signature := d.stages[stageDecode] - keyFetch
+	if signature < 0 {
+		signature = 0
+	}
+	return StageDurations{
+		Discovery: d.stages[stageDiscovery],
+		KeyFetch:  keyFetch,
+		Signature: signature,
+		Claims:    d.stages[stageClaims],
+	}
+}
@@ -0,0 +1,123 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_detailed_verification_reports_cold_caches_and_stages(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetDelay(10 * time.Millisecond)
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	result, err := jv.VerifyAccessTokenDetailed(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.HasWarning(WarningColdDiscovery) || !result.HasWarning(WarningColdKeySet) || len(result.Warnings) != 2 {
+		t.Errorf("expected the cold cache warnings, got %v", result.Warnings)
+	}
+	if result.Durations.Discovery < 10*time.Millisecond || result.Durations.KeyFetch < 10*time.Millisecond {
+		t.Errorf("expected the fetches to be timed, got %+v", result.Durations)
+	}
+	if result.KeyID != issuer.KeyID() || result.Token == nil {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	result, err = jv.VerifyAccessTokenDetailed(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 0 || result.Durations.KeyFetch != 0 || result.Durations.Discovery >= 10*time.Millisecond {
+		t.Errorf("expected a warm verification, got %v and %+v", result.Warnings, result.Durations)
+	}
+}
+
+func Test_detailed_verification_warns_about_the_token(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jv.NearExpiryThreshold = time.Minute
+
+	now := time.Now().Unix()
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		expected WarningCode
+	}{
+		{"expired within the leeway", map[string]interface{}{"exp": now - 30}, WarningLeewayUsed},
+		{"issued in the future", map[string]interface{}{"iat": now + 30}, WarningLeewayUsed},
+		{"not yet valid", map[string]interface{}{"nbf": now + 30}, WarningLeewayUsed},
+		{"near expiry", map[string]interface{}{"exp": now + 30}, WarningNearExpiry},
+	}
+
+	for _, test := range tests {
+		claims := issuer.Claims("api://default")
+		for claim, value := range test.claims {
+			claims[claim] = value
+		}
+
+		result, err := jv.VerifyAccessTokenDetailed(context.Background(), issuer.Sign(claims))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !result.HasWarning(test.expected) {
+			t.Errorf("%s: expected a %s warning, got %v", test.name, test.expected, result.Warnings)
+		}
+	}
+}
+
+func Test_detailed_verification_returns_a_result_on_failure(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := jv.VerifyAccessTokenDetailed(context.Background(), issuer.Sign(issuer.Claims("api://other")))
+	if err == nil {
+		t.Fatal("expected the audience to fail")
+	}
+	if result == nil || result.Token == nil || result.KeyID != issuer.KeyID() || result.HasWarning(WarningLeewayUsed) {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
@@ -0,0 +1,156 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_discovery_and_jwks_tolerate_leading_junk(t *testing.T) {
+	prefixes := map[string]string{
+		"bom":            "\xef\xbb\xbf",
+		"whitespace":     " \r\n\t",
+		"bom whitespace": "\xef\xbb\xbf\n",
+	}
+
+	for name, prefix := range prefixes {
+		issuer := testissuer.New()
+		issuer.SetBodyRewrite(func(path string, body []byte) []byte {
+			return append([]byte(prefix), body...)
+		})
+
+		jvs := JwtVerifier{
+			Issuer:           issuer.URL,
+			ClaimsToValidate: map[string]string{"aud": "api://default"},
+		}
+
+		if _, err := jvs.New().VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+			t.Errorf("%s: could not verify access_token: %s", name, err)
+		}
+
+		issuer.Close()
+	}
+}
+
+func Test_malformed_discovery_documents_are_diagnosable(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetBodyRewrite(func(path string, body []byte) []byte {
+		return []byte("<html><body>Proxy login required</body></html>")
+	})
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	_, err := jvs.New().VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+
+	var malformed *errors.DiscoveryMalformed
+	if !goerrors.As(err, &malformed) {
+		t.Fatalf("expected a DiscoveryMalformed error, got %v", err)
+	}
+
+	if !strings.HasPrefix(malformed.Snippet, "<html><body>") || !strings.Contains(err.Error(), "<html>") {
+		t.Errorf("expected the error to include the start of the body, got %s", err)
+	}
+}
+
+func Test_malformed_key_sets_are_diagnosable(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetBodyRewrite(func(path string, body []byte) []byte {
+		if strings.HasSuffix(path, "/v1/keys") {
+			return []byte("<!DOCTYPE html>\n<title>Bad Gateway</title>")
+		}
+		return body
+	})
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	_, err := jvs.New().VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+
+	var malformed *errors.DiscoveryMalformed
+	if !goerrors.As(err, &malformed) {
+		t.Fatalf("expected a DiscoveryMalformed error, got %v", err)
+	}
+
+	if malformed.Snippet != "<!DOCTYPE html>.<title>Bad Gateway</title>" {
+		t.Errorf("unexpected snippet %q", malformed.Snippet)
+	}
+
+	var unavailable *errors.KeysUnavailable
+	if !goerrors.As(err, &unavailable) {
+		t.Errorf("expected a malformed key set to leave the keys unavailable")
+	}
+}
+
+func Test_request_headers_are_sent_and_never_revealed(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.RequireHeader("X-Api-Key", "gateway-secret")
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	log := &recordingLogger{}
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithRequestHeader("X-Api-Key", "gateway-secret"),
+		WithLogger(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("expected both requests to carry the header, got %d metadata and %d JWKS requests",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+
+	other := testissuer.New()
+	defer other.Close()
+	other.RequireHeader("X-Api-Key", "a-different-secret")
+
+	jv, err = NewVerifier(other.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithRequestHeader("X-Api-Key", "gateway-secret"),
+		WithRetry(1, time.Millisecond),
+		WithLogger(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jv.VerifyAccessToken(other.Sign(other.Claims("api://default")))
+	if err == nil {
+		t.Fatalf("verified a token although the gateway rejected the request")
+	}
+	if strings.Contains(err.Error(), "gateway-secret") || strings.Contains(errors.DiagnosticString(err), "gateway-secret") {
+		t.Errorf("the header value appeared in the error: %s", err)
+	}
+	if log.contains("gateway-secret") {
+		t.Errorf("the header value was logged")
+	}
+}
@@ -0,0 +1,66 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+// VerifyDPoPAccessToken verifies an access token like VerifyAccessToken,
+// and also requires it to be bound, through its cnf claim, to the key with
+// the JWK thumbprint jkt (RFC 9449). The caller validates the DPoP proof
+// and computes jkt from the proof's key; this method does not see the
+// proof. A token that verifies but is not bound to jkt is rejected with
+// errors.ConfirmationMismatch.
+func (j *JwtVerifier) VerifyDPoPAccessToken(jwt string, jkt string) (*Jwt, error) {
+	ctx, end := j.startVerification(context.Background(), tracing.SpanVerifyAccessToken, "VerifyDPoPAccessToken")
+	myJwt, err := j.verifyAccessToken(ctx, jwt, verifyCall{})
+	if err == nil {
+		err = validateConfirmation(myJwt.Claims["cnf"], jkt)
+	}
+	end(myJwt, err)
+
+	j.recordVerification(err)
+	if err != nil {
+		j.log().Debug("DPoP access token verification failed", "error", err.Error())
+	}
+	return myJwt, err
+}
+
+func validateConfirmation(cnf interface{}, jkt string) error {
+	if jkt == "" {
+		return errors.ConfirmationMismatchError("no proof key thumbprint was given")
+	}
+	if cnf == nil {
+		return errors.ConfirmationMismatchError("cnf: missing")
+	}
+	confirmation, ok := cnf.(map[string]interface{})
+	if !ok {
+		return errors.ConfirmationMismatchError("cnf: not an object")
+	}
+	thumbprint, ok := confirmation["jkt"].(string)
+	if !ok || thumbprint == "" {
+		return errors.ConfirmationMismatchError("cnf.jkt: missing")
+	}
+	if thumbprint != jkt {
+		return errors.ConfirmationMismatchError("cnf.jkt does not match the thumbprint of the proof key")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_dpop_bound_tokens_must_match_the_proof_key(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	const jkt = "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"
+
+	tests := []struct {
+		name   string
+		cnf    interface{}
+		jkt    string
+		reason string
+	}{
+		{"bound to the proof key", map[string]interface{}{"jkt": jkt}, jkt, ""},
+		{"bound to another key", map[string]interface{}{"jkt": "other"}, jkt, "does not match"},
+		{"cnf absent", nil, jkt, "cnf: missing"},
+		{"cnf not an object", jkt, jkt, "cnf: not an object"},
+		{"cnf without jkt", map[string]interface{}{"x5t#S256": "abc"}, jkt, "cnf.jkt: missing"},
+		{"jkt not a string", map[string]interface{}{"jkt": 1}, jkt, "cnf.jkt: missing"},
+		{"no thumbprint given", map[string]interface{}{"jkt": jkt}, "", "no proof key thumbprint"},
+	}
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+	jv := jvs.New()
+
+	for _, test := range tests {
+		claims := issuer.Claims("api://default")
+		if test.cnf != nil {
+			claims["cnf"] = test.cnf
+		}
+
+		_, err := jv.VerifyDPoPAccessToken(issuer.Sign(claims), test.jkt)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err)
+			}
+			continue
+		}
+
+		var mismatch *errors.ConfirmationMismatch
+		if !goerrors.As(err, &mismatch) || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%s: expected a ConfirmationMismatch error containing %q, got %v", test.name, test.reason, err)
+		}
+	}
+}
+
+func Test_dpop_verification_checks_the_token_first(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+	jv := jvs.New()
+
+	claims := issuer.Claims("api://other")
+	claims["cnf"] = map[string]interface{}{"jkt": "abc"}
+
+	_, err := jv.VerifyDPoPAccessToken(issuer.Sign(claims), "abc")
+	var mismatch *errors.ConfirmationMismatch
+	if err == nil || goerrors.As(err, &mismatch) {
+		t.Errorf("expected the audience to be rejected, got %v", err)
+	}
+
+	if stats := jv.Stats(); stats.Rejected != 1 || stats.Verified != 0 {
+		t.Errorf("expected one rejection, got %+v", stats)
+	}
+}
@@ -0,0 +1,71 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import "fmt"
+
+// AttestationReason says why a signature attestation was refused.
+type AttestationReason string
+
+const (
+	// AttestationUnknownKey is an attestation signed with a key the
+	// verifier does not have, such as one rotated out.
+	AttestationUnknownKey AttestationReason = "unknown_key"
+
+	// AttestationForged is an attestation whose signature does not verify,
+	// or that was made for another token.
+	AttestationForged AttestationReason = "forged"
+
+	// AttestationExpired is an attestation past its expiry.
+	AttestationExpired AttestationReason = "expired"
+)
+
+// AttestationInvalid is returned by VerifyWithAttestation when the
+// attestation that a gateway verified the token's signature cannot be
+// trusted. The token's signature is then not considered verified.
+type AttestationInvalid struct {
+	message string
+
+	// KeyID is the ID of the attestation key the attestation names.
+	KeyID string
+
+	Reason AttestationReason
+}
+
+func AttestationInvalidError(keyID string, reason AttestationReason) *AttestationInvalid {
+	var message string
+	switch reason {
+	case AttestationUnknownKey:
+		message = fmt.Sprintf("the attestation key %q is unknown", keyID)
+	case AttestationForged:
+		message = fmt.Sprintf("the attestation signed with key %q is not valid for this token", keyID)
+	case AttestationExpired:
+		message = fmt.Sprintf("the attestation signed with key %q has expired", keyID)
+	default:
+		message = fmt.Sprintf("the attestation signed with key %q is invalid", keyID)
+	}
+
+	return &AttestationInvalid{
+		message: message,
+		KeyID:   keyID,
+		Reason:  reason,
+	}
+}
+
+func (e *AttestationInvalid) Error() string {
+	return e.message
+}
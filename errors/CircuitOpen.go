@@ -0,0 +1,39 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+// CircuitOpen is returned instead of fetching the discovery document or
+// key set while a circuit breaker is open after repeated failures. It is
+// wrapped in a KeysUnavailable, so stale keys and degraded mode take over
+// as they do for a failed fetch.
+type CircuitOpen struct {
+	message string
+}
+
+// ErrCircuitOpen is the error returned while a circuit breaker is open.
+// Test for it with errors.Is.
+var ErrCircuitOpen error = CircuitOpenError()
+
+func CircuitOpenError() *CircuitOpen {
+	return &CircuitOpen{
+		message: "the circuit breaker is open: requests to the issuer are suspended after repeated failures",
+	}
+}
+
+func (e *CircuitOpen) Error() string {
+	return e.message
+}
@@ -0,0 +1,33 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import "fmt"
+
+type ConfirmationMismatch struct {
+	message string
+}
+
+func ConfirmationMismatchError(reason string) *ConfirmationMismatch {
+	return &ConfirmationMismatch{
+		message: fmt.Sprintf("the token is not bound to the proof key: %s", reason),
+	}
+}
+
+func (e *ConfirmationMismatch) Error() string {
+	return e.message
+}
@@ -0,0 +1,43 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+)
+
+// DiscoveryMalformed is returned when a discovery document or key set is
+// not the JSON expected. Snippet holds the start of the body, with
+// unprintable bytes replaced.
+type DiscoveryMalformed struct {
+	message string
+
+	URL     string
+	Snippet string
+}
+
+func DiscoveryMalformedError(url string, snippet string, reason string) *DiscoveryMalformed {
+	return &DiscoveryMalformed{
+		message: fmt.Sprintf("the document at %s is malformed: %s; it begins with %q", url, reason, snippet),
+		URL:     url,
+		Snippet: snippet,
+	}
+}
+
+func (e *DiscoveryMalformed) Error() string {
+	return e.message
+}
@@ -0,0 +1,41 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import "fmt"
+
+// HeaderRejected is returned for tokens whose header has a member
+// the verifier refuses to honor: a crit member, since the verifier
+// understands no extensions, or a jwk or jku member, which would have the
+// token name its own key. Keys only ever come from the issuer's key set.
+type HeaderRejected struct {
+	message string
+
+	// Parameter is the rejected header member, e.g. "jwk".
+	Parameter string
+}
+
+func HeaderRejectedError(parameter string, reason string) *HeaderRejected {
+	return &HeaderRejected{
+		message:   fmt.Sprintf("the tokens header parameter '%s' is not accepted: %s", parameter, reason),
+		Parameter: parameter,
+	}
+}
+
+func (e *HeaderRejected) Error() string {
+	return e.message
+}
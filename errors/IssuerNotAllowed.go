@@ -0,0 +1,38 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+)
+
+type IssuerNotAllowed struct {
+	message string
+
+	Issuer string
+}
+
+func IssuerNotAllowedError(issuer string) *IssuerNotAllowed {
+	return &IssuerNotAllowed{
+		message: fmt.Sprintf("issuer not allowed: %q", issuer),
+		Issuer:  issuer,
+	}
+}
+
+func (e *IssuerNotAllowed) Error() string {
+	return e.message
+}
@@ -0,0 +1,37 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+// JwtEncrypted is returned for encrypted tokens (JWE): tokens in the five
+// part compact serialization, and tokens whose header has an enc member.
+type JwtEncrypted struct {
+	message string
+}
+
+// ErrEncryptedTokenNotSupported is the error returned for encrypted tokens.
+// Test for it with errors.Is.
+var ErrEncryptedTokenNotSupported error = JwtEncryptedError()
+
+func JwtEncryptedError() *JwtEncrypted {
+	return &JwtEncrypted{
+		message: "encrypted tokens are not supported: only signed JWTs can be verified, so the authorization server must not encrypt its tokens",
+	}
+}
+
+func (e *JwtEncrypted) Error() string {
+	return e.message
+}
@@ -0,0 +1,42 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import "fmt"
+
+// JwtTooLarge is returned for tokens longer than the verifier's
+// MaxTokenSize. They are rejected before any part of them is decoded.
+type JwtTooLarge struct {
+	message string
+
+	// Size is the length of the token in bytes and MaxSize the limit it
+	// exceeds.
+	Size    int
+	MaxSize int
+}
+
+func JwtTooLargeError(size int, maxSize int) *JwtTooLarge {
+	return &JwtTooLarge{
+		message: fmt.Sprintf("token exceeds maximum size: it is %d bytes, the limit is %d", size, maxSize),
+		Size:    size,
+		MaxSize: maxSize,
+	}
+}
+
+func (e *JwtTooLarge) Error() string {
+	return e.message
+}
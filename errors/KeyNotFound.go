@@ -0,0 +1,102 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxListedKeyIDs is how many of the key set's kids a KeyNotFound message
+// lists.
+const maxListedKeyIDs = 10
+
+// KeyNotFound is returned when the key set has no key with the token's
+// kid. Kids are compared byte for byte, so NearMiss, if set, is a kid of
+// the key set that differs from the token's only in whitespace or case,
+// which is usually a misconfigured issuer.
+type KeyNotFound struct {
+	message string
+
+	KeyID    string
+	KeyIDs   []string
+	NearMiss string
+
+	// Sources are the JWKS URIs of the key sets searched, in order, when
+	// the verifier has secondary key sets. KeyIDs are then the kids of all
+	// of them.
+	Sources []string
+}
+
+func KeyNotFoundError(kid string, kids []string) *KeyNotFound {
+	return keyNotFound(kid, kids, nil)
+}
+
+// KeyNotFoundInKeySetsError is KeyNotFoundError for a kid searched for in
+// several key sets, whose JWKS URIs are sources.
+func KeyNotFoundInKeySetsError(kid string, kids []string, sources []string) *KeyNotFound {
+	return keyNotFound(kid, kids, sources)
+}
+
+func keyNotFound(kid string, kids []string, sources []string) *KeyNotFound {
+	e := &KeyNotFound{KeyID: kid, KeyIDs: kids, Sources: sources}
+
+	keySet := "the key set has"
+	var b strings.Builder
+	if len(sources) == 0 {
+		fmt.Fprintf(&b, "no key found in key set for kid %q", kid)
+	} else {
+		keySet = "the key sets have"
+		fmt.Fprintf(&b, "no key found for kid %q in the key sets at %s", kid, strings.Join(sources, ", "))
+	}
+	if len(kids) == 0 {
+		fmt.Fprintf(&b, "; %s no kids", keySet)
+	} else {
+		listed := kids
+		if len(listed) > maxListedKeyIDs {
+			listed = listed[:maxListedKeyIDs]
+		}
+		quoted := make([]string, len(listed))
+		for i, k := range listed {
+			quoted[i] = fmt.Sprintf("%q", k)
+		}
+		fmt.Fprintf(&b, "; %s %s", keySet, strings.Join(quoted, ", "))
+		if len(kids) > len(listed) {
+			fmt.Fprintf(&b, " and %d more", len(kids)-len(listed))
+		}
+	}
+
+	for _, k := range kids {
+		if k != kid && foldKeyID(k) == foldKeyID(kid) {
+			e.NearMiss = k
+			fmt.Fprintf(&b, "; %q differs from it only in whitespace or case", k)
+			break
+		}
+	}
+
+	e.message = b.String()
+	return e
+}
+
+// foldKeyID removes whitespace from kid and lowers its case.
+func foldKeyID(kid string) string {
+	return strings.ToLower(strings.Join(strings.Fields(kid), ""))
+}
+
+func (e *KeyNotFound) Error() string {
+	return e.message
+}
@@ -0,0 +1,45 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+// keysUnavailableMessage is the message of the zero KeysUnavailable.
+const keysUnavailableMessage = "the keys needed to verify the token are unavailable"
+
+// KeysUnavailable is returned when the keys needed to verify a token could
+// not be obtained, because the discovery document or the key set could not
+// be fetched. Its message is that of the underlying error, or a generic one
+// for the zero value.
+type KeysUnavailable struct {
+	err error
+}
+
+func KeysUnavailableError(err error) *KeysUnavailable {
+	return &KeysUnavailable{
+		err: err,
+	}
+}
+
+func (e *KeysUnavailable) Error() string {
+	if e.err == nil {
+		return keysUnavailableMessage
+	}
+	return e.err.Error()
+}
+
+func (e *KeysUnavailable) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,40 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import "fmt"
+
+// OrgAccessToken is returned for an access token when the verifier's issuer
+// is an Okta org authorization server, whose access tokens are meant for
+// Okta's own APIs and cannot be verified locally.
+type OrgAccessToken struct {
+	message string
+
+	Issuer string
+}
+
+func OrgAccessTokenError(issuer string) *OrgAccessToken {
+	return &OrgAccessToken{
+		message: fmt.Sprintf("access tokens of the org authorization server %s cannot be verified locally; "+
+			"verify them with introspection, or issue them from a custom authorization server", issuer),
+		Issuer: issuer,
+	}
+}
+
+func (e *OrgAccessToken) Error() string {
+	return e.message
+}
@@ -0,0 +1,42 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TLSPinMismatch is returned when none of the certificates an issuer
+// presents has a pinned public key. Presented holds the base64 SHA-256
+// hashes of the presented keys, for comparison with the pins.
+type TLSPinMismatch struct {
+	message string
+
+	Presented []string
+}
+
+func TLSPinMismatchError(presented []string) *TLSPinMismatch {
+	return &TLSPinMismatch{
+		message:   fmt.Sprintf("none of the certificate keys presented match a pinned key; presented %s", strings.Join(presented, ", ")),
+		Presented: presented,
+	}
+}
+
+func (e *TLSPinMismatch) Error() string {
+	return e.message
+}
@@ -0,0 +1,39 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+	"time"
+)
+
+type TokenNotYetValid struct {
+	message string
+
+	NotBefore time.Time
+}
+
+func TokenNotYetValidError(notBefore time.Time) *TokenNotYetValid {
+	return &TokenNotYetValid{
+		message:   fmt.Sprintf("token not yet valid, it is valid from %s", notBefore.UTC().Format(time.RFC3339)),
+		NotBefore: notBefore,
+	}
+}
+
+func (e *TokenNotYetValid) Error() string {
+	return e.message
+}
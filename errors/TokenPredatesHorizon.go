@@ -0,0 +1,42 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+	"time"
+)
+
+type TokenPredatesHorizon struct {
+	message string
+
+	IssuedAt time.Time
+	Horizon  time.Time
+}
+
+func TokenPredatesHorizonError(issuedAt time.Time, horizon time.Time) *TokenPredatesHorizon {
+	return &TokenPredatesHorizon{
+		message: fmt.Sprintf("the token was issued at %s, before the revocation horizon %s",
+			issuedAt.UTC().Format(time.RFC3339), horizon.UTC().Format(time.RFC3339)),
+		IssuedAt: issuedAt,
+		Horizon:  horizon,
+	}
+}
+
+func (e *TokenPredatesHorizon) Error() string {
+	return e.message
+}
@@ -0,0 +1,42 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+	"time"
+)
+
+type TokenTooOld struct {
+	message string
+
+	IssuedAt time.Time
+	MaxAge   time.Duration
+}
+
+func TokenTooOldError(issuedAt time.Time, maxAge time.Duration) *TokenTooOld {
+	return &TokenTooOld{
+		message: fmt.Sprintf("the token is too old: it was issued at %s, more than the maximum age of %s ago",
+			issuedAt.UTC().Format(time.RFC3339), maxAge),
+		IssuedAt: issuedAt,
+		MaxAge:   maxAge,
+	}
+}
+
+func (e *TokenTooOld) Error() string {
+	return e.message
+}
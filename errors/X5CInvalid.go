@@ -0,0 +1,69 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import "fmt"
+
+// X5CReason says why a key failed x5c validation.
+type X5CReason string
+
+const (
+	// X5CMissing is a key without an x5c certificate chain.
+	X5CMissing X5CReason = "missing"
+
+	// X5CChainInvalid is a key whose certificate chain does not verify
+	// against the trusted roots, or has expired.
+	X5CChainInvalid X5CReason = "chain_invalid"
+
+	// X5CKeyMismatch is a key whose leaf certificate is for another key.
+	X5CKeyMismatch X5CReason = "key_mismatch"
+)
+
+// X5CInvalid is returned when x5c validation is enabled and the key the
+// token is signed with is not backed by a certificate chaining to a
+// trusted root.
+type X5CInvalid struct {
+	message string
+
+	Reason X5CReason
+}
+
+func X5CInvalidError(kid string, reason X5CReason, detail string) *X5CInvalid {
+	var message string
+	switch reason {
+	case X5CMissing:
+		message = fmt.Sprintf("the key %q has no x5c certificate chain", kid)
+	case X5CChainInvalid:
+		message = fmt.Sprintf("the x5c certificate chain of the key %q is not trusted", kid)
+	case X5CKeyMismatch:
+		message = fmt.Sprintf("the x5c leaf certificate of the key %q is for another key", kid)
+	default:
+		message = fmt.Sprintf("the x5c certificate chain of the key %q is invalid", kid)
+	}
+	if detail != "" {
+		message += ": " + detail
+	}
+
+	return &X5CInvalid{
+		message: message,
+		Reason:  reason,
+	}
+}
+
+func (e *X5CInvalid) Error() string {
+	return e.message
+}
@@ -0,0 +1,219 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// detail is what the typed errors in this package add to DiagnosticString.
+type detail struct {
+	code     string
+	category string
+	url      string
+}
+
+type describer interface {
+	describe() detail
+}
+
+func (e *JwtEmptyString) describe() detail {
+	return detail{code: "JWT_EMPTY", category: "token"}
+}
+
+func (e *JwtEncrypted) describe() detail {
+	return detail{code: "JWT_ENCRYPTED", category: "token"}
+}
+
+func (e *JwtTooLarge) describe() detail {
+	return detail{code: "JWT_TOO_LARGE", category: "token"}
+}
+
+func (e *TokenPredatesHorizon) describe() detail {
+	return detail{code: "TOKEN_PREDATES_HORIZON", category: "claims"}
+}
+
+func (e *TokenTooOld) describe() detail {
+	return detail{code: "TOKEN_TOO_OLD", category: "claims"}
+}
+
+func (e *TokenNotYetValid) describe() detail {
+	return detail{code: "TOKEN_NOT_YET_VALID", category: "claims"}
+}
+
+func (e *ConfirmationMismatch) describe() detail {
+	return detail{code: "CONFIRMATION_MISMATCH", category: "claims"}
+}
+
+func (e *HeaderRejected) describe() detail {
+	return detail{code: "HEADER_REJECTED", category: "token"}
+}
+
+func (e *KeyNotPinned) describe() detail {
+	return detail{code: "KEY_NOT_PINNED", category: "token"}
+}
+
+func (e *KeyNotFound) describe() detail {
+	return detail{code: "KEY_NOT_FOUND", category: "token"}
+}
+
+func (e *AttestationInvalid) describe() detail {
+	return detail{code: "ATTESTATION_INVALID", category: "token"}
+}
+
+func (e *X5CInvalid) describe() detail {
+	return detail{code: "X5C_INVALID", category: "token"}
+}
+
+func (e *OrgAccessToken) describe() detail {
+	return detail{code: "ORG_ACCESS_TOKEN", category: "token", url: e.Issuer}
+}
+
+func (e *IssuerNotAllowed) describe() detail {
+	return detail{code: "ISSUER_NOT_ALLOWED", category: "claims"}
+}
+
+func (e *KeysUnavailable) describe() detail {
+	return detail{code: "KEYS_UNAVAILABLE", category: "keys"}
+}
+
+func (e *DiscoveryMalformed) describe() detail {
+	return detail{code: "DISCOVERY_MALFORMED", category: "keys", url: e.URL}
+}
+
+func (e *CircuitOpen) describe() detail {
+	return detail{code: "CIRCUIT_OPEN", category: "keys"}
+}
+
+func (e *TLSPinMismatch) describe() detail {
+	return detail{code: "TLS_PIN_MISMATCH", category: "keys"}
+}
+
+func (e *Unrecognized) describe() detail {
+	return detail{code: e.Code, category: e.Category}
+}
+
+func (e *JwtEmptyString) DiagnosticString() string       { return DiagnosticString(e) }
+func (e *JwtEncrypted) DiagnosticString() string         { return DiagnosticString(e) }
+func (e *JwtTooLarge) DiagnosticString() string          { return DiagnosticString(e) }
+func (e *TokenPredatesHorizon) DiagnosticString() string { return DiagnosticString(e) }
+func (e *TokenTooOld) DiagnosticString() string          { return DiagnosticString(e) }
+func (e *TokenNotYetValid) DiagnosticString() string     { return DiagnosticString(e) }
+func (e *ConfirmationMismatch) DiagnosticString() string { return DiagnosticString(e) }
+func (e *HeaderRejected) DiagnosticString() string       { return DiagnosticString(e) }
+func (e *KeyNotPinned) DiagnosticString() string         { return DiagnosticString(e) }
+func (e *KeyNotFound) DiagnosticString() string          { return DiagnosticString(e) }
+func (e *AttestationInvalid) DiagnosticString() string   { return DiagnosticString(e) }
+func (e *X5CInvalid) DiagnosticString() string           { return DiagnosticString(e) }
+func (e *OrgAccessToken) DiagnosticString() string       { return DiagnosticString(e) }
+func (e *IssuerNotAllowed) DiagnosticString() string     { return DiagnosticString(e) }
+func (e *KeysUnavailable) DiagnosticString() string      { return DiagnosticString(e) }
+func (e *DiscoveryMalformed) DiagnosticString() string   { return DiagnosticString(e) }
+func (e *TLSPinMismatch) DiagnosticString() string       { return DiagnosticString(e) }
+func (e *CircuitOpen) DiagnosticString() string          { return DiagnosticString(e) }
+func (e *Unrecognized) DiagnosticString() string         { return DiagnosticString(e) }
+
+// Code returns the code of the first typed error from this package in
+// err's tree, as shown by DiagnosticString, or "" if there is none.
+func Code(err error) string {
+	var d describer
+	if stderrors.As(err, &d) {
+		return d.describe().code
+	}
+	return ""
+}
+
+// Category returns the category of the first typed error from this
+// package in err's tree, as shown by DiagnosticString, or "" if there is
+// none.
+func Category(err error) string {
+	var d describer
+	if stderrors.As(err, &d) {
+		return d.describe().category
+	}
+	return ""
+}
+
+// DiagnosticString describes err and every error it wraps, one numbered
+// layer per line, for support requests. Each layer shows only the part of
+// the message it added, along with the code, category and URL where they
+// are known. Credentials and query strings are removed from URLs.
+func DiagnosticString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for n := 1; err != nil; n++ {
+		next := stderrors.Unwrap(err)
+
+		message := err.Error()
+		if next != nil {
+			message = strings.TrimSuffix(message, next.Error())
+			message = strings.TrimRight(message, ": ")
+		}
+
+		var d detail
+		if described, ok := err.(describer); ok {
+			d = described.describe()
+		}
+		if urlErr, ok := err.(*url.Error); ok {
+			d.url = urlErr.URL
+		}
+
+		var redacted string
+		if d.url != "" {
+			redacted = redactURL(d.url)
+			message = strings.Replace(message, d.url, redacted, -1)
+		}
+
+		fmt.Fprintf(&b, "%d. ", n)
+		if d.code != "" {
+			fmt.Fprintf(&b, "[%s %s]", d.code, d.category)
+		} else {
+			fmt.Fprintf(&b, "[%T]", err)
+		}
+		if message != "" {
+			fmt.Fprintf(&b, " %s", message)
+		}
+		b.WriteString("\n")
+
+		if redacted != "" {
+			fmt.Fprintf(&b, "   url: %s\n", redacted)
+		}
+
+		err = next
+	}
+
+	return b.String()
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(unparseable url)"
+	}
+	u.User = nil
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	u.Fragment = ""
+	return u.String()
+}
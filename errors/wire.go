@@ -0,0 +1,551 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WireVersion is the version of the JSON encoding of the typed errors. It
+// only changes if a change would make older decoders misread an error;
+// new codes and new fields do not change it. Decoders reject versions
+// newer than their own.
+const WireVersion = 1
+
+// wire is the JSON encoding of a typed error. Claim, Expected and Actual
+// describe the failed claim, for errors about a claim; Reason is an
+// error's own Reason field; KeyIDs, NearMiss and Sources are those of a
+// KeyNotFound, whose Actual is the token's kid; Parameter is the header
+// member of a HeaderRejected; an AttestationInvalid's Actual is its KeyID;
+// Cause is the typed error a KeysUnavailable wraps, if any.
+type wire struct {
+	Version   int      `json:"version"`
+	Code      string   `json:"code"`
+	Category  string   `json:"category,omitempty"`
+	Message   string   `json:"message"`
+	Claim     string   `json:"claim,omitempty"`
+	Expected  string   `json:"expected,omitempty"`
+	Actual    string   `json:"actual,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Snippet   string   `json:"snippet,omitempty"`
+	Presented []string `json:"presented,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	KeyIDs    []string `json:"kids,omitempty"`
+	NearMiss  string   `json:"nearMiss,omitempty"`
+	Sources   []string `json:"sources,omitempty"`
+	Parameter string   `json:"parameter,omitempty"`
+	Cause     *wire    `json:"cause,omitempty"`
+}
+
+// serializable is implemented by the typed errors.
+type serializable interface {
+	describer
+	error
+	toWire() wire
+	fromWire(w wire) error
+}
+
+// MarshalError encodes the first typed error from this package in err's
+// tree as JSON, so that it can be sent to another process and decoded with
+// UnmarshalError. It returns an error if err's tree has no typed error.
+func MarshalError(err error) ([]byte, error) {
+	var s serializable
+	if !stderrors.As(err, &s) {
+		return nil, fmt.Errorf("%T has no typed error to marshal", err)
+	}
+	return json.Marshal(encode(s))
+}
+
+// UnmarshalError decodes an error encoded by MarshalError or the
+// MarshalJSON method of a typed error, returning the typed error for its
+// code. An error with a code this package does not know, sent by a newer
+// release, is returned as an *Unrecognized. The second return value
+// reports encodings that are malformed or from a newer WireVersion.
+func UnmarshalError(data []byte) (error, error) {
+	var w wire
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("could not decode the error: %w", err)
+	}
+	return decode(w)
+}
+
+func encode(s serializable) wire {
+	w := s.toWire()
+	d := s.describe()
+	w.Version = WireVersion
+	w.Code = d.code
+	w.Category = d.category
+	w.Message = s.Error()
+	return w
+}
+
+func decode(w wire) (serializable, error) {
+	if w.Version < 1 || w.Version > WireVersion {
+		return nil, fmt.Errorf("could not decode the error: unsupported version %d", w.Version)
+	}
+
+	var s serializable
+	switch w.Code {
+	case "JWT_EMPTY":
+		s = &JwtEmptyString{}
+	case "JWT_ENCRYPTED":
+		s = &JwtEncrypted{}
+	case "JWT_TOO_LARGE":
+		s = &JwtTooLarge{}
+	case "TOKEN_PREDATES_HORIZON":
+		s = &TokenPredatesHorizon{}
+	case "TOKEN_TOO_OLD":
+		s = &TokenTooOld{}
+	case "TOKEN_NOT_YET_VALID":
+		s = &TokenNotYetValid{}
+	case "CONFIRMATION_MISMATCH":
+		s = &ConfirmationMismatch{}
+	case "HEADER_REJECTED":
+		s = &HeaderRejected{}
+	case "KEY_NOT_PINNED":
+		s = &KeyNotPinned{}
+	case "KEY_NOT_FOUND":
+		s = &KeyNotFound{}
+	case "ATTESTATION_INVALID":
+		s = &AttestationInvalid{}
+	case "X5C_INVALID":
+		s = &X5CInvalid{}
+	case "ORG_ACCESS_TOKEN":
+		s = &OrgAccessToken{}
+	case "ISSUER_NOT_ALLOWED":
+		s = &IssuerNotAllowed{}
+	case "KEYS_UNAVAILABLE":
+		s = &KeysUnavailable{}
+	case "DISCOVERY_MALFORMED":
+		s = &DiscoveryMalformed{}
+	case "TLS_PIN_MISMATCH":
+		s = &TLSPinMismatch{}
+	case "CIRCUIT_OPEN":
+		s = &CircuitOpen{}
+	case "":
+		return nil, fmt.Errorf("could not decode the error: it has no code")
+	default:
+		s = &Unrecognized{}
+	}
+
+	if err := s.fromWire(w); err != nil {
+		return nil, fmt.Errorf("could not decode the %s error: %w", w.Code, err)
+	}
+	return s, nil
+}
+
+// unmarshalInto decodes data into s, which must be of the type for the
+// encoded code.
+func unmarshalInto(s serializable, data []byte) error {
+	var w wire
+	if err := json.Unmarshal(data, &w); err != nil {
+		return fmt.Errorf("could not decode the error: %w", err)
+	}
+	if w.Version < 1 || w.Version > WireVersion {
+		return fmt.Errorf("could not decode the error: unsupported version %d", w.Version)
+	}
+	if code := s.describe().code; w.Code != code {
+		return fmt.Errorf("could not decode a %s error as %s", w.Code, code)
+	}
+	return s.fromWire(w)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// Unrecognized is an error decoded by UnmarshalError with a code this
+// release does not know, sent by a newer one. Code and Category are as
+// sent, so DiagnosticString and Code report them.
+type Unrecognized struct {
+	message string
+
+	Code     string
+	Category string
+}
+
+func (e *Unrecognized) Error() string {
+	return e.message
+}
+
+func (e *JwtEmptyString) toWire() wire { return wire{} }
+
+func (e *JwtEmptyString) fromWire(w wire) error {
+	e.message = w.Message
+	return nil
+}
+
+func (e *JwtEncrypted) toWire() wire { return wire{} }
+
+func (e *JwtEncrypted) fromWire(w wire) error {
+	e.message = w.Message
+	return nil
+}
+
+func (e *JwtTooLarge) toWire() wire {
+	return wire{Expected: strconv.Itoa(e.MaxSize), Actual: strconv.Itoa(e.Size)}
+}
+
+func (e *JwtTooLarge) fromWire(w wire) error {
+	size, err := strconv.Atoi(w.Actual)
+	if err != nil {
+		return err
+	}
+	maxSize, err := strconv.Atoi(w.Expected)
+	if err != nil {
+		return err
+	}
+	e.message, e.Size, e.MaxSize = w.Message, size, maxSize
+	return nil
+}
+
+func (e *TokenPredatesHorizon) toWire() wire {
+	return wire{Claim: "iat", Expected: formatTime(e.Horizon), Actual: formatTime(e.IssuedAt)}
+}
+
+func (e *TokenPredatesHorizon) fromWire(w wire) error {
+	issuedAt, err := parseTime(w.Actual)
+	if err != nil {
+		return err
+	}
+	horizon, err := parseTime(w.Expected)
+	if err != nil {
+		return err
+	}
+	e.message, e.IssuedAt, e.Horizon = w.Message, issuedAt, horizon
+	return nil
+}
+
+func (e *TokenTooOld) toWire() wire {
+	return wire{Claim: "iat", Expected: e.MaxAge.String(), Actual: formatTime(e.IssuedAt)}
+}
+
+func (e *TokenTooOld) fromWire(w wire) error {
+	issuedAt, err := parseTime(w.Actual)
+	if err != nil {
+		return err
+	}
+	maxAge, err := time.ParseDuration(w.Expected)
+	if err != nil {
+		return err
+	}
+	e.message, e.IssuedAt, e.MaxAge = w.Message, issuedAt, maxAge
+	return nil
+}
+
+func (e *TokenNotYetValid) toWire() wire {
+	return wire{Claim: "nbf", Actual: formatTime(e.NotBefore)}
+}
+
+func (e *TokenNotYetValid) fromWire(w wire) error {
+	notBefore, err := parseTime(w.Actual)
+	if err != nil {
+		return err
+	}
+	e.message, e.NotBefore = w.Message, notBefore
+	return nil
+}
+
+func (e *ConfirmationMismatch) toWire() wire { return wire{Claim: "cnf"} }
+
+func (e *ConfirmationMismatch) fromWire(w wire) error {
+	e.message = w.Message
+	return nil
+}
+
+func (e *HeaderRejected) toWire() wire { return wire{Parameter: e.Parameter} }
+
+func (e *HeaderRejected) fromWire(w wire) error {
+	e.message, e.Parameter = w.Message, w.Parameter
+	return nil
+}
+
+func (e *KeyNotPinned) toWire() wire { return wire{} }
+
+func (e *KeyNotPinned) fromWire(w wire) error {
+	e.message = w.Message
+	return nil
+}
+
+func (e *KeyNotFound) toWire() wire {
+	return wire{Actual: e.KeyID, KeyIDs: e.KeyIDs, NearMiss: e.NearMiss, Sources: e.Sources}
+}
+
+func (e *KeyNotFound) fromWire(w wire) error {
+	e.message, e.KeyID, e.KeyIDs, e.NearMiss, e.Sources = w.Message, w.Actual, w.KeyIDs, w.NearMiss, w.Sources
+	return nil
+}
+
+func (e *AttestationInvalid) toWire() wire { return wire{Actual: e.KeyID, Reason: string(e.Reason)} }
+
+func (e *AttestationInvalid) fromWire(w wire) error {
+	e.message, e.KeyID, e.Reason = w.Message, w.Actual, AttestationReason(w.Reason)
+	return nil
+}
+
+func (e *X5CInvalid) toWire() wire { return wire{Reason: string(e.Reason)} }
+
+func (e *X5CInvalid) fromWire(w wire) error {
+	e.message, e.Reason = w.Message, X5CReason(w.Reason)
+	return nil
+}
+
+func (e *OrgAccessToken) toWire() wire { return wire{URL: e.Issuer} }
+
+func (e *OrgAccessToken) fromWire(w wire) error {
+	e.message, e.Issuer = w.Message, w.URL
+	return nil
+}
+
+func (e *IssuerNotAllowed) toWire() wire { return wire{Claim: "iss", Actual: e.Issuer} }
+
+func (e *IssuerNotAllowed) fromWire(w wire) error {
+	e.message, e.Issuer = w.Message, w.Actual
+	return nil
+}
+
+func (e *KeysUnavailable) toWire() wire {
+	var w wire
+	var cause serializable
+	if stderrors.As(e.err, &cause) {
+		encoded := encode(cause)
+		w.Cause = &encoded
+	}
+	return w
+}
+
+func (e *KeysUnavailable) fromWire(w wire) error {
+	if w.Cause == nil {
+		if w.Message != keysUnavailableMessage {
+			e.err = stderrors.New(w.Message)
+		}
+		return nil
+	}
+	cause, err := decode(*w.Cause)
+	if err != nil {
+		return err
+	}
+	e.err = &decodedCause{message: w.Message, cause: cause}
+	return nil
+}
+
+// decodedCause is the error a decoded KeysUnavailable wraps: the message
+// of the original, wrapping the typed error it contained.
+type decodedCause struct {
+	message string
+	cause   error
+}
+
+func (e *decodedCause) Error() string { return e.message }
+func (e *decodedCause) Unwrap() error { return e.cause }
+
+func (e *DiscoveryMalformed) toWire() wire { return wire{URL: e.URL, Snippet: e.Snippet} }
+
+func (e *DiscoveryMalformed) fromWire(w wire) error {
+	e.message, e.URL, e.Snippet = w.Message, w.URL, w.Snippet
+	return nil
+}
+
+func (e *TLSPinMismatch) toWire() wire { return wire{Presented: e.Presented} }
+
+func (e *TLSPinMismatch) fromWire(w wire) error {
+	e.message, e.Presented = w.Message, w.Presented
+	return nil
+}
+
+func (e *CircuitOpen) toWire() wire { return wire{} }
+
+func (e *CircuitOpen) fromWire(w wire) error {
+	e.message = w.Message
+	return nil
+}
+
+func (e *Unrecognized) toWire() wire { return wire{} }
+
+func (e *Unrecognized) fromWire(w wire) error {
+	e.message, e.Code, e.Category = w.Message, w.Code, w.Category
+	return nil
+}
+
+// MarshalJSON and UnmarshalJSON encode the typed errors in the format of
+// MarshalError.
+
+func (e *JwtEmptyString) MarshalJSON() ([]byte, error)       { return json.Marshal(encode(e)) }
+func (e *JwtEncrypted) MarshalJSON() ([]byte, error)         { return json.Marshal(encode(e)) }
+func (e *JwtTooLarge) MarshalJSON() ([]byte, error)          { return json.Marshal(encode(e)) }
+func (e *TokenPredatesHorizon) MarshalJSON() ([]byte, error) { return json.Marshal(encode(e)) }
+func (e *TokenTooOld) MarshalJSON() ([]byte, error)          { return json.Marshal(encode(e)) }
+func (e *TokenNotYetValid) MarshalJSON() ([]byte, error)     { return json.Marshal(encode(e)) }
+func (e *ConfirmationMismatch) MarshalJSON() ([]byte, error) { return json.Marshal(encode(e)) }
+func (e *HeaderRejected) MarshalJSON() ([]byte, error)       { return json.Marshal(encode(e)) }
+func (e *KeyNotPinned) MarshalJSON() ([]byte, error)         { return json.Marshal(encode(e)) }
+func (e *KeyNotFound) MarshalJSON() ([]byte, error)          { return json.Marshal(encode(e)) }
+func (e *AttestationInvalid) MarshalJSON() ([]byte, error)   { return json.Marshal(encode(e)) }
+func (e *X5CInvalid) MarshalJSON() ([]byte, error)           { return json.Marshal(encode(e)) }
+func (e *OrgAccessToken) MarshalJSON() ([]byte, error)       { return json.Marshal(encode(e)) }
+func (e *IssuerNotAllowed) MarshalJSON() ([]byte, error)     { return json.Marshal(encode(e)) }
+func (e *KeysUnavailable) MarshalJSON() ([]byte, error)      { return json.Marshal(encode(e)) }
+func (e *DiscoveryMalformed) MarshalJSON() ([]byte, error)   { return json.Marshal(encode(e)) }
+func (e *TLSPinMismatch) MarshalJSON() ([]byte, error)       { return json.Marshal(encode(e)) }
+func (e *CircuitOpen) MarshalJSON() ([]byte, error)          { return json.Marshal(encode(e)) }
+func (e *Unrecognized) MarshalJSON() ([]byte, error)         { return json.Marshal(encode(e)) }
+
+func (e *JwtEmptyString) UnmarshalJSON(data []byte) error       { return unmarshalInto(e, data) }
+func (e *JwtEncrypted) UnmarshalJSON(data []byte) error         { return unmarshalInto(e, data) }
+func (e *JwtTooLarge) UnmarshalJSON(data []byte) error          { return unmarshalInto(e, data) }
+func (e *TokenPredatesHorizon) UnmarshalJSON(data []byte) error { return unmarshalInto(e, data) }
+func (e *TokenTooOld) UnmarshalJSON(data []byte) error          { return unmarshalInto(e, data) }
+func (e *TokenNotYetValid) UnmarshalJSON(data []byte) error     { return unmarshalInto(e, data) }
+func (e *ConfirmationMismatch) UnmarshalJSON(data []byte) error { return unmarshalInto(e, data) }
+func (e *HeaderRejected) UnmarshalJSON(data []byte) error       { return unmarshalInto(e, data) }
+func (e *KeyNotPinned) UnmarshalJSON(data []byte) error         { return unmarshalInto(e, data) }
+func (e *KeyNotFound) UnmarshalJSON(data []byte) error          { return unmarshalInto(e, data) }
+func (e *AttestationInvalid) UnmarshalJSON(data []byte) error   { return unmarshalInto(e, data) }
+func (e *X5CInvalid) UnmarshalJSON(data []byte) error           { return unmarshalInto(e, data) }
+func (e *OrgAccessToken) UnmarshalJSON(data []byte) error       { return unmarshalInto(e, data) }
+func (e *IssuerNotAllowed) UnmarshalJSON(data []byte) error     { return unmarshalInto(e, data) }
+func (e *KeysUnavailable) UnmarshalJSON(data []byte) error      { return unmarshalInto(e, data) }
+func (e *DiscoveryMalformed) UnmarshalJSON(data []byte) error   { return unmarshalInto(e, data) }
+func (e *TLSPinMismatch) UnmarshalJSON(data []byte) error       { return unmarshalInto(e, data) }
+func (e *CircuitOpen) UnmarshalJSON(data []byte) error          { return unmarshalInto(e, data) }
+
+// UnmarshalJSON accepts any code, as UnmarshalError does for codes it does
+// not know.
+func (e *Unrecognized) UnmarshalJSON(data []byte) error {
+	var w wire
+	if err := json.Unmarshal(data, &w); err != nil {
+		return fmt.Errorf("could not decode the error: %w", err)
+	}
+	if w.Version < 1 || w.Version > WireVersion {
+		return fmt.Errorf("could not decode the error: unsupported version %d", w.Version)
+	}
+	return e.fromWire(w)
+}
+
+// Is reports whether target is an error of the same type with the same
+// message, so that errors.Is matches an error decoded by UnmarshalError
+// against the original. A target of the type's zero value matches every
+// error of the type.
+
+func (e *JwtEmptyString) Is(target error) bool {
+	t, ok := target.(*JwtEmptyString)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *JwtEncrypted) Is(target error) bool {
+	t, ok := target.(*JwtEncrypted)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *JwtTooLarge) Is(target error) bool {
+	t, ok := target.(*JwtTooLarge)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *TokenPredatesHorizon) Is(target error) bool {
+	t, ok := target.(*TokenPredatesHorizon)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *TokenTooOld) Is(target error) bool {
+	t, ok := target.(*TokenTooOld)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *TokenNotYetValid) Is(target error) bool {
+	t, ok := target.(*TokenNotYetValid)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *ConfirmationMismatch) Is(target error) bool {
+	t, ok := target.(*ConfirmationMismatch)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *HeaderRejected) Is(target error) bool {
+	t, ok := target.(*HeaderRejected)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *KeyNotPinned) Is(target error) bool {
+	t, ok := target.(*KeyNotPinned)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *KeyNotFound) Is(target error) bool {
+	t, ok := target.(*KeyNotFound)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *AttestationInvalid) Is(target error) bool {
+	t, ok := target.(*AttestationInvalid)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *X5CInvalid) Is(target error) bool {
+	t, ok := target.(*X5CInvalid)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *OrgAccessToken) Is(target error) bool {
+	t, ok := target.(*OrgAccessToken)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *IssuerNotAllowed) Is(target error) bool {
+	t, ok := target.(*IssuerNotAllowed)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *KeysUnavailable) Is(target error) bool {
+	t, ok := target.(*KeysUnavailable)
+	return ok && (t.err == nil || t.Error() == e.Error())
+}
+
+func (e *DiscoveryMalformed) Is(target error) bool {
+	t, ok := target.(*DiscoveryMalformed)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *TLSPinMismatch) Is(target error) bool {
+	t, ok := target.(*TLSPinMismatch)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *CircuitOpen) Is(target error) bool {
+	t, ok := target.(*CircuitOpen)
+	return ok && (t.message == "" || t.message == e.message)
+}
+
+func (e *Unrecognized) Is(target error) bool {
+	t, ok := target.(*Unrecognized)
+	return ok && (t.Code == "" || t.Code == e.Code && t.message == e.message)
+}
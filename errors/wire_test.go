@@ -0,0 +1,196 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_every_typed_error_survives_a_round_trip(t *testing.T) {
+	issuedAt := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	horizon := issuedAt.Add(time.Hour)
+
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{JwtEmptyStringError(), &JwtEmptyString{}},
+		{JwtEncryptedError(), &JwtEncrypted{}},
+		{JwtTooLargeError(20000, 16384), &JwtTooLarge{}},
+		{TokenPredatesHorizonError(issuedAt, horizon), &TokenPredatesHorizon{}},
+		{TokenTooOldError(issuedAt, 15*time.Minute), &TokenTooOld{}},
+		{TokenNotYetValidError(horizon), &TokenNotYetValid{}},
+		{ConfirmationMismatchError("cnf: missing"), &ConfirmationMismatch{}},
+		{KeyNotPinnedError(`kid "key2" is not allowed`), &KeyNotPinned{}},
+		{AttestationInvalidError("gateway-1", AttestationExpired), &AttestationInvalid{}},
+		{X5CInvalidError("key1", X5CKeyMismatch, ""), &X5CInvalid{}},
+		{IssuerNotAllowedError("https://evil.example.com"), &IssuerNotAllowed{}},
+		{OrgAccessTokenError("https://example.okta.com"), &OrgAccessToken{}},
+		{HeaderRejectedError("jwk", "keys are only taken from the issuer's key set"), &HeaderRejected{}},
+		{KeyNotFoundError("key1", []string{"key1 ", "key2"}), &KeyNotFound{}},
+		{KeyNotFoundInKeySetsError("key1", []string{"key2"}, []string{"https://a.example.com/keys", "https://b.example.com/keys"}), &KeyNotFound{}},
+		{KeysUnavailableError(stderrors.New("unexpected status 503")), &KeysUnavailable{}},
+		{&KeysUnavailable{}, &KeysUnavailable{}},
+		{DiscoveryMalformedError("https://example.com/v1/keys", "<html>", "not json"), &DiscoveryMalformed{}},
+		{TLSPinMismatchError([]string{"abc=", "def="}), &TLSPinMismatch{}},
+		{CircuitOpenError(), &CircuitOpen{}},
+		{&Unrecognized{message: "something new", Code: "SOMETHING_NEW", Category: "claims"}, &Unrecognized{}},
+	}
+
+	for _, test := range tests {
+		data, err := MarshalError(fmt.Errorf("could not verify: %w", test.err))
+		if err != nil {
+			t.Fatalf("MarshalError(%T) returned %s", test.err, err)
+		}
+
+		decoded, err := UnmarshalError(data)
+		if err != nil {
+			t.Fatalf("UnmarshalError(%s) returned %s", data, err)
+		}
+
+		if reflect.TypeOf(decoded) != reflect.TypeOf(test.err) {
+			t.Errorf("%T was decoded as %T", test.err, decoded)
+		}
+		if decoded.Error() != test.err.Error() || Code(decoded) != Code(test.err) || Category(decoded) != Category(test.err) {
+			t.Errorf("%T was decoded as %q [%s %s]", test.err, decoded, Code(decoded), Category(decoded))
+		}
+		if !stderrors.Is(decoded, test.err) || !stderrors.Is(test.err, decoded) || !stderrors.Is(decoded, test.kind) {
+			t.Errorf("errors.Is does not match the decoded %T", test.err)
+		}
+		if DiagnosticString(decoded) != DiagnosticString(test.err) {
+			t.Errorf("%T has a different diagnostic string once decoded:\n%s", test.err, DiagnosticString(decoded))
+		}
+
+		// The methods use the same encoding.
+		direct, err := json.Marshal(test.err)
+		if err != nil || string(direct) != string(data) {
+			t.Errorf("MarshalJSON of %T returned %s, %v", test.err, direct, err)
+		}
+		into := reflect.New(reflect.TypeOf(test.err).Elem()).Interface().(json.Unmarshaler)
+		if err := into.UnmarshalJSON(data); err != nil || !stderrors.Is(into.(error), test.err) {
+			t.Errorf("UnmarshalJSON of %T returned %v", test.err, err)
+		}
+	}
+}
+
+func Test_round_trips_keep_the_fields(t *testing.T) {
+	issuedAt := time.Date(2020, 9, 13, 12, 26, 40, 500, time.UTC)
+	horizon := issuedAt.Add(time.Hour)
+
+	var predates TokenPredatesHorizon
+	if err := json.Unmarshal(mustMarshal(t, TokenPredatesHorizonError(issuedAt, horizon)), &predates); err != nil {
+		t.Fatal(err)
+	}
+	if !predates.IssuedAt.Equal(issuedAt) || !predates.Horizon.Equal(horizon) {
+		t.Errorf("unexpected times %s and %s", predates.IssuedAt, predates.Horizon)
+	}
+
+	var malformed DiscoveryMalformed
+	if err := json.Unmarshal(mustMarshal(t, DiscoveryMalformedError("https://example.com", "<html>", "not json")), &malformed); err != nil {
+		t.Fatal(err)
+	}
+	if malformed.URL != "https://example.com" || malformed.Snippet != "<html>" {
+		t.Errorf("unexpected fields %+v", malformed)
+	}
+
+	var pins TLSPinMismatch
+	if err := json.Unmarshal(mustMarshal(t, TLSPinMismatchError([]string{"abc="})), &pins); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pins.Presented, []string{"abc="}) {
+		t.Errorf("unexpected presented keys %v", pins.Presented)
+	}
+}
+
+func Test_keys_unavailable_keeps_a_typed_cause(t *testing.T) {
+	original := KeysUnavailableError(fmt.Errorf("Get \"https://example.com\": %w", TLSPinMismatchError([]string{"abc="})))
+
+	decoded, err := UnmarshalError(mustMarshal(t, original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pins *TLSPinMismatch
+	if !stderrors.As(decoded, &pins) || !reflect.DeepEqual(pins.Presented, []string{"abc="}) {
+		t.Errorf("the cause was not decoded: %v", decoded)
+	}
+	if decoded.Error() != original.Error() || Code(decoded) != "KEYS_UNAVAILABLE" {
+		t.Errorf("unexpected decoded error %q", decoded)
+	}
+}
+
+func Test_the_wire_format_is_stable(t *testing.T) {
+	data := mustMarshal(t, IssuerNotAllowedError("https://evil.example.com"))
+	expected := `{"version":1,"code":"ISSUER_NOT_ALLOWED","category":"claims",` +
+		`"message":"issuer not allowed: \"https://evil.example.com\"","claim":"iss","actual":"https://evil.example.com"}`
+	if string(data) != expected {
+		t.Errorf("unexpected encoding:\n%s\nexpected:\n%s", data, expected)
+	}
+
+	// Fields from a newer release are ignored.
+	decoded, err := UnmarshalError([]byte(`{"version":1,"code":"KEY_NOT_PINNED","category":"token",` +
+		`"message":"the token is not signed with a pinned key: kid","hint":"rotate"}`))
+	if err != nil || !stderrors.Is(decoded, &KeyNotPinned{}) {
+		t.Errorf("UnmarshalError returned %v, %v", decoded, err)
+	}
+}
+
+func Test_unknown_codes_and_versions(t *testing.T) {
+	decoded, err := UnmarshalError([]byte(`{"version":1,"code":"TOKEN_REPLAYED","category":"claims","message":"jti seen before"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unrecognized *Unrecognized
+	if !stderrors.As(decoded, &unrecognized) || unrecognized.Code != "TOKEN_REPLAYED" || Code(decoded) != "TOKEN_REPLAYED" {
+		t.Errorf("expected an unrecognized error, got %#v", decoded)
+	}
+
+	for _, data := range []string{
+		`{"version":2,"code":"KEY_NOT_PINNED","message":"kid"}`,
+		`{"version":0,"code":"KEY_NOT_PINNED","message":"kid"}`,
+		`{"version":1,"message":"no code"}`,
+		`{"version":1,"code":"TOKEN_NOT_YET_VALID","message":"soon","actual":"tomorrow"}`,
+		`not json`,
+	} {
+		if _, err := UnmarshalError([]byte(data)); err == nil {
+			t.Errorf("expected an error decoding %s", data)
+		}
+	}
+
+	var pinned KeyNotPinned
+	if err := json.Unmarshal([]byte(`{"version":1,"code":"JWT_EMPTY","message":"empty"}`), &pinned); err == nil {
+		t.Errorf("expected an error decoding another code into a KeyNotPinned")
+	}
+
+	if _, err := MarshalError(stderrors.New("signature invalid")); err == nil {
+		t.Errorf("expected an error marshalling an untyped error")
+	}
+}
+
+func mustMarshal(t *testing.T, err error) []byte {
+	t.Helper()
+	data, marshalErr := MarshalError(err)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	return data
+}
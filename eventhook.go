@@ -0,0 +1,79 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// EventHookChallengeHeader carries the value Okta expects echoed back when
+// it verifies an event hook endpoint.
+const EventHookChallengeHeader = "X-Okta-Verification-Challenge"
+
+// VerifyEventHookRequest verifies the token in the Authorization header of
+// an Okta event hook delivery, which may be a Bearer token or the bare
+// token. It is verified as an access token, so the verifier should expect
+// the hook's issuer and have the hook endpoint's URL as its aud.
+func (j *JwtVerifier) VerifyEventHookRequest(r *http.Request) (*Jwt, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("event hook deliveries are POST requests, got %s", r.Method)
+	}
+
+	token, err := eventHookToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return j.VerifyAccessTokenContext(r.Context(), token)
+}
+
+func eventHookToken(r *http.Request) (string, error) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if header == "" {
+		return "", fmt.Errorf("the request does not contain an Authorization header")
+	}
+	if !strings.Contains(header, " ") {
+		return header, nil
+	}
+	return BearerTokenExtractor(r)
+}
+
+// AnswerEventHookChallenge answers Okta's one-time verification of an event
+// hook endpoint by echoing the EventHookChallengeHeader value as
+// {"verification": value}. It reports whether r was a verification
+// request; if not, it writes nothing. The error is that of encoding or
+// writing the answer; if the answer could not be encoded, a 500 is written
+// instead.
+func AnswerEventHookChallenge(w http.ResponseWriter, r *http.Request) (bool, error) {
+	challenge := r.Header.Get(EventHookChallengeHeader)
+	if r.Method != http.MethodGet || challenge == "" {
+		return false, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"verification": challenge})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return true, fmt.Errorf("could not encode the event hook verification answer: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		return true, fmt.Errorf("could not write the event hook verification answer: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,132 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	goerrors "errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_event_hook_challenge_and_delivery(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var jv *JwtVerifier
+	var delivered []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if answered, err := AnswerEventHookChallenge(w, r); answered {
+			if err != nil {
+				t.Errorf("could not answer the challenge: %s", err)
+			}
+			return
+		}
+		jwt, err := jv.VerifyEventHookRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		delivered = append(delivered, jwt.Issuer()+" "+string(body))
+	}))
+	defer hook.Close()
+	endpoint := hook.URL + "/hooks/okta"
+
+	var err error
+	jv, err = NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", endpoint),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
+	req.Header.Set(EventHookChallengeHeader, "a1b2c3")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answer map[string]string
+	json.NewDecoder(resp.Body).Decode(&answer)
+	resp.Body.Close()
+	if answer["verification"] != "a1b2c3" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected challenge response %v with content type %q", answer, resp.Header.Get("Content-Type"))
+	}
+
+	token := issuer.Sign(issuer.Claims(endpoint))
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"bearer token", "Bearer " + token, http.StatusOK},
+		{"bare token", token, http.StatusOK},
+		{"other audience", "Bearer " + issuer.Sign(issuer.Claims("api://default")), http.StatusUnauthorized},
+		{"no token", "", http.StatusUnauthorized},
+		{"basic credentials", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(`{"eventType":"user.session.start"}`))
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, resp.StatusCode)
+		}
+	}
+
+	if len(delivered) != 2 || delivered[0] != issuer.URL+` {"eventType":"user.session.start"}` {
+		t.Errorf("unexpected deliveries %q", delivered)
+	}
+}
+
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func Test_event_hook_challenge_reports_write_errors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/hooks/okta", nil)
+	req.Header.Set(EventHookChallengeHeader, "a1b2c3")
+
+	answered, err := AnswerEventHookChallenge(failingWriter{httptest.NewRecorder()}, req)
+	if !answered || !goerrors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("expected the write error to be returned, got %v, %v", answered, err)
+	}
+
+	answered, err = AnswerEventHookChallenge(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hooks/okta", nil))
+	if answered || err != nil {
+		t.Errorf("a delivery was answered as a challenge: %v, %v", answered, err)
+	}
+}
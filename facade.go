@@ -0,0 +1,53 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import "github.com/okta/okta-jwt-verifier-golang/verify"
+
+// facade adapts the verification methods of JwtVerifier and MultiVerifier
+// to verify.Verifier.
+type facade struct {
+	verifyAccessToken func(string) (*Jwt, error)
+	verifyIdToken     func(string) (*Jwt, error)
+}
+
+// Facade returns the verifier as a verify.Verifier, the stable API for code
+// that wraps this package.
+func (j *JwtVerifier) Facade() verify.Verifier {
+	return facade{verifyAccessToken: j.VerifyAccessToken, verifyIdToken: j.VerifyIdToken}
+}
+
+// Facade returns the verifier as a verify.Verifier, the stable API for code
+// that wraps this package.
+func (m *MultiVerifier) Facade() verify.Verifier {
+	return facade{verifyAccessToken: m.VerifyAccessToken, verifyIdToken: m.VerifyIdToken}
+}
+
+func (f facade) VerifyAccessToken(token string) (verify.Claims, error) {
+	return claimsOf(f.verifyAccessToken(token))
+}
+
+func (f facade) VerifyIdToken(token string) (verify.Claims, error) {
+	return claimsOf(f.verifyIdToken(token))
+}
+
+func claimsOf(jwt *Jwt, err error) (verify.Claims, error) {
+	if err != nil {
+		return nil, err
+	}
+	return jwt.Claims, nil
+}
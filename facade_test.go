@@ -0,0 +1,57 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/verify"
+)
+
+func Test_facade_returns_claims_and_codes(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+	jv := jvs.New()
+
+	for name, v := range map[string]verify.Verifier{
+		"verifier":       jv.Facade(),
+		"multi verifier": NewMultiVerifier(jv).Facade(),
+	} {
+		claims, err := v.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+		if err != nil {
+			t.Fatalf("%s: could not verify access_token: %s", name, err)
+		}
+		if claims["sub"] != "user@example.com" {
+			t.Errorf("%s: unexpected claims %v", name, claims)
+		}
+
+		claims, err = v.VerifyIdToken(issuer.Sign(issuer.Claims("api://other")))
+		if claims != nil || verify.CodeOf(err) != verify.CodeInvalid {
+			t.Errorf("%s: expected no claims and %s, got %v, %v", name, verify.CodeInvalid, claims, err)
+		}
+
+		if _, err := v.VerifyAccessToken(""); verify.CodeOf(err) != verify.CodeEmpty {
+			t.Errorf("%s: expected %s, got %v", name, verify.CodeEmpty, err)
+		}
+	}
+}
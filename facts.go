@@ -0,0 +1,90 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Standard facts, set by Middleware with WithSourceIPFact and
+// WithTLSClientCertFact.
+const (
+	// FactSourceIP is the net.IP the request came from.
+	FactSourceIP = "source_ip"
+
+	// FactTLSClientCert is true when the request was made over TLS with a
+	// client certificate, and false otherwise.
+	FactTLSClientCert = "tls_client_cert"
+)
+
+// Facts are what is known about the circumstances of a verification, such
+// as the request's source IP, attached to a call with WithFact. The
+// verifier itself never sets or reads them; they are passed to
+// ClaimValidators.
+type Facts map[string]interface{}
+
+// Require returns the fact named name, or an error if it was not attached
+// to the call.
+func (f Facts) Require(name string) (interface{}, error) {
+	value, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("fact %q is not available", name)
+	}
+	return value, nil
+}
+
+// ClaimValidator checks the value of a claim, given the facts attached to
+// the call. It is only called for claims the token carries; a validator
+// that needs a fact the call lacks should fail, which Facts.Require makes
+// easy.
+type ClaimValidator func(value interface{}, facts Facts) error
+
+// validateClaimValidators runs the validator of each claim the token
+// carries, except those marked Advisory in strictness, in name order, and
+// returns the first failure.
+func validateClaimValidators(validators map[string]ClaimValidator, claims map[string]interface{}, facts Facts, strictness map[string]Strictness) error {
+	names := make([]string, 0, len(validators))
+	for name := range validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strictness[name] == Advisory {
+			continue
+		}
+		if err := runClaimValidator(name, validators[name], claims, facts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runClaimValidator(name string, validator ClaimValidator, claims map[string]interface{}, facts Facts) error {
+	value, ok := claims[name]
+	if !ok {
+		return nil
+	}
+	if facts == nil {
+		facts = Facts{}
+	}
+	if err := validator(value, facts); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
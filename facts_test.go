@@ -0,0 +1,114 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+// internalZoneOnly accepts network_zone "internal" only from private
+// source addresses.
+func internalZoneOnly(value interface{}, facts Facts) error {
+	if value != "internal" {
+		return nil
+	}
+	fact, err := facts.Require(FactSourceIP)
+	if err != nil {
+		return err
+	}
+	if ip, ok := fact.(net.IP); !ok || !ip.IsPrivate() {
+		return fmt.Errorf("internal tokens are not accepted from %v", fact)
+	}
+	return nil
+}
+
+func Test_claim_validators_consult_the_call_facts(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithClaimValidator("network_zone", internalZoneOnly),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["network_zone"] = "internal"
+	internal := issuer.Sign(claims)
+
+	tests := []struct {
+		name  string
+		token string
+		opts  []VerifyOption
+		valid bool
+	}{
+		{"private source", internal, []VerifyOption{WithFact(FactSourceIP, net.ParseIP("10.1.2.3"))}, true},
+		{"public source", internal, []VerifyOption{WithFact(FactSourceIP, net.ParseIP("203.0.113.7"))}, false},
+		{"no claim", issuer.Sign(issuer.Claims("api://default")), nil, true},
+	}
+
+	for _, test := range tests {
+		_, err := jv.VerifyAccessTokenContext(context.Background(), test.token, test.opts...)
+		if test.valid && err != nil {
+			t.Errorf("%s: expected the token to be accepted: %s", test.name, err)
+		}
+		if !test.valid && (err == nil || !strings.Contains(err.Error(), "network_zone: internal tokens are not accepted")) {
+			t.Errorf("%s: expected the validator's error, got %v", test.name, err)
+		}
+	}
+
+	if _, err := jv.VerifyAccessTokenContext(context.Background(), internal, WithFact(FactSourceIP, net.ParseIP("10.1.2.3"))); err != nil {
+		t.Errorf("a fact from a previous call was not applied: %s", err)
+	}
+}
+
+func Test_claim_validators_fail_without_a_required_fact(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithClaimValidator("network_zone", internalZoneOnly),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["network_zone"] = "internal"
+
+	_, err = jv.VerifyAccessTokenContext(context.Background(), issuer.Sign(claims))
+	if err == nil || !strings.Contains(err.Error(), `network_zone: fact "source_ip" is not available`) {
+		t.Errorf("expected the missing fact to be reported, got %v", err)
+	}
+	if failureReason(err) != FailureClaims {
+		t.Errorf("expected a claims failure, got %q", failureReason(err))
+	}
+
+	if _, err := NewVerifier(issuer.URL, WithClaimValidator("network_zone", nil)); err == nil {
+		t.Errorf("expected a nil validator to be rejected")
+	}
+}
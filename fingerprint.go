@@ -0,0 +1,213 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// secretClaims are expected claim values that must not appear in a
+// ConfigDescription. They are replaced by their SHA-256 hash.
+var secretClaims = map[string]bool{
+	"nonce": true,
+}
+
+// ConfigDescription is the effective verification policy of a JwtVerifier.
+// It covers only the settings that decide whether a token is accepted, and
+// the InitProfile; the discovery, adaptor, logger and hooks are not part of
+// it.
+//
+// Fields added after the first release are tagged omitempty, so that their
+// default value leaves existing fingerprints unchanged.
+type ConfigDescription struct {
+	Issuer string `json:"issuer"`
+
+	SkipIssuerValidation bool `json:"skipIssuerValidation,omitempty"`
+
+	// ClaimsToValidate holds the expected claim values, with secret values
+	// such as the nonce replaced by "sha256:" and their hex encoded hash.
+	ClaimsToValidate map[string]string `json:"claimsToValidate"`
+
+	AllowedAlgorithms []string `json:"allowedAlgorithms"`
+
+	Leeway time.Duration `json:"leeway"`
+
+	RequiredScopes []string `json:"requiredScopes"`
+
+	RequiredGroups []string `json:"requiredGroups"`
+
+	RequireAllGroups bool `json:"requireAllGroups"`
+
+	GroupsClaim string `json:"groupsClaim"`
+
+	// NotIssuedBefore is the horizon set by SetNotIssuedBefore, or the zero
+	// time.
+	NotIssuedBefore time.Time `json:"notIssuedBefore"`
+
+	EnableDegradedMode bool `json:"enableDegradedMode,omitempty"`
+
+	ClaimRequirements map[string]StructClaimRequirement `json:"claimRequirements,omitempty"`
+
+	AllowNonCompliantBase64 bool `json:"allowNonCompliantBase64,omitempty"`
+
+	RequireSubject bool `json:"requireSubject,omitempty"`
+
+	ExpectedTokenType string `json:"expectedTokenType,omitempty"`
+
+	ForceLocalAccessTokenVerification bool `json:"forceLocalAccessTokenVerification,omitempty"`
+
+	AllowedKIDs []string `json:"allowedKids,omitempty"`
+
+	AllowedKeyThumbprints []string `json:"allowedKeyThumbprints,omitempty"`
+
+	// X5CValidation is set when X5CRoots is. The roots themselves are not
+	// described.
+	X5CValidation bool `json:"x5cValidation,omitempty"`
+
+	// TypedClaimsToValidate holds the expected claim values, each shown
+	// with its Go type.
+	TypedClaimsToValidate map[string]string `json:"typedClaimsToValidate,omitempty"`
+
+	// ClaimValidators names the claims with a ClaimValidator. What the
+	// validators check is not described.
+	ClaimValidators []string `json:"claimValidators,omitempty"`
+
+	// AdvisoryClaims names the claims marked Advisory in ClaimStrictness.
+	AdvisoryClaims []string `json:"advisoryClaims,omitempty"`
+
+	MaxTokenSize int `json:"maxTokenSize,omitempty"`
+
+	MaxTokenAge time.Duration `json:"maxTokenAge,omitempty"`
+
+	TransactionMaxTokenAge time.Duration `json:"transactionMaxTokenAge,omitempty"`
+
+	// TokenCacheTTL is how long a verified token is accepted without its
+	// signature being checked again, or 0 without a token cache.
+	TokenCacheTTL time.Duration `json:"tokenCacheTTL,omitempty"`
+
+	SecondaryKeySets []KeySource `json:"secondaryKeySets,omitempty"`
+
+	// AttestationKeyIDs are the IDs of the AttestationKeys, whose
+	// attestations VerifyWithAttestation accepts. The keys themselves are
+	// not described.
+	AttestationKeyIDs []string `json:"attestationKeyIds,omitempty"`
+
+	// LegacyBehaviors names the LegacyBehaviors the verifier reverted to,
+	// so that verifiers still relying on one can be found.
+	LegacyBehaviors []string `json:"legacyBehaviors,omitempty"`
+
+	// InitProfile names the verifier's InitProfile, e.g. "lazy". It does not
+	// affect which tokens are accepted, so it is left out of
+	// ConfigFingerprint.
+	InitProfile string `json:"initProfile,omitempty"`
+}
+
+// DescribeConfig returns the verifier's effective configuration for
+// display or comparison.
+func (j *JwtVerifier) DescribeConfig() ConfigDescription {
+	claims := make(map[string]string, len(j.ClaimsToValidate))
+	for claim, value := range j.ClaimsToValidate {
+		if secretClaims[claim] {
+			sum := sha256.Sum256([]byte(value))
+			value = "sha256:" + hex.EncodeToString(sum[:])
+		}
+		claims[claim] = value
+	}
+
+	typedClaims := make(map[string]string, len(j.TypedClaimsToValidate))
+	for claim, value := range j.TypedClaimsToValidate {
+		typedClaims[claim] = describeClaimValue(value)
+	}
+
+	validated := make([]string, 0, len(j.ClaimValidators))
+	for claim := range j.ClaimValidators {
+		validated = append(validated, claim)
+	}
+	sort.Strings(validated)
+
+	var attestationKeyIDs []string
+	for _, key := range j.AttestationKeys {
+		attestationKeyIDs = append(attestationKeyIDs, key.ID)
+	}
+
+	groupsClaim := j.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	return ConfigDescription{
+		Issuer:               j.Issuer,
+		SkipIssuerValidation: j.SkipIssuerValidation,
+		ClaimsToValidate:     claims,
+		AllowedAlgorithms:    sortedCopy(j.algorithms()),
+		Leeway:               j.leewayDuration(),
+		RequiredScopes:       sortedCopy(j.RequiredScopes),
+		RequiredGroups:       sortedCopy(j.RequiredGroups),
+		RequireAllGroups:     j.RequireAllGroups,
+		GroupsClaim:          groupsClaim,
+		NotIssuedBefore:      j.NotIssuedBefore().UTC(),
+		EnableDegradedMode:   j.EnableDegradedMode,
+		ClaimRequirements:    j.ClaimRequirements,
+
+		AllowNonCompliantBase64:           j.AllowNonCompliantBase64,
+		RequireSubject:                    j.RequireSubject,
+		ExpectedTokenType:                 j.ExpectedTokenType,
+		ForceLocalAccessTokenVerification: j.ForceLocalAccessTokenVerification,
+		AllowedKIDs:                       sortedCopy(j.AllowedKIDs),
+		AllowedKeyThumbprints:             sortedCopy(j.AllowedKeyThumbprints),
+		X5CValidation:                     j.X5CRoots != nil,
+		TypedClaimsToValidate:             typedClaims,
+		ClaimValidators:                   validated,
+		AdvisoryClaims:                    j.advisoryClaims(),
+		MaxTokenSize:                      j.MaxTokenSize,
+		MaxTokenAge:                       j.MaxTokenAge,
+		TransactionMaxTokenAge:            j.TransactionMaxTokenAge,
+		TokenCacheTTL:                     j.tokenCacheTTL(),
+		SecondaryKeySets:                  j.SecondaryKeySets,
+		AttestationKeyIDs:                 sortedCopy(attestationKeyIDs),
+		LegacyBehaviors:                   j.legacy.names(),
+		InitProfile:                       j.initProfile.String(),
+	}
+}
+
+// ConfigFingerprint returns a hex encoded SHA-256 hash of DescribeConfig,
+// without the InitProfile.
+// Two verifiers with the same policy have the same fingerprint, across
+// processes and releases, so it can be used to detect configuration drift
+// between services.
+func (j *JwtVerifier) ConfigFingerprint() string {
+	// encoding/json writes struct fields in declaration order and map keys
+	// sorted, so the encoding is canonical.
+	desc := j.DescribeConfig()
+	desc.InitProfile = ""
+	b, err := json.Marshal(desc)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,166 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/discovery/oidc"
+	"github.com/okta/okta-jwt-verifier-golang/logger"
+)
+
+func fingerprintBaseline() *JwtVerifier {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+		ClaimsToValidate: map[string]string{
+			"aud":   "api://default",
+			"nonce": "abc123",
+		},
+		RequiredScopes: []string{"openid", "profile"},
+		RequiredGroups: []string{"Admins"},
+	}
+	return jvs.New()
+}
+
+func Test_config_fingerprint_changes_with_policy(t *testing.T) {
+	baseline := fingerprintBaseline().ConfigFingerprint()
+
+	tests := []struct {
+		name   string
+		change func(j *JwtVerifier)
+	}{
+		{"issuer", func(j *JwtVerifier) { j.Issuer = "https://other.oktapreview.com" }},
+		{"issuer check", func(j *JwtVerifier) { j.SkipIssuerValidation = true }},
+		{"aud", func(j *JwtVerifier) { j.ClaimsToValidate["aud"] = "api://other" }},
+		{"missing aud", func(j *JwtVerifier) { delete(j.ClaimsToValidate, "aud") }},
+		{"nonce", func(j *JwtVerifier) { j.ClaimsToValidate["nonce"] = "xyz789" }},
+		{"leeway", func(j *JwtVerifier) { j.SetLeeway("30s") }},
+		{"scopes", func(j *JwtVerifier) { j.RequiredScopes = []string{"openid"} }},
+		{"groups", func(j *JwtVerifier) { j.RequiredGroups = []string{"Admins", "Support"} }},
+		{"require all groups", func(j *JwtVerifier) { j.RequireAllGroups = true }},
+		{"groups claim", func(j *JwtVerifier) { j.GroupsClaim = "roles" }},
+		{"degraded mode", func(j *JwtVerifier) { j.EnableDegradedMode = true }},
+		{"non-compliant base64", func(j *JwtVerifier) { j.AllowNonCompliantBase64 = true }},
+		{"require subject", func(j *JwtVerifier) { j.RequireSubject = true }},
+		{"token type", func(j *JwtVerifier) { j.ExpectedTokenType = "at+jwt" }},
+		{"force local verification", func(j *JwtVerifier) { j.ForceLocalAccessTokenVerification = true }},
+		{"allowed kids", func(j *JwtVerifier) { j.AllowedKIDs = []string{"key1"} }},
+		{"allowed key thumbprints", func(j *JwtVerifier) { j.AllowedKeyThumbprints = []string{"abc"} }},
+		{"x5c validation", func(j *JwtVerifier) { j.X5CRoots = x509.NewCertPool() }},
+		{"typed claims", func(j *JwtVerifier) { j.TypedClaimsToValidate = map[string]interface{}{"tenant_id": 42} }},
+		{"claim validators", func(j *JwtVerifier) {
+			j.ClaimValidators = map[string]ClaimValidator{"network_zone": func(interface{}, Facts) error { return nil }}
+		}},
+		{"advisory claims", func(j *JwtVerifier) { j.ClaimStrictness = map[string]Strictness{"tenant_id": Advisory} }},
+		{"max token size", func(j *JwtVerifier) { j.MaxTokenSize = 4096 }},
+		{"max token age", func(j *JwtVerifier) { j.MaxTokenAge = 15 * time.Minute }},
+		{"transaction max token age", func(j *JwtVerifier) { j.TransactionMaxTokenAge = time.Minute }},
+		{"token cache", func(j *JwtVerifier) { j.TokenCacheSize = 100 }},
+		{"secondary key sets", func(j *JwtVerifier) {
+			j.SecondaryKeySets = []KeySource{{JWKSURI: "https://other.oktapreview.com/oauth2/v1/keys"}}
+		}},
+		{"legacy behaviors", func(j *JwtVerifier) { j.legacy = legacySet{LegacyIssExactMatch: true} }},
+		{"attestation keys", func(j *JwtVerifier) { j.AttestationKeys = []AttestationKey{{ID: "gateway-1"}} }},
+		{"horizon", func(j *JwtVerifier) { j.SetNotIssuedBefore(time.Unix(1600000000, 0)) }},
+	}
+
+	for _, test := range tests {
+		jv := fingerprintBaseline()
+		test.change(jv)
+		if jv.ConfigFingerprint() == baseline {
+			t.Errorf("changing the %s did not change the fingerprint", test.name)
+		}
+	}
+}
+
+func Test_config_fingerprint_ignores_non_policy_fields(t *testing.T) {
+	baseline := fingerprintBaseline().ConfigFingerprint()
+
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+		ClaimsToValidate: map[string]string{
+			"nonce": "abc123",
+			"aud":   "api://default",
+		},
+		RequiredScopes: []string{"profile", "openid"},
+		RequiredGroups: []string{"Admins"},
+		GroupsClaim:    "groups",
+		Discovery:      (&oidc.Oidc{}).New(),
+		Adaptor:        (&lestrratGoJwx.LestrratGoJwx{MinRefreshInterval: time.Minute}).New(),
+		Logger:         logger.NoOp(),
+		Hooks:          Hooks{OnNearExpiry: func(NearExpiryEvent) {}},
+	}
+	jv := jvs.New()
+
+	if got := jv.ConfigFingerprint(); got != baseline {
+		t.Errorf("the fingerprint changed when only non-policy fields differed: %s != %s", got, baseline)
+	}
+}
+
+func Test_describe_config_hashes_the_nonce(t *testing.T) {
+	desc := fingerprintBaseline().DescribeConfig()
+
+	nonce := desc.ClaimsToValidate["nonce"]
+	if !strings.HasPrefix(nonce, "sha256:") || strings.Contains(nonce, "abc123") {
+		t.Errorf("the nonce was not hashed: %q", nonce)
+	}
+
+	if desc.ClaimsToValidate["aud"] != "api://default" {
+		t.Errorf("expected the aud to be described as is, got %q", desc.ClaimsToValidate["aud"])
+	}
+
+	if desc.Leeway != 2*time.Minute {
+		t.Errorf("expected the default leeway, got %s", desc.Leeway)
+	}
+}
+
+func Test_config_fingerprint_encodes_infinite_bounds(t *testing.T) {
+	bounded := func(min float64, max float64) string {
+		jv := fingerprintBaseline()
+		jv.ClaimRequirements = map[string]StructClaimRequirement{
+			"limit": {Type: TypeNumber, Minimum: &min, Maximum: &max},
+		}
+		return jv.ConfigFingerprint()
+	}
+
+	infinite := bounded(math.Inf(-1), math.Inf(1))
+	if infinite == bounded(0, math.Inf(1)) || infinite == bounded(math.Inf(-1), 100) {
+		t.Errorf("infinite bounds have the fingerprint of finite ones")
+	}
+
+	min, max := math.Inf(-1), math.NaN()
+	b, err := json.Marshal(StructClaimRequirement{Minimum: &min, Maximum: &max})
+	if err != nil || string(b) != `{"minimum":"-Inf","maximum":"NaN"}` {
+		t.Errorf("unexpected encoding of non-finite bounds: %s, %v", b, err)
+	}
+
+	// Finite bounds are encoded as before, so fingerprints do not change.
+	type plain StructClaimRequirement
+	min, max = -1.5, 10
+	requirement := StructClaimRequirement{Type: TypeNumber, Required: true, Minimum: &min, Maximum: &max}
+	got, _ := json.Marshal(requirement)
+	want, _ := json.Marshal(plain(requirement))
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
@@ -3,6 +3,19 @@ module github.com/okta/okta-jwt-verifier-golang
 require (
 	github.com/lestrrat-go/jwx v1.0.3
 	github.com/patrickmn/go-cache v0.0.0-20180815053127-5633e0862627
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
 )
 
-go 1.13
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/lestrrat-go/iter v0.0.0-20200422075355-fc1769541911 // indirect
+	github.com/lestrrat-go/pdebug v0.0.0-20200204225717-4d6bd78da58d // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+)
+
+go 1.20
@@ -0,0 +1,348 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/lifecycle"
+)
+
+// hookQueueSize is how many calls to Async hooks may wait to run before
+// further calls are dropped.
+const hookQueueSize = 256
+
+// Hooks are optional callbacks the verifier invokes to report on its work.
+// They never receive the raw token and cannot change the verification
+// result.
+//
+// A verifier calls JwtVerifier.Hooks first and then each of
+// AdditionalHooks, in order. Hooks are called synchronously on the
+// verifying goroutine, so a slow hook slows verification, and may be
+// called concurrently when the verifier is shared. A hook that panics is
+// recovered and reported to every OnHookPanic; the verification is not
+// affected.
+type Hooks struct {
+	// OnNearExpiry is called when a token verifies successfully but expires
+	// within the verifier's NearExpiryThreshold.
+	OnNearExpiry func(NearExpiryEvent)
+
+	// OnVerification is called once for every call to VerifyAccessToken,
+	// VerifyIdToken and their variants, with the outcome, for metrics. A
+	// token VerifyDegraded returns unverified is reported as a failure
+	// with Degraded set.
+	OnVerification func(VerificationEvent)
+
+	// OnCircuitStateChange is called when the CircuitBreaker changes
+	// state, on the goroutine whose fetch, or whose refusal, changed it.
+	OnCircuitStateChange func(CircuitEvent)
+
+	// OnKeyNotFound is called when a token's kid is not in the key set,
+	// even after a refresh, with the kids the key set does have.
+	OnKeyNotFound func(KeyNotFoundEvent)
+
+	// OnSecondaryKeySet is called when a token's signature is verified
+	// with a key from one of SecondaryKeySets instead of the issuer's key
+	// set. Tokens answered from the token cache do not call it.
+	OnSecondaryKeySet func(SecondaryKeySetEvent)
+
+	// OnHookPanic is called, synchronously, when any hook panics.
+	OnHookPanic func(HookPanicEvent)
+
+	// Async runs this set's hooks, except OnHookPanic, one at a time on a
+	// background goroutine instead of the verifying goroutine. If more than
+	// 256 calls are waiting, further calls are dropped and counted in
+	// DroppedHookCalls.
+	Async bool
+}
+
+type HookPanicEvent struct {
+	// Hook names the hook that panicked, e.g. "OnNearExpiry".
+	Hook string
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+type CircuitEvent struct {
+	From circuit.State
+	To   circuit.State
+}
+
+type KeyNotFoundEvent struct {
+	// KeyID is the token's kid.
+	KeyID string
+
+	// KeyIDs are the kids of the key set.
+	KeyIDs []string
+
+	// NearMiss is a kid of the key set that differs from KeyID only in
+	// whitespace or case, if there is one. Kids are compared byte for
+	// byte, so it points to a misconfigured issuer.
+	NearMiss string
+
+	// RequestID is the identifier set on the verification's context with
+	// WithRequestID, or empty.
+	RequestID string
+}
+
+type SecondaryKeySetEvent struct {
+	// JWKSURI is the URL of the secondary key set the token was verified
+	// with, and KeyID the token's kid.
+	JWKSURI string
+	KeyID   string
+
+	// RequestID is the identifier set on the verification's context with
+	// WithRequestID, or empty.
+	RequestID string
+}
+
+type NearExpiryEvent struct {
+	// Remaining is the time left until the token's exp.
+	Remaining time.Duration
+
+	// ClientID is the token's cid or client_id claim, if present.
+	ClientID string
+
+	// Fingerprint identifies the token without revealing it.
+	Fingerprint string
+
+	// RequestID is the identifier set on the verification's context with
+	// WithRequestID, or empty.
+	RequestID string
+}
+
+func (j *JwtVerifier) notifyNearExpiry(ctx context.Context, jwt string, token *Jwt, now time.Time) {
+	if j.NearExpiryThreshold <= 0 {
+		return
+	}
+
+	exp, err := token.Expiry()
+	if err != nil {
+		return
+	}
+
+	remaining := exp.Sub(now)
+	if remaining >= j.NearExpiryThreshold {
+		return
+	}
+	j.recordNearExpiry()
+
+	cid, _ := token.ClientID()
+	event := NearExpiryEvent{
+		Remaining:   remaining,
+		ClientID:    cid,
+		Fingerprint: tokenFingerprint(jwt),
+		RequestID:   requestID(ctx),
+	}
+	j.runHooks("OnNearExpiry", func(h Hooks) func() {
+		if h.OnNearExpiry == nil {
+			return nil
+		}
+		onNearExpiry := h.OnNearExpiry
+		return func() { onNearExpiry(event) }
+	})
+}
+
+func (j *JwtVerifier) notifyKeyNotFound(ctx context.Context, err *errors.KeyNotFound) {
+	if err.NearMiss != "" {
+		j.log().Warn("the token's kid differs from a key set kid only in whitespace or case",
+			"kid", err.KeyID, "near_miss", err.NearMiss)
+	}
+
+	event := KeyNotFoundEvent{
+		KeyID:     err.KeyID,
+		KeyIDs:    append([]string(nil), err.KeyIDs...),
+		NearMiss:  err.NearMiss,
+		RequestID: requestID(ctx),
+	}
+	j.runHooks("OnKeyNotFound", func(h Hooks) func() {
+		if h.OnKeyNotFound == nil {
+			return nil
+		}
+		onKeyNotFound := h.OnKeyNotFound
+		return func() { onKeyNotFound(event) }
+	})
+}
+
+func (j *JwtVerifier) notifySecondaryKeySet(ctx context.Context, source *KeySource, kid string) {
+	j.recordSecondaryKeySet()
+	j.log().Debug("token verified with a secondary key set", "url", source.JWKSURI, "kid", kid)
+
+	event := SecondaryKeySetEvent{JWKSURI: source.JWKSURI, KeyID: kid, RequestID: requestID(ctx)}
+	j.runHooks("OnSecondaryKeySet", func(h Hooks) func() {
+		if h.OnSecondaryKeySet == nil {
+			return nil
+		}
+		onSecondaryKeySet := h.OnSecondaryKeySet
+		return func() { onSecondaryKeySet(event) }
+	})
+}
+
+func (j *JwtVerifier) circuitStateChanged(from circuit.State, to circuit.State) {
+	if to == circuit.Open {
+		j.recordCircuitOpen()
+		j.log().Warn("circuit breaker opened, issuer requests are suspended", "from", string(from))
+	} else {
+		j.log().Debug("circuit breaker changed state", "from", string(from), "to", string(to))
+	}
+
+	event := CircuitEvent{From: from, To: to}
+	j.runHooks("OnCircuitStateChange", func(h Hooks) func() {
+		if h.OnCircuitStateChange == nil {
+			return nil
+		}
+		onCircuitStateChange := h.OnCircuitStateChange
+		return func() { onCircuitStateChange(event) }
+	})
+}
+
+func (j *JwtVerifier) hookSets() []Hooks {
+	return append([]Hooks{j.Hooks}, j.AdditionalHooks...)
+}
+
+// runHooks calls the hook named name of every hook set, in order. bind
+// returns the call for a set, or nil if the set does not have the hook.
+func (j *JwtVerifier) runHooks(name string, bind func(Hooks) func()) {
+	for _, h := range j.hookSets() {
+		call := bind(h)
+		if call == nil {
+			continue
+		}
+		if h.Async && j.hookQueue != nil {
+			j.hookQueue.enqueue(func() { j.callHook(name, call) })
+			continue
+		}
+		j.callHook(name, call)
+	}
+}
+
+// callHook calls a hook, recovering and reporting a panic.
+func (j *JwtVerifier) callHook(name string, call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			j.hookPanicked(name, r, debug.Stack())
+		}
+	}()
+	call()
+}
+
+func (j *JwtVerifier) hookPanicked(name string, value interface{}, stack []byte) {
+	j.log().Warn("hook panicked", "hook", name, "panic", fmt.Sprint(value))
+
+	event := HookPanicEvent{Hook: name, Value: value, Stack: stack}
+	for _, h := range j.hookSets() {
+		if h.OnHookPanic == nil {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					j.log().Warn("hook panicked", "hook", "OnHookPanic", "panic", fmt.Sprint(r))
+				}
+			}()
+			h.OnHookPanic(event)
+		}()
+	}
+}
+
+// DroppedHookCalls returns how many calls to Async hooks were dropped
+// because the queue was full.
+func (j *JwtVerifier) DroppedHookCalls() uint64 {
+	if j.hookQueue == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&j.hookQueue.dropped)
+}
+
+// hookQueue runs the calls to Async hooks on a single goroutine, started
+// when the first call is queued and stopped by Close.
+type hookQueue struct {
+	// dropped is first so that it is 64-bit aligned for atomic access on
+	// 32-bit platforms.
+	dropped uint64
+
+	calls      chan func()
+	stop       chan struct{}
+	start      sync.Once
+	close      sync.Once
+	goroutines *lifecycle.Registry
+}
+
+func newHookQueue(goroutines *lifecycle.Registry) *hookQueue {
+	return &hookQueue{
+		calls:      make(chan func(), hookQueueSize),
+		stop:       make(chan struct{}),
+		goroutines: goroutines,
+	}
+}
+
+func (q *hookQueue) enqueue(call func()) {
+	// Calls made after shutdown are discarded, as queued ones are, rather
+	// than starting a goroutine Close has already waited for.
+	select {
+	case <-q.stop:
+		return
+	default:
+	}
+
+	q.start.Do(func() {
+		q.goroutines.Go("hook queue", func() {
+			for {
+				select {
+				case <-q.stop:
+					return
+				default:
+				}
+				select {
+				case call := <-q.calls:
+					call()
+				case <-q.stop:
+					return
+				}
+			}
+		})
+	})
+
+	select {
+	case q.calls <- call:
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+	}
+}
+
+func (q *hookQueue) shutdown() {
+	q.close.Do(func() {
+		close(q.stop)
+	})
+}
+
+// tokenFingerprint is a short, stable identifier for a token that is safe
+// to log.
+func tokenFingerprint(jwt string) string {
+	return tokenHash(jwt)[:16]
+}
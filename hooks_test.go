@@ -0,0 +1,361 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_near_expiry_hook_fires_inside_the_threshold(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var events []NearExpiryEvent
+	jvs := JwtVerifier{
+		Issuer:              issuer.URL,
+		ClaimsToValidate:    map[string]string{"aud": "api://default"},
+		NearExpiryThreshold: time.Minute,
+		Hooks: Hooks{
+			OnNearExpiry: func(e NearExpiryEvent) {
+				events = append(events, e)
+			},
+		},
+	}
+
+	jv := jvs.New()
+
+	inside := issuer.Claims("api://default")
+	inside["exp"] = time.Now().Add(30 * time.Second).Unix()
+	inside["cid"] = "client123"
+	insideToken := issuer.Sign(inside)
+
+	outside := issuer.Claims("api://default")
+	outside["exp"] = time.Now().Add(2 * time.Minute).Unix()
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(outside)); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	if len(events) != 0 {
+		t.Fatalf("expected no event outside the threshold, got %d", len(events))
+	}
+
+	if _, err := jv.VerifyAccessToken(insideToken); err != nil {
+		t.Fatalf("a near expiry token must still verify: %s", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event inside the threshold, got %d", len(events))
+	}
+	if stats := jv.Stats(); stats.NearExpiry != 1 {
+		t.Errorf("expected 1 near expiry token in the stats, got %d", stats.NearExpiry)
+	}
+
+	e := events[0]
+	if e.Remaining <= 0 || e.Remaining > 30*time.Second {
+		t.Errorf("unexpected remaining lifetime %s", e.Remaining)
+	}
+	if e.ClientID != "client123" {
+		t.Errorf("expected cid client123, got %q", e.ClientID)
+	}
+	if e.Fingerprint == "" || strings.Contains(insideToken, e.Fingerprint) {
+		t.Errorf("unexpected fingerprint %q", e.Fingerprint)
+	}
+
+	jv.NearExpiryThreshold = 0
+	if _, err := jv.VerifyAccessToken(insideToken); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("expected a zero threshold to disable the hook")
+	}
+	if stats := jv.Stats(); stats.NearExpiry != 1 {
+		t.Errorf("expected a zero threshold to disable the counter, got %d", stats.NearExpiry)
+	}
+}
+
+func nearExpiryToken(issuer *testissuer.Issuer) string {
+	claims := issuer.Claims("api://default")
+	claims["exp"] = time.Now().Add(30 * time.Second).Unix()
+	return issuer.Sign(claims)
+}
+
+func Test_hook_sets_are_called_in_registration_order(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var calls []string
+	record := func(name string) Hooks {
+		return Hooks{OnNearExpiry: func(NearExpiryEvent) { calls = append(calls, name) }}
+	}
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithHooks(record("first")),
+		WithHooks(Hooks{}),
+		WithHooks(record("second")),
+		WithHooks(record("third")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jv.NearExpiryThreshold = time.Minute
+
+	if _, err := jv.VerifyAccessToken(nearExpiryToken(issuer)); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	if strings.Join(calls, ",") != "first,second,third" {
+		t.Errorf("hooks were called out of order: %v", calls)
+	}
+}
+
+func Test_a_panicking_hook_does_not_fail_verification(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var panics []HookPanicEvent
+	called := false
+	log := &recordingLogger{}
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithLogger(log),
+		WithHooks(Hooks{
+			OnNearExpiry: func(NearExpiryEvent) { panic("hook bug") },
+			OnHookPanic:  func(e HookPanicEvent) { panics = append(panics, e) },
+		}),
+		WithHooks(Hooks{
+			OnNearExpiry: func(NearExpiryEvent) { called = true },
+			OnHookPanic:  func(HookPanicEvent) { panic("panic handler bug") },
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jv.NearExpiryThreshold = time.Minute
+
+	if _, err := jv.VerifyAccessToken(nearExpiryToken(issuer)); err != nil {
+		t.Fatalf("a panicking hook failed the verification: %s", err)
+	}
+
+	if !called {
+		t.Errorf("a panic stopped later hooks from being called")
+	}
+	if len(panics) != 1 || panics[0].Hook != "OnNearExpiry" || panics[0].Value != "hook bug" || len(panics[0].Stack) == 0 {
+		t.Errorf("unexpected panic events: %v", panics)
+	}
+	if !log.contains("hook bug") || !log.contains("panic handler bug") {
+		t.Errorf("the panics were not logged")
+	}
+}
+
+func Test_async_hooks_do_not_delay_verification(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithHooks(Hooks{
+			Async: true,
+			OnNearExpiry: func(NearExpiryEvent) {
+				<-release
+				mu.Lock()
+				calls++
+				mu.Unlock()
+			},
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+	jv.NearExpiryThreshold = time.Minute
+
+	token := nearExpiryToken(issuer)
+	start := time.Now()
+	total := hookQueueSize + 10
+	for i := 0; i < total; i++ {
+		if _, err := jv.VerifyAccessToken(token); err != nil {
+			t.Fatalf("could not verify access_token: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("a blocked async hook delayed verification: %s", elapsed)
+	}
+
+	// One call is running and hookQueueSize are queued; the rest, at
+	// least, were dropped.
+	dropped := jv.DroppedHookCalls()
+	if dropped < uint64(total-hookQueueSize-1) {
+		t.Errorf("expected calls to be dropped while the queue was full, got %d", dropped)
+	}
+
+	close(release)
+	waitFor(t, "queued hooks", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return uint64(calls)+dropped == uint64(total)
+	})
+}
+
+func Test_verification_hook_reports_each_outcome(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var mu sync.Mutex
+	var events []VerificationEvent
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithHooks(Hooks{
+			OnVerification: func(e VerificationEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, e)
+			},
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := issuer.Sign(issuer.Claims("api://default"))
+
+	expired := issuer.Claims("api://default")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	other := issuer.Claims("api://default")
+	other["sub"] = "other@example.com"
+	parts := strings.Split(valid, ".")
+	forged := parts[0] + "." + parts[1] + "." + strings.Split(issuer.Sign(other), ".")[2]
+
+	tests := []struct {
+		name     string
+		token    string
+		cacheHit bool
+		expected FailureReason
+	}{
+		{"first", valid, false, FailureNone},
+		{"cached", valid, true, FailureNone},
+		{"expired", issuer.Sign(expired), true, FailureExpired},
+		{"audience", issuer.Sign(issuer.Claims("api://other")), true, FailureAudience},
+		{"signature", forged, true, FailureSignature},
+		{"malformed", "not.a.jwt", true, FailureMalformed},
+	}
+
+	for _, test := range tests {
+		mu.Lock()
+		events = nil
+		mu.Unlock()
+
+		_, verifyErr := jv.VerifyAccessToken(test.token)
+
+		mu.Lock()
+		if len(events) != 1 {
+			t.Fatalf("%s: expected 1 event, got %d", test.name, len(events))
+		}
+		e := events[0]
+		mu.Unlock()
+
+		if e.Method != "VerifyAccessToken" {
+			t.Errorf("%s: unexpected method %q", test.name, e.Method)
+		}
+		if e.Success != (verifyErr == nil) || e.Failure != test.expected {
+			t.Errorf("%s: expected failure %q, got success %v and failure %q (%v)",
+				test.name, test.expected, e.Success, e.Failure, verifyErr)
+		}
+		if e.CacheHit != test.cacheHit {
+			t.Errorf("%s: expected cache hit %v, got %v", test.name, test.cacheHit, e.CacheHit)
+		}
+		if e.Duration <= 0 {
+			t.Errorf("%s: unexpected duration %s", test.name, e.Duration)
+		}
+	}
+}
+
+func Test_verification_hook_reports_unavailable_keys(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetUnavailable(true)
+
+	var events []VerificationEvent
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithRetry(1, time.Millisecond),
+		WithHooks(Hooks{
+			OnVerification: func(e VerificationEvent) {
+				events = append(events, e)
+			},
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jv.VerifyIdToken(issuer.Sign(issuer.Claims("api://default"))); err == nil {
+		t.Fatal("expected the verification to fail")
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	e := events[0]
+	if e.Method != "VerifyIdToken" || e.Success || e.CacheHit || e.Failure != FailureKeysUnavailable {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func Test_hook_events_carry_the_request_id(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var nearExpiry []NearExpiryEvent
+	var notFound []KeyNotFoundEvent
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithHooks(Hooks{
+			OnNearExpiry:  func(e NearExpiryEvent) { nearExpiry = append(nearExpiry, e) },
+			OnKeyNotFound: func(e KeyNotFoundEvent) { notFound = append(notFound, e) },
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jv.NearExpiryThreshold = time.Minute
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	if _, err := jv.VerifyAccessTokenContext(ctx, nearExpiryToken(issuer)); err != nil {
+		t.Fatal(err)
+	}
+	header := map[string]interface{}{"alg": "RS256", "kid": "unknown"}
+	if _, err := jv.VerifyAccessTokenContext(ctx, issuer.SignWithHeader(header, issuer.Claims("api://default"))); err == nil {
+		t.Fatal("a token with an unknown kid was accepted")
+	}
+
+	if len(nearExpiry) != 1 || nearExpiry[0].RequestID != "req-1" {
+		t.Errorf("expected the near expiry event to carry the request ID, got %+v", nearExpiry)
+	}
+	if len(notFound) != 1 || notFound[0].RequestID != "req-1" {
+		t.Errorf("expected the key not found event to carry the request ID, got %+v", notFound)
+	}
+}
@@ -0,0 +1,105 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_raising_the_horizon_rejects_previously_valid_tokens(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["iat"] = time.Now().Add(-time.Minute).Unix()
+	token := issuer.Sign(claims)
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	jv := jvs.New()
+
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	jv.SetNotIssuedBefore(time.Now())
+
+	_, err := jv.VerifyAccessToken(token)
+	var predates *errors.TokenPredatesHorizon
+	if !goerrors.As(err, &predates) {
+		t.Fatalf("expected a TokenPredatesHorizon error, got %v", err)
+	}
+
+	if _, err := jv.VerifyIdToken(token); !goerrors.As(err, &predates) {
+		t.Errorf("expected a TokenPredatesHorizon error for id tokens, got %v", err)
+	}
+
+	stats := jv.Stats()
+	if stats.PredatedHorizon != 2 || stats.Rejected != 2 {
+		t.Errorf("expected both rejections to be counted, got %+v", stats)
+	}
+	if !stats.NotIssuedBefore.Equal(jv.NotIssuedBefore()) {
+		t.Errorf("expected the horizon %s in the stats, got %s", jv.NotIssuedBefore(), stats.NotIssuedBefore)
+	}
+
+	jv.SetNotIssuedBefore(time.Time{})
+
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Errorf("could not verify access_token after clearing the horizon: %s", err)
+	}
+}
+
+func Test_the_horizon_can_be_changed_during_verification(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	jv := jvs.New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			jv.VerifyAccessToken(token)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			jv.SetNotIssuedBefore(time.Now().Add(-time.Duration(i) * time.Hour))
+		}(i)
+	}
+	wg.Wait()
+
+	if jv.NotIssuedBefore().IsZero() {
+		t.Errorf("expected a horizon to be set")
+	}
+}
@@ -0,0 +1,95 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// InitProfile decides how much of its startup work NewVerifier does before
+// returning. The work is that of Prime: fetching the discovery document and
+// key set.
+type InitProfile struct {
+	eager      bool
+	bestEffort bool
+	timeout    time.Duration
+}
+
+// Lazy does no network work in NewVerifier; the first verification fetches
+// what it needs. It is the default, and suits command line tools.
+func Lazy() InitProfile {
+	return InitProfile{}
+}
+
+// Eager primes the verifier in NewVerifier, which returns Prime's error if
+// it fails. It suits API servers that should not start misconfigured.
+func Eager() InitProfile {
+	return InitProfile{eager: true}
+}
+
+// EagerBestEffort primes the verifier in NewVerifier for at most timeout.
+// If priming fails or takes longer, NewVerifier logs a warning and returns
+// the verifier anyway, which then fetches lazily; fetches still in flight
+// complete in the background and are cached.
+func EagerBestEffort(timeout time.Duration) InitProfile {
+	return InitProfile{eager: true, bestEffort: true, timeout: timeout}
+}
+
+// String names the profile, as DescribeConfig shows it.
+func (p InitProfile) String() string {
+	switch {
+	case !p.eager:
+		return "lazy"
+	case !p.bestEffort:
+		return "eager"
+	}
+	return fmt.Sprintf("eager-best-effort(%s)", p.timeout)
+}
+
+// WithInitProfile sets how NewVerifier initializes the verifier. It
+// defaults to Lazy.
+func WithInitProfile(profile InitProfile) Option {
+	return func(o *verifierOptions) {
+		if profile.bestEffort && profile.timeout <= 0 {
+			o.fail("EagerBestEffort requires a positive timeout")
+			return
+		}
+		o.init = profile
+	}
+}
+
+// initialize does the startup work of the verifier's InitProfile.
+func (j *JwtVerifier) initialize() error {
+	profile := j.initProfile
+	if !profile.eager {
+		return nil
+	}
+
+	if !profile.bestEffort {
+		return j.Prime(context.Background())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), profile.timeout)
+	defer cancel()
+	if err := j.Prime(ctx); err != nil {
+		j.log().Warn("warmup did not complete, continuing lazily", "issuer", j.Issuer,
+			"timeout", profile.timeout.String(), "error", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func newProfiledVerifier(issuer *testissuer.Issuer, profile InitProfile) (*JwtVerifier, error) {
+	return NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithRetry(1, time.Millisecond),
+		WithInitProfile(profile))
+}
+
+func Test_lazy_initialization_does_no_network_work(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetUnavailable(true)
+
+	jv, err := newProfiledVerifier(issuer, Lazy())
+	if err != nil {
+		t.Fatalf("a lazy verifier failed on an unavailable issuer: %s", err)
+	}
+	if issuer.MetadataRequests() != 0 || issuer.JWKSRequests() != 0 {
+		t.Errorf("a lazy verifier made requests at startup")
+	}
+	if got := jv.DescribeConfig().InitProfile; got != "lazy" {
+		t.Errorf("expected the lazy profile to be described, got %q", got)
+	}
+}
+
+func Test_eager_initialization_warms_up_or_fails(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := newProfiledVerifier(issuer, Eager())
+	if err != nil {
+		t.Fatalf("an eager verifier failed on a healthy issuer: %s", err)
+	}
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("expected the documents to be fetched at startup, got %d and %d requests",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("the first verification after warmup fetched again")
+	}
+	if got := jv.DescribeConfig().InitProfile; got != "eager" {
+		t.Errorf("expected the eager profile to be described, got %q", got)
+	}
+
+	issuer.SetUnavailable(true)
+	if _, err := newProfiledVerifier(issuer, Eager()); err == nil {
+		t.Errorf("an eager verifier started with an unavailable issuer")
+	}
+}
+
+func Test_best_effort_initialization_never_exceeds_its_deadline(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetDelay(300 * time.Millisecond)
+
+	start := time.Now()
+	jv, err := newProfiledVerifier(issuer, EagerBestEffort(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("a best effort verifier failed on a slow issuer: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 250*time.Millisecond {
+		t.Errorf("NewVerifier took %s, past its 50ms deadline", elapsed)
+	}
+	if got := jv.DescribeConfig().InitProfile; got != "eager-best-effort(50ms)" {
+		t.Errorf("expected the best effort profile to be described, got %q", got)
+	}
+
+	// The verifier falls back to fetching lazily.
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify access_token after the deadline passed: %s", err)
+	}
+
+	issuer.SetDelay(0)
+	issuer.SetUnavailable(true)
+	if _, err := newProfiledVerifier(issuer, EagerBestEffort(time.Second)); err != nil {
+		t.Errorf("a best effort verifier failed on an unavailable issuer: %s", err)
+	}
+}
+
+func Test_init_profiles_are_validated_and_left_out_of_the_fingerprint(t *testing.T) {
+	if _, err := NewVerifier("https://golang.oktapreview.com", WithInitProfile(EagerBestEffort(0))); err == nil {
+		t.Errorf("expected an error for a best effort profile without a timeout")
+	}
+
+	jv := fingerprintBaseline()
+	lazy := jv.ConfigFingerprint()
+	jv.initProfile = EagerBestEffort(time.Second)
+	if jv.ConfigFingerprint() != lazy {
+		t.Errorf("the init profile changed the fingerprint")
+	}
+}
@@ -0,0 +1,344 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+// Package fetch retrieves the JSON documents published by an issuer.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	goerrors "errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
+)
+
+const (
+	// DefaultAttempts is how many times a document is requested before
+	// giving up, unless Retry says otherwise.
+	DefaultAttempts = 3
+
+	// DefaultBaseDelay is the delay before the first retry. It doubles for
+	// each retry after that.
+	DefaultBaseDelay = 100 * time.Millisecond
+
+	// DefaultTimeout bounds a fetch, including its retries, unless a
+	// timeout is given.
+	DefaultTimeout = 30 * time.Second
+)
+
+// Retry configures how failed requests are retried. The zero value uses
+// DefaultAttempts and DefaultBaseDelay.
+type Retry struct {
+	Attempts  int
+	BaseDelay time.Duration
+
+	// Rand jitters the delays. It defaults to a source seeded from
+	// crypto/rand.
+	Rand RandSource
+}
+
+// RandSource is a source of randomness that is safe for concurrent use.
+type RandSource interface {
+	Int63n(n int64) int64
+}
+
+// NewRand returns a RandSource drawing from src, which need not be safe for
+// concurrent use. With a fixed seed, such as rand.NewSource(1), the jitter
+// is reproducible.
+func NewRand(src rand.Source) RandSource {
+	return &lockedRand{rand: rand.New(src)}
+}
+
+type lockedRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *lockedRand) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Int63n(n)
+}
+
+// defaultRand is seeded from crypto/rand, so that the jitter of processes
+// started together differs, whatever the seed of math/rand.
+var defaultRand = NewRand(rand.NewSource(cryptoSeed()))
+
+func cryptoSeed() int64 {
+	var b [8]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
+
+func (r Retry) attempts() int {
+	if r.Attempts <= 0 {
+		return DefaultAttempts
+	}
+	return r.Attempts
+}
+
+// delay returns the jittered delay before the given retry, counting from 1:
+// between half and all of BaseDelay * 2^(retry-1).
+func (r Retry) delay(retry int) time.Duration {
+	base := r.BaseDelay
+	if base == 0 {
+		base = DefaultBaseDelay
+	}
+	random := r.Rand
+	if random == nil {
+		random = defaultRand
+	}
+	d := base << uint(retry-1)
+	return d/2 + time.Duration(random.Int63n(int64(d/2)+1))
+}
+
+// statusError is returned for responses other than 200 OK.
+type statusError struct {
+	url    string
+	status int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.status, e.url)
+}
+
+// retryable reports whether a request that failed with err may succeed if
+// it is repeated: network errors, 429 Too Many Requests and 5xx responses.
+func retryable(err error) bool {
+	if s, ok := err.(*statusError); ok {
+		return s.status == http.StatusTooManyRequests || s.status >= 500
+	}
+	return true
+}
+
+var bom = []byte("\xef\xbb\xbf")
+
+// snippetLength is how much of a malformed body is kept for diagnostics.
+const snippetLength = 64
+
+// Config configures Get. The zero value uses http.DefaultClient and the
+// default retries and timeout.
+type Config struct {
+	Client  *http.Client
+	Retry   Retry
+	Timeout time.Duration
+
+	// Header is added to every request. Its values are never included in
+	// errors.
+	Header map[string]string
+
+	// Breaker, if set, is consulted before each fetch and told whether it
+	// reached the server. While it is open, fetches fail at once with
+	// errors.ErrCircuitOpen.
+	Breaker *circuit.Breaker
+}
+
+// Response is a successful response.
+type Response struct {
+	// Body has had TrimPrefix applied.
+	Body []byte
+
+	Header http.Header
+}
+
+// Get fetches url and returns the body with TrimPrefix applied. Responses
+// other than 200 OK are an error. Network errors, 429 and 5xx responses are
+// retried with exponential backoff as configured by config.Retry.
+//
+// The whole fetch, retries included, must finish within config.Timeout, or
+// DefaultTimeout if it is zero; if it does not, the error wraps
+// context.DeadlineExceeded.
+func Get(config Config, url string) ([]byte, error) {
+	resp, err := GetResponse(context.Background(), config, url)
+	return resp.Body, err
+}
+
+// GetResponse is Get that also returns the response headers. The requests
+// carry ctx's values, such as a trace span, but not its deadline or
+// cancellation: the response is cached for other callers, so one caller
+// giving up must not fail it.
+func GetResponse(ctx context.Context, config Config, url string) (Response, error) {
+	return do(detached{ctx}, config, url, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	})
+}
+
+// detached is a context with the values of another, but never done.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// PostForm is Get for a POST of form, as an
+// application/x-www-form-urlencoded body, that also ends when ctx does.
+func PostForm(ctx context.Context, config Config, url string, form neturl.Values) ([]byte, error) {
+	body := form.Encode()
+	resp, err := do(ctx, config, url, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	return resp.Body, err
+}
+
+func do(parent context.Context, config Config, url string, newRequest func(context.Context) (*http.Request, error)) (Response, error) {
+	if config.Breaker == nil {
+		return retrying(parent, config, url, newRequest)
+	}
+
+	if err := config.Breaker.Allow(); err != nil {
+		return Response{}, err
+	}
+	resp, err := retrying(parent, config, url, newRequest)
+	config.Breaker.Done(err != nil && unreachable(err))
+	return resp, err
+}
+
+// unreachable reports whether a failed fetch counts against a breaker: the
+// server could not be reached in time or was unable to answer. A
+// cancelled request or a 404 says nothing about the server's health.
+func unreachable(err error) bool {
+	if goerrors.Is(err, context.Canceled) {
+		return false
+	}
+	if goerrors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var status *statusError
+	if goerrors.As(err, &status) {
+		return retryable(status)
+	}
+	return true
+}
+
+func retrying(parent context.Context, config Config, url string, newRequest func(context.Context) (*http.Request, error)) (Response, error) {
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	retry := config.Retry
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	var err error
+	for attempt := 1; attempt <= retry.attempts(); attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(retry.delay(attempt - 1)):
+			case <-ctx.Done():
+			}
+		}
+
+		if ctx.Err() != nil {
+			return Response{}, interrupted(ctx, url, timeout)
+		}
+
+		var resp Response
+		resp, err = send(ctx, client, config.Header, url, newRequest)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return Response{}, interrupted(ctx, url, timeout)
+		}
+		if !retryable(err) {
+			return Response{}, err
+		}
+	}
+
+	return Response{}, err
+}
+
+// interrupted describes why ctx ended a request to url.
+func interrupted(ctx context.Context, url string, timeout time.Duration) error {
+	if ctx.Err() == context.Canceled {
+		return fmt.Errorf("request to %s was cancelled: %w", url, ctx.Err())
+	}
+	return fmt.Errorf("request to %s timed out after %s: %w", url, timeout, ctx.Err())
+}
+
+func send(ctx context.Context, client *http.Client, header map[string]string, url string,
+	newRequest func(context.Context) (*http.Request, error)) (Response, error) {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, &statusError{url: url, status: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Body: TrimPrefix(body), Header: resp.Header}, nil
+}
+
+// TrimPrefix removes a leading UTF-8 byte order mark and whitespace, which
+// some proxies add to the documents they relay.
+func TrimPrefix(body []byte) []byte {
+	return bytes.TrimLeft(bytes.TrimPrefix(body, bom), " \t\r\n")
+}
+
+// Snippet returns the start of body with anything other than printable
+// ASCII replaced, so it is safe to include in errors and logs.
+func Snippet(body []byte) string {
+	if len(body) > snippetLength {
+		body = body[:snippetLength]
+	}
+
+	snippet := make([]byte, len(body))
+	for i, c := range body {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		snippet[i] = c
+	}
+	return string(snippet)
+}
@@ -0,0 +1,278 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
+)
+
+func Test_trim_prefix_removes_a_bom_and_whitespace(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{"{}", "{}"},
+		{"\xef\xbb\xbf{}", "{}"},
+		{" \r\n\t{}", "{}"},
+		{"\xef\xbb\xbf \n{}", "{}"},
+		{"<html></html>", "<html></html>"},
+	}
+
+	for _, test := range tests {
+		if got := string(TrimPrefix([]byte(test.body))); got != test.expected {
+			t.Errorf("TrimPrefix(%q) returned %q, expected %q", test.body, got, test.expected)
+		}
+	}
+}
+
+func Test_snippet_is_short_and_printable(t *testing.T) {
+	if got := Snippet([]byte("<html>\r\n\x00\xff")); got != "<html>...." {
+		t.Errorf("Snippet() returned %q", got)
+	}
+
+	long := make([]byte, 1000)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if got := Snippet(long); len(got) != snippetLength {
+		t.Errorf("Snippet() returned %d bytes, expected %d", len(got), snippetLength)
+	}
+}
+
+func failingServer(failures int, status int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(atomic.AddInt32(&requests, 1)) <= failures {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	return server, &requests
+}
+
+func Test_get_retries_server_errors(t *testing.T) {
+	retry := Retry{Attempts: 3, BaseDelay: time.Millisecond}
+
+	for _, status := range []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		server, requests := failingServer(2, status)
+
+		body, err := Get(Config{Retry: retry}, server.URL)
+		if err != nil || string(body) != "{}" {
+			t.Errorf("%d: expected success after retries, got %q, %v", status, body, err)
+		}
+		if got := atomic.LoadInt32(requests); got != 3 {
+			t.Errorf("%d: expected 3 requests, got %d", status, got)
+		}
+
+		server.Close()
+	}
+}
+
+func Test_get_gives_up_after_the_last_attempt(t *testing.T) {
+	server, requests := failingServer(5, http.StatusBadGateway)
+	defer server.Close()
+
+	_, err := Get(Config{Retry: Retry{Attempts: 2, BaseDelay: time.Millisecond}}, server.URL)
+	if err == nil || !strings.Contains(err.Error(), "unexpected status 502") {
+		t.Errorf("expected the last error to be returned, got %v", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("expected 2 requests, got %d", got)
+	}
+}
+
+func Test_get_does_not_retry_client_errors(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusUnauthorized, http.StatusBadRequest} {
+		server, requests := failingServer(1, status)
+
+		if _, err := Get(Config{Retry: Retry{Attempts: 3, BaseDelay: time.Millisecond}}, server.URL); err == nil {
+			t.Errorf("%d: expected an error", status)
+		}
+		if got := atomic.LoadInt32(requests); got != 1 {
+			t.Errorf("%d: expected 1 request, got %d", status, got)
+		}
+
+		server.Close()
+	}
+}
+
+func Test_get_counts_only_server_failures_against_the_breaker(t *testing.T) {
+	config := Config{
+		Retry:   Retry{Attempts: 1},
+		Breaker: circuit.New(1, time.Minute, time.Minute),
+	}
+
+	notFound, _ := failingServer(1, http.StatusNotFound)
+	defer notFound.Close()
+	Get(config, notFound.URL)
+	if config.Breaker.State() != circuit.Closed {
+		t.Fatalf("a 404 opened the breaker")
+	}
+
+	unavailable, requests := failingServer(5, http.StatusServiceUnavailable)
+	defer unavailable.Close()
+	Get(config, unavailable.URL)
+	if config.Breaker.State() != circuit.Open {
+		t.Fatalf("a 503 did not open the breaker")
+	}
+
+	if _, err := Get(config, unavailable.URL); err == nil || !strings.Contains(err.Error(), "circuit breaker is open") {
+		t.Errorf("expected the open breaker to refuse the request, got %v", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+}
+
+func Test_get_retries_network_errors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	start := time.Now()
+	if _, err := Get(Config{Retry: Retry{Attempts: 3, BaseDelay: 10 * time.Millisecond}}, url); err == nil {
+		t.Fatalf("expected an error from a closed server")
+	}
+
+	// Two retries wait at least 5ms and 10ms.
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("expected the retries to back off, took %s", elapsed)
+	}
+}
+
+func Test_get_times_out(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := Get(Config{Retry: Retry{Attempts: 3, BaseDelay: time.Millisecond}, Timeout: 50 * time.Millisecond}, server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the timeout was not honoured, took %s", elapsed)
+	}
+}
+
+func Test_retry_delays_grow_exponentially_with_jitter(t *testing.T) {
+	retry := Retry{BaseDelay: 100 * time.Millisecond, Rand: NewRand(rand.NewSource(1))}
+	for n, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			if d := retry.delay(n); d < max/2 || d > max {
+				t.Errorf("retry %d: delay %s is outside [%s, %s]", n, d, max/2, max)
+			}
+		}
+	}
+}
+
+func Test_retry_delays_are_reproducible_with_a_fixed_seed(t *testing.T) {
+	delays := func(retry Retry) []time.Duration {
+		var ds []time.Duration
+		for n := 1; n <= 5; n++ {
+			ds = append(ds, retry.delay(n))
+		}
+		return ds
+	}
+
+	first := delays(Retry{Rand: NewRand(rand.NewSource(42))})
+	second := delays(Retry{Rand: NewRand(rand.NewSource(42))})
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("the same seed gave different delays: %v and %v", first, second)
+	}
+
+	if other := delays(Retry{Rand: NewRand(rand.NewSource(43))}); reflect.DeepEqual(first, other) {
+		t.Errorf("different seeds gave the same delays: %v", first)
+	}
+}
+
+func Test_post_form_sends_the_form_and_honours_the_context(t *testing.T) {
+	var form string
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		r.ParseForm()
+		form = r.PostForm.Encode()
+		contentType = r.Header.Get("Content-Type")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	body, err := PostForm(context.Background(), Config{}, server.URL, neturl.Values{"token": {"abc"}})
+	if err != nil || string(body) != "{}" {
+		t.Fatalf("PostForm() returned %q, %v", body, err)
+	}
+	if form != "token=abc" || contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("unexpected request: %q with content type %q", form, contentType)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := PostForm(ctx, Config{}, server.URL, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled context to fail the request, got %v", err)
+	}
+}
+
+type valueKey struct{}
+
+type valueTransport struct {
+	seen interface{}
+}
+
+func (t *valueTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.seen = r.Context().Value(valueKey{})
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func Test_get_response_carries_the_context_values_but_not_its_cancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	transport := &valueTransport{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), valueKey{}, "span"))
+	cancel()
+
+	resp, err := GetResponse(ctx, Config{Client: &http.Client{Transport: transport}}, server.URL)
+	if err != nil || string(resp.Body) != "{}" {
+		t.Fatalf("GetResponse() returned %q, %v", resp.Body, err)
+	}
+	if transport.seen != "span" {
+		t.Errorf("expected the request to carry the context's values, got %v", transport.seen)
+	}
+}
@@ -0,0 +1,103 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package fetch
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lifetime returns how long the response may be cached, according to its
+// Cache-Control max-age directive, less its Age, or failing that its
+// Expires header. no-store, no-cache and an Expires that cannot be parsed
+// all mean the response must not be reused, which is a lifetime of zero. A
+// response without either header gets fallback. The result is clamped to
+// [min, max]; a max of zero means no upper bound.
+func (r Response) Lifetime(fallback, min, max time.Duration) time.Duration {
+	lifetime, ok := r.headerLifetime(time.Now())
+	if !ok {
+		lifetime = fallback
+	}
+	if max > 0 && lifetime > max {
+		lifetime = max
+	}
+	if lifetime < min {
+		lifetime = min
+	}
+	return lifetime
+}
+
+// headerLifetime returns the lifetime given by the headers, and false if
+// they give none.
+func (r Response) headerLifetime(now time.Time) (time.Duration, bool) {
+	if maxAge, ok := cacheControlMaxAge(r.Header.Values("Cache-Control")); ok {
+		if age, err := strconv.ParseInt(strings.TrimSpace(r.Header.Get("Age")), 10, 64); err == nil && age > 0 {
+			maxAge -= time.Duration(age) * time.Second
+		}
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		return maxAge, true
+	}
+
+	expires := r.Header.Get("Expires")
+	if expires == "" {
+		return 0, false
+	}
+	at, err := http.ParseTime(expires)
+	if err != nil {
+		// RFC 9111: an invalid Expires, such as "0", means already expired.
+		return 0, true
+	}
+	if date, err := http.ParseTime(r.Header.Get("Date")); err == nil {
+		now = date
+	}
+	if lifetime := at.Sub(now); lifetime > 0 {
+		return lifetime, true
+	}
+	return 0, true
+}
+
+// cacheControlMaxAge returns the max-age given by the Cache-Control header
+// values, with no-store and no-cache treated as a max-age of zero.
+func cacheControlMaxAge(values []string) (time.Duration, bool) {
+	var maxAge time.Duration
+	found := false
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "no-store", "no-cache":
+				return 0, true
+			case "max-age":
+				seconds, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(arg), `"`), 10, 64)
+				if err != nil || seconds < 0 {
+					return 0, true
+				}
+				if seconds > int64(maxDuration/time.Second) {
+					seconds = int64(maxDuration / time.Second)
+				}
+				maxAge, found = time.Duration(seconds)*time.Second, true
+			}
+		}
+	}
+	return maxAge, found
+}
+
+const maxDuration = time.Duration(1<<63 - 1)
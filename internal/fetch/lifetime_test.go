@@ -0,0 +1,94 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_lifetime_follows_the_cache_headers(t *testing.T) {
+	date := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{"no headers", http.Header{}, 5 * time.Minute},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=3600"}}, time.Hour},
+		{"quoted max-age", http.Header{"Cache-Control": {`max-age="600"`}}, 10 * time.Minute},
+		{"max-age less age", http.Header{"Cache-Control": {"max-age=3600"}, "Age": {"600"}}, 50 * time.Minute},
+		{"max-age below the minimum", http.Header{"Cache-Control": {"max-age=5"}}, time.Minute},
+		{"max-age above the maximum", http.Header{"Cache-Control": {"max-age=604800"}}, 24 * time.Hour},
+		{"huge max-age", http.Header{"Cache-Control": {"max-age=99999999999999999"}}, 24 * time.Hour},
+		{"max-age=0", http.Header{"Cache-Control": {"max-age=0"}}, time.Minute},
+		{"invalid max-age", http.Header{"Cache-Control": {"max-age=soon"}}, time.Minute},
+		{"no-store", http.Header{"Cache-Control": {"no-store, max-age=3600"}}, time.Minute},
+		{"no-cache", http.Header{"Cache-Control": {"max-age=3600", "no-cache"}}, time.Minute},
+		{"other directives only", http.Header{"Cache-Control": {"public, must-revalidate"}}, 5 * time.Minute},
+		{"max-age wins over expires", http.Header{
+			"Cache-Control": {"max-age=7200"},
+			"Date":          {date.Format(http.TimeFormat)},
+			"Expires":       {date.Add(time.Hour).Format(http.TimeFormat)},
+		}, 2 * time.Hour},
+		{"expires", http.Header{
+			"Date":    {date.Format(http.TimeFormat)},
+			"Expires": {date.Add(30 * time.Minute).Format(http.TimeFormat)},
+		}, 30 * time.Minute},
+		{"expires in the past", http.Header{
+			"Date":    {date.Format(http.TimeFormat)},
+			"Expires": {date.Add(-time.Hour).Format(http.TimeFormat)},
+		}, time.Minute},
+		{"invalid expires", http.Header{"Expires": {"0"}}, time.Minute},
+	}
+
+	for _, test := range tests {
+		got := Response{Header: test.header}.Lifetime(5*time.Minute, time.Minute, 24*time.Hour)
+		if got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, got)
+		}
+	}
+}
+
+func Test_lifetime_without_a_maximum(t *testing.T) {
+	resp := Response{Header: http.Header{"Cache-Control": {"max-age=604800"}}}
+	if got := resp.Lifetime(5*time.Minute, 0, 0); got != 7*24*time.Hour {
+		t.Errorf("expected a week, got %s", got)
+	}
+}
+
+func Test_get_response_returns_the_headers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=120")
+		w.Write([]byte("\xef\xbb\xbf{}"))
+	}))
+	defer server.Close()
+
+	resp, err := GetResponse(context.Background(), Config{}, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "{}" {
+		t.Errorf("expected the trimmed body, got %q", resp.Body)
+	}
+	if got := resp.Lifetime(5*time.Minute, 0, 0); got != 2*time.Minute {
+		t.Errorf("expected the lifetime from the response, got %s", got)
+	}
+}
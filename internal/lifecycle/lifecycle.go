@@ -0,0 +1,114 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package lifecycle tracks the goroutines a verifier starts, so that Close
+// can wait for them to exit and leaked ones can be listed.
+package lifecycle
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry tracks running goroutines by name. Its zero value is ready to
+// use, and a nil Registry runs goroutines untracked.
+type Registry struct {
+	mu      sync.Mutex
+	next    uint64
+	running map[uint64]string
+
+	// idle is closed when the last running goroutine exits.
+	idle chan struct{}
+}
+
+// Go runs f on a new goroutine, registered under name until f returns.
+func (r *Registry) Go(name string, f func()) {
+	if r == nil {
+		go f()
+		return
+	}
+
+	r.mu.Lock()
+	if r.running == nil {
+		r.running = map[uint64]string{}
+	}
+	if len(r.running) == 0 {
+		r.idle = make(chan struct{})
+	}
+	r.next++
+	id := r.next
+	r.running[id] = name
+	r.mu.Unlock()
+
+	go func() {
+		defer r.done(id)
+		f()
+	}()
+}
+
+func (r *Registry) done(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, id)
+	if len(r.running) == 0 {
+		close(r.idle)
+	}
+}
+
+// Running returns the names of the running goroutines, sorted, with a
+// name repeated for each goroutine running under it.
+func (r *Registry) Running() []string {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, name := range r.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Wait waits up to timeout for every running goroutine to exit, and
+// reports whether they did. Goroutines started while it waits are waited
+// for too.
+func (r *Registry) Wait(timeout time.Duration) bool {
+	if r == nil {
+		return true
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		r.mu.Lock()
+		if len(r.running) == 0 {
+			r.mu.Unlock()
+			return true
+		}
+		idle := r.idle
+		r.mu.Unlock()
+
+		select {
+		case <-idle:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
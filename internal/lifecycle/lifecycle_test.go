@@ -0,0 +1,63 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package lifecycle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_wait_returns_once_every_goroutine_has_exited(t *testing.T) {
+	var r Registry
+	release := make(chan struct{})
+	r.Go("worker", func() { <-release })
+	r.Go("worker", func() { <-release })
+	r.Go("other", func() {})
+
+	if r.Wait(10 * time.Millisecond) {
+		t.Fatalf("Wait returned true while goroutines were blocked")
+	}
+	if running := r.Running(); !reflect.DeepEqual(running, []string{"worker", "worker"}) {
+		t.Errorf("expected two workers running, got %v", running)
+	}
+
+	close(release)
+	if !r.Wait(time.Second) {
+		t.Fatalf("Wait timed out with %v running", r.Running())
+	}
+	if running := r.Running(); len(running) > 0 {
+		t.Errorf("expected nothing running, got %v", running)
+	}
+
+	// The registry can be reused once idle.
+	r.Go("again", func() {})
+	if !r.Wait(time.Second) {
+		t.Errorf("Wait timed out after reuse")
+	}
+}
+
+func Test_a_nil_registry_runs_goroutines_untracked(t *testing.T) {
+	var r *Registry
+	done := make(chan struct{})
+	r.Go("untracked", func() { close(done) })
+	<-done
+
+	if r.Running() != nil || !r.Wait(0) {
+		t.Errorf("a nil registry should have nothing running")
+	}
+}
@@ -0,0 +1,58 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+// Package memo keeps the decoded form of the last document seen under each
+// key, so documents read from a cache are only decoded when they change.
+package memo
+
+import (
+	"bytes"
+	"sync"
+)
+
+type entry struct {
+	raw   []byte
+	value interface{}
+}
+
+type Memo struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// Decode returns the decoded form of raw, calling decode only if raw differs
+// from the document last decoded for key.
+func (m *Memo) Decode(key string, raw []byte, decode func([]byte) (interface{}, error)) (interface{}, error) {
+	m.mu.Lock()
+	e, ok := m.entries[key]
+	m.mu.Unlock()
+	if ok && bytes.Equal(e.raw, raw) {
+		return e.value, nil
+	}
+
+	value, err := decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if m.entries == nil {
+		m.entries = map[string]entry{}
+	}
+	m.entries[key] = entry{raw: append([]byte(nil), raw...), value: value}
+	m.mu.Unlock()
+
+	return value, nil
+}
@@ -0,0 +1,79 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+// Package segment decodes the base64 segments of a compact JWS.
+package segment
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// IsBase64URL reports whether s uses only the unpadded base64url alphabet
+// and has a length an encoding can produce.
+func IsBase64URL(s string) bool {
+	if len(s)%4 == 1 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// IsStdBase64 reports whether s uses only the standard base64 alphabet,
+// with or without padding, and has a length an encoding can produce.
+func IsStdBase64(s string) bool {
+	unpadded := strings.TrimRight(s, "=")
+	if padding := len(s) - len(unpadded); padding > 2 || (padding > 0 && len(s)%4 != 0) {
+		return false
+	}
+	if len(unpadded)%4 == 1 {
+		return false
+	}
+	for i := 0; i < len(unpadded); i++ {
+		c := unpadded[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '+', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeLenient decodes s as unpadded base64url, as RFC 7515 requires, and
+// failing that as standard base64, padded or not, as some non-compliant
+// signers produce. The second return value reports whether the fallback
+// was needed.
+func DecodeLenient(s string) ([]byte, bool, error) {
+	if IsBase64URL(s) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		return b, false, err
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.RawStdEncoding, base64.StdEncoding} {
+		if b, err := encoding.DecodeString(s); err == nil {
+			return b, true, nil
+		}
+	}
+	return nil, false, fmt.Errorf("not base64url or standard base64")
+}
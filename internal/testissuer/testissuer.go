@@ -0,0 +1,552 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package testissuer provides an in-process authorization server that
+// serves a discovery document and a JWKS, and mints RS256 tokens signed by
+// the keys it publishes. It is only intended for tests.
+package testissuer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// issuerPath is the path of a custom authorization server's issuer.
+const issuerPath = "/oauth2/default"
+
+type signingKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+type Issuer struct {
+	Server *httptest.Server
+
+	// URL is the issuer identifier, suitable for JwtVerifier.Issuer.
+	URL string
+
+	// path is the issuer's path: issuerPath, or empty for an org
+	// authorization server.
+	path string
+
+	mu               sync.Mutex
+	keys             []signingKey
+	keyParams        map[string]interface{}
+	unavailable      bool
+	jwksUnavailable  bool
+	rewriteBody      func(path string, body []byte) []byte
+	responseHeader   http.Header
+	requiredHeader   [2]string
+	failures         int
+	failureStatus    int
+	delay            time.Duration
+	metadataRequests int
+	jwksRequests     int
+
+	introspectionClient   [2]string
+	opaqueTokens          map[string]map[string]interface{}
+	revoked               map[string]bool
+	introspectionRequests int
+}
+
+// New starts an issuer with a single signing key.
+func New() *Issuer {
+	i := &Issuer{path: issuerPath}
+	i.Server = httptest.NewServer(http.HandlerFunc(i.serveHTTP))
+	i.URL = i.Server.URL + issuerPath
+	i.Rotate()
+	return i
+}
+
+// NewOrg starts an issuer shaped like an Okta org authorization server,
+// whose URL has no path.
+func NewOrg() *Issuer {
+	i := &Issuer{}
+	i.Server = httptest.NewServer(http.HandlerFunc(i.serveHTTP))
+	i.URL = i.Server.URL
+	i.Rotate()
+	return i
+}
+
+// NewTLS starts an issuer served over HTTPS with a self-signed certificate,
+// available as Server.Certificate(). Failed handshakes are not logged.
+func NewTLS() *Issuer {
+	i := &Issuer{path: issuerPath}
+	i.Server = httptest.NewUnstartedServer(http.HandlerFunc(i.serveHTTP))
+	i.Server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	i.Server.StartTLS()
+	i.URL = i.Server.URL + issuerPath
+	i.Rotate()
+	return i
+}
+
+func (i *Issuer) Close() {
+	i.Server.Close()
+}
+
+// Rotate adds a new signing key to the JWKS and uses it to sign subsequent
+// tokens. Previously published keys remain in the JWKS.
+func (i *Issuer) Rotate() string {
+	i.mu.Lock()
+	kid := fmt.Sprintf("key%d", len(i.keys)+1)
+	i.mu.Unlock()
+	return i.RotateTo(kid)
+}
+
+// RotateTo is Rotate with the given kid for the new key.
+func (i *Issuer) RotateTo(kid string) string {
+	return i.RotateToSize(kid, 2048)
+}
+
+// RotateToSize is RotateTo with an RSA key of the given size in bits.
+func (i *Issuer) RotateToSize(kid string, bits int) string {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		panic(err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys = append(i.keys, signingKey{kid: kid, key: key})
+	return kid
+}
+
+// SetKeyParams overrides members of every published JWK. A nil value
+// removes the member, e.g. {"use": nil, "key_ops": []string{"verify"}}.
+func (i *Issuer) SetKeyParams(params map[string]interface{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keyParams = params
+}
+
+// SetUnavailable makes every endpoint respond with 503 Service Unavailable,
+// as during an outage, until it is called again with false.
+func (i *Issuer) SetUnavailable(unavailable bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.unavailable = unavailable
+}
+
+// SetJWKSUnavailable makes the JWKS endpoint respond with 503 Service
+// Unavailable while the discovery document is still served.
+func (i *Issuer) SetJWKSUnavailable(unavailable bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.jwksUnavailable = unavailable
+}
+
+// SetBodyRewrite passes the discovery document and JWKS bodies through
+// rewrite before they are served, e.g. to add a prefix as some proxies do.
+func (i *Issuer) SetBodyRewrite(rewrite func(path string, body []byte) []byte) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rewriteBody = rewrite
+}
+
+// SetResponseHeader sets a header, e.g. Cache-Control, on every JSON
+// response. An empty value removes it.
+func (i *Issuer) SetResponseHeader(name string, value string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.responseHeader == nil {
+		i.responseHeader = http.Header{}
+	}
+	if value == "" {
+		i.responseHeader.Del(name)
+	} else {
+		i.responseHeader.Set(name, value)
+	}
+}
+
+// RequireHeader makes every endpoint respond with 401 Unauthorized to
+// requests without the header name set to value.
+func (i *Issuer) RequireHeader(name string, value string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.requiredHeader = [2]string{name, value}
+}
+
+// FailNext makes the next n requests, to any endpoint, respond with status.
+func (i *Issuer) FailNext(n int, status int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.failures = n
+	i.failureStatus = status
+}
+
+// SetDelay makes every endpoint wait for d before responding, as a slow
+// issuer would.
+func (i *Issuer) SetDelay(d time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.delay = d
+}
+
+// KeyID returns the kid of the key currently used for signing.
+func (i *Issuer) KeyID() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.keys[len(i.keys)-1].kid
+}
+
+// PublicKey returns the public key currently used for signing.
+func (i *Issuer) PublicKey() *rsa.PublicKey {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return &i.keys[len(i.keys)-1].key.PublicKey
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint, base64url encoded, of
+// the key currently used for signing.
+func (i *Issuer) Thumbprint() string {
+	i.mu.Lock()
+	key := i.keys[len(i.keys)-1].key
+	i.mu.Unlock()
+
+	// The required members in lexicographic order, without whitespace.
+	canonical := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()))
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Claims returns a set of claims that will pass verification for the given
+// audience: the issuer, the audience, and an exp and iat relative to now.
+func (i *Issuer) Claims(aud string) map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss": i.URL,
+		"aud": aud,
+		"sub": "user@example.com",
+		"iat": now,
+		"exp": now + 3600,
+	}
+}
+
+// Sign returns a compact RS256 JWT carrying the given claims, signed by the
+// current key.
+func (i *Issuer) Sign(claims map[string]interface{}) string {
+	return i.SignWithHeader(map[string]interface{}{
+		"alg": "RS256",
+		"kid": i.KeyID(),
+	}, claims)
+}
+
+// SignWithHeader returns a compact JWT with an arbitrary header. The
+// signature is always computed with the current key.
+func (i *Issuer) SignWithHeader(header map[string]interface{}, claims map[string]interface{}) string {
+	i.mu.Lock()
+	key := i.keys[len(i.keys)-1].key
+	i.mu.Unlock()
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// SignRaw returns a compact JWT made of the given header and claims JSON,
+// encoded with encoding, and signed by the current key over the encoded
+// segments. It is for fixtures that other methods cannot produce, such as
+// tokens in standard base64.
+func (i *Issuer) SignRaw(header []byte, claims []byte, encoding *base64.Encoding) string {
+	signingInput := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	return signingInput + "." + encoding.EncodeToString(i.signature(signingInput))
+}
+
+// SignSegments returns a compact JWT of the given encoded header and
+// payload segments, signed by the current key over them as they are, with
+// a base64url signature. It is for fixtures whose segments are encoded
+// differently.
+func (i *Issuer) SignSegments(header string, payload string) string {
+	signingInput := header + "." + payload
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(i.signature(signingInput))
+}
+
+func (i *Issuer) signature(signingInput string) []byte {
+	i.mu.Lock()
+	key := i.keys[len(i.keys)-1].key
+	i.mu.Unlock()
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
+
+// SetIntrospectionClient makes the introspection endpoint require HTTP
+// Basic authentication with the given client ID and secret.
+func (i *Issuer) SetIntrospectionClient(clientID string, clientSecret string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.introspectionClient = [2]string{clientID, clientSecret}
+}
+
+// IssueOpaque returns a random opaque token that the introspection endpoint
+// reports as active with the given claims.
+func (i *Issuer) IssueOpaque(claims map[string]interface{}) string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.opaqueTokens == nil {
+		i.opaqueTokens = map[string]map[string]interface{}{}
+	}
+	i.opaqueTokens[token] = claims
+	return token
+}
+
+// Revoke makes the introspection endpoint report token as inactive.
+func (i *Issuer) Revoke(token string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.revoked == nil {
+		i.revoked = map[string]bool{}
+	}
+	i.revoked[token] = true
+}
+
+// IntrospectionRequests returns how many introspection requests were
+// answered.
+func (i *Issuer) IntrospectionRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.introspectionRequests
+}
+
+// MetadataRequests returns how many times the discovery document was served.
+func (i *Issuer) MetadataRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.metadataRequests
+}
+
+// JWKSRequests returns how many times the JWKS was served.
+func (i *Issuer) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksRequests
+}
+
+func (i *Issuer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	if i.failures > 0 {
+		i.failures--
+		status := i.failureStatus
+		i.mu.Unlock()
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	unavailable := i.unavailable
+	required := i.requiredHeader
+	delay := i.delay
+	i.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if unavailable {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if required[0] != "" && r.Header.Get(required[0]) != required[1] {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case i.path + "/.well-known/openid-configuration":
+		i.mu.Lock()
+		i.metadataRequests++
+		i.mu.Unlock()
+		i.writeJSON(w, r, map[string]interface{}{
+			"issuer":                 i.URL,
+			"jwks_uri":               i.URL + "/v1/keys",
+			"introspection_endpoint": i.URL + "/v1/introspect",
+
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	case i.path + "/v1/keys":
+		i.mu.Lock()
+		i.jwksRequests++
+		if i.jwksUnavailable {
+			i.mu.Unlock()
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		keySet := i.keySet()
+		i.mu.Unlock()
+		i.writeJSON(w, r, keySet)
+	case i.path + "/v1/introspect":
+		i.introspect(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// JWKS returns the key set as the JWKS endpoint serves it, without
+// counting a request.
+func (i *Issuer) JWKS() []byte {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	b, err := json.Marshal(i.keySet())
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// keySet builds the JWKS document. i.mu must be held.
+func (i *Issuer) keySet() map[string]interface{} {
+	keys := make([]map[string]interface{}, 0, len(i.keys))
+	for _, k := range i.keys {
+		jwk := map[string]interface{}{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": k.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		}
+		for name, value := range i.keyParams {
+			if value == nil {
+				delete(jwk, name)
+			} else {
+				jwk[name] = value
+			}
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// introspect answers an RFC 7662 request. Opaque tokens from IssueOpaque
+// and unexpired JWTs are active unless revoked; JWTs are not verified.
+func (i *Issuer) introspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	i.mu.Lock()
+	client := i.introspectionClient
+	i.mu.Unlock()
+	if client[0] != "" {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != client[0] || secret != client[1] {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	token := r.PostFormValue("token")
+
+	i.mu.Lock()
+	i.introspectionRequests++
+	revoked := i.revoked[token]
+	claims, opaque := i.opaqueTokens[token]
+	i.mu.Unlock()
+
+	if !opaque {
+		claims = jwtClaims(token)
+		if exp, ok := claims["exp"].(float64); ok && int64(exp) <= time.Now().Unix() {
+			claims = nil
+		}
+	}
+
+	response := map[string]interface{}{"active": false}
+	if claims != nil && !revoked {
+		for name, value := range claims {
+			response[name] = value
+		}
+		response["active"] = true
+	}
+	i.writeJSON(w, r, response)
+}
+
+func jwtClaims(token string) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+func (i *Issuer) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	i.mu.Lock()
+	rewrite := i.rewriteBody
+	for name, values := range i.responseHeader {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	i.mu.Unlock()
+	if rewrite != nil {
+		body = rewrite(r.URL.Path, body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func encodeSegment(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,258 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/fetch"
+)
+
+// DefaultIntrospectionCacheTTL is how long an active introspection result
+// is reused when IntrospectionCacheTTL is zero.
+const DefaultIntrospectionCacheTTL = 10 * time.Second
+
+// introspectionCacheSize bounds how many active results are cached.
+const introspectionCacheSize = 10000
+
+// IntrospectionResult is an RFC 7662 introspection response. Only Active is
+// meaningful for an inactive token.
+type IntrospectionResult struct {
+	Active bool
+
+	Scope     string
+	ClientID  string
+	Username  string
+	TokenType string
+	Subject   string
+	Issuer    string
+	Audience  []string
+	JwtID     string
+
+	// Expiry, IssuedAt and NotBefore are the exp, iat and nbf members, or
+	// the zero time when absent.
+	Expiry    time.Time
+	IssuedAt  time.Time
+	NotBefore time.Time
+
+	// Claims holds every member of the response, including those above.
+	// Numbers are json.Number. It is shared by cached results and must not
+	// be modified.
+	Claims map[string]interface{}
+}
+
+// Scopes returns Scope split on spaces.
+func (r *IntrospectionResult) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// Introspect asks the issuer's introspection_endpoint, found by discovery,
+// whether token is active. It works for opaque tokens, such as those of an
+// Okta org authorization server, and detects JWTs that verify locally but
+// have been revoked. The client authenticates with HTTP Basic, or with only
+// a client_id in the form when clientSecret is empty.
+//
+// An inactive token is not an error: the result has Active false. Active
+// results are cached for IntrospectionCacheTTL, but never past the token's
+// exp, so a revocation may go unnoticed for that long. The request uses the
+// verifier's HTTP client, request headers, retries and RequestTimeout.
+func (j *JwtVerifier) Introspect(ctx context.Context, token string, clientID string, clientSecret string) (*IntrospectionResult, error) {
+	if token == "" {
+		return nil, fmt.Errorf("token to introspect is empty")
+	}
+
+	metaData, err := j.getMetaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, ok := metaData["introspection_endpoint"].(string)
+	if !ok || endpoint == "" {
+		return nil, fmt.Errorf("the issuer's discovery document has no introspection_endpoint")
+	}
+
+	key := introspectionKey(endpoint, clientID, clientSecret, token)
+	if result, ok := j.introspections.get(key, j.now()); ok {
+		j.log().Debug("introspection cache hit", "url", endpoint)
+		return result, nil
+	}
+
+	form := url.Values{"token": {token}}
+	header := make(map[string]string, len(j.RequestHeaders)+1)
+	for name, value := range j.RequestHeaders {
+		header[name] = value
+	}
+	if clientSecret != "" {
+		header["Authorization"] = "Basic " + basicAuth(clientID, clientSecret)
+	} else {
+		form.Set("client_id", clientID)
+	}
+
+	body, err := fetch.PostForm(ctx, fetch.Config{
+		Client:  j.httpClient,
+		Retry:   j.retry,
+		Timeout: j.RequestTimeout,
+		Header:  header,
+	}, endpoint, form)
+	if err != nil {
+		j.log().Warn("introspection request failed", "url", endpoint, "error", err.Error())
+		return nil, fmt.Errorf("introspection request was not successful: %w", err)
+	}
+
+	result, err := decodeIntrospection(body)
+	if err != nil {
+		return nil, fmt.Errorf("introspection response from %s is malformed: %w", endpoint, err)
+	}
+
+	if result.Active {
+		j.introspections.put(key, result, j.now(), j.introspectionExpiry(result))
+	}
+
+	return result, nil
+}
+
+// introspectionExpiry is when a cached active result must be discarded.
+func (j *JwtVerifier) introspectionExpiry(result *IntrospectionResult) time.Time {
+	ttl := j.IntrospectionCacheTTL
+	if ttl == 0 {
+		ttl = DefaultIntrospectionCacheTTL
+	}
+	if ttl < 0 {
+		return time.Time{}
+	}
+	expires := j.now().Add(ttl)
+	if !result.Expiry.IsZero() && result.Expiry.Before(expires) {
+		expires = result.Expiry
+	}
+	return expires
+}
+
+func decodeIntrospection(body []byte) (*IntrospectionResult, error) {
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil || claims == nil {
+		return nil, fmt.Errorf("not a json object: %q", fetch.Snippet(body))
+	}
+
+	active, ok := claims["active"].(bool)
+	if !ok {
+		return nil, fmt.Errorf("the active member is missing or not a boolean")
+	}
+
+	result := &IntrospectionResult{Active: active, Claims: claims}
+	if !active {
+		return result, nil
+	}
+
+	jwt := &Jwt{Claims: claims}
+	result.Scope, _ = jwt.StringClaim("scope")
+	result.ClientID, _ = jwt.StringClaim("client_id")
+	result.Username, _ = jwt.StringClaim("username")
+	result.TokenType, _ = jwt.StringClaim("token_type")
+	result.Subject, _ = jwt.StringClaim("sub")
+	result.Issuer, _ = jwt.StringClaim("iss")
+	result.Audience = jwt.Audience()
+	result.JwtID, _ = jwt.StringClaim("jti")
+
+	for name, t := range map[string]*time.Time{"exp": &result.Expiry, "iat": &result.IssuedAt, "nbf": &result.NotBefore} {
+		if _, present := claims[name]; !present {
+			continue
+		}
+		value, err := jwt.TimeClaim(name)
+		if err != nil {
+			return nil, err
+		}
+		*t = value
+	}
+
+	return result, nil
+}
+
+func basicAuth(clientID string, clientSecret string) string {
+	// RFC 6749 section 2.3.1 form-encodes the credentials before joining
+	// them.
+	credentials := url.QueryEscape(clientID) + ":" + url.QueryEscape(clientSecret)
+	return base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// introspectionKey identifies a cached result. The credentials are part of
+// it so that a result is only reused for the client that obtained it, and
+// everything is hashed so the cache holds neither tokens nor secrets.
+func introspectionKey(endpoint string, clientID string, clientSecret string, token string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(endpoint + "\x00" + clientID + "\x00" + clientSecret + "\x00" + token))
+}
+
+type cachedIntrospection struct {
+	result  *IntrospectionResult
+	expires time.Time
+}
+
+// introspectionCache holds active introspection results until they expire.
+type introspectionCache struct {
+	mu      sync.Mutex
+	results map[[sha256.Size]byte]cachedIntrospection
+}
+
+func newIntrospectionCache() *introspectionCache {
+	return &introspectionCache{results: map[[sha256.Size]byte]cachedIntrospection{}}
+}
+
+func (c *introspectionCache) get(key [sha256.Size]byte, now time.Time) (*IntrospectionResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.results[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(cached.expires) {
+		delete(c.results, key)
+		return nil, false
+	}
+	result := *cached.result
+	return &result, true
+}
+
+// put caches result until expires. When the cache is full, expired results
+// are dropped, and if it is still full the result is not cached.
+func (c *introspectionCache) put(key [sha256.Size]byte, result *IntrospectionResult, now time.Time, expires time.Time) {
+	if !now.Before(expires) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.results) >= introspectionCacheSize {
+		for k, cached := range c.results {
+			if !now.Before(cached.expires) {
+				delete(c.results, k)
+			}
+		}
+		if len(c.results) >= introspectionCacheSize {
+			return
+		}
+	}
+	c.results[key] = cachedIntrospection{result: result, expires: expires}
+}
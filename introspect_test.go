@@ -0,0 +1,144 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_introspect_reports_an_opaque_token(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	issuer.SetIntrospectionClient("client", "s3cr3t")
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := issuer.IssueOpaque(map[string]interface{}{
+		"scope":     "openid profile",
+		"client_id": "client",
+		"sub":       "user@example.com",
+		"aud":       "api://default",
+		"exp":       exp,
+		"uid":       "00u1",
+	})
+
+	jv, err := NewVerifier(issuer.URL, WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := jv.Introspect(context.Background(), token, "client", "s3cr3t")
+	if err != nil {
+		t.Fatalf("could not introspect the token: %s", err)
+	}
+
+	if !result.Active || result.Subject != "user@example.com" || result.ClientID != "client" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if !reflect.DeepEqual(result.Scopes(), []string{"openid", "profile"}) {
+		t.Errorf("expected the scopes to be split, got %v", result.Scopes())
+	}
+	if !reflect.DeepEqual(result.Audience, []string{"api://default"}) {
+		t.Errorf("expected the audience to be a slice, got %v", result.Audience)
+	}
+	if result.Expiry.Unix() != exp || !result.IssuedAt.IsZero() {
+		t.Errorf("unexpected times: exp %s, iat %s", result.Expiry, result.IssuedAt)
+	}
+	if result.Claims["uid"] != "00u1" {
+		t.Errorf("expected other members in Claims, got %v", result.Claims)
+	}
+
+	if _, err := jv.Introspect(context.Background(), token, "client", "wrong"); err == nil {
+		t.Errorf("expected an error for bad client credentials")
+	} else if strings.Contains(err.Error(), "wrong") {
+		t.Errorf("the client secret leaked into the error: %s", err)
+	}
+}
+
+func Test_introspect_detects_a_revoked_jwt(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithIntrospectionCacheTTL(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	issuer.Revoke(token)
+
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("expected the revoked token to verify locally: %s", err)
+	}
+
+	result, err := jv.Introspect(context.Background(), token, "client", "")
+	if err != nil {
+		t.Fatalf("could not introspect the token: %s", err)
+	}
+	if result.Active {
+		t.Errorf("expected the revoked token to be inactive")
+	}
+}
+
+func Test_introspect_caches_active_results(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	now := time.Now()
+	jv, err := NewVerifier(issuer.URL,
+		WithCache(cache.NewMemory()),
+		WithClock(func() time.Time { return now }),
+		WithIntrospectionCacheTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	inactive := issuer.IssueOpaque(map[string]interface{}{})
+	issuer.Revoke(inactive)
+
+	for i := 0; i < 2; i++ {
+		if _, err := jv.Introspect(context.Background(), token, "client", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jv.Introspect(context.Background(), inactive, "client", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := issuer.IntrospectionRequests(); got != 3 {
+		t.Errorf("expected the active result to be reused and the inactive one not, got %d requests", got)
+	}
+
+	issuer.Revoke(token)
+	now = now.Add(time.Minute)
+	result, err := jv.Introspect(context.Background(), token, "client", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Active {
+		t.Errorf("expected the revocation to be seen once the cached result expired")
+	}
+}
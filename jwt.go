@@ -0,0 +1,436 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/segment"
+)
+
+// Copy returns a deep copy of the token, whose header and claims can be
+// modified without affecting the original or other copies.
+func (j *Jwt) Copy() *Jwt {
+	if j == nil {
+		return nil
+	}
+	c := *j
+	c.Header = copyValue(j.Header).(map[string]interface{})
+	c.Claims = j.ClaimsCopy()
+	return &c
+}
+
+// ClaimsCopy returns a deep copy of the claims, which can be modified
+// without affecting the token.
+func (j *Jwt) ClaimsCopy() map[string]interface{} {
+	if j == nil || j.Claims == nil {
+		return nil
+	}
+	return copyValue(j.Claims).(map[string]interface{})
+}
+
+// FlattenClaims returns the token's claims as flat key/value pairs for
+// logging systems that do not accept nested JSON. See Claims.Flatten.
+func (j *Jwt) FlattenClaims(prefix string, sep string) map[string]string {
+	var claims map[string]interface{}
+	if j != nil {
+		claims = j.Claims
+	}
+	return Claims(claims).Flatten(prefix, sep)
+}
+
+// Claim returns a deep copy of the named claim and whether it is present.
+func (j *Jwt) Claim(name string) (interface{}, bool) {
+	if j == nil {
+		return nil, false
+	}
+	v, ok := j.Claims[name]
+	return copyValue(v), ok
+}
+
+// copyValue deep copies the maps and slices a decoded JSON value is made
+// of. Other values are returned as they are.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = copyValue(value)
+		}
+		return c
+	case Claims:
+		if v == nil {
+			return v
+		}
+		return Claims(copyValue(map[string]interface{}(v)).(map[string]interface{}))
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = copyValue(value)
+		}
+		return c
+	case []string:
+		if v == nil {
+			return v
+		}
+		return append([]string{}, v...)
+	}
+	return v
+}
+
+// Subject returns the `sub` claim and whether it was present as a string.
+func (j *Jwt) Subject() (string, bool) {
+	return j.StringClaim("sub")
+}
+
+// Issuer returns the `iss` claim, or an empty string if it is missing.
+func (j *Jwt) Issuer() string {
+	iss, _ := j.StringClaim("iss")
+	return iss
+}
+
+// Audience returns the `aud` claim as a slice, regardless of whether the
+// token carried a single string or an array of strings.
+func (j *Jwt) Audience() []string {
+	aud, _ := j.StringSliceClaim("aud")
+	return aud
+}
+
+// ClientID returns the client the token was issued to: Okta's `cid` claim
+// or, for tokens without one such as RFC 9068 access tokens, the
+// `client_id` claim.
+func (j *Jwt) ClientID() (string, bool) {
+	if cid, ok := j.StringClaim("cid"); ok {
+		return cid, true
+	}
+	return j.StringClaim("client_id")
+}
+
+// Expiry returns the `exp` claim as a time.
+func (j *Jwt) Expiry() (time.Time, error) {
+	return j.TimeClaim("exp")
+}
+
+// IssuedAt returns the `iat` claim as a time.
+func (j *Jwt) IssuedAt() (time.Time, error) {
+	return j.TimeClaim("iat")
+}
+
+// Scopes returns the scopes granted to the token. Okta issues these as an
+// array in the `scp` claim, while other issuers use a space-delimited
+// `scope` string; both are supported.
+func (j *Jwt) Scopes() []string {
+	if scopes, ok := j.StringSliceClaim("scp"); ok {
+		return scopes
+	}
+	if scope, ok := j.StringClaim("scope"); ok {
+		return strings.Fields(scope)
+	}
+	return nil
+}
+
+// HasScopes reports whether the token was granted all of the given scopes.
+func (j *Jwt) HasScopes(scopes ...string) bool {
+	return j.RequireScopes(scopes...) == nil
+}
+
+// RequireScopes returns an error listing every given scope that the token
+// was not granted.
+func (j *Jwt) RequireScopes(scopes ...string) error {
+	granted := map[string]bool{}
+	for _, scope := range j.Scopes() {
+		granted[scope] = true
+	}
+
+	var missing []string
+	for _, scope := range scopes {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required scopes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Groups returns the groups in the `groups` claim, or in the `grp` claim
+// if there is no `groups` claim. It returns nil when neither is present or
+// the value is not a string or array of strings. Use StringSliceClaim for
+// groups carried in a custom claim.
+func (j *Jwt) Groups() []string {
+	if groups, ok := j.StringSliceClaim("groups"); ok {
+		return groups
+	}
+	groups, _ := j.StringSliceClaim("grp")
+	return groups
+}
+
+// StringClaim returns the named claim if it is present and is a string.
+func (j *Jwt) StringClaim(name string) (string, bool) {
+	if j == nil {
+		return "", false
+	}
+	s, ok := j.Claims[name].(string)
+	return s, ok
+}
+
+// StringSliceClaim returns the named claim as a slice of strings. A single
+// string value is returned as a one element slice. The second return value
+// is false if the claim is missing or any element is not a string.
+func (j *Jwt) StringSliceClaim(name string) ([]string, bool) {
+	if j == nil {
+		return nil, false
+	}
+	switch v := j.Claims[name].(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return v, true
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, element := range v {
+			s, ok := element.(string)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, s)
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// ClaimsInto decodes the token's claims into v, which is typically a
+// pointer to a struct with json tags, as json.Unmarshal would. For tokens
+// returned by the verifier the payload itself is decoded, so numbers keep
+// their full precision; numbers decoded into an interface{} are
+// json.Number.
+func (j *Jwt) ClaimsInto(v interface{}) error {
+	if j == nil {
+		return fmt.Errorf("there are no claims to decode")
+	}
+
+	var payload []byte
+	var err error
+	if j.payload != "" {
+		payload, _, err = segment.DecodeLenient(j.payload)
+	} else {
+		payload, err = json.Marshal(j.Claims)
+	}
+	if err != nil {
+		return fmt.Errorf("could not decode the claims: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("could not decode the claims: %w", err)
+	}
+	return nil
+}
+
+// TimeClaim returns the named claim, interpreted as seconds since the epoch,
+// as a time.
+func (j *Jwt) TimeClaim(name string) (time.Time, error) {
+	if j == nil {
+		return time.Time{}, fmt.Errorf("%s: missing", name)
+	}
+	v, ok := j.Claims[name]
+	if !ok || v == nil {
+		return time.Time{}, fmt.Errorf("%s: missing", name)
+	}
+	seconds, err := numericValue(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+// numericValue converts the representations a JSON number can take once
+// decoded into a float64.
+func numericValue(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", n.String())
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("unexpected type %T, expected a number", v)
+}
+
+// SensitiveClaims are the claims masked by String and Redacted, unless the
+// verifier sets its own SensitiveClaims. They are the personal data an
+// Okta token may carry; the structural claims, such as sub, are not.
+var SensitiveClaims = []string{
+	"email", "email_verified", "name", "given_name", "family_name", "middle_name", "nickname",
+	"preferred_username", "phone_number", "address", "birthdate", "locale", "zoneinfo",
+}
+
+// redactedValue replaces the values of sensitive claims.
+const redactedValue = "[REDACTED]"
+
+func (j *Jwt) sensitiveClaims() []string {
+	if j.sensitive != nil {
+		return j.sensitive
+	}
+	return SensitiveClaims
+}
+
+// String describes the token for logs by its iss, sub, aud, exp and kid,
+// and the names of its other claims. Sensitive claims are masked, and no
+// other claim values are shown. It has a value receiver so that a Jwt
+// value, not only a *Jwt, is printed this way.
+func (j Jwt) String() string {
+	r := j.Redacted()
+
+	var b strings.Builder
+	b.WriteString("Jwt{")
+	field := func(name string, value interface{}) {
+		if b.Len() > len("Jwt{") {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%s=%v", name, value)
+	}
+
+	if iss, ok := r.StringClaim("iss"); ok {
+		field("iss", strconv.Quote(iss))
+	}
+	if sub, ok := r.StringClaim("sub"); ok {
+		field("sub", strconv.Quote(sub))
+	}
+	if aud := r.Audience(); len(aud) > 0 {
+		field("aud", aud)
+	}
+	if exp, err := r.Expiry(); err == nil {
+		field("exp", exp.UTC().Format(time.RFC3339))
+	}
+	if kid, ok := r.Header["kid"].(string); ok {
+		field("kid", strconv.Quote(kid))
+	}
+
+	var others []string
+	for name := range r.Claims {
+		switch name {
+		case "iss", "sub", "aud", "exp":
+			continue
+		}
+		others = append(others, name)
+	}
+	if len(others) > 0 {
+		sort.Strings(others)
+		field("claims", others)
+	}
+	if r.Unverified {
+		field("unverified", true)
+	}
+
+	b.WriteString("}")
+	return b.String()
+}
+
+// Redacted returns a copy of the token whose sensitive claims are replaced
+// by "[REDACTED]", for logging claims with json.Marshal. Its ClaimsInto
+// decodes the redacted claims.
+func (j *Jwt) Redacted() *Jwt {
+	if j == nil {
+		return nil
+	}
+	c := j.Copy()
+	c.payload = ""
+	for _, name := range j.sensitiveClaims() {
+		if _, ok := c.Claims[name]; ok {
+			c.Claims[name] = redactedValue
+		}
+	}
+	return c
+}
+
+// jwtJSON is the JSON encoding of a Jwt.
+type jwtJSON struct {
+	Header     map[string]interface{} `json:"header,omitempty"`
+	Claims     json.RawMessage        `json:"claims"`
+	Unverified bool                   `json:"unverified,omitempty"`
+}
+
+// MarshalJSON encodes the token's header, claims and Unverified flag, so
+// that its claims can be passed to another service. The claims are encoded
+// in full; marshal Redacted for logs. Info describes the local
+// verification and is not encoded. Like String, it has a value receiver,
+// so a Jwt value is encoded the same way as a *Jwt.
+func (j Jwt) MarshalJSON() ([]byte, error) {
+	claims, err := json.Marshal(j.Claims)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jwtJSON{Header: j.Header, Claims: claims, Unverified: j.Unverified})
+}
+
+// UnmarshalJSON decodes a token encoded by MarshalJSON. As for tokens
+// returned by the verifier, ClaimsInto decodes the encoded claims
+// themselves, so numbers keep their full precision. The token masks the
+// package's SensitiveClaims.
+//
+// The encoding carries no signature, so anyone able to send it can forge
+// its claims. The decoded token is therefore always Unverified, whatever
+// the encoding says: verify the raw token instead wherever the claims
+// grant access.
+func (j *Jwt) UnmarshalJSON(data []byte) error {
+	var encoded jwtJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(encoded.Claims, &claims); err != nil {
+		return fmt.Errorf("could not decode the claims: %w", err)
+	}
+
+	*j = Jwt{
+		Header:     encoded.Header,
+		Claims:     claims,
+		Unverified: true,
+		payload:    base64.RawURLEncoding.EncodeToString(encoded.Claims),
+	}
+	return nil
+}
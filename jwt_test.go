@@ -0,0 +1,409 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_string_claim_accessors(t *testing.T) {
+	jwt := &Jwt{Claims: map[string]interface{}{
+		"sub": "user@example.com",
+		"iss": "https://golang.oktapreview.com",
+		"cid": 123.0,
+	}}
+
+	if sub, ok := jwt.Subject(); !ok || sub != "user@example.com" {
+		t.Errorf("Subject() returned %q, %v", sub, ok)
+	}
+
+	if jwt.Issuer() != "https://golang.oktapreview.com" {
+		t.Errorf("Issuer() returned %q", jwt.Issuer())
+	}
+
+	if _, ok := jwt.StringClaim("cid"); ok {
+		t.Errorf("StringClaim() reported a number as a string")
+	}
+
+	if _, ok := jwt.StringClaim("missing"); ok {
+		t.Errorf("StringClaim() reported a missing claim as present")
+	}
+
+	if cid, ok := (&Jwt{Claims: map[string]interface{}{"client_id": "abc123"}}).ClientID(); !ok || cid != "abc123" {
+		t.Errorf("ClientID() did not fall back to client_id, returned %q, %v", cid, ok)
+	}
+
+	var nilJwt *Jwt
+	if _, ok := nilJwt.Subject(); ok {
+		t.Errorf("Subject() on a nil Jwt reported a value")
+	}
+}
+
+func Test_audience_is_normalized_to_a_slice(t *testing.T) {
+	tests := []struct {
+		aud      interface{}
+		expected []string
+	}{
+		{"api://default", []string{"api://default"}},
+		{[]interface{}{"a", "b"}, []string{"a", "b"}},
+		{[]string{"a"}, []string{"a"}},
+		{[]interface{}{"a", 1.0}, nil},
+		{nil, nil},
+	}
+
+	for _, test := range tests {
+		jwt := &Jwt{Claims: map[string]interface{}{"aud": test.aud}}
+		if got := jwt.Audience(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Audience() for %v returned %v, expected %v", test.aud, got, test.expected)
+		}
+	}
+}
+
+func Test_time_claims_accept_float64_and_json_number(t *testing.T) {
+	jwt := &Jwt{Claims: map[string]interface{}{
+		"exp": float64(1600000000),
+		"iat": json.Number("1500000000"),
+		"bad": "yesterday",
+	}}
+
+	exp, err := jwt.Expiry()
+	if err != nil || !exp.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("Expiry() returned %v, %v", exp, err)
+	}
+
+	iat, err := jwt.IssuedAt()
+	if err != nil || !iat.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("IssuedAt() returned %v, %v", iat, err)
+	}
+
+	if _, err := jwt.TimeClaim("bad"); err == nil {
+		t.Errorf("TimeClaim() did not return an error for a string value")
+	}
+
+	if _, err := jwt.TimeClaim("nbf"); err == nil {
+		t.Errorf("TimeClaim() did not return an error for a missing claim")
+	}
+}
+
+func Test_scopes_are_read_from_scp_or_scope(t *testing.T) {
+	okta := &Jwt{Claims: map[string]interface{}{"scp": []interface{}{"openid", "profile"}}}
+	if got := okta.Scopes(); !reflect.DeepEqual(got, []string{"openid", "profile"}) {
+		t.Errorf("Scopes() returned %v for an scp array", got)
+	}
+
+	other := &Jwt{Claims: map[string]interface{}{"scope": "openid  email"}}
+	if got := other.Scopes(); !reflect.DeepEqual(got, []string{"openid", "email"}) {
+		t.Errorf("Scopes() returned %v for a scope string", got)
+	}
+
+	none := &Jwt{Claims: map[string]interface{}{}}
+	if got := none.Scopes(); got != nil {
+		t.Errorf("Scopes() returned %v for a token without scopes", got)
+	}
+}
+
+func Test_require_scopes_lists_missing_scopes(t *testing.T) {
+	jwt := &Jwt{Claims: map[string]interface{}{"scp": []interface{}{"openid", "profile"}}}
+
+	if !jwt.HasScopes("openid", "profile") {
+		t.Errorf("HasScopes() returned false for granted scopes")
+	}
+
+	if jwt.HasScopes("openid", "email") {
+		t.Errorf("HasScopes() returned true when a scope was missing")
+	}
+
+	err := jwt.RequireScopes("email", "openid", "groups")
+	if err == nil {
+		t.Fatalf("RequireScopes() did not return an error for missing scopes")
+	}
+
+	if err.Error() != "missing required scopes: email, groups" {
+		t.Errorf("RequireScopes() returned an unexpected error: %s", err)
+	}
+}
+
+func Test_groups_handles_missing_and_single_values(t *testing.T) {
+	tests := []struct {
+		groups   interface{}
+		expected []string
+	}{
+		{[]interface{}{"Everyone", "Admins"}, []string{"Everyone", "Admins"}},
+		{"Admins", []string{"Admins"}},
+		{nil, nil},
+		{42.0, nil},
+	}
+
+	grp := &Jwt{Claims: map[string]interface{}{"grp": []interface{}{"Admins"}}}
+	if got := grp.Groups(); !reflect.DeepEqual(got, []string{"Admins"}) {
+		t.Errorf("Groups() did not fall back to grp, returned %v", got)
+	}
+
+	for _, test := range tests {
+		claims := map[string]interface{}{}
+		if test.groups != nil {
+			claims["groups"] = test.groups
+		}
+		jwt := &Jwt{Claims: claims}
+		if got := jwt.Groups(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Groups() for %v returned %v, expected %v", test.groups, got, test.expected)
+		}
+	}
+}
+
+func Test_claims_into_decodes_the_payload_with_full_precision(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["login_ms"] = int64(1600000000123456789)
+	claims["tenant"] = map[string]interface{}{"id": 9007199254740993}
+	token, err := jv.VerifyAccessToken(issuer.Sign(claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var into struct {
+		Subject string                 `json:"sub"`
+		LoginMs int64                  `json:"login_ms"`
+		Tenant  map[string]interface{} `json:"tenant"`
+	}
+	if err := token.ClaimsInto(&into); err != nil {
+		t.Fatalf("ClaimsInto() returned an error: %s", err)
+	}
+
+	if into.Subject != "user@example.com" || into.LoginMs != 1600000000123456789 {
+		t.Errorf("unexpected claims %+v", into)
+	}
+	if into.Tenant["id"] != json.Number("9007199254740993") {
+		t.Errorf("expected a nested number as an exact json.Number, got %#v", into.Tenant["id"])
+	}
+
+	var wrong struct {
+		Subject int `json:"sub"`
+	}
+	if err := token.ClaimsInto(&wrong); err == nil {
+		t.Errorf("expected an error decoding a string claim into an int")
+	}
+}
+
+func Test_claims_into_falls_back_to_the_claims_map(t *testing.T) {
+	jwt := &Jwt{Claims: map[string]interface{}{"sub": "user@example.com", "exp": 1600000000.0}}
+
+	var into struct {
+		Subject string `json:"sub"`
+		Expiry  int64  `json:"exp"`
+	}
+	if err := jwt.ClaimsInto(&into); err != nil || into.Subject != "user@example.com" || into.Expiry != 1600000000 {
+		t.Errorf("ClaimsInto() returned %+v, %v", into, err)
+	}
+}
+
+func Test_copies_share_nothing_with_the_token(t *testing.T) {
+	jwt := &Jwt{
+		Header: map[string]interface{}{"kid": "key1"},
+		Claims: map[string]interface{}{
+			"sub":    "user@example.com",
+			"tenant": map[string]interface{}{"id": "acme"},
+			"groups": []interface{}{"Admins"},
+		},
+	}
+
+	c := jwt.Copy()
+	c.Header["kid"] = "key2"
+	c.Claims["tenant"].(map[string]interface{})["id"] = "other"
+
+	claims := jwt.ClaimsCopy()
+	claims["groups"].([]interface{})[0] = "Everyone"
+
+	groups, _ := jwt.Claim("groups")
+	groups.([]interface{})[0] = "Support"
+
+	if jwt.Header["kid"] != "key1" ||
+		jwt.Claims["tenant"].(map[string]interface{})["id"] != "acme" ||
+		jwt.Claims["groups"].([]interface{})[0] != "Admins" {
+		t.Errorf("modifying a copy changed the token: %v %v", jwt.Header, jwt.Claims)
+	}
+
+	var nilJwt *Jwt
+	if nilJwt.Copy() != nil || nilJwt.ClaimsCopy() != nil {
+		t.Errorf("copies of a nil Jwt were not nil")
+	}
+}
+
+func Test_tokens_round_trip_through_json(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["email"] = "user@example.com"
+	claims["tenant"] = map[string]interface{}{"id": "t1", "tier": 2}
+	token, err := jv.VerifyIdToken(issuer.Sign(claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Jwt
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("could not unmarshal %s: %s", data, err)
+	}
+	if !reflect.DeepEqual(decoded.Claims, token.Claims) {
+		t.Errorf("expected the claims %v, got %v", token.Claims, decoded.Claims)
+	}
+	if !reflect.DeepEqual(decoded.Header, token.Header) {
+		t.Errorf("expected the header %v, got %v", token.Header, decoded.Header)
+	}
+
+	var into struct {
+		Email string `json:"email"`
+	}
+	if err := decoded.ClaimsInto(&into); err != nil || into.Email != "user@example.com" {
+		t.Errorf("ClaimsInto() on a decoded token returned %+v, %v", into, err)
+	}
+
+	if !decoded.Unverified {
+		t.Errorf("a token decoded from JSON is not marked Unverified")
+	}
+
+	if err := json.Unmarshal([]byte(`{"claims":"not an object"}`), &decoded); err == nil {
+		t.Errorf("expected an error decoding claims that are not an object")
+	}
+}
+
+func Test_string_and_redacted_mask_sensitive_claims(t *testing.T) {
+	jwt := &Jwt{
+		Header: map[string]interface{}{"alg": "RS256", "kid": "key1"},
+		Claims: map[string]interface{}{
+			"iss":   "https://golang.oktapreview.com",
+			"sub":   "00u1abcd",
+			"aud":   "api://default",
+			"exp":   1600000000.0,
+			"email": "user@example.com",
+			"name":  "Jane Doe",
+			"scp":   []interface{}{"openid"},
+		},
+	}
+
+	expected := `Jwt{iss="https://golang.oktapreview.com" sub="00u1abcd" aud=[api://default] exp=2020-09-13T12:26:40Z kid="key1" claims=[email name scp]}`
+	if got := jwt.String(); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	redacted := jwt.Redacted()
+	if redacted.Claims["email"] != "[REDACTED]" || redacted.Claims["name"] != "[REDACTED]" {
+		t.Errorf("sensitive claims were not masked: %v", redacted.Claims)
+	}
+	if redacted.Claims["sub"] != "00u1abcd" || jwt.Claims["email"] != "user@example.com" {
+		t.Errorf("Redacted() masked too much or changed the token: %v, %v", redacted.Claims, jwt.Claims)
+	}
+
+	if got := fmt.Sprint(*jwt); got != expected {
+		t.Errorf("expected a Jwt value to print as %s, got %s", expected, got)
+	}
+	if got := fmt.Sprint((*Jwt)(nil)); got != "<nil>" {
+		t.Errorf("expected a nil *Jwt to print as <nil>, got %s", got)
+	}
+
+	byValue, err := json.Marshal(*jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPointer, err := json.Marshal(jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(byValue) != string(byPointer) {
+		t.Errorf("expected a Jwt value to encode as %s, got %s", byPointer, byValue)
+	}
+
+	jwt.sensitive = []string{"sub"}
+	if got := jwt.String(); !strings.Contains(got, `sub="[REDACTED]"`) {
+		t.Errorf("expected the sub to be masked, got %s", got)
+	}
+	if redacted := jwt.Redacted(); redacted.Claims["email"] != "user@example.com" {
+		t.Errorf("expected only the verifier's sensitive claims to be masked, got %v", redacted.Claims)
+	}
+}
+
+func Test_verifiers_set_the_sensitive_claims_of_their_tokens(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["email"] = "user@example.com"
+	claims["employee_id"] = "E123"
+	raw := issuer.Sign(claims)
+
+	tests := []struct {
+		opts   []Option
+		masked map[string]bool
+	}{
+		{nil, map[string]bool{"email": true}},
+		{[]Option{WithSensitiveClaims("employee_id")}, map[string]bool{"employee_id": true}},
+		{[]Option{WithSensitiveClaims()}, map[string]bool{}},
+	}
+
+	for i, test := range tests {
+		opts := append([]Option{WithClaimToValidate("aud", "api://default"), WithCache(cache.NewMemory())}, test.opts...)
+		jv, err := NewVerifier(issuer.URL, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := jv.VerifyAccessToken(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		redacted := token.Redacted()
+		var into map[string]interface{}
+		if err := redacted.ClaimsInto(&into); err != nil {
+			t.Fatal(err)
+		}
+		for _, claim := range []string{"email", "employee_id"} {
+			if masked := into[claim] == "[REDACTED]"; masked != test.masked[claim] {
+				t.Errorf("case %d: expected %s masked %v, got %v", i, claim, test.masked[claim], into[claim])
+			}
+		}
+	}
+}
@@ -17,41 +17,405 @@
 package jwtverifier
 
 import (
-	"encoding/base64"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"net/http"
-	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/okta/okta-jwt-verifier-golang/adaptors"
 	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
 	"github.com/okta/okta-jwt-verifier-golang/discovery"
 	"github.com/okta/okta-jwt-verifier-golang/discovery/oidc"
 	"github.com/okta/okta-jwt-verifier-golang/errors"
-	"github.com/patrickmn/go-cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/fetch"
+	"github.com/okta/okta-jwt-verifier-golang/internal/lifecycle"
+	"github.com/okta/okta-jwt-verifier-golang/internal/memo"
+	"github.com/okta/okta-jwt-verifier-golang/internal/segment"
+	"github.com/okta/okta-jwt-verifier-golang/logger"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
 )
 
-var metaDataCache *cache.Cache = cache.New(5*time.Minute, 10*time.Minute)
 var metaDataMu = &sync.Mutex{}
-var regx = regexp.MustCompile(`[a-zA-Z0-9-_]+\.[a-zA-Z0-9-_]+\.?([a-zA-Z0-9-_]+)[/a-zA-Z0-9-_]+?$`)
-
+var metaDataDecoded = &memo.Memo{}
+
+// JwtVerifier verifies Okta access and ID tokens.
+//
+// A JwtVerifier returned by New is safe for concurrent use by multiple
+// goroutines. Its configuration fields, and SetLeeway, must not be changed
+// once it is shared; New takes its own copy of ClaimsToValidate,
+// TypedClaimsToValidate, ClaimValidators, ClaimStrictness, RequiredScopes,
+// RequiredGroups, SecondaryKeySets and AttestationKeys so later changes to the values passed in do not
+// affect it. The discovery and key set caches are shared by all verifiers in the
+// process and are guarded internally.
 type JwtVerifier struct {
+	// Issuer is used for discovery and is the value the `iss` claim must
+	// match, unless ClaimsToValidate["iss"] is set. A trailing slash on
+	// either is ignored.
 	Issuer string
 
+	// AllowHTTP accepts an http issuer on a host other than localhost or a
+	// loopback address, such as a mock issuer on a test network. The key
+	// set is then fetched over plaintext, so never set it in production.
+	// Without it, NewVerifier rejects such issuers and New logs a warning.
+	AllowHTTP bool
+
+	// SkipIssuerValidation disables the `iss` check. Only use it when the
+	// issuer is trusted through other means.
+	SkipIssuerValidation bool
+
 	ClaimsToValidate map[string]string
 
+	// TypedClaimsToValidate are claims that access and ID tokens must carry
+	// with the given values. Unlike ClaimsToValidate, any claim may be
+	// given, and the values may be numbers, booleans, strings, or slices
+	// and maps of these. Numbers are compared by value whatever their Go
+	// type, and slices as sets, ignoring order.
+	TypedClaimsToValidate map[string]interface{}
+
+	// ClaimValidators are custom checks of the claims access and ID tokens
+	// carry, which may consult the Facts attached to each call with
+	// WithFact, e.g. to accept a network_zone claim only from certain
+	// source addresses. A claim the token does not carry is not checked.
+	ClaimValidators map[string]ClaimValidator
+
+	// ClaimStrictness marks claims whose TypedClaimsToValidate,
+	// ClaimValidators and ClaimRequirements checks are Advisory: a failure
+	// is recorded in the token's Info.AdvisoryFailures, the OnVerification
+	// hooks and the log, and the token is accepted. Claims not listed are
+	// Required.
+	ClaimStrictness map[string]Strictness
+
+	// RequiredScopes are the scopes an access token must be granted to pass
+	// VerifyAccessToken.
+	RequiredScopes []string
+
+	// RequiredGroups are checked against the groups claim of both access
+	// and ID tokens. By default a token must be a member of at least one of
+	// them; set RequireAllGroups to require membership of every group.
+	// Tokens without the groups claim are rejected.
+	RequiredGroups []string
+
+	RequireAllGroups bool
+
+	// ExpectedTokenType, if set, is the typ header VerifyAccessToken
+	// requires, typically "at+jwt" for RFC 9068 access tokens. VerifyIdToken
+	// then requires ID tokens to have a typ of "JWT" or none, so that an
+	// access token cannot be passed off as an ID token. Comparison ignores
+	// case and an "application/" prefix.
+	ExpectedTokenType string
+
+	// ForceLocalAccessTokenVerification verifies access tokens locally even
+	// when the Issuer is an Okta org authorization server, one whose URL
+	// has no /oauth2/ path segment. Without it VerifyAccessToken rejects
+	// every token from such an issuer with errors.OrgAccessToken, since
+	// org authorization server access tokens are only meant for Okta's own
+	// APIs and must be verified with introspection. ID tokens are verified
+	// either way. Set it for issuers other than Okta's whose URL has no
+	// /oauth2/ segment.
+	ForceLocalAccessTokenVerification bool
+
+	// MaxTokenSize, if positive, is the length in bytes beyond which tokens
+	// are rejected with errors.JwtTooLarge before any part of them is
+	// decoded, so that oversized input costs nothing to reject. As the
+	// header and payload are decoded from the token, it bounds them too.
+	// Zero, the default for a JwtVerifier literal, means no limit;
+	// NewVerifier defaults to DefaultMaxTokenSize.
+	MaxTokenSize int
+
+	// MaxTokenAge, if positive, rejects tokens issued longer ago than it,
+	// plus the leeway, with errors.TokenTooOld, whatever their exp. Tokens
+	// without an iat claim are rejected either way.
+	MaxTokenAge time.Duration
+
+	// TransactionMaxTokenAge is the MaxTokenAge of verifications made with
+	// WithTransactionID, unless MaxTokenAge is shorter. It defaults to
+	// DefaultTransactionMaxTokenAge.
+	TransactionMaxTokenAge time.Duration
+
+	// RequireSubject rejects access and ID tokens whose sub claim is
+	// missing or empty. To require a particular subject, set "sub" in
+	// ClaimsToValidate instead.
+	RequireSubject bool
+
+	// EnableDegradedMode allows VerifyDegraded to return unverified claims
+	// while the issuer's keys cannot be fetched.
+	EnableDegradedMode bool
+
+	// GroupsClaim names the claim holding the token's groups. It defaults
+	// to `groups`, in which case `grp` is also accepted.
+	GroupsClaim string
+
+	// ClaimRequirements describe the structure required of object and
+	// array claims, such as Okta entitlements, in both access and ID tokens.
+	ClaimRequirements map[string]StructClaimRequirement
+
+	// NearExpiryThreshold enables Hooks.OnNearExpiry for tokens that verify
+	// with less than this much time left before they expire. Zero disables
+	// it.
+	NearExpiryThreshold time.Duration
+
+	// LeewayWarningRate enables a warning, logged once each time the rate
+	// is crossed, when more than this fraction of the tokens verified over
+	// the last LeewayWarningWindow were accepted only thanks to the leeway.
+	// So many tokens past their exp point at a clock problem, ours or the
+	// issuer's. The window must hold at least 10 verifications. Zero
+	// disables it; LeewayWarningWindow defaults to
+	// DefaultLeewayWarningWindow.
+	LeewayWarningRate   float64
+	LeewayWarningWindow time.Duration
+
+	Hooks Hooks
+
+	// AdditionalHooks are called after Hooks, in order.
+	AdditionalHooks []Hooks
+
 	Discovery discovery.Discovery
 
 	Adaptor adaptors.Adaptor
 
+	// Cache holds the discovery document and key set between verifications.
+	// It defaults to an in-process cache shared by all verifiers.
+	Cache cache.Cache
+
+	// AllowNonCompliantBase64 accepts tokens with segments in standard
+	// base64, with '+', '/' and possibly padding, instead of the base64url
+	// RFC 7515 requires. Only enable it for an issuer known to produce such
+	// tokens. The signature is still checked against the segments exactly as
+	// they appear in the token. It needs the default adaptor; tokens it
+	// accepts have Info.NonCompliantBase64 set.
+	AllowNonCompliantBase64 bool
+
+	// RequestHeaders are added to the discovery and, with the default
+	// adaptor, key set requests, e.g. an API key for a gateway in front of
+	// the issuer. Their values are never included in errors or logs.
+	RequestHeaders map[string]string
+
+	// Now returns the current time for the exp and iat checks and the
+	// near-expiry hook. It defaults to time.Now; tests can fix it.
+	Now func() time.Time
+
+	// RequestTimeout bounds the discovery and, with the default adaptor,
+	// key set requests, retries included. It defaults to 30 seconds. A
+	// request that times out fails with an error wrapping
+	// context.DeadlineExceeded.
+	RequestTimeout time.Duration
+
+	// MinCacheLifetime and MaxCacheLifetime bound how long the discovery
+	// document and, with the default adaptor, key set are cached for.
+	// Within them, the lifetime is taken from each response's Cache-Control
+	// max-age or Expires header, or is five minutes if it has neither. They
+	// default to cache.DefaultMinLifetime and cache.DefaultMaxLifetime.
+	MinCacheLifetime time.Duration
+	MaxCacheLifetime time.Duration
+
+	// Tracer, if set, traces each verification and, with the default
+	// adaptor, the discovery and key set fetches it makes; see package
+	// tracing. Use oteltracing.New for OpenTelemetry.
+	Tracer tracing.Tracer
+
+	// AllowedKIDs, if not empty, are the only kids tokens may be signed
+	// with. Tokens with any other kid, or none, fail with
+	// errors.KeyNotPinned before the key set is consulted. The default
+	// adaptor also ignores keys with other kids in the key set, so keys an
+	// issuer adds by mistake are never trusted. List both kids while
+	// rotating.
+	AllowedKIDs []string
+
+	// AllowedKeyThumbprints, if not empty, are the RFC 7638 SHA-256
+	// thumbprints, base64url encoded, of the only keys tokens may be signed
+	// with; other keys the issuer publishes are never used. It needs the
+	// default adaptor: with any other, every token fails with
+	// errors.KeyNotPinned.
+	AllowedKeyThumbprints []string
+
+	// X5CRoots, if set, are the roots the signing key's x5c certificate
+	// chain must verify against, and the chain's leaf certificate must be
+	// for the key. Tokens signed with a key without x5c, with an untrusted
+	// chain or with a leaf for another key fail with errors.X5CInvalid. It
+	// needs the default adaptor: with any other, every token fails with
+	// errors.KeyNotPinned.
+	X5CRoots *x509.CertPool
+
+	// OnKeySetChange approves key set changes: it is called when a fetched
+	// key set has different kids from the one in use, and returning false
+	// keeps the one in use and retries the change within a minute. The first
+	// key set fetched is always accepted. It needs the default adaptor, and
+	// its decisions are counted in Stats.
+	OnKeySetChange func(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool
+
+	// LocalKeys, if set, is the key set tokens are verified with, read from
+	// a file or reader instead of fetched from the issuer, and no discovery
+	// document is fetched to verify tokens. The iss, aud and exp checks are
+	// unchanged. It needs the default adaptor.
+	LocalKeys *lestrratGoJwx.LocalKeySet
+
+	// CircuitBreaker, if set, guards the discovery document and key set
+	// fetches: after repeated failures it opens, and verifications that
+	// need a fetch fail at once with errors.ErrCircuitOpen until a probe
+	// after its cooldown succeeds. Its state changes are reported to
+	// OnCircuitStateChange and in Stats. The default adaptor shares it.
+	CircuitBreaker *circuit.Breaker
+
+	// IntrospectionCacheTTL is how long Introspect reuses an active result.
+	// It defaults to DefaultIntrospectionCacheTTL; a negative value disables
+	// caching.
+	IntrospectionCacheTTL time.Duration
+
+	// TokenCacheSize, if positive, caches the result of up to that many
+	// successful signature checks, keyed by the SHA-256 hash of the token,
+	// so that verifying the same token again skips the check. The claims
+	// are still checked on every verification. When the cache is full, the
+	// least recently used result is evicted. It is off by default.
+	//
+	// A cached token is accepted for TokenCacheTTL even if its key is
+	// removed from the key set meanwhile.
+	TokenCacheSize int
+
+	// TokenCacheTTL is how long a cached result is reused, but never past
+	// the token's exp. It defaults to DefaultTokenCacheTTL.
+	TokenCacheTTL time.Duration
+
+	// MaxCacheBytes, if positive, bounds the memory of the verifier's
+	// caches together: the discovery documents and, with the default
+	// adaptor, key sets it stores in Cache, and the token cache. Under pressure the least recently used
+	// cached tokens are evicted first. Documents are never evicted, since
+	// there is only one per URL and verification needs it, so they take
+	// their share first and the token cache gets what is left. Sizes are
+	// those of the documents and tokens as received; parsed keys and
+	// claims are not counted. It is enforced as tokens are cached.
+	MaxCacheBytes int64
+
+	// SecondaryKeySets are consulted, in order, for tokens whose kid is not
+	// in the issuer's key set, e.g. while migrating from one authorization
+	// server to another. Each is fetched and cached on its own, and tokens
+	// verified with one have Info.SecondaryKeySet set. If no key set has
+	// the kid, the error wraps an errors.KeyNotFound listing them all. It
+	// cannot be combined with LocalKeys.
+	SecondaryKeySets []KeySource
+
+	// AttestationKeys enable AttestSignature and VerifyWithAttestation,
+	// which are unavailable without them. A gateway signs attestations with
+	// the first key; services accept attestations signed with any of them.
+	// To rotate keys, add the new key on the services, then make it the
+	// first on the gateway, then remove the old key once the attestations
+	// it signed have expired.
+	AttestationKeys []AttestationKey
+
+	// AttestationTTL is how long attestations signed by AttestSignature are
+	// valid. It defaults to DefaultAttestationTTL.
+	AttestationTTL time.Duration
+
+	// Coordinator, with a shared Cache, limits background refreshes to one
+	// process at a time. See DistributedCoordinator.
+	Coordinator DistributedCoordinator
+
+	// LegacyBehaviors revert the named behavior changes, until their
+	// removal. Each one in use is logged as a warning by New and listed in
+	// DescribeConfig; unknown names are ignored.
+	LegacyBehaviors []LegacyBehavior
+
+	// SensitiveClaims are the claims the tokens returned by the verifier
+	// mask in String and Redacted. Nil uses the package's SensitiveClaims;
+	// an empty slice masks none.
+	SensitiveClaims []string
+
+	// Logger receives debug and warning events about discovery, caching and
+	// verification failures. It defaults to discarding them.
+	Logger logger.Logger
+
 	leeway int64
+
+	httpClient *http.Client
+
+	retry fetch.Retry
+
+	allowedAlgorithms []string
+
+	notIssuedBefore atomic.Value
+
+	decodes *decodeGroup
+
+	background *backgroundRefresh
+
+	hookQueue *hookQueue
+
+	// goroutines tracks every goroutine the verifier starts, for Close and
+	// DebugGoroutines.
+	goroutines *lifecycle.Registry
+
+	stats *verifierStats
+
+	introspections *introspectionCache
+
+	tokens *tokenCache
+
+	// documentCache wraps Cache to account for the documents the verifier
+	// stores in it.
+	documentCache *documentCache
+
+	// adaptorPinsKeys is set when the adaptor enforces
+	// AllowedKeyThumbprints.
+	adaptorPinsKeys bool
+
+	// initProfile is the profile NewVerifier initialized the verifier with.
+	initProfile InitProfile
+
+	// orgIssuer is set when the Issuer is an org authorization server.
+	orgIssuer bool
+
+	// legacy is the set of LegacyBehaviors in effect.
+	legacy legacySet
 }
 
 type Jwt struct {
+	// Header holds the token's JOSE header parameters. They are kept apart
+	// from Claims: a claim named alg, kid or typ is returned as is and
+	// plays no part in verification, and header parameters are never
+	// validated as claims.
+	Header map[string]interface{}
+
+	// Claims are the token's claims. A Jwt shared between goroutines, such
+	// as one stored in a request context, must not be modified: use
+	// ClaimsCopy or Copy for a version that may be.
 	Claims map[string]interface{}
+
+	// Unverified is set on tokens returned by VerifyDegraded whose
+	// signature could not be checked, and on tokens decoded from JSON.
+	Unverified bool
+
+	Info VerificationInfo
+
+	// payload is the token's encoded payload segment, for ClaimsInto.
+	payload string
+
+	// sensitive is the verifier's SensitiveClaims.
+	sensitive []string
+}
+
+// VerificationInfo records how a token was verified.
+type VerificationInfo struct {
+	// NonCompliantBase64 is set when a segment of the token was standard
+	// base64 rather than base64url, and was only accepted because
+	// AllowNonCompliantBase64 is set.
+	NonCompliantBase64 bool
+
+	// AdvisoryFailures are the failed checks of claims marked Advisory in
+	// ClaimStrictness, which did not fail the verification.
+	AdvisoryFailures []AdvisoryFailure
+
+	// SecondaryKeySet is the JWKS URI of the entry of SecondaryKeySets the
+	// token's signature was verified with, or empty if it was verified with
+	// the issuer's key set.
+	SecondaryKeySet string
 }
 
 func (j *JwtVerifier) New() *JwtVerifier {
@@ -61,125 +425,479 @@ func (j *JwtVerifier) New() *JwtVerifier {
 		j.Discovery = disc.New()
 	}
 
+	if j.Logger == nil {
+		j.Logger = logger.NoOp()
+	}
+
+	j.orgIssuer = isOrgIssuer(j.Issuer)
+	j.LegacyBehaviors = append([]LegacyBehavior(nil), j.LegacyBehaviors...)
+	j.legacy = j.newLegacySet(j.LegacyBehaviors)
+
+	if !j.AllowHTTP && isPlaintextIssuer(j.Issuer) {
+		j.Logger.Warn("the issuer does not use https, so its keys are fetched over plaintext", "url", j.Issuer)
+	}
+
+	j.documentCache = newDocumentCache(j.Cache)
+
 	// Default to LestrratGoJwx Adaptor if none is defined
 	if j.Adaptor == nil {
-		adaptor := lestrratGoJwx.LestrratGoJwx{}
+		adaptor := lestrratGoJwx.LestrratGoJwx{
+			Logger:         j.Logger,
+			HTTPClient:     j.httpClient,
+			Cache:          j.documents(),
+			RetryAttempts:  j.retry.Attempts,
+			RetryBaseDelay: j.retry.BaseDelay,
+			RetryRand:      j.retry.Rand,
+			RequestTimeout: j.RequestTimeout,
+			RequestHeaders: j.RequestHeaders,
+
+			MinCacheLifetime: j.MinCacheLifetime,
+			MaxCacheLifetime: j.MaxCacheLifetime,
+
+			AllowNonCompliantBase64: j.AllowNonCompliantBase64 || j.legacy[LegacyHeaderStdEncoding],
+			AllowedKIDs:             j.AllowedKIDs,
+			AllowedKeyThumbprints:   j.AllowedKeyThumbprints,
+			X5CRoots:                j.X5CRoots,
+
+			LocalKeys:      j.LocalKeys,
+			CircuitBreaker: j.CircuitBreaker,
+		}
+		j.adaptorPinsKeys = true
+		if j.OnKeySetChange != nil {
+			adaptor.OnKeySetChange = j.approveKeySetChange
+		}
+		// The adaptor's key set fetches are noted for OnVerification
+		// hooks even without a Tracer.
+		adaptor.Tracer = fetchTracer{tracing.OrNoOp(j.Tracer)}
 		j.Adaptor = adaptor.New()
 	}
 
 	// Default to PT2M Leeway
 	j.leeway = 120
 
+	claimsToValidate := make(map[string]string, len(j.ClaimsToValidate))
+	for claim, value := range j.ClaimsToValidate {
+		claimsToValidate[claim] = value
+	}
+	j.ClaimsToValidate = claimsToValidate
+
+	typedClaimsToValidate := make(map[string]interface{}, len(j.TypedClaimsToValidate))
+	for claim, value := range j.TypedClaimsToValidate {
+		typedClaimsToValidate[claim] = value
+	}
+	j.TypedClaimsToValidate = typedClaimsToValidate
+
+	claimValidators := make(map[string]ClaimValidator, len(j.ClaimValidators))
+	for claim, validator := range j.ClaimValidators {
+		claimValidators[claim] = validator
+	}
+	j.ClaimValidators = claimValidators
+	j.RequiredScopes = append([]string(nil), j.RequiredScopes...)
+	j.RequiredGroups = append([]string(nil), j.RequiredGroups...)
+	j.AttestationKeys = append([]AttestationKey(nil), j.AttestationKeys...)
+	j.SecondaryKeySets = append([]KeySource(nil), j.SecondaryKeySets...)
+	if j.SensitiveClaims != nil {
+		j.SensitiveClaims = append([]string{}, j.SensitiveClaims...)
+	}
+
+	claimRequirements := make(map[string]StructClaimRequirement, len(j.ClaimRequirements))
+	for claim, requirement := range j.ClaimRequirements {
+		claimRequirements[claim] = requirement
+	}
+	j.ClaimRequirements = claimRequirements
+
+	claimStrictness := make(map[string]Strictness, len(j.ClaimStrictness))
+	for claim, strictness := range j.ClaimStrictness {
+		claimStrictness[claim] = strictness
+		if strictness == Advisory && !j.checksClaim(claim) {
+			j.Logger.Warn("an advisory claim has no check", "claim", claim)
+		}
+	}
+	j.ClaimStrictness = claimStrictness
+
+	j.decodes = newDecodeGroup()
+	j.goroutines = &lifecycle.Registry{}
+	j.hookQueue = newHookQueue(j.goroutines)
+	j.stats = &verifierStats{}
+	j.introspections = newIntrospectionCache()
+	j.tokens = newTokenCache(j.TokenCacheSize)
+
+	if j.CircuitBreaker != nil {
+		j.CircuitBreaker.Notify(j.circuitStateChanged)
+	}
+
 	return j
 }
 
 func (j *JwtVerifier) SetLeeway(duration string) {
 	dur, _ := time.ParseDuration(duration)
-	j.leeway = int64(dur.Seconds())
+	j.leeway = int64(dur / time.Second)
+}
+
+// SetNotIssuedBefore rejects every token issued before horizon, regardless
+// of its expiry. It is safe to call while verifications are in flight; a
+// zero time removes the horizon.
+func (j *JwtVerifier) SetNotIssuedBefore(horizon time.Time) {
+	j.notIssuedBefore.Store(horizon)
+}
+
+// NotIssuedBefore returns the horizon set by SetNotIssuedBefore.
+func (j *JwtVerifier) NotIssuedBefore() time.Time {
+	horizon, _ := j.notIssuedBefore.Load().(time.Time)
+	return horizon
 }
 
 func (j *JwtVerifier) VerifyAccessToken(jwt string) (*Jwt, error) {
-	validJwt, err := j.isValidJwt(jwt)
-	if validJwt == false {
-		return nil, fmt.Errorf("token is not valid: %s", err.Error())
+	return j.VerifyAccessTokenContext(context.Background(), jwt)
+}
+
+// VerifyAccessTokenContext is VerifyAccessToken with a context, which
+// carries the parent of its trace span, and options for this call only.
+// The context's cancellation does not abort fetches of the discovery
+// document or key set.
+func (j *JwtVerifier) VerifyAccessTokenContext(ctx context.Context, jwt string, opts ...VerifyOption) (*Jwt, error) {
+	ctx, end := j.startVerification(ctx, tracing.SpanVerifyAccessToken, "VerifyAccessToken")
+	myJwt, err := j.verifyAccessToken(ctx, jwt, newVerifyCall(opts))
+	end(myJwt, err)
+	j.recordVerification(err)
+	if err != nil {
+		j.log().Debug("access token verification failed", "error", err.Error())
+	}
+	return myJwt, err
+}
+
+func (j *JwtVerifier) verifyAccessToken(ctx context.Context, jwt string, call verifyCall) (*Jwt, error) {
+	header, err := j.parseAccessToken(jwt)
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := j.decodeJwt(jwt)
+	resp, source, err := j.decodeJwt(ctx, jwt, header)
 	if err != nil {
 		return nil, err
 	}
 
-	token := resp.(map[string]interface{})
+	start := time.Now()
+	myJwt, err := j.validateAccessTokenClaims(ctx, jwt, header, resp.(map[string]interface{}), call)
+	detailFrom(ctx).since(stageClaims, start)
+	myJwt.Info.SecondaryKeySet = source.uri()
+	return myJwt, err
+}
+
+// parseAccessToken parses an access token and makes the checks of its
+// header that come before its signature is verified.
+func (j *JwtVerifier) parseAccessToken(jwt string) (jwtHeader, error) {
+	header, err := j.parseJwt(jwt)
+	if err != nil {
+		return jwtHeader{}, failedWith(FailureMalformed, "token is not valid: %w", err)
+	}
+
+	if j.orgIssuer && !j.ForceLocalAccessTokenVerification {
+		return jwtHeader{}, failedWith(FailureOther, "token is not valid: %w", errors.OrgAccessTokenError(j.Issuer))
+	}
 
+	if j.ExpectedTokenType != "" && !sameTokenType(header.typ, j.ExpectedTokenType) {
+		return jwtHeader{}, failedWith(FailureMalformed, "token is not valid: the tokens header 'typ' is %q, expected %q",
+			header.typ, j.ExpectedTokenType)
+	}
+	return header, nil
+}
+
+// validateAccessTokenClaims runs every check on an access token other than
+// the signature. Every failing check is reported, joined in one error.
+func (j *JwtVerifier) validateAccessTokenClaims(ctx context.Context, jwt string, header jwtHeader, token map[string]interface{}, call verifyCall) (*Jwt, error) {
+	canonicalizeTemporalClaims(token)
 	myJwt := Jwt{
-		Claims: token,
+		Header:    header.params,
+		Claims:    token,
+		Info:      header.info(),
+		payload:   header.segments[1],
+		sensitive: j.SensitiveClaims,
 	}
 
-	err = j.validateIss(token["iss"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issuer` was not able to be validated. %s", err.Error())
+	// now is the single instant every temporal check of the token, and
+	// what is recorded about it, is made against.
+	now := j.now()
+
+	var errs []error
+	if err := j.validateTokenIss(token["iss"]); err != nil {
+		errs = append(errs, failedWith(FailureIssuer, "the `Issuer` was not able to be validated. %w", err))
 	}
 
-	err = j.validateAudience(token["aud"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Audience` was not able to be validated. %s", err.Error())
+	if !call.policies {
+		if err := j.validateAudience(token["aud"]); err != nil {
+			errs = append(errs, failedWith(FailureAudience, "the `Audience` was not able to be validated. %w", err))
+		}
+
+		if err := j.validateClientIdClaims(token); err != nil {
+			errs = append(errs, failedWith(FailureAudience, "the `Client Id` was not able to be validated. %w", err))
+		}
 	}
 
-	err = j.validateClientId(token["cid"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Client Id` was not able to be validated. %s", err.Error())
+	if err := j.validateSubject(token["sub"]); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Subject` was not able to be validated. %w", err))
 	}
 
-	err = j.validateExp(token["exp"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Expiration` was not able to be validated. %s", err.Error())
+	if err := j.validateExp(token["exp"], now); err != nil {
+		errs = append(errs, failedWith(FailureExpired, "the `Expiration` was not able to be validated. %w", err))
 	}
 
-	err = j.validateIat(token["iat"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issued At` was not able to be validated. %s", err.Error())
+	if err := j.validateNbf(token["nbf"], now); err != nil {
+		errs = append(errs, failedWith(FailureNotYetValid, "the `Not Before` was not able to be validated. %w", err))
+	}
+
+	if err := j.validateIat(token["iat"], now); err != nil {
+		errs = append(errs, failedWith(FailureNotYetValid, "the `Issued At` was not able to be validated. %w", err))
+	} else if err := j.validateHorizon(token["iat"]); err != nil {
+		errs = append(errs, failedWith(FailurePredatesHorizon, "the `Issued At` was not able to be validated. %w", err))
+	}
+
+	if err := j.validateMaxAge(token["iat"], j.maxTokenAge(call), now); err != nil {
+		errs = append(errs, failedWith(FailureTooOld, "the `Issued At` was not able to be validated. %w", err))
 	}
 
+	if !call.policies {
+		if err := myJwt.RequireScopes(j.RequiredScopes...); err != nil {
+			errs = append(errs, failedWith(FailureClaims, "the `Scopes` were not able to be validated. %w", err))
+		}
+
+		if err := j.validateGroups(&myJwt); err != nil {
+			errs = append(errs, failedWith(FailureClaims, "the `Groups` were not able to be validated. %w", err))
+		}
+
+		if err := j.validateClaimRequirements(token); err != nil {
+			errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+		}
+	}
+
+	if err := validateClaimValues(j.TypedClaimsToValidate, token, j.ClaimStrictness); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+	}
+
+	if err := validateClaimValues(call.claims, token, nil); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+	}
+
+	if err := validateClaimValidators(j.ClaimValidators, token, call.facts, j.ClaimStrictness); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+	}
+
+	if call.policy != nil {
+		for _, err := range call.policy.check(&myJwt) {
+			errs = append(errs, failedWith(FailureClaims, "the `Policy` was not satisfied. %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &myJwt, joinValidationErrors(errs)
+	}
+
+	myJwt.Info.AdvisoryFailures = j.advisoryFailures(token, call.facts)
+
+	j.recordLeeway(&myJwt, now)
+	j.notifyNearExpiry(ctx, jwt, &myJwt, now)
+
 	return &myJwt, nil
 }
 
-func (j *JwtVerifier) decodeJwt(jwt string) (interface{}, error) {
-	metaData, err := j.getMetaData()
+// decodeJwt verifies the token's signature and returns its claims, and the
+// secondary key set it was verified with, if any.
+func (j *JwtVerifier) decodeJwt(ctx context.Context, jwt string, header jwtHeader) (interface{}, *KeySource, error) {
+	if err := j.validatePinnedKey(header); err != nil {
+		return nil, nil, failedWith(FailureSignature, "could not decode token: %w", err)
+	}
+
+	var key [sha256.Size]byte
+	if j.tokens != nil {
+		key = sha256.Sum256([]byte(jwt))
+		if resp, source, ok := j.tokens.get(key, j.now()); ok {
+			j.log().Debug("token cache hit")
+			return resp, source, nil
+		}
+	}
+
+	detail := detailFrom(ctx)
+	start := time.Now()
+	jwksUri, err := j.jwksUri(ctx)
+	detail.since(stageDiscovery, start)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	resp, err := j.Adaptor.Decode(jwt, metaData["jwks_uri"].(string))
+	// Adaptors are given the kid, alg and segments so they are spared
+	// splitting the token and parsing the header again. A kid that is not a
+	// string is left for the adaptor to reject.
+	kid, _ := header.kid.(string)
+	detail.setKeyID(kid)
+	config := adaptors.DecodeConfig{
+		JWKSURI:            jwksUri,
+		KeyID:              kid,
+		HTTPClient:         j.httpClient,
+		RequestTimeout:     j.RequestTimeout,
+		Cache:              j.Cache,
+		Algorithms:         j.algorithms(),
+		Algorithm:          header.alg,
+		Segments:           header.segments,
+		NonCompliantBase64: header.nonCompliant,
+	}
+	start = time.Now()
+	resp, source, err := j.decodeWithKeySets(ctx, jwt, config)
+	detail.since(stageDecode, start)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not decode token: %s", err.Error())
+		var notFound *errors.KeyNotFound
+		if goerrors.As(err, &notFound) {
+			j.notifyKeyNotFound(ctx, notFound)
+		}
+		return nil, nil, failedWith(FailureSignature, "could not decode token: %w", err)
+	}
+
+	if err := j.checkKeySetIssuer(resp.(map[string]interface{}), source); err != nil {
+		return nil, nil, failedWith(FailureSignature, "could not decode token: %w", err)
+	}
+	if source != nil {
+		j.notifySecondaryKeySet(ctx, source, kid)
 	}
 
-	return resp, nil
+	if j.tokens != nil {
+		j.cacheToken(key, jwt, resp, source)
+	}
+
+	return resp, source, nil
+}
+
+// jwksUri returns the jwks_uri from the discovery document or, with
+// LocalKeys, where the local key set was read from, without discovery.
+func (j *JwtVerifier) jwksUri(ctx context.Context) (string, error) {
+	if j.LocalKeys != nil {
+		return j.LocalKeys.Source(), nil
+	}
+
+	metaData, err := j.getMetaData(ctx)
+	if err != nil {
+		return "", err
+	}
+	return metaData["jwks_uri"].(string), nil
 }
 
 func (j *JwtVerifier) VerifyIdToken(jwt string) (*Jwt, error) {
-	validJwt, err := j.isValidJwt(jwt)
-	if validJwt == false {
-		return nil, fmt.Errorf("token is not valid: %s", err.Error())
+	return j.VerifyIdTokenContext(context.Background(), jwt)
+}
+
+// VerifyIdTokenContext is VerifyIdToken with a context, which carries the
+// parent of its trace span, and options for this call only. The context's
+// cancellation does not abort fetches of the discovery document or key set.
+func (j *JwtVerifier) VerifyIdTokenContext(ctx context.Context, jwt string, opts ...VerifyOption) (*Jwt, error) {
+	ctx, end := j.startVerification(ctx, tracing.SpanVerifyIdToken, "VerifyIdToken")
+	myJwt, err := j.verifyIdToken(ctx, jwt, newVerifyCall(opts))
+	end(myJwt, err)
+	j.recordVerification(err)
+	if err != nil {
+		j.log().Debug("id token verification failed", "error", err.Error())
 	}
+	return myJwt, err
+}
 
-	resp, err := j.decodeJwt(jwt)
+func (j *JwtVerifier) verifyIdToken(ctx context.Context, jwt string, call verifyCall) (*Jwt, error) {
+	header, err := j.parseJwt(jwt)
+	if err != nil {
+		return nil, failedWith(FailureMalformed, "token is not valid: %w", err)
+	}
+
+	if j.ExpectedTokenType != "" && header.typ != "" && !sameTokenType(header.typ, "JWT") {
+		return nil, failedWith(FailureMalformed, "token is not valid: the tokens header 'typ' is %q, expected \"JWT\" or none",
+			header.typ)
+	}
+
+	resp, source, err := j.decodeJwt(ctx, jwt, header)
 	if err != nil {
 		return nil, err
 	}
 
 	token := resp.(map[string]interface{})
+	canonicalizeTemporalClaims(token)
 
 	myJwt := Jwt{
-		Claims: token,
+		Header:    header.params,
+		Claims:    token,
+		Info:      header.info(),
+		payload:   header.segments[1],
+		sensitive: j.SensitiveClaims,
 	}
+	myJwt.Info.SecondaryKeySet = source.uri()
 
-	err = j.validateIss(token["iss"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issuer` was not able to be validated. %s", err.Error())
+	// now is the single instant every temporal check of the token, and
+	// what is recorded about it, is made against.
+	now := j.now()
+
+	var errs []error
+	if err := j.validateTokenIss(token["iss"]); err != nil {
+		errs = append(errs, failedWith(FailureIssuer, "the `Issuer` was not able to be validated. %w", err))
 	}
 
-	err = j.validateAudience(token["aud"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Audience` was not able to be validated. %s", err.Error())
+	if err := j.validateAudience(token["aud"]); err != nil {
+		errs = append(errs, failedWith(FailureAudience, "the `Audience` was not able to be validated. %w", err))
 	}
 
-	err = j.validateExp(token["exp"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Expiration` was not able to be validated. %s", err.Error())
+	if err := j.validateAuthorizedParty(token["azp"], token["aud"]); err != nil {
+		errs = append(errs, failedWith(FailureAudience, "the `Authorized Party` was not able to be validated. %w", err))
 	}
 
-	err = j.validateIat(token["iat"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issued At` was not able to be validated. %s", err.Error())
+	if err := j.validateSubject(token["sub"]); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Subject` was not able to be validated. %w", err))
 	}
 
-	err = j.validateNonce(token["nonce"])
-	if err != nil {
-		return &myJwt, fmt.Errorf("the `Nonce` was not able to be validated. %s", err.Error())
+	if err := j.validateExp(token["exp"], now); err != nil {
+		errs = append(errs, failedWith(FailureExpired, "the `Expiration` was not able to be validated. %w", err))
+	}
+
+	if err := j.validateNbf(token["nbf"], now); err != nil {
+		errs = append(errs, failedWith(FailureNotYetValid, "the `Not Before` was not able to be validated. %w", err))
+	}
+
+	if err := j.validateIat(token["iat"], now); err != nil {
+		errs = append(errs, failedWith(FailureNotYetValid, "the `Issued At` was not able to be validated. %w", err))
+	} else if err := j.validateHorizon(token["iat"]); err != nil {
+		errs = append(errs, failedWith(FailurePredatesHorizon, "the `Issued At` was not able to be validated. %w", err))
+	}
+
+	if err := j.validateMaxAge(token["iat"], j.maxTokenAge(call), now); err != nil {
+		errs = append(errs, failedWith(FailureTooOld, "the `Issued At` was not able to be validated. %w", err))
+	}
+
+	if err := j.validateNonce(token["nonce"]); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Nonce` was not able to be validated. %w", err))
 	}
 
+	if err := j.validateGroups(&myJwt); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Groups` were not able to be validated. %w", err))
+	}
+
+	if err := j.validateClaimRequirements(token); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+	}
+
+	if err := validateClaimValues(j.TypedClaimsToValidate, token, j.ClaimStrictness); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+	}
+
+	if err := validateClaimValues(call.claims, token, nil); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+	}
+
+	if err := validateClaimValidators(j.ClaimValidators, token, call.facts, j.ClaimStrictness); err != nil {
+		errs = append(errs, failedWith(FailureClaims, "the `Claims` were not able to be validated. %w", err))
+	}
+
+	if len(errs) > 0 {
+		return &myJwt, joinValidationErrors(errs)
+	}
+
+	myJwt.Info.AdvisoryFailures = j.advisoryFailures(token, call.facts)
+
+	j.recordLeeway(&myJwt, now)
+	j.notifyNearExpiry(ctx, jwt, &myJwt, now)
+
 	return &myJwt, nil
 }
 
@@ -191,6 +909,17 @@ func (j *JwtVerifier) GetAdaptor() adaptors.Adaptor {
 	return j.Adaptor
 }
 
+func (j *JwtVerifier) log() logger.Logger {
+	return logger.OrNoOp(j.Logger)
+}
+
+func (j *JwtVerifier) now() time.Time {
+	if j.Now == nil {
+		return time.Now()
+	}
+	return j.Now()
+}
+
 func (j *JwtVerifier) validateNonce(nonce interface{}) error {
 	if nonce == nil {
 		nonce = ""
@@ -216,6 +945,16 @@ func (j *JwtVerifier) validateAudience(audience interface{}) error {
 			}
 		}
 		return fmt.Errorf("aud: %s does not match %s", v, j.ClaimsToValidate["aud"])
+	case []interface{}:
+		if j.legacy[LegacyAudStringOnly] {
+			return fmt.Errorf("Unknown type for audience validation")
+		}
+		for _, element := range v {
+			if element == j.ClaimsToValidate["aud"] {
+				return nil
+			}
+		}
+		return fmt.Errorf("aud: %s does not match %s", v, j.ClaimsToValidate["aud"])
 	default:
 		return fmt.Errorf("Unknown type for audience validation")
 	}
@@ -223,6 +962,57 @@ func (j *JwtVerifier) validateAudience(audience interface{}) error {
 	return nil
 }
 
+func (j *JwtVerifier) validateAuthorizedParty(azp interface{}, audience interface{}) error {
+	// The authorized party is the client the ID token was issued to, which defaults to the expected audience
+	expected, exists := j.ClaimsToValidate["azp"]
+	if !exists {
+		expected = j.ClaimsToValidate["aud"]
+	}
+
+	if azp == nil {
+		if audienceCount(audience) > 1 {
+			return fmt.Errorf("azp: missing, but required when the token has multiple audiences")
+		}
+		return nil
+	}
+
+	if azp != expected {
+		return fmt.Errorf("azp: %s does not match %s", azp, expected)
+	}
+	return nil
+}
+
+func audienceCount(audience interface{}) int {
+	switch v := audience.(type) {
+	case []string:
+		return len(v)
+	case []interface{}:
+		return len(v)
+	case nil:
+		return 0
+	}
+	return 1
+}
+
+// validateClientIdClaims validates the token's cid claim or, for tokens
+// without one such as RFC 9068 access tokens, its client_id claim. A token
+// carrying both must carry the same client in each.
+func (j *JwtVerifier) validateClientIdClaims(claims map[string]interface{}) error {
+	if _, exists := j.ClaimsToValidate["cid"]; !exists {
+		return nil
+	}
+
+	cid, hasCid := claims["cid"]
+	clientId, hasClientId := claims["client_id"]
+	switch {
+	case hasCid && hasClientId && !claimValuesEqual(cid, clientId):
+		return fmt.Errorf("cid: %v conflicts with client_id %v", cid, clientId)
+	case !hasCid && hasClientId:
+		return j.validateClientId(clientId)
+	}
+	return j.validateClientId(cid)
+}
+
 func (j *JwtVerifier) validateClientId(clientId interface{}) error {
 	// Client Id can be optional, it will be validated if it is present in the ClaimsToValidate array
 	if cid, exists := j.ClaimsToValidate["cid"]; exists && clientId != cid {
@@ -247,117 +1037,479 @@ func (j *JwtVerifier) validateClientId(clientId interface{}) error {
 	return nil
 }
 
-func (j *JwtVerifier) validateExp(exp interface{}) error {
-	expf, ok := exp.(float64)
-	if !ok {
+// validateSubject checks sub against ClaimsToValidate["sub"], if set, and
+// that it is present if RequireSubject is set.
+func (j *JwtVerifier) validateSubject(subject interface{}) error {
+	sub, _ := subject.(string)
+	if (j.RequireSubject || j.ClaimsToValidate["sub"] != "") && sub == "" {
+		return fmt.Errorf("sub: missing")
+	}
+
+	if expected, exists := j.ClaimsToValidate["sub"]; exists && sub != expected {
+		return fmt.Errorf("sub: %s does not match %s", sub, expected)
+	}
+	return nil
+}
+
+func (j *JwtVerifier) validateGroups(token *Jwt) error {
+	if len(j.RequiredGroups) == 0 {
+		return nil
+	}
+
+	names := []string{j.GroupsClaim}
+	if j.GroupsClaim == "" {
+		names = []string{"groups", "grp"}
+	}
+
+	var groups []string
+	present := false
+	for _, name := range names {
+		if _, exists := token.Claims[name]; exists {
+			groups, _ = token.StringSliceClaim(name)
+			present = true
+			break
+		}
+	}
+
+	if !present {
+		return fmt.Errorf("groups: the token does not contain a %s claim", strings.Join(names, " or "))
+	}
+
+	member := map[string]bool{}
+	for _, group := range groups {
+		member[group] = true
+	}
+
+	var missing []string
+	for _, group := range j.RequiredGroups {
+		if !member[group] {
+			missing = append(missing, group)
+		}
+	}
+
+	if j.RequireAllGroups && len(missing) > 0 {
+		return fmt.Errorf("groups: missing required groups %s", strings.Join(missing, ", "))
+	}
+
+	if !j.RequireAllGroups && len(missing) == len(j.RequiredGroups) {
+		return fmt.Errorf("groups: not a member of any of %s", strings.Join(j.RequiredGroups, ", "))
+	}
+	return nil
+}
+
+func (j *JwtVerifier) validateExp(exp interface{}, now time.Time) error {
+	if exp == nil {
 		return fmt.Errorf("exp: missing")
 	}
-	if float64(time.Now().Unix()-j.leeway) > expf {
+	expSeconds, err := unixSeconds("exp", exp)
+	if err != nil {
+		return err
+	}
+	if !AcceptableExpiry(time.Unix(expSeconds, 0), now, j.leewayDuration()) {
 		return fmt.Errorf("the token is expired")
 	}
 	return nil
 }
 
-func (j *JwtVerifier) validateIat(iat interface{}) error {
-	iatf, ok := iat.(float64)
-	if !ok {
+func (j *JwtVerifier) validateIat(iat interface{}, now time.Time) error {
+	if iat == nil {
 		return fmt.Errorf("iat: missing")
 	}
-	if float64(time.Now().Unix()+j.leeway) < iatf {
+	iatSeconds, err := unixSeconds("iat", iat)
+	if err != nil {
+		return err
+	}
+	if !AcceptableIssuedAt(time.Unix(iatSeconds, 0), now, j.leewayDuration()) {
 		return fmt.Errorf("the token was issued in the future")
 	}
 	return nil
 }
 
+// validateNbf allows for the same leeway as validateIat. Tokens without an
+// nbf claim are valid immediately.
+func (j *JwtVerifier) validateNbf(nbf interface{}, now time.Time) error {
+	if nbf == nil {
+		return nil
+	}
+	nbfSeconds, err := unixSeconds("nbf", nbf)
+	if err != nil {
+		return err
+	}
+	if !AcceptableNotBefore(time.Unix(nbfSeconds, 0), now, j.leewayDuration()) {
+		return errors.TokenNotYetValidError(time.Unix(nbfSeconds, 0))
+	}
+	return nil
+}
+
+// leewayDuration is the leeway for the Acceptable functions.
+func (j *JwtVerifier) leewayDuration() time.Duration {
+	return time.Duration(j.leeway) * time.Second
+}
+
+func (j *JwtVerifier) validateHorizon(iat interface{}) error {
+	horizon := j.NotIssuedBefore()
+	if horizon.IsZero() {
+		return nil
+	}
+
+	if iat == nil {
+		return fmt.Errorf("iat: missing")
+	}
+	iatSeconds, err := unixSeconds("iat", iat)
+	if err != nil {
+		return err
+	}
+	if iatSeconds < horizon.Unix() {
+		return errors.TokenPredatesHorizonError(time.Unix(iatSeconds, 0), horizon)
+	}
+	return nil
+}
+
+// validateMaxAge allows for the same leeway as validateIat. A missing or
+// malformed iat is left to validateIat to report.
+func (j *JwtVerifier) validateMaxAge(iat interface{}, maxAge time.Duration, now time.Time) error {
+	if maxAge <= 0 || iat == nil {
+		return nil
+	}
+	iatSeconds, err := unixSeconds("iat", iat)
+	if err != nil {
+		return nil
+	}
+	issuedAt := time.Unix(iatSeconds, 0)
+	if now.Sub(issuedAt) > maxAge+j.leewayDuration() {
+		return errors.TokenTooOldError(issuedAt, maxAge)
+	}
+	return nil
+}
+
+// maxTokenAge is the MaxTokenAge of call, tightened for transactions.
+func (j *JwtVerifier) maxTokenAge(call verifyCall) time.Duration {
+	if !call.transaction {
+		return j.MaxTokenAge
+	}
+	maxAge := j.TransactionMaxTokenAge
+	if maxAge <= 0 {
+		maxAge = DefaultTransactionMaxTokenAge
+	}
+	if j.MaxTokenAge > 0 && j.MaxTokenAge < maxAge {
+		return j.MaxTokenAge
+	}
+	return maxAge
+}
+
 func (j *JwtVerifier) validateIss(issuer interface{}) error {
-	if issuer != j.Issuer {
-		return fmt.Errorf("iss: %s does not match %s", issuer, j.Issuer)
+	if j.SkipIssuerValidation {
+		return nil
+	}
+
+	expected := j.Issuer
+	if iss, exists := j.ClaimsToValidate["iss"]; exists {
+		expected = iss
+	}
+
+	claim, ok := issuer.(string)
+	if ok && j.legacy[LegacyIssExactMatch] && claim != expected {
+		return fmt.Errorf("iss: %v does not match %s", issuer, expected)
+	}
+	if !ok || claim == "" || normalizeIssuer(claim) != normalizeIssuer(expected) {
+		return fmt.Errorf("iss: %v does not match %s", issuer, expected)
 	}
 	return nil
 }
 
-func (j *JwtVerifier) getMetaData() (map[string]interface{}, error) {
-	metaDataUrl := j.Issuer + j.Discovery.GetWellKnownUrl()
+// metaDataUrl is the URL of the issuer's discovery document. A trailing
+// slash on the issuer is ignored.
+func (j *JwtVerifier) metaDataUrl() string {
+	return normalizeIssuer(j.Issuer) + j.Discovery.GetWellKnownUrl()
+}
+
+func (j *JwtVerifier) getMetaData(ctx context.Context) (map[string]interface{}, error) {
+	metaDataUrl := j.metaDataUrl()
 
 	metaDataMu.Lock()
 	defer metaDataMu.Unlock()
 
-	if x, found := metaDataCache.Get(metaDataUrl); found {
-		return x.(map[string]interface{}), nil
+	if body, found := j.documents().Get(cache.MetadataKey(metaDataUrl)); found {
+		md, err := decodeMetaData(metaDataUrl, body)
+		if err == nil {
+			j.log().Debug("metadata cache hit", "url", metaDataUrl)
+			return md, nil
+		}
+		j.log().Warn("cached metadata is malformed", "url", metaDataUrl, "error", err.Error())
 	}
 
-	resp, err := http.Get(metaDataUrl)
+	return j.fetchMetaData(ctx, metaDataUrl)
+}
+
+// fetchMetaData fetches the discovery document and caches it. It does not
+// take metaDataMu, so a background refresh does not block verifications.
+func (j *JwtVerifier) fetchMetaData(ctx context.Context, metaDataUrl string) (_ map[string]interface{}, err error) {
+	ctx, end := j.startFetch(ctx, tracing.SpanFetchMetadata, metaDataUrl)
+	defer func() { end(err) }()
+
+	j.log().Debug("fetching metadata", "url", metaDataUrl)
+	resp, err := fetch.GetResponse(ctx, fetch.Config{
+		Client:  j.httpClient,
+		Retry:   j.retry,
+		Timeout: j.RequestTimeout,
+		Header:  j.RequestHeaders,
+		Breaker: j.CircuitBreaker,
+	}, metaDataUrl)
 
 	if err != nil {
-		return nil, fmt.Errorf("request for metadata was not successful: %s", err.Error())
+		j.log().Warn("metadata request failed", "url", metaDataUrl, "error", err.Error())
+		return nil, fmt.Errorf("request for metadata was not successful: %w", errors.KeysUnavailableError(err))
 	}
 
-	defer resp.Body.Close()
-
-	md := make(map[string]interface{})
-	json.NewDecoder(resp.Body).Decode(&md)
+	md, err := decodeMetaData(metaDataUrl, resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
-	metaDataCache.SetDefault(metaDataUrl, md)
+	lifetime := resp.Lifetime(cacheLifetime, j.minCacheLifetime(), j.maxCacheLifetime())
+	j.log().Debug("caching metadata", "url", metaDataUrl, "lifetime", lifetime.String())
+	j.documents().Set(cache.MetadataKey(metaDataUrl), resp.Body, lifetime)
+	metaDataFetched.Store(metaDataUrl, time.Now())
 
 	return md, nil
 }
 
+func (j *JwtVerifier) minCacheLifetime() time.Duration {
+	if j.MinCacheLifetime > 0 {
+		return j.MinCacheLifetime
+	}
+	return cache.DefaultMinLifetime
+}
+
+func (j *JwtVerifier) maxCacheLifetime() time.Duration {
+	if j.MaxCacheLifetime > 0 {
+		return j.MaxCacheLifetime
+	}
+	return cache.DefaultMaxLifetime
+}
+
+// decodeMetaData decodes a discovery document. Documents are decoded once
+// and the result shared, so it must not be modified.
+func decodeMetaData(metaDataUrl string, body []byte) (map[string]interface{}, error) {
+	md, err := metaDataDecoded.Decode(metaDataUrl, body, func(body []byte) (interface{}, error) {
+		md := make(map[string]interface{})
+		if err := json.Unmarshal(body, &md); err != nil {
+			return nil, errors.DiscoveryMalformedError(metaDataUrl, fetch.Snippet(body), err.Error())
+		}
+
+		if _, ok := md["jwks_uri"].(string); !ok {
+			return nil, errors.DiscoveryMalformedError(metaDataUrl, fetch.Snippet(body), "jwks_uri is missing")
+		}
+		return md, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return md.(map[string]interface{}), nil
+}
+
+// validatePinnedKey checks the token's kid against AllowedKIDs, and that
+// AllowedKeyThumbprints and X5CRoots can be enforced.
+func (j *JwtVerifier) validatePinnedKey(header jwtHeader) error {
+	if len(j.AllowedKeyThumbprints) > 0 && !j.adaptorPinsKeys {
+		return errors.KeyNotPinnedError("AllowedKeyThumbprints needs the default adaptor")
+	}
+	if j.X5CRoots != nil && !j.adaptorPinsKeys {
+		return errors.KeyNotPinnedError("X5CRoots needs the default adaptor")
+	}
+	if len(j.AllowedKIDs) == 0 {
+		return nil
+	}
+
+	kid, _ := header.kid.(string)
+	for _, allowed := range j.AllowedKIDs {
+		if kid != "" && kid == allowed {
+			return nil
+		}
+	}
+	return errors.KeyNotPinnedError(fmt.Sprintf("kid %q is not allowed", kid))
+}
+
 func (j *JwtVerifier) isValidJwt(jwt string) (bool, error) {
+	_, err := j.parseJwt(jwt)
+	return err == nil, err
+}
+
+// isEncryptedHeader reports whether header is the header of a JWE. Only a
+// JWE header has an enc member, naming the content encryption algorithm.
+func isEncryptedHeader(header map[string]interface{}) bool {
+	_, ok := header["enc"]
+	return ok
+}
+
+// jwtHeader is what verification needs from a token that passed parseJwt,
+// so that it is split and its header decoded only once.
+type jwtHeader struct {
+	kid interface{}
+
+	// alg is the alg member, one of the verifier's algorithms.
+	alg string
+
+	// typ is the typ member, or "" if there is none.
+	typ string
+
+	// params are all the header's members, for Jwt.Header.
+	params map[string]interface{}
+
+	// segments are the token's header, payload and signature, still
+	// encoded.
+	segments [3]string
+
+	// nonCompliant is set when a segment is standard rather than URL
+	// base64.
+	nonCompliant bool
+}
+
+// info returns the VerificationInfo of the token the header is from.
+func (h jwtHeader) info() VerificationInfo {
+	return VerificationInfo{NonCompliantBase64: h.nonCompliant}
+}
+
+var segmentNames = [3]string{"header", "payload", "signature"}
+
+// parseJwt checks the structure of a token and the contents of its header,
+// and returns the header.
+func (j *JwtVerifier) parseJwt(jwt string) (jwtHeader, error) {
 	if jwt == "" {
-		return false, errors.JwtEmptyStringError()
+		return jwtHeader{}, errors.JwtEmptyStringError()
 	}
 
-	// Verify that the JWT Follows correct JWT encoding.
-	var jwtRegex = regx.MatchString
-	if !jwtRegex(jwt) {
-		return false, fmt.Errorf("token must contain at least 1 period ('.') and only characters 'a-Z 0-9 _'")
+	if j.MaxTokenSize > 0 && len(jwt) > j.MaxTokenSize {
+		return jwtHeader{}, errors.JwtTooLargeError(len(jwt), j.MaxTokenSize)
 	}
 
-	parts := strings.Split(jwt, ".")
-	header := parts[0]
-	header = padHeader(header)
-	headerDecoded, err := base64.StdEncoding.DecodeString(header)
+	// A JWS in compact serialization is three base64url segments separated
+	// by periods. Five segments is the compact serialization of a JWE.
+	switch strings.Count(jwt, ".") {
+	case 2:
+	case 4:
+		return jwtHeader{}, errors.JwtEncryptedError()
+	default:
+		return jwtHeader{}, fmt.Errorf("token must contain exactly 3 parts separated by periods ('.')")
+	}
+
+	first := strings.IndexByte(jwt, '.')
+	last := strings.LastIndexByte(jwt, '.')
+	parts := [3]string{jwt[:first], jwt[first+1 : last], jwt[last+1:]}
+
+	nonCompliant := false
+	for i, part := range parts {
+		if part == "" {
+			return jwtHeader{}, fmt.Errorf("the tokens %s is empty", segmentNames[i])
+		}
+		if segment.IsBase64URL(part) {
+			continue
+		}
+		nonCompliant = true
+		if i == 0 && j.legacy[LegacyHeaderStdEncoding] && segment.IsStdBase64(part) {
+			continue
+		}
+		if !j.AllowNonCompliantBase64 || !segment.IsStdBase64(part) {
+			return jwtHeader{}, fmt.Errorf("the tokens %s does not appear to be a base64 encoded string", segmentNames[i])
+		}
+	}
+
+	headerDecoded, _, err := segment.DecodeLenient(parts[0])
 
 	if err != nil {
-		return false, fmt.Errorf("the tokens header does not appear to be a base64 encoded string")
+		return jwtHeader{}, fmt.Errorf("the tokens header does not appear to be a base64 encoded string")
 	}
 
 	var jsonObject map[string]interface{}
-	isHeaderJson := json.Unmarshal([]byte(headerDecoded), &jsonObject) == nil
+	isHeaderJson := json.Unmarshal(headerDecoded, &jsonObject) == nil
 	if isHeaderJson == false {
-		return false, fmt.Errorf("the tokens header is not a json object")
-	}
-
-	if len(jsonObject) < 2 {
-		return false, fmt.Errorf("the tokens header does not contain enough properties. " +
-			"Should contain `alg` and `kid`")
+		return jwtHeader{}, fmt.Errorf("the tokens header is not a json object")
 	}
 
-	if len(jsonObject) > 2 {
-		return false, fmt.Errorf("the tokens header contains too many properties. " +
-			"Should only contain `alg` and `kid`")
+	if isEncryptedHeader(jsonObject) {
+		return jwtHeader{}, errors.JwtEncryptedError()
 	}
 
 	_, algExists := jsonObject["alg"]
-	_, kidExists := jsonObject["kid"]
+	kid, kidExists := jsonObject["kid"]
 
 	if algExists == false {
-		return false, fmt.Errorf("the tokens header must contain an 'alg'")
+		return jwtHeader{}, fmt.Errorf("the tokens header must contain an 'alg'")
 	}
 
 	if kidExists == false {
-		return false, fmt.Errorf("the tokens header must contain a 'kid'")
+		return jwtHeader{}, fmt.Errorf("the tokens header must contain a 'kid'")
+	}
+
+	if j.legacy[LegacyHeaderExactMembers] && len(jsonObject) > 2 {
+		return jwtHeader{}, fmt.Errorf("the tokens header contains too many properties. " +
+			"Should only contain `alg` and `kid`")
 	}
 
-	if jsonObject["alg"] != "RS256" {
-		return false, fmt.Errorf("the only supported alg is RS256")
+	if err := rejectHeaderParameters(jsonObject); err != nil {
+		return jwtHeader{}, err
 	}
 
-	return true, nil
+	// Other members, such as typ and x5t, are allowed.
+	var typ string
+	if value, typExists := jsonObject["typ"]; typExists {
+		var ok bool
+		if typ, ok = value.(string); !ok {
+			return jwtHeader{}, fmt.Errorf("the tokens header 'typ' must be a string")
+		}
+	}
+
+	allowed := j.algorithms()
+	for _, alg := range allowed {
+		if jsonObject["alg"] == alg {
+			return jwtHeader{
+				kid:          kid,
+				alg:          alg,
+				typ:          typ,
+				params:       jsonObject,
+				segments:     parts,
+				nonCompliant: nonCompliant,
+			}, nil
+		}
+	}
+
+	if len(allowed) == 1 {
+		return jwtHeader{}, fmt.Errorf("the only supported alg is %s", allowed[0])
+	}
+	return jwtHeader{}, fmt.Errorf("the alg must be one of %s", strings.Join(allowed, ", "))
 }
-func padHeader(header string) string {
-	if i := len(header) % 4; i != 0 {
-		header += strings.Repeat("=", 4-i)
+
+// rejectHeaderParameters returns an errors.HeaderRejected for header
+// members that would change how the token is verified. No extensions are
+// understood, so any crit member is rejected (RFC 7515, section 4.1.11),
+// and the signing key is only ever taken from the issuer's key set, never
+// from a jwk or jku member.
+func rejectHeaderParameters(header map[string]interface{}) error {
+	if crit, ok := header["crit"]; ok {
+		return errors.HeaderRejectedError("crit", fmt.Sprintf("the critical extensions %v are not supported", crit))
+	}
+	if _, ok := header["jwk"]; ok {
+		return errors.HeaderRejectedError("jwk", "the signing key must come from the issuer's key set, not the token")
+	}
+	if _, ok := header["jku"]; ok {
+		return errors.HeaderRejectedError("jku", "the signing key must come from the issuer's key set, not a URL in the token")
+	}
+	return nil
+}
+
+// sameTokenType compares typ header values as media types, ignoring case
+// and an "application/" prefix (RFC 7515, section 4.1.9).
+func sameTokenType(typ string, expected string) bool {
+	normalize := func(t string) string {
+		t = strings.ToLower(t)
+		return strings.TrimPrefix(t, "application/")
+	}
+	return normalize(typ) == normalize(expected)
+}
+
+func (j *JwtVerifier) algorithms() []string {
+	if len(j.allowedAlgorithms) == 0 {
+		return DefaultAllowedAlgorithms
 	}
-	return header
+	return j.allowedAlgorithms
 }
@@ -18,7 +18,12 @@ package jwtverifier
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	goerrors "errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -29,8 +34,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
 	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
 	"github.com/okta/okta-jwt-verifier-golang/discovery/oidc"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
 	"github.com/okta/okta-jwt-verifier-golang/utils"
 )
 
@@ -73,6 +83,54 @@ func Test_can_validate_iss_from_issuer_provided(t *testing.T) {
 	}
 }
 
+func Test_iss_validation_tolerates_a_trailing_slash(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com/oauth2/default/",
+	}
+
+	jv := jvs.New()
+
+	if err := jv.validateIss("https://golang.oktapreview.com/oauth2/default"); err != nil {
+		t.Errorf("the issuer validation triggered an error for a trailing slash difference: %s", err)
+	}
+
+	if err := jv.validateIss("https://golang.oktapreview.com/oauth2/other"); err == nil {
+		t.Errorf("the issuer validation did not trigger an error for a different issuer")
+	}
+
+	if err := jv.validateIss(nil); err == nil {
+		t.Errorf("the issuer validation did not trigger an error for a missing iss")
+	}
+}
+
+func Test_iss_can_be_validated_against_an_explicit_value(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer:           "https://golang.oktapreview.com/oauth2/default",
+		ClaimsToValidate: map[string]string{"iss": "https://issuer.example.com"},
+	}
+
+	jv := jvs.New()
+
+	if err := jv.validateIss("https://issuer.example.com"); err != nil {
+		t.Errorf("the issuer validation triggered an error for the explicit issuer: %s", err)
+	}
+
+	if err := jv.validateIss("https://golang.oktapreview.com/oauth2/default"); err == nil {
+		t.Errorf("the issuer validation did not use the explicit issuer")
+	}
+}
+
+func Test_iss_validation_can_be_skipped(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer:               "https://golang.oktapreview.com",
+		SkipIssuerValidation: true,
+	}
+
+	if err := jvs.New().validateIss("https://other.example.com"); err != nil {
+		t.Errorf("the issuer validation triggered an error when skipped: %s", err)
+	}
+}
+
 func Test_can_validate_nonce(t *testing.T) {
 	tv := map[string]string{}
 	tv["nonce"] = "abc123"
@@ -124,6 +182,193 @@ func Test_can_validate_cid(t *testing.T) {
 	}
 }
 
+func Test_cid_falls_back_to_client_id(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithClaimToValidate("cid", "abc123"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		expected string
+	}{
+		{"cid only", map[string]interface{}{"cid": "abc123"}, ""},
+		{"client_id only", map[string]interface{}{"client_id": "abc123"}, ""},
+		{"both matching", map[string]interface{}{"cid": "abc123", "client_id": "abc123"}, ""},
+		{"both conflicting", map[string]interface{}{"cid": "abc123", "client_id": "other"}, "cid: abc123 conflicts with client_id other"},
+		{"other client_id", map[string]interface{}{"client_id": "other"}, "other does not match abc123"},
+		{"neither", map[string]interface{}{}, "Client Id"},
+	}
+
+	for _, test := range tests {
+		claims := issuer.Claims("api://default")
+		for claim, value := range test.claims {
+			claims[claim] = value
+		}
+
+		token, err := jv.VerifyAccessToken(issuer.Sign(claims))
+		switch {
+		case test.expected == "" && err != nil:
+			t.Errorf("%s: %s", test.name, err)
+		case test.expected == "" && token.Claims["sub"] == nil:
+			t.Errorf("%s: expected the token's claims", test.name)
+		case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func Test_can_validate_aud_array(t *testing.T) {
+	tv := map[string]string{}
+	tv["aud"] = "abc123"
+
+	jvs := JwtVerifier{
+		Issuer:           "https://golang.oktapreview.com",
+		ClaimsToValidate: tv,
+	}
+
+	jv := jvs.New()
+
+	err := jv.validateAudience([]interface{}{"other", "abc123"})
+	if err != nil {
+		t.Errorf("the audience validation triggered an error for a matching array: %s", err)
+	}
+
+	err = jv.validateAudience([]interface{}{"other", "test"})
+	if err == nil {
+		t.Errorf("the audience validation did not trigger an error for an array without a match")
+	}
+}
+
+func Test_can_validate_azp(t *testing.T) {
+	tv := map[string]string{}
+	tv["aud"] = "abc123"
+
+	jvs := JwtVerifier{
+		Issuer:           "https://golang.oktapreview.com",
+		ClaimsToValidate: tv,
+	}
+
+	jv := jvs.New()
+
+	tests := []struct {
+		name    string
+		azp     interface{}
+		aud     interface{}
+		wantErr bool
+	}{
+		{"single audience without azp", nil, "abc123", false},
+		{"single audience with matching azp", "abc123", "abc123", false},
+		{"single audience with mismatched azp", "test", "abc123", true},
+		{"multiple audiences without azp", nil, []interface{}{"abc123", "other"}, true},
+		{"multiple audiences with matching azp", "abc123", []interface{}{"abc123", "other"}, false},
+		{"multiple audiences with mismatched azp", "other", []interface{}{"abc123", "other"}, true},
+	}
+
+	for _, test := range tests {
+		err := jv.validateAuthorizedParty(test.azp, test.aud)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: the azp validation did not trigger an error", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: the azp validation triggered an error: %s", test.name, err)
+		}
+	}
+}
+
+func Test_azp_can_be_validated_against_an_explicit_value(t *testing.T) {
+	tv := map[string]string{}
+	tv["aud"] = "abc123"
+	tv["azp"] = "client"
+
+	jvs := JwtVerifier{
+		Issuer:           "https://golang.oktapreview.com",
+		ClaimsToValidate: tv,
+	}
+
+	jv := jvs.New()
+
+	if err := jv.validateAuthorizedParty("client", []interface{}{"abc123", "client"}); err != nil {
+		t.Errorf("the azp validation triggered an error: %s", err)
+	}
+
+	if err := jv.validateAuthorizedParty("abc123", "abc123"); err == nil {
+		t.Errorf("the azp validation did not trigger an error when azp did not match the configured value")
+	}
+}
+
+func Test_can_validate_groups(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer:         "https://golang.oktapreview.com",
+		RequiredGroups: []string{"Admins", "Support"},
+	}
+
+	jv := jvs.New()
+
+	withGroups := func(groups ...interface{}) *Jwt {
+		return &Jwt{Claims: map[string]interface{}{"groups": groups}}
+	}
+
+	if err := jv.validateGroups(withGroups("Everyone", "Support")); err != nil {
+		t.Errorf("the groups validation triggered an error for a member of one group: %s", err)
+	}
+
+	err := jv.validateGroups(withGroups("Everyone"))
+	if err == nil || !strings.Contains(err.Error(), "not a member") {
+		t.Errorf("the groups validation did not trigger an error for a member of no required group: %v", err)
+	}
+
+	jv.RequireAllGroups = true
+
+	err = jv.validateGroups(withGroups("Everyone", "Support"))
+	if err == nil || !strings.Contains(err.Error(), "Admins") {
+		t.Errorf("the groups validation did not report the missing group: %v", err)
+	}
+
+	if err := jv.validateGroups(withGroups("Admins", "Support")); err != nil {
+		t.Errorf("the groups validation triggered an error for a member of all groups: %s", err)
+	}
+}
+
+func Test_groups_validation_handles_claim_names(t *testing.T) {
+	tests := []struct {
+		name        string
+		groupsClaim string
+		claims      map[string]interface{}
+		errContains string
+	}{
+		{"groups", "", map[string]interface{}{"groups": []interface{}{"Admins"}}, ""},
+		{"grp alias", "", map[string]interface{}{"grp": []interface{}{"Admins"}}, ""},
+		{"custom name", "roles", map[string]interface{}{"roles": []interface{}{"Admins"}}, ""},
+		{"custom name ignores groups", "roles", map[string]interface{}{"groups": []interface{}{"Admins"}}, "does not contain a roles claim"},
+		{"absent", "", map[string]interface{}{}, "does not contain a groups or grp claim"},
+		{"present without the group", "", map[string]interface{}{"groups": []interface{}{}}, "not a member"},
+	}
+
+	for _, test := range tests {
+		jvs := JwtVerifier{
+			Issuer:         "https://golang.oktapreview.com",
+			RequiredGroups: []string{"Admins"},
+			GroupsClaim:    test.groupsClaim,
+		}
+
+		err := jvs.New().validateGroups(&Jwt{Claims: test.claims})
+		if test.errContains == "" && err != nil {
+			t.Errorf("%s: the groups validation triggered an error: %s", test.name, err)
+		}
+		if test.errContains != "" && (err == nil || !strings.Contains(err.Error(), test.errContains)) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.errContains, err)
+		}
+	}
+}
+
 func Test_can_validate_iat(t *testing.T) {
 	jvs := JwtVerifier{
 		Issuer: "https://golang.oktapreview.com",
@@ -132,13 +377,13 @@ func Test_can_validate_iat(t *testing.T) {
 	jv := jvs.New()
 
 	// token issued in future triggers error
-	err := jv.validateIat(float64(time.Now().Unix() + 300))
+	err := jv.validateIat(float64(time.Now().Unix()+300), jv.now())
 	if err == nil {
 		t.Errorf("the iat validation did not trigger an error")
 	}
 
 	// token within leeway does not trigger error
-	err = jv.validateIat(float64(time.Now().Unix()))
+	err = jv.validateIat(float64(time.Now().Unix()), jv.now())
 	if err != nil {
 		t.Errorf("the iat validation triggered an error")
 	}
@@ -152,13 +397,13 @@ func Test_can_validate_exp(t *testing.T) {
 	jv := jvs.New()
 
 	// expired token triggers error
-	err := jv.validateExp(float64(time.Now().Unix() - 300))
+	err := jv.validateExp(float64(time.Now().Unix()-300), jv.now())
 	if err == nil {
 		t.Errorf("the exp validation did not trigger an error for expired token")
 	}
 
 	// token within leeway does not trigger error
-	err = jv.validateExp(float64(time.Now().Unix()))
+	err = jv.validateExp(float64(time.Now().Unix()), jv.now())
 	if err != nil {
 		t.Errorf("the exp validation triggered an error for valid token")
 	}
@@ -175,10 +420,10 @@ func Test_invalid_formatting_of_id_token_throws_an_error(t *testing.T) {
 	_, err := jv.VerifyIdToken("aa")
 
 	if err == nil {
-		t.Errorf("an error was not thrown when an id token does not contain at least 1 period ('.')")
+		t.Errorf("an error was not thrown when an id token does not contain 3 parts")
 	}
 
-	if !strings.Contains(err.Error(), "token must contain at least 1 period ('.')") {
+	if !strings.Contains(err.Error(), "token must contain exactly 3 parts") {
 		t.Errorf("the error for id token with no periods did not trigger")
 	}
 }
@@ -220,14 +465,14 @@ func Test_an_id_token_header_that_is_not_contain_the_correct_parts_throws_an_err
 
 	_, err := jv.VerifyIdToken("ew0KICAidGVzdCI6ICJ0aGlzIg0KfQ.aa.aa")
 
-	if !strings.Contains(err.Error(), "header does not contain enough properties") {
-		t.Errorf("the error for id token with header that does not contain enough properties did not trigger")
+	if !strings.Contains(err.Error(), "header must contain an 'alg'") {
+		t.Errorf("the error for id token with header that does not contain alg or kid did not trigger")
 	}
 
 	_, err = jv.VerifyIdToken("ew0KICAidGVzdCI6ICJ0aGlzIiwNCiAgImFuZCI6ICJ0aGlzIiwNCiAgImhlbGxvIjogIndvcmxkIg0KfQ.aa.aa")
 
-	if !strings.Contains(err.Error(), "header contains too many properties") {
-		t.Errorf("the error for id token with header that contains too many properties did not trigger")
+	if !strings.Contains(err.Error(), "header must contain an 'alg'") {
+		t.Errorf("the error for id token with header that has other members but no alg did not trigger")
 	}
 
 	_, err = jv.VerifyIdToken("ew0KICAia2lkIjogImFiYzEyMyIsDQogICJhbmQiOiAidGhpcyINCn0.aa.aa")
@@ -257,6 +502,298 @@ func Test_an_id_token_header_that_is_not_rs256_throws_an_error(t *testing.T) {
 	}
 }
 
+func Test_token_headers_are_decoded_as_base64url(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+	}
+
+	jv := jvs.New()
+
+	headers := []string{
+		// {"alg":"RS256","kid":"a?b"}, 36 characters
+		"eyJhbGciOiJSUzI1NiIsImtpZCI6ImE_YiJ9",
+		// {"alg":"RS256","kid":"~~~"}, 36 characters
+		"eyJhbGciOiJSUzI1NiIsImtpZCI6In5-fiJ9",
+		// {"alg":"RS256","kid":"k>>1"}, 38 characters
+		"eyJhbGciOiJSUzI1NiIsImtpZCI6Ims-PjEifQ",
+		// {"alg":"RS256","kid":"ab??"}, 38 characters
+		"eyJhbGciOiJSUzI1NiIsImtpZCI6ImFiPz8ifQ",
+	}
+
+	for _, header := range headers {
+		valid, err := jv.isValidJwt(header + ".aa.aa")
+		if !valid {
+			t.Errorf("the header %s was rejected: %s", header, err)
+		}
+	}
+
+	_, err := jv.isValidJwt("eyJhbGciOiJSUzI1NiIsImtpZCI6ImFiPz8ifQ==.aa.aa")
+	if err == nil {
+		t.Errorf("a padded header was accepted")
+	}
+}
+
+func Test_headers_with_extra_members_are_accepted_unless_they_name_a_key(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+	}
+
+	jv := jvs.New()
+
+	tests := []struct {
+		header    string
+		parameter string
+	}{
+		{`{"alg":"RS256","kid":"abc123","typ":"JWT","x5t":"dGh1bWJwcmludA"}`, ""},
+		{`{"alg":"RS256","kid":"abc123","crit":["exp"],"exp":1600000000}`, "crit"},
+		{`{"alg":"RS256","kid":"abc123","jwk":{"kty":"RSA","n":"AQAB","e":"AQAB"}}`, "jwk"},
+		{`{"alg":"RS256","kid":"abc123","jku":"https://evil.example.com/keys"}`, "jku"},
+	}
+
+	for _, test := range tests {
+		_, err := jv.isValidJwt(base64.RawURLEncoding.EncodeToString([]byte(test.header)) + ".aa.aa")
+		if test.parameter == "" {
+			if err != nil {
+				t.Errorf("the header %s was rejected: %s", test.header, err)
+			}
+			continue
+		}
+
+		var rejected *errors.HeaderRejected
+		if !goerrors.As(err, &rejected) || rejected.Parameter != test.parameter {
+			t.Errorf("expected the header %s to be rejected for %s, got %v", test.header, test.parameter, err)
+		}
+	}
+}
+
+func Test_tokens_must_have_three_base64url_parts(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+	}
+
+	jv := jvs.New()
+
+	// {"alg":"RS256","kid":"abc123"}
+	header := "eyJhbGciOiJSUzI1NiIsImtpZCI6ImFiYzEyMyJ9"
+
+	tests := []struct {
+		name        string
+		jwt         string
+		errContains string
+	}{
+		{"3 parts", header + ".aa.aa", ""},
+		{"2 parts", header + ".aa", "exactly 3 parts"},
+		{"4 parts", header + ".aa.aa.aa", "exactly 3 parts"},
+		{"5 parts", header + ".aa.aa.aa.aa", "encrypted tokens are not supported"},
+		{"empty header", ".aa.aa", "header is empty"},
+		{"empty payload", header + "..aa", "payload is empty"},
+		{"empty signature", header + ".aa.", "signature is empty"},
+		{"slash in signature", header + ".aa.a/a", "signature does not appear to be a base64 encoded string"},
+		{"padded payload", header + ".aa==.aa", "payload does not appear to be a base64 encoded string"},
+		{"truncated payload", header + ".aaaaa.aa", "payload does not appear to be a base64 encoded string"},
+	}
+
+	for _, test := range tests {
+		_, err := jv.isValidJwt(test.jwt)
+		if test.errContains == "" && err != nil {
+			t.Errorf("%s: the token was rejected: %s", test.name, err)
+		}
+		if test.errContains != "" && (err == nil || !strings.Contains(err.Error(), test.errContains)) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.errContains, err)
+		}
+	}
+
+	_, err := jv.VerifyAccessToken(header + ".aa.aa.aa.aa")
+	var encrypted *errors.JwtEncrypted
+	if !goerrors.As(err, &encrypted) {
+		t.Errorf("expected a JwtEncrypted error for a JWE, got %v", err)
+	}
+}
+
+func Test_encrypted_tokens_are_rejected_as_such(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := json.Marshal(issuer.Claims("api://default"))
+	encrypted, err := jwe.Encrypt(claims, jwa.RSA_OAEP, &key.PublicKey, jwa.A256GCM, jwa.NoCompress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {"alg":"RS256","enc":"A256GCM","kid":"abc123"}
+	encHeader := "eyJhbGciOiJSUzI1NiIsImVuYyI6IkEyNTZHQ00iLCJraWQiOiJhYmMxMjMifQ"
+
+	for name, token := range map[string]string{
+		"compact JWE":    string(encrypted),
+		"enc in 3 parts": encHeader + ".aa.aa",
+	} {
+		if _, err := jv.VerifyIdToken(token); !goerrors.Is(err, errors.ErrEncryptedTokenNotSupported) {
+			t.Errorf("%s: expected ErrEncryptedTokenNotSupported from VerifyIdToken, got %v", name, err)
+		}
+		if _, err := jv.VerifyAccessToken(token); !goerrors.Is(err, errors.ErrEncryptedTokenNotSupported) {
+			t.Errorf("%s: expected ErrEncryptedTokenNotSupported from VerifyAccessToken, got %v", name, err)
+		}
+	}
+
+	if issuer.MetadataRequests() != 0 {
+		t.Errorf("an encrypted token caused %d discovery requests", issuer.MetadataRequests())
+	}
+}
+
+func BenchmarkIsValidJwt(b *testing.B) {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+	}
+
+	jv := jvs.New()
+	jwt := "eyJhbGciOiJSUzI1NiIsImtpZCI6ImFiYzEyMyJ9." +
+		"eyJpc3MiOiJodHRwczovL2dvbGFuZy5va3RhcHJldmlldy5jb20iLCJhdWQiOiJhcGk6Ly9kZWZhdWx0In0." +
+		strings.Repeat("a", 342)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if valid, err := jv.isValidJwt(jwt); !valid {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyAccessToken(b *testing.B) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	jv := jvs.New()
+	jwt := issuer.Sign(issuer.Claims("api://default"))
+
+	if _, err := jv.VerifyAccessToken(jwt); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := jv.VerifyAccessToken(jwt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkVerifyAccessTokenCached is BenchmarkVerifyAccessToken with a
+// token cache, so that only the first verification checks the signature.
+func BenchmarkVerifyAccessTokenCached(b *testing.B) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTokenCache(1000, time.Minute),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	jwt := issuer.Sign(issuer.Claims("api://default"))
+
+	if _, err := jv.VerifyAccessToken(jwt); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := jv.VerifyAccessToken(jwt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkVerifyAccessTokenNonCompliant verifies a token whose segments
+// are standard base64, which the adaptor cannot hand to jws.
+func BenchmarkVerifyAccessTokenNonCompliant(b *testing.B) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithNonCompliantBase64(),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	jwt := nonCompliantToken(b, issuer, base64.RawStdEncoding)
+
+	if _, err := jv.VerifyAccessToken(jwt); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := jv.VerifyAccessToken(jwt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkVerifyAccessTokenKeySizes compares verification with 2048- and
+// 4096-bit RSA keys. Serial verifies the token once per iteration;
+// Coalesced verifies it from every CPU at once, so concurrent
+// verifications of the same token share one signature check.
+func BenchmarkVerifyAccessTokenKeySizes(b *testing.B) {
+	for _, bits := range []int{2048, 4096} {
+		issuer := testissuer.New()
+		issuer.RotateToSize(fmt.Sprintf("rsa%d", bits), bits)
+
+		jv, err := NewVerifier(issuer.URL,
+			WithClaimToValidate("aud", "api://default"),
+			WithCache(cache.NewMemory()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		jwt := issuer.Sign(issuer.Claims("api://default"))
+		if _, err := jv.VerifyAccessToken(jwt); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("rsa%d/Serial", bits), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := jv.VerifyAccessToken(jwt); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("rsa%d/Coalesced", bits), func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := jv.VerifyAccessToken(jwt); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+
+		issuer.Close()
+	}
+}
+
 // ACCESS TOKEN TESTS
 func Test_invalid_formatting_of_access_token_throws_an_error(t *testing.T) {
 	jvs := JwtVerifier{
@@ -268,10 +805,10 @@ func Test_invalid_formatting_of_access_token_throws_an_error(t *testing.T) {
 	_, err := jv.VerifyAccessToken("aa")
 
 	if err == nil {
-		t.Errorf("an error was not thrown when an access token does not contain at least 1 period ('.')")
+		t.Errorf("an error was not thrown when an access token does not contain 3 parts")
 	}
 
-	if !strings.Contains(err.Error(), "token must contain at least 1 period ('.')") {
+	if !strings.Contains(err.Error(), "token must contain exactly 3 parts") {
 		t.Errorf("the error for access token with no periods did not trigger")
 	}
 }
@@ -313,15 +850,14 @@ func Test_an_access_token_header_that_is_not_contain_the_correct_parts_throws_an
 
 	_, err := jv.VerifyAccessToken("ew0KICAidGVzdCI6ICJ0aGlzIg0KfQ.aa.aa")
 
-	if !strings.Contains(err.Error(), "header does not contain enough properties") {
-		t.Errorf("the error for access token with header that does not contain enough properties did not" +
-			" trigger")
+	if !strings.Contains(err.Error(), "header must contain an 'alg'") {
+		t.Errorf("the error for access token with header that does not contain alg or kid did not trigger")
 	}
 
 	_, err = jv.VerifyAccessToken("ew0KICAidGVzdCI6ICJ0aGlzIiwNCiAgImFuZCI6ICJ0aGlzIiwNCiAgImhlbGxvIjogIndvcmxkIg0KfQ.aa.aa")
 
-	if !strings.Contains(err.Error(), "header contains too many properties") {
-		t.Errorf("the error for access token with header that contains too many properties did not trigger")
+	if !strings.Contains(err.Error(), "header must contain an 'alg'") {
+		t.Errorf("the error for access token with header that has other members but no alg did not trigger")
 	}
 
 	_, err = jv.VerifyAccessToken("ew0KICAia2lkIjogImFiYzEyMyIsDQogICJhbmQiOiAidGhpcyINCn0.aa.aa")
@@ -482,3 +1018,348 @@ func Test_a_successful_authentication_can_have_its_tokens_parsed(t *testing.T) {
 		t.Errorf("issuer claim could not be pulled from access_token")
 	}
 }
+
+func Test_every_failing_claim_is_reported(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://other")
+	claims["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	token := issuer.Sign(claims)
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+	jv := jvs.New()
+	jv.SetNotIssuedBefore(time.Now().Add(-time.Minute))
+
+	for name, verify := range map[string]func(string) (*Jwt, error){
+		"access": jv.VerifyAccessToken,
+		"id":     jv.VerifyIdToken,
+	} {
+		_, err := verify(token)
+		if err == nil {
+			t.Fatalf("%s token: expected an error", name)
+		}
+
+		for _, claim := range []string{"`Audience`", "`Expiration`", "`Issued At`"} {
+			if !strings.Contains(err.Error(), claim) {
+				t.Errorf("%s token: the error does not report the %s: %s", name, claim, err)
+			}
+		}
+
+		var predates *errors.TokenPredatesHorizon
+		if !goerrors.As(err, &predates) {
+			t.Errorf("%s token: the joined error does not wrap TokenPredatesHorizon: %v", name, err)
+		}
+	}
+}
+
+func Test_subject_presence_and_value(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	tests := []struct {
+		name     string
+		sub      interface{}
+		require  bool
+		expected string
+		err      string
+	}{
+		{"missing, not required", nil, false, "", ""},
+		{"empty, not required", "", false, "", ""},
+		{"missing, required", nil, true, "", "sub: missing"},
+		{"empty, required", "", true, "", "sub: missing"},
+		{"not a string, required", 42, true, "", "sub: missing"},
+		{"present, required", "user@example.com", true, "", ""},
+		{"matching", "user@example.com", false, "user@example.com", ""},
+		{"mismatching", "other@example.com", false, "user@example.com", "sub: other@example.com does not match user@example.com"},
+		{"missing, expected", nil, false, "user@example.com", "sub: missing"},
+		{"empty, expected", "", false, "user@example.com", "sub: missing"},
+	}
+
+	for _, test := range tests {
+		claims := issuer.Claims("api://default")
+		delete(claims, "sub")
+		if test.sub != nil {
+			claims["sub"] = test.sub
+		}
+		token := issuer.Sign(claims)
+
+		opts := []Option{WithClaimToValidate("aud", "api://default")}
+		if test.require {
+			opts = append(opts, WithRequireSubject())
+		}
+		if test.expected != "" {
+			opts = append(opts, WithClaimToValidate("sub", test.expected))
+		}
+		jv, err := NewVerifier(issuer.URL, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for kind, verify := range map[string]func(string) (*Jwt, error){
+			"access": jv.VerifyAccessToken,
+			"id":     jv.VerifyIdToken,
+		} {
+			_, err := verify(token)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("%s, %s token: unexpected error: %s", test.name, kind, err)
+				}
+				continue
+			}
+			if err == nil || !strings.Contains(err.Error(), "the `Subject` was not able to be validated. "+test.err) {
+				t.Errorf("%s, %s token: expected %q, got %v", test.name, kind, test.err, err)
+			}
+		}
+	}
+}
+
+func Test_not_before_is_validated_with_leeway(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+	jv := jvs.New()
+
+	now := time.Now()
+	tests := []struct {
+		nbf   interface{}
+		valid bool
+	}{
+		{nil, true},
+		{now.Add(-time.Hour).Unix(), true},
+		{now.Add(time.Minute).Unix(), true},
+		{now.Add(time.Hour).Unix(), false},
+	}
+
+	for _, test := range tests {
+		claims := issuer.Claims("api://default")
+		if test.nbf != nil {
+			claims["nbf"] = test.nbf
+		}
+		token := issuer.Sign(claims)
+
+		for kind, verify := range map[string]func(string) (*Jwt, error){
+			"access": jv.VerifyAccessToken,
+			"id":     jv.VerifyIdToken,
+		} {
+			_, err := verify(token)
+			if test.valid {
+				if err != nil {
+					t.Errorf("%s token with nbf %v: unexpected error: %s", kind, test.nbf, err)
+				}
+				continue
+			}
+
+			var notYetValid *errors.TokenNotYetValid
+			if !goerrors.As(err, &notYetValid) {
+				t.Errorf("%s token with nbf %v: expected a TokenNotYetValid error, got %v", kind, test.nbf, err)
+			} else if !strings.Contains(err.Error(), "token not yet valid") {
+				t.Errorf("%s token: unexpected message %q", kind, err)
+			}
+		}
+	}
+}
+
+func Test_not_before_accepts_json_numbers(t *testing.T) {
+	jvs := JwtVerifier{Issuer: "https://golang.oktapreview.com"}
+	jv := jvs.New()
+
+	future := json.Number(fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+	claims := map[string]interface{}{"nbf": future}
+	canonicalizeTemporalClaims(claims)
+
+	var notYetValid *errors.TokenNotYetValid
+	if err := jv.validateNbf(claims["nbf"], jv.now()); !goerrors.As(err, &notYetValid) {
+		t.Errorf("expected a TokenNotYetValid error for a json.Number nbf, got %v", err)
+	}
+
+	if err := jv.validateNbf(true, jv.now()); err == nil || !strings.Contains(err.Error(), "nbf: malformed") {
+		t.Errorf("expected a bool nbf to be malformed, got %v", err)
+	}
+}
+
+func Test_typ_header_and_extra_members(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	token := func(members map[string]interface{}) string {
+		header := map[string]interface{}{"alg": "RS256", "kid": issuer.KeyID()}
+		for name, value := range members {
+			header[name] = value
+		}
+		return issuer.SignWithHeader(header, issuer.Claims("api://default"))
+	}
+
+	tests := []struct {
+		name     string
+		members  map[string]interface{}
+		expected string
+		access   bool
+		id       bool
+	}{
+		{"no typ, unchecked", nil, "", true, true},
+		{"at+jwt, unchecked", map[string]interface{}{"typ": "at+jwt"}, "", true, true},
+		{"extra members, unchecked", map[string]interface{}{"typ": "JWT", "x5t": "abc", "cty": "json"}, "", true, true},
+		{"at+jwt", map[string]interface{}{"typ": "at+jwt"}, "at+jwt", true, false},
+		{"media type form", map[string]interface{}{"typ": "application/AT+JWT"}, "at+jwt", true, false},
+		{"JWT", map[string]interface{}{"typ": "JWT"}, "at+jwt", false, true},
+		{"no typ", nil, "at+jwt", false, true},
+		{"extra members", map[string]interface{}{"typ": "at+jwt", "x-custom": 1}, "at+jwt", true, false},
+		{"typ not a string", map[string]interface{}{"typ": 1}, "", false, false},
+	}
+
+	for _, test := range tests {
+		jv, err := NewVerifier(issuer.URL,
+			WithClaimToValidate("aud", "api://default"),
+			WithExpectedTokenType(test.expected))
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwt := token(test.members)
+
+		if _, err := jv.VerifyAccessToken(jwt); (err == nil) != test.access {
+			t.Errorf("%s: access token expected valid=%v, got %v", test.name, test.access, err)
+		}
+		if _, err := jv.VerifyIdToken(jwt); (err == nil) != test.id {
+			t.Errorf("%s: id token expected valid=%v, got %v", test.name, test.id, err)
+		}
+	}
+}
+
+func Test_tokens_from_keys_that_are_not_pinned_are_rejected(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	pinnedKid := issuer.KeyID()
+	pinnedThumbprint := issuer.Thumbprint()
+	pinned := issuer.Sign(issuer.Claims("api://default"))
+	issuer.Rotate()
+	unpinned := issuer.Sign(issuer.Claims("api://default"))
+
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"kid", WithAllowedKIDs(pinnedKid)},
+		{"thumbprint", WithAllowedKeyThumbprints(pinnedThumbprint)},
+	}
+
+	for _, test := range tests {
+		jv, err := NewVerifier(issuer.URL,
+			WithClaimToValidate("aud", "api://default"),
+			WithCache(cache.NewMemory()),
+			test.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := jv.VerifyAccessToken(pinned); err != nil {
+			t.Errorf("%s: expected a token from the pinned key to verify: %s", test.name, err)
+		}
+
+		var notPinned *errors.KeyNotPinned
+		if _, err := jv.VerifyAccessToken(unpinned); !goerrors.As(err, &notPinned) {
+			t.Errorf("%s: expected a KeyNotPinned error for a validly signed token, got %v", test.name, err)
+		}
+	}
+}
+
+func Test_key_thumbprints_fail_closed_with_a_custom_adaptor(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := JwtVerifier{
+		Issuer:                issuer.URL,
+		ClaimsToValidate:      map[string]string{"aud": "api://default"},
+		Adaptor:               lestrratGoJwx.LestrratGoJwx{}.New(),
+		AllowedKeyThumbprints: []string{issuer.Thumbprint()},
+	}
+
+	var notPinned *errors.KeyNotPinned
+	if _, err := jvs.New().VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); !goerrors.As(err, &notPinned) {
+		t.Errorf("expected a KeyNotPinned error, got %v", err)
+	}
+
+	_, err := NewVerifier(issuer.URL,
+		WithAdaptor(lestrratGoJwx.LestrratGoJwx{}.New()),
+		WithAllowedKeyThumbprints(issuer.Thumbprint()))
+	if err == nil {
+		t.Errorf("expected WithAllowedKeyThumbprints to be rejected with a custom adaptor")
+	}
+}
+
+func Test_header_parameters_and_claims_are_kept_apart(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+	kid := issuer.KeyID()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithExpectedTokenType("at+jwt"),
+		WithAllowedKIDs(kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The payload reuses header parameter names, and the header carries
+	// claim names, with values that would fail verification if either were
+	// read from the wrong namespace.
+	claims := issuer.Claims("api://default")
+	claims["alg"] = "none"
+	claims["kid"] = "not-pinned"
+	claims["typ"] = "JWT"
+	claims["crit"] = []string{"exp"}
+	header := map[string]interface{}{
+		"alg": "RS256",
+		"kid": kid,
+		"typ": "at+jwt",
+		"exp": 1,
+		"aud": "api://other",
+		"iss": "https://evil.example.com",
+	}
+
+	token, err := jv.VerifyAccessToken(issuer.SignWithHeader(header, claims))
+	if err != nil {
+		t.Fatalf("expected the token to verify: %s", err)
+	}
+
+	for name, expected := range map[string]interface{}{"alg": "none", "kid": "not-pinned", "typ": "JWT"} {
+		if token.Claims[name] != expected {
+			t.Errorf("expected the %s claim to be %q, got %v", name, expected, token.Claims[name])
+		}
+	}
+	if !reflect.DeepEqual(token.Claims["crit"], []interface{}{"exp"}) {
+		t.Errorf("expected the crit claim as is, got %v", token.Claims["crit"])
+	}
+
+	for name, expected := range map[string]interface{}{"alg": "RS256", "kid": kid, "typ": "at+jwt", "aud": "api://other"} {
+		if token.Header[name] != expected {
+			t.Errorf("expected the %s header parameter to be %q, got %v", name, expected, token.Header[name])
+		}
+	}
+	if _, ok := token.Header["sub"]; ok {
+		t.Errorf("a claim leaked into the header: %v", token.Header)
+	}
+
+	flat := token.FlattenClaims("claims", ".")
+	if flat["claims.alg"] != "none" || flat["claims.kid"] != "not-pinned" {
+		t.Errorf("expected Flatten to cover the claims only, got %v", flat)
+	}
+
+	issuer.Rotate()
+	claims["kid"] = kid
+	unpinned := issuer.SignWithHeader(map[string]interface{}{"alg": "RS256", "kid": issuer.KeyID(), "typ": "at+jwt"}, claims)
+	var notPinned *errors.KeyNotPinned
+	if _, err := jv.VerifyAccessToken(unpinned); !goerrors.As(err, &notPinned) {
+		t.Errorf("expected the header kid, not the kid claim, to be checked against the pins, got %v", err)
+	}
+}
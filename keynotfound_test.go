@@ -0,0 +1,65 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"bytes"
+	goerrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_a_kid_with_a_trailing_space_is_reported_as_a_near_miss(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	kid := issuer.KeyID()
+	issuer.SetBodyRewrite(func(path string, body []byte) []byte {
+		if !strings.HasSuffix(path, "/v1/keys") {
+			return body
+		}
+		return bytes.Replace(body, []byte(`"kid":"`+kid+`"`), []byte(`"kid":"`+kid+` "`), 1)
+	})
+
+	var events []KeyNotFoundEvent
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithHooks(Hooks{OnKeyNotFound: func(e KeyNotFoundEvent) { events = append(events, e) }}),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+	var notFound *errors.KeyNotFound
+	if !goerrors.As(err, &notFound) {
+		t.Fatalf("expected a KeyNotFound error, got %v", err)
+	}
+	if notFound.KeyID != kid || notFound.NearMiss != kid+" " ||
+		!strings.Contains(err.Error(), "differs from it only in whitespace or case") {
+		t.Errorf("the error does not point out the near miss: %s", err)
+	}
+
+	if len(events) != 1 || events[0].KeyID != kid || events[0].NearMiss != kid+" " ||
+		len(events[0].KeyIDs) != 1 || events[0].KeyIDs[0] != kid+" " {
+		t.Errorf("unexpected OnKeyNotFound events %+v", events)
+	}
+}
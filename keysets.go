@@ -0,0 +1,126 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+// KeySource is a secondary key set, consulted when the issuer's key set
+// has no key with a token's kid, such as that of another authorization
+// server during a migration.
+type KeySource struct {
+	// JWKSURI is the URL of the key set.
+	JWKSURI string `json:"jwksUri"`
+
+	// Issuer, if set, is the iss of the tokens signed with the key set.
+	// Such tokens pass the iss check, and must be signed with a key from
+	// this key set.
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// uri returns the key set's JWKS URI, or "" for a nil KeySource, which
+// stands for the issuer's key set.
+func (s *KeySource) uri() string {
+	if s == nil {
+		return ""
+	}
+	return s.JWKSURI
+}
+
+// decodeWithKeySets decodes the token with the issuer's key set and, if it
+// has no key with the token's kid, with each of SecondaryKeySets in turn.
+// It returns the secondary key set the token was verified with, if any.
+// Each key set is fetched and cached on its own.
+func (j *JwtVerifier) decodeWithKeySets(ctx context.Context, jwt string, config adaptors.DecodeConfig) (interface{}, *KeySource, error) {
+	resp, err := j.decodes.do(jwt, func() (interface{}, error) {
+		return adaptors.Decoder(j.Adaptor).DecodeWithConfig(ctx, jwt, config)
+	})
+
+	var notFound *errors.KeyNotFound
+	if len(j.SecondaryKeySets) == 0 || !goerrors.As(err, &notFound) {
+		return resp, nil, err
+	}
+
+	sources := []string{config.JWKSURI}
+	kids := append([]string(nil), notFound.KeyIDs...)
+	for i := range j.SecondaryKeySets {
+		source := &j.SecondaryKeySets[i]
+		secondary := config
+		secondary.JWKSURI = source.JWKSURI
+
+		// Tokens contain no spaces, so the key cannot be that of a decode
+		// with the issuer's key set.
+		resp, err = j.decodes.do(source.JWKSURI+" "+jwt, func() (interface{}, error) {
+			return adaptors.Decoder(j.Adaptor).DecodeWithConfig(ctx, jwt, secondary)
+		})
+		if err == nil {
+			return resp, source, nil
+		}
+		if !goerrors.As(err, &notFound) {
+			return nil, nil, err
+		}
+		sources = append(sources, source.JWKSURI)
+		kids = append(kids, notFound.KeyIDs...)
+	}
+
+	return nil, nil, errors.KeyNotFoundInKeySetsError(notFound.KeyID, kids, sources)
+}
+
+// checkKeySetIssuer binds the Issuers of SecondaryKeySets to their key
+// sets: a token verified with such a key set must carry its Issuer, and a
+// token carrying it must have been verified with that key set.
+func (j *JwtVerifier) checkKeySetIssuer(claims map[string]interface{}, source *KeySource) error {
+	iss, _ := claims["iss"].(string)
+	if source != nil && source.Issuer != "" {
+		if normalizeIssuer(iss) != normalizeIssuer(source.Issuer) {
+			return fmt.Errorf("the token's issuer %q is not %s, the issuer of the key set at %s", iss, source.Issuer, source.JWKSURI)
+		}
+		return nil
+	}
+
+	for _, s := range j.SecondaryKeySets {
+		if s.Issuer != "" && normalizeIssuer(iss) == normalizeIssuer(s.Issuer) {
+			return fmt.Errorf("tokens from %s must be signed with a key from the key set at %s", s.Issuer, s.JWKSURI)
+		}
+	}
+	return nil
+}
+
+// validateTokenIss is validateIss for a token's iss claim, which may also
+// be the Issuer of one of SecondaryKeySets: decodeJwt has checked that such
+// a token was signed with a key from that key set.
+func (j *JwtVerifier) validateTokenIss(issuer interface{}) error {
+	err := j.validateIss(issuer)
+	if err == nil {
+		return nil
+	}
+
+	if iss, ok := issuer.(string); ok && iss != "" {
+		for _, source := range j.SecondaryKeySets {
+			if source.Issuer != "" && normalizeIssuer(iss) == normalizeIssuer(source.Issuer) {
+				return nil
+			}
+		}
+	}
+	return err
+}
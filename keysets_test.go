@@ -0,0 +1,182 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	goerrors "errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_secondary_key_sets_verify_tokens_from_another_issuer(t *testing.T) {
+	primary := testissuer.New()
+	defer primary.Close()
+	secondary := testissuer.New()
+	defer secondary.Close()
+	secondary.RotateTo("secondary-key")
+
+	source := KeySource{JWKSURI: secondary.URL + "/v1/keys", Issuer: secondary.URL}
+	jv, err := NewVerifier(primary.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithSecondaryKeySets(source),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jv.VerifyAccessToken(primary.Sign(primary.Claims("api://default")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Info.SecondaryKeySet != "" {
+		t.Errorf("a token from the primary key set was flagged with %q", token.Info.SecondaryKeySet)
+	}
+
+	for i := 0; i < 2; i++ {
+		token, err = jv.VerifyAccessToken(secondary.Sign(secondary.Claims("api://default")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Info.SecondaryKeySet != source.JWKSURI {
+			t.Errorf("expected the token to be flagged with %q, got %q", source.JWKSURI, token.Info.SecondaryKeySet)
+		}
+	}
+	if secondary.JWKSRequests() != 1 {
+		t.Errorf("expected the secondary key set to be fetched once and cached, got %d fetches", secondary.JWKSRequests())
+	}
+	if secondary.MetadataRequests() != 0 {
+		t.Errorf("the secondary issuer's discovery document was fetched")
+	}
+
+	// Each issuer's tokens must be signed with its own keys.
+	crossed := []string{
+		secondary.Sign(primary.Claims("api://default")),
+		primary.Sign(secondary.Claims("api://default")),
+	}
+	for _, jwt := range crossed {
+		if _, err := jv.VerifyAccessToken(jwt); err == nil {
+			t.Errorf("a token signed with another issuer's key was accepted")
+		}
+	}
+}
+
+func Test_an_unknown_kid_lists_every_key_set(t *testing.T) {
+	primary := testissuer.New()
+	defer primary.Close()
+	secondary := testissuer.New()
+	defer secondary.Close()
+	secondary.RotateTo("secondary-key")
+	unknown := testissuer.New()
+	defer unknown.Close()
+	unknown.RotateTo("unknown-key")
+
+	sources := []string{primary.URL + "/v1/keys", secondary.URL + "/v1/keys"}
+	jv, err := NewVerifier(primary.URL,
+		WithSecondaryKeySets(KeySource{JWKSURI: sources[1]}),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jv.VerifyAccessToken(unknown.Sign(unknown.Claims("api://default")))
+
+	var notFound *errors.KeyNotFound
+	if !goerrors.As(err, &notFound) {
+		t.Fatalf("expected a KeyNotFound, got %v", err)
+	}
+	if !reflect.DeepEqual(notFound.Sources, sources) {
+		t.Errorf("expected the key sets %v, got %v", sources, notFound.Sources)
+	}
+	if !strings.Contains(err.Error(), strings.Join(sources, ", ")) {
+		t.Errorf("the error does not list the key sets: %s", err)
+	}
+}
+
+func Test_secondary_key_sets_must_use_https(t *testing.T) {
+	_, err := NewVerifier("https://golang.oktapreview.com/oauth2/default",
+		WithSecondaryKeySets(KeySource{JWKSURI: "http://other.oktapreview.com/oauth2/default/v1/keys"}))
+	if err == nil || !strings.Contains(err.Error(), "must use https") {
+		t.Errorf("expected an http key set to be refused, got %v", err)
+	}
+}
+
+func Test_secondary_key_set_verifications_are_reported(t *testing.T) {
+	primary := testissuer.New()
+	defer primary.Close()
+	secondary := testissuer.New()
+	defer secondary.Close()
+	secondary.RotateTo("secondary-key")
+
+	var events []SecondaryKeySetEvent
+	source := KeySource{JWKSURI: secondary.URL + "/v1/keys", Issuer: secondary.URL}
+	jv, err := NewVerifier(primary.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithSecondaryKeySets(source),
+		WithHooks(Hooks{OnSecondaryKeySet: func(e SecondaryKeySetEvent) { events = append(events, e) }}),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := jv.SecondaryKeySetInfo()
+	if err != nil || len(infos) != 0 {
+		t.Fatalf("expected no key set before any was loaded, got %v, %v", infos, err)
+	}
+
+	if _, err := jv.VerifyAccessToken(primary.Sign(primary.Claims("api://default"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("a token from the primary key set was reported: %+v", events)
+	}
+
+	ctx := WithRequestID(context.Background(), "request-1")
+	if _, err := jv.VerifyAccessTokenContext(ctx, secondary.Sign(secondary.Claims("api://default"))); err != nil {
+		t.Fatal(err)
+	}
+	// Verified with the secondary key, but carrying the primary's iss.
+	if _, err := jv.VerifyAccessToken(secondary.Sign(primary.Claims("api://default"))); err == nil {
+		t.Fatal("a token signed with another issuer's key was accepted")
+	}
+
+	want := []SecondaryKeySetEvent{{JWKSURI: source.JWKSURI, KeyID: "secondary-key", RequestID: "request-1"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected %+v, got %+v", want, events)
+	}
+	if n := jv.Stats().SecondaryKeySetVerifications; n != 1 {
+		t.Errorf("expected 1 secondary key set verification, got %d", n)
+	}
+
+	infos, err = jv.SecondaryKeySetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].URL != source.JWKSURI {
+		t.Fatalf("expected the secondary key set to be described, got %+v", infos)
+	}
+	for _, key := range infos[0].Keys {
+		if key.KeyID == "secondary-key" && key.Verifications != 2 {
+			t.Errorf("expected the secondary key to have checked 2 signatures, got %d", key.Verifications)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"time"
+)
+
+const (
+	// DefaultLeewayWarningWindow is the LeewayWarningWindow used when it
+	// is not set.
+	DefaultLeewayWarningWindow = 5 * time.Minute
+
+	// leewayWarningMinVerifications is the number of verifications the
+	// window must hold before its rate is trusted enough to warn.
+	leewayWarningMinVerifications = 10
+
+	// leewayBuckets is the number of buckets the window slides by.
+	leewayBuckets = 10
+)
+
+// leewayWindow counts the tokens verified, and those of them accepted only
+// thanks to the leeway, over a window sliding by a tenth of its length. It
+// is guarded by the verifierStats mutex.
+type leewayWindow struct {
+	buckets [leewayBuckets]leewayBucket
+
+	// warned is set once the rate has been warned about, until it falls
+	// back to the threshold.
+	warned bool
+}
+
+type leewayBucket struct {
+	start    time.Time
+	verified uint64
+	masked   uint64
+}
+
+// add counts a verification made at now in the window.
+func (w *leewayWindow) add(now time.Time, window time.Duration, masked bool) {
+	width := window / leewayBuckets
+	if width <= 0 {
+		width = 1
+	}
+	start := now.Truncate(width)
+	i := (start.UnixNano() / int64(width)) % leewayBuckets
+	if i < 0 {
+		i += leewayBuckets
+	}
+	bucket := &w.buckets[i]
+	if !bucket.start.Equal(start) {
+		*bucket = leewayBucket{start: start}
+	}
+	bucket.verified++
+	if masked {
+		bucket.masked++
+	}
+}
+
+// rate returns the fraction of the verifications in the window ending at
+// now that were accepted only thanks to the leeway, and their number.
+func (w *leewayWindow) rate(now time.Time, window time.Duration) (float64, uint64) {
+	var verified, masked uint64
+	for _, bucket := range w.buckets {
+		if bucket.start.After(now) || now.Sub(bucket.start) >= window {
+			continue
+		}
+		verified += bucket.verified
+		masked += bucket.masked
+	}
+	if verified == 0 {
+		return 0, 0
+	}
+	return float64(masked) / float64(verified), verified
+}
+
+// leewayWindow returns LeewayWarningWindow, or its default.
+func (j *JwtVerifier) leewayWindow() time.Duration {
+	if j.LeewayWarningWindow > 0 {
+		return j.LeewayWarningWindow
+	}
+	return DefaultLeewayWarningWindow
+}
+
+// recordLeeway records whether a verified token was accepted only thanks to
+// the leeway, its exp having passed at now, and warns once when the rate of
+// such tokens over the window exceeds LeewayWarningRate.
+func (j *JwtVerifier) recordLeeway(token *Jwt, now time.Time) {
+	exp, err := token.Expiry()
+	masked := err == nil && !AcceptableExpiry(exp, now, 0)
+
+	j.stats.mu.Lock()
+	if masked {
+		j.stats.stats.LeewayMasked++
+	}
+	if j.LeewayWarningRate <= 0 {
+		j.stats.mu.Unlock()
+		return
+	}
+	window := j.leewayWindow()
+	j.stats.leeway.add(now, window, masked)
+	rate, verified := j.stats.leeway.rate(now, window)
+	warn := false
+	if rate <= j.LeewayWarningRate {
+		j.stats.leeway.warned = false
+	} else if verified >= leewayWarningMinVerifications && !j.stats.leeway.warned {
+		j.stats.leeway.warned = true
+		warn = true
+	}
+	j.stats.mu.Unlock()
+
+	if warn {
+		j.log().Warn("many tokens are accepted only thanks to the leeway, check the clocks",
+			"rate", rate, "threshold", j.LeewayWarningRate, "window", window.String())
+	}
+}
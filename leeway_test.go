@@ -0,0 +1,109 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_tokens_accepted_only_thanks_to_the_leeway_are_reported(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	log := &recordingLogger{}
+	now := time.Now()
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithLeeway(time.Minute),
+		WithLeewayWarning(0.3, time.Minute),
+		WithLogger(log),
+		WithClock(func() time.Time { return now }),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verify verifies n tokens, masked of them expired 30 seconds ago.
+	verify := func(n int, masked bool) {
+		t.Helper()
+		claims := issuer.Claims("api://default")
+		claims["iat"] = now.Add(-time.Hour).Unix()
+		claims["exp"] = now.Add(time.Hour).Unix()
+		if masked {
+			claims["exp"] = now.Add(-30 * time.Second).Unix()
+		}
+		token := issuer.Sign(claims)
+		for i := 0; i < n; i++ {
+			if _, err := jv.VerifyAccessToken(token); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	warnings := func() int {
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		n := 0
+		for _, event := range log.events {
+			if strings.Contains(event, "accepted only thanks to the leeway") {
+				n++
+			}
+		}
+		return n
+	}
+
+	verify(8, false)
+	verify(2, true)
+	stats := jv.Stats()
+	if stats.LeewayMasked != 2 || stats.LeewayMaskedRate != 0.2 {
+		t.Errorf("expected 2 masked tokens at a rate of 0.2, got %d at %v", stats.LeewayMasked, stats.LeewayMaskedRate)
+	}
+	if warnings() != 0 {
+		t.Errorf("warned below the threshold: %v", log.events)
+	}
+
+	verify(3, true)
+	verify(1, true)
+	if warnings() != 1 {
+		t.Errorf("expected one warning above the threshold, got %v", log.events)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if rate := jv.Stats().LeewayMaskedRate; rate != 0 {
+		t.Errorf("expected the window to have slid past the masked tokens, got a rate of %v", rate)
+	}
+	verify(10, false)
+	verify(5, true)
+	if warnings() != 2 {
+		t.Errorf("expected a warning once the rate crossed the threshold again, got %v", log.events)
+	}
+	if stats := jv.Stats(); stats.LeewayMasked != 11 || stats.Verified != 29 {
+		t.Errorf("expected 11 of 29 tokens to be masked, got %d of %d", stats.LeewayMasked, stats.Verified)
+	}
+}
+
+func Test_leeway_warning_needs_a_rate_between_0_and_1(t *testing.T) {
+	for _, rate := range []float64{0, -0.5, 1, 2} {
+		if _, err := NewVerifier("https://example.okta.com", WithLeewayWarning(rate, 0)); err == nil {
+			t.Errorf("accepted a leeway warning rate of %v", rate)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import "sort"
+
+// LegacyBehavior names a behavior change that can be reverted, for a
+// limited time, with WithLegacyBehavior or JwtVerifier.LegacyBehaviors, so
+// that users who hit an edge case can roll back without downgrading the
+// module. Each is removed after its deadline in legacyDeadlines, and
+// verifiers using one are listed in DescribeConfig, so that stragglers
+// can be found.
+type LegacyBehavior string
+
+const (
+	// LegacyHeaderStdEncoding accepts token headers in standard base64,
+	// padded or not, instead of only the base64url RFC 7515 requires. The
+	// payload and signature must still be base64url. It may be removed
+	// after 2027-04-30.
+	LegacyHeaderStdEncoding LegacyBehavior = "header_std_encoding"
+
+	// LegacyHeaderExactMembers rejects token headers with members other
+	// than alg and kid, such as typ. It may be removed after 2027-04-30.
+	LegacyHeaderExactMembers LegacyBehavior = "header_exact_members"
+
+	// LegacyAudStringOnly rejects tokens whose aud is an array, even one
+	// containing the expected audience. It may be removed after
+	// 2027-04-30.
+	LegacyAudStringOnly LegacyBehavior = "aud_string_only"
+
+	// LegacyIssExactMatch compares the iss claim with the issuer byte for
+	// byte, so that a trailing slash on either fails the check. It may be
+	// removed after 2027-04-30.
+	LegacyIssExactMatch LegacyBehavior = "iss_exact_match"
+)
+
+// legacyDeadlines are the dates after which a release may remove each
+// LegacyBehavior. A behavior without a deadline is unknown.
+var legacyDeadlines = map[LegacyBehavior]string{
+	LegacyHeaderStdEncoding:  "2027-04-30",
+	LegacyHeaderExactMembers: "2027-04-30",
+	LegacyAudStringOnly:      "2027-04-30",
+	LegacyIssExactMatch:      "2027-04-30",
+}
+
+// legacySet is the set of legacy behaviors a verifier has reverted to. A
+// nil set reverts none.
+type legacySet map[LegacyBehavior]bool
+
+// newLegacySet returns the set of behaviors, logging a warning for each,
+// as they are meant to be temporary. Unknown behaviors are left out.
+func (j *JwtVerifier) newLegacySet(behaviors []LegacyBehavior) legacySet {
+	if len(behaviors) == 0 {
+		return nil
+	}
+
+	set := make(legacySet, len(behaviors))
+	for _, b := range behaviors {
+		deadline, ok := legacyDeadlines[b]
+		if !ok {
+			j.Logger.Warn("ignoring an unknown legacy behavior", "behavior", string(b))
+			continue
+		}
+		j.Logger.Warn("reverting to a legacy behavior", "behavior", string(b), "removal_after", deadline)
+		set[b] = true
+	}
+	return set
+}
+
+// names returns the behaviors in the set, sorted.
+func (s legacySet) names() []string {
+	var names []string
+	for b := range s {
+		names = append(names, string(b))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,111 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_legacy_behaviors_restore_the_previous_behavior(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	stdHeader := func() string {
+		header, _ := json.Marshal(map[string]interface{}{"alg": "RS256", "kid": issuer.KeyID()})
+		claims, _ := json.Marshal(issuer.Claims("api://default"))
+		return issuer.SignSegments(base64.StdEncoding.EncodeToString(header), base64.RawURLEncoding.EncodeToString(claims))
+	}
+	typHeader := func() string {
+		return issuer.SignWithHeader(map[string]interface{}{"alg": "RS256", "kid": issuer.KeyID(), "typ": "JWT"},
+			issuer.Claims("api://default"))
+	}
+	audArray := func() string {
+		claims := issuer.Claims("api://default")
+		claims["aud"] = []string{"api://default", "api://other"}
+		return issuer.Sign(claims)
+	}
+	issSlash := func() string {
+		claims := issuer.Claims("api://default")
+		claims["iss"] = issuer.URL + "/"
+		return issuer.Sign(claims)
+	}
+
+	tests := []struct {
+		behavior LegacyBehavior
+		token    func() string
+
+		// accepted is whether the token is accepted without the legacy
+		// behavior; with it, the opposite holds.
+		accepted bool
+	}{
+		{LegacyHeaderStdEncoding, stdHeader, false},
+		{LegacyHeaderExactMembers, typHeader, true},
+		{LegacyAudStringOnly, audArray, true},
+		{LegacyIssExactMatch, issSlash, true},
+	}
+
+	for _, test := range tests {
+		for _, legacy := range []bool{false, true} {
+			opts := []Option{WithClaimToValidate("aud", "api://default"), WithCache(cache.NewMemory())}
+			if legacy {
+				opts = append(opts, WithLegacyBehavior(test.behavior))
+			}
+			jv, err := NewVerifier(issuer.URL, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = jv.VerifyAccessToken(test.token())
+			if accepted := err == nil; accepted != (test.accepted != legacy) {
+				t.Errorf("%s (legacy %v): expected accepted %v, got error %v", test.behavior, legacy, !accepted, err)
+			}
+		}
+	}
+}
+
+func Test_legacy_behaviors_are_described_and_validated(t *testing.T) {
+	jv, err := NewVerifier("https://golang.oktapreview.com/oauth2/default",
+		WithLegacyBehavior("iss_exact_match", LegacyAudStringOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"aud_string_only", "iss_exact_match"}
+	if got := jv.DescribeConfig().LegacyBehaviors; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the legacy behaviors %v to be described, got %v", expected, got)
+	}
+
+	_, err = NewVerifier("https://golang.oktapreview.com/oauth2/default", WithLegacyBehavior("lenient_everything"))
+	if err == nil || !strings.Contains(err.Error(), `unknown legacy behavior "lenient_everything"`) {
+		t.Errorf("expected an unknown legacy behavior to be an error, got %v", err)
+	}
+
+	jvs := JwtVerifier{
+		Issuer:          "https://golang.oktapreview.com/oauth2/default",
+		LegacyBehaviors: []LegacyBehavior{"lenient_everything"},
+	}
+	if got := jvs.New().DescribeConfig().LegacyBehaviors; got != nil {
+		t.Errorf("an unknown legacy behavior was described: %v", got)
+	}
+}
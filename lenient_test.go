@@ -0,0 +1,148 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+// nonCompliantToken signs a token in encoding whose header, payload and
+// signature segments all contain '+' or '/'. Only the bytes '>', '?' and
+// '~' encode to those, so the kid must contain one of them.
+func nonCompliantToken(t testing.TB, issuer *testissuer.Issuer, encoding *base64.Encoding) string {
+	t.Helper()
+	if !strings.ContainsAny(issuer.KeyID(), ">?~") {
+		issuer.RotateTo("partner~key")
+	}
+
+	for n := 0; n < 1000; n++ {
+		header := fmt.Sprintf(`{"alg":"RS256",%s"kid":%q}`, strings.Repeat(" ", n%16), issuer.KeyID())
+		claims := issuer.Claims("api://default")
+		claims["pad"] = strings.Repeat("?", n%7) + ">"
+		body, err := json.Marshal(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := issuer.SignRaw([]byte(header), body, encoding)
+		parts := strings.Split(token, ".")
+		if strings.ContainsAny(parts[0], "+/") && strings.ContainsAny(parts[1], "+/") && strings.ContainsAny(parts[2], "+/") {
+			return token
+		}
+	}
+	t.Fatalf("could not produce a token with '+' or '/' in every segment")
+	return ""
+}
+
+func Test_non_compliant_base64_is_rejected_by_default(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL, WithClaimToValidate("aud", "api://default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jv.VerifyAccessToken(nonCompliantToken(t, issuer, base64.RawStdEncoding))
+	if err == nil || !strings.Contains(err.Error(), "does not appear to be a base64 encoded string") {
+		t.Errorf("expected standard base64 to be rejected, got %v", err)
+	}
+}
+
+func Test_non_compliant_base64_can_be_allowed(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithNonCompliantBase64())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.RawStdEncoding, base64.StdEncoding} {
+		token, err := jv.VerifyAccessToken(nonCompliantToken(t, issuer, encoding))
+		if err != nil {
+			t.Fatalf("could not verify a standard base64 token: %s", err)
+		}
+		if !token.Info.NonCompliantBase64 {
+			t.Errorf("the fallback was not recorded")
+		}
+		if token.Claims["aud"] != "api://default" {
+			t.Errorf("unexpected claims %v", token.Claims)
+		}
+
+		token, err = jv.VerifyIdToken(nonCompliantToken(t, issuer, encoding))
+		if err != nil {
+			t.Fatalf("could not verify a standard base64 id_token: %s", err)
+		}
+		if !token.Info.NonCompliantBase64 {
+			t.Errorf("the fallback was not recorded for an id_token")
+		}
+	}
+
+	token, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+	if err != nil {
+		t.Fatalf("could not verify a compliant token: %s", err)
+	}
+	if token.Info.NonCompliantBase64 {
+		t.Errorf("the fallback was recorded for a compliant token")
+	}
+}
+
+func Test_non_compliant_base64_signatures_cover_the_original_segments(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithNonCompliantBase64())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(nonCompliantToken(t, issuer, base64.RawStdEncoding), ".")
+
+	// The same header and claims, re-encoded as base64url, were not what
+	// was signed.
+	transcoded := make([]string, len(parts))
+	for i, part := range parts {
+		b, err := base64.RawStdEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transcoded[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	if _, err := jv.VerifyAccessToken(strings.Join(transcoded, ".")); err == nil {
+		t.Errorf("verified a token whose signed segments were re-encoded")
+	}
+
+	// Changed claims keep failing when encoded in standard base64.
+	claims := issuer.Claims("api://default")
+	claims["sub"] = "attacker@example.com"
+	body, _ := json.Marshal(claims)
+	parts[1] = base64.RawStdEncoding.EncodeToString(body)
+	if _, err := jv.VerifyAccessToken(strings.Join(parts, ".")); err == nil {
+		t.Errorf("verified a token with modified claims")
+	}
+}
@@ -0,0 +1,99 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_local_keys_verify_tokens_without_discovery(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, issuer.JWKS(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	issuer.SetUnavailable(true)
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithJWKSFile(path),
+		WithInitProfile(Eager()))
+	if err != nil {
+		t.Fatalf("could not create a verifier with a local key set: %s", err)
+	}
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatalf("could not verify a token with the local key set: %s", err)
+	}
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://other"))); err == nil || !strings.Contains(err.Error(), "aud") {
+		t.Errorf("expected the aud to be validated as usual, got %v", err)
+	}
+
+	issuer.Rotate()
+	rotated := issuer.Sign(issuer.Claims("api://default"))
+	if err := os.WriteFile(path, issuer.JWKS(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := jv.LocalKeys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jv.VerifyAccessToken(rotated); err != nil {
+		t.Errorf("could not verify a token after reloading the key set: %s", err)
+	}
+
+	if err := jv.Prime(context.Background()); err != nil {
+		t.Errorf("could not prime a verifier with a local key set: %s", err)
+	}
+
+	if issuer.MetadataRequests() != 0 || issuer.JWKSRequests() != 0 {
+		t.Errorf("expected no requests to the issuer, got %d and %d", issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+}
+
+func Test_local_keys_options_are_validated(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	if _, err := NewVerifier("https://golang.oktapreview.com",
+		WithJWKSFile(filepath.Join(t.TempDir(), "missing.json"))); err == nil {
+		t.Errorf("expected an error for a missing JWKS file")
+	}
+
+	keys, err := lestrratGoJwx.NewLocalKeySetFromReader(bytes.NewReader(issuer.JWKS()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewVerifier("https://golang.oktapreview.com",
+		WithLocalKeys(keys),
+		WithAdaptor(lestrratGoJwx.LestrratGoJwx{}))
+	if err == nil || !strings.Contains(err.Error(), "default adaptor") {
+		t.Errorf("expected local keys to require the default adaptor, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package logger
+
+// Logger receives operational events from the verifier and adaptors.
+// keysAndValues are alternating keys and values, in the style of zap's
+// SugaredLogger or log/slog, so most structured loggers can be adapted with
+// a few lines. Tokens are never passed to a Logger.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+}
+
+type noOp struct{}
+
+func (noOp) Debug(msg string, keysAndValues ...interface{}) {}
+
+func (noOp) Warn(msg string, keysAndValues ...interface{}) {}
+
+// NoOp returns a Logger that discards every event.
+func NoOp() Logger {
+	return noOp{}
+}
+
+// OrNoOp returns l, or a Logger that discards every event if l is nil.
+func OrNoOp(l Logger) Logger {
+	if l == nil {
+		return noOp{}
+	}
+	return l
+}
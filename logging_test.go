@@ -0,0 +1,103 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *recordingLogger) record(level string, msg string, keysAndValues ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, fmt.Sprint(level, " ", msg, " ", keysAndValues))
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.record("debug", msg, keysAndValues...)
+}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.record("warn", msg, keysAndValues...)
+}
+
+func (l *recordingLogger) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, event := range l.events {
+		if strings.Contains(event, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_events_are_sent_to_the_configured_logger(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	log := &recordingLogger{}
+	jvs := JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Logger:           log,
+	}
+
+	jv := jvs.New()
+
+	valid := issuer.Sign(issuer.Claims("api://default"))
+	if _, err := jv.VerifyAccessToken(valid); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	invalid := issuer.Sign(issuer.Claims("api://other"))
+	if _, err := jv.VerifyAccessToken(invalid); err == nil {
+		t.Fatalf("expected an audience error")
+	}
+
+	for _, expected := range []string{
+		"debug fetching metadata",
+		"debug metadata cache hit",
+		"debug fetching key set",
+		"debug key set cache hit",
+		"debug access token verification failed",
+	} {
+		if !log.contains(expected) {
+			t.Errorf("expected a %q event, got %v", expected, log.events)
+		}
+	}
+
+	for _, token := range []string{valid, invalid} {
+		if log.contains(token) {
+			t.Errorf("a token was logged")
+		}
+	}
+}
+
+func Test_a_verifier_without_a_logger_does_not_panic(t *testing.T) {
+	jv := &JwtVerifier{Issuer: "https://golang.oktapreview.com"}
+	jv.log().Debug("discarded")
+}
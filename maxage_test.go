@@ -0,0 +1,121 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_max_token_age_rejects_old_tokens_whatever_their_exp(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	now := time.Now()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithMaxTokenAge(15*time.Minute),
+		WithClock(func() time.Time { return now }),
+		WithCache(cache.NewMemory()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify a fresh access_token: %s", err)
+	}
+
+	// The token still has 40 minutes until its exp, but was issued 20
+	// minutes ago, more than the maximum age and the leeway.
+	now = now.Add(20 * time.Minute)
+
+	_, err = jv.VerifyAccessToken(token)
+	var tooOld *errors.TokenTooOld
+	if !goerrors.As(err, &tooOld) {
+		t.Fatalf("expected a TokenTooOld error, got %v", err)
+	}
+	if reason := failureReason(err); reason != FailureTooOld {
+		t.Errorf("expected the %q failure reason, got %q", FailureTooOld, reason)
+	}
+	if tooOld.MaxAge != 15*time.Minute {
+		t.Errorf("expected the maximum age in the error, got %s", tooOld.MaxAge)
+	}
+	if _, err := jv.VerifyIdToken(token); !goerrors.As(err, &tooOld) {
+		t.Errorf("expected a TokenTooOld error for id tokens, got %v", err)
+	}
+}
+
+func Test_max_token_age_accepts_numeric_iat_forms_and_requires_iat(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	token := issuer.Sign(claims)
+	now := time.Now()
+	exp := now.Add(time.Hour).Unix()
+
+	tests := []struct {
+		iat interface{}
+		err string
+	}{
+		{float64(now.Add(-time.Minute).Unix()), ""},
+		{json.Number(fmt.Sprint(now.Add(-time.Minute).Unix())), ""},
+		{float64(now.Add(-time.Hour).Unix()), "the token is too old"},
+		{json.Number(fmt.Sprint(now.Add(-time.Hour).Unix())), "the token is too old"},
+		{nil, "iat: missing"},
+	}
+
+	for _, test := range tests {
+		jvs := JwtVerifier{
+			Issuer:           issuer.URL,
+			ClaimsToValidate: map[string]string{"aud": "api://default"},
+			Adaptor:          claimsAdaptor{claims: claims, exp: exp, iat: test.iat},
+			MaxTokenAge:      15 * time.Minute,
+		}
+		jv := jvs.New()
+
+		_, err := jv.VerifyAccessToken(token)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("iat %#v: %s", test.iat, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("iat %#v: expected an error containing %q, got %v", test.iat, test.err, err)
+		}
+	}
+}
+
+func Test_max_token_age_must_be_positive(t *testing.T) {
+	_, err := NewVerifier("https://golang.oktapreview.com/oauth2/default", WithMaxTokenAge(0))
+	if err == nil || !strings.Contains(err.Error(), "maximum token age must be positive") {
+		t.Errorf("expected a zero maximum age to be an error, got %v", err)
+	}
+}
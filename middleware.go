@@ -0,0 +1,244 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+// DefaultRequestIDHeader is the header Middleware takes each request's ID
+// from, unless WithRequestIDHeader names another.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+const claimsContextKey contextKey = iota
+
+// TokenExtractor pulls the raw token out of a request.
+type TokenExtractor func(r *http.Request) (string, error)
+
+// ErrorResponder writes the response for a request whose token could not be
+// extracted or verified.
+type ErrorResponder func(w http.ResponseWriter, r *http.Request, err error)
+
+type MiddlewareOption func(*middleware)
+
+type middleware struct {
+	verifier       *JwtVerifier
+	extractor      TokenExtractor
+	errorResponder ErrorResponder
+	skipPaths      map[string]bool
+	verifyOptions  func(r *http.Request) ([]VerifyOption, error)
+	sourceIP       bool
+	tlsClientCert  bool
+	requestID      string
+}
+
+// WithTokenExtractor replaces the default Authorization header extractor.
+func WithTokenExtractor(extractor TokenExtractor) MiddlewareOption {
+	return func(m *middleware) {
+		m.extractor = extractor
+	}
+}
+
+// WithErrorResponder replaces the default plain 401 response.
+func WithErrorResponder(responder ErrorResponder) MiddlewareOption {
+	return func(m *middleware) {
+		m.errorResponder = responder
+	}
+}
+
+// WithSkipPaths passes requests for the given paths through without
+// verification.
+func WithSkipPaths(paths ...string) MiddlewareOption {
+	return func(m *middleware) {
+		for _, path := range paths {
+			m.skipPaths[path] = true
+		}
+	}
+}
+
+// WithVerifyOptions sets a function that returns the options for
+// verifying each request's token, such as WithExpectedClaim with a device
+// id read from a request header. If it returns an error, the request is
+// rejected through the ErrorResponder.
+func WithVerifyOptions(resolve func(r *http.Request) ([]VerifyOption, error)) MiddlewareOption {
+	return func(m *middleware) {
+		m.verifyOptions = resolve
+	}
+}
+
+// WithSourceIPFact attaches the request's source IP, taken from its
+// RemoteAddr, to each verification as the FactSourceIP fact. Behind a proxy
+// that is the proxy's address; attach the client's with WithVerifyOptions
+// instead.
+func WithSourceIPFact() MiddlewareOption {
+	return func(m *middleware) {
+		m.sourceIP = true
+	}
+}
+
+// WithTLSClientCertFact attaches whether the request presented a TLS
+// client certificate to each verification as the FactTLSClientCert fact.
+func WithTLSClientCertFact() MiddlewareOption {
+	return func(m *middleware) {
+		m.tlsClientCert = true
+	}
+}
+
+// WithRequestIDHeader sets the header Middleware takes each request's ID
+// from, for WithRequestID, in place of DefaultRequestIDHeader. An empty
+// name turns this off. A request ID already on the request's context is
+// kept.
+func WithRequestIDHeader(name string) MiddlewareOption {
+	return func(m *middleware) {
+		m.requestID = name
+	}
+}
+
+// facts returns the options attaching the standard facts about r that m
+// is configured to attach.
+func (m *middleware) facts(r *http.Request) []VerifyOption {
+	var facts []VerifyOption
+	if m.sourceIP {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			facts = append(facts, WithFact(FactSourceIP, ip))
+		}
+	}
+	if m.tlsClientCert {
+		presented := r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+		facts = append(facts, WithFact(FactTLSClientCert, presented))
+	}
+	return facts
+}
+
+// Middleware returns net/http middleware that verifies the access token on
+// each request with v and stores the result in the request context, where
+// downstream handlers can read it with ClaimsFromContext.
+func Middleware(v *JwtVerifier, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	m := &middleware{
+		verifier:       v,
+		extractor:      BearerTokenExtractor,
+		errorResponder: unauthorized,
+		skipPaths:      map[string]bool{},
+		requestID:      DefaultRequestIDHeader,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m.skipPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if id := r.Header.Get(m.requestID); m.requestID != "" && id != "" {
+				if _, ok := RequestIDFromContext(r.Context()); !ok {
+					r = r.WithContext(WithRequestID(r.Context(), id))
+				}
+			}
+
+			token, err := m.extractor(r)
+			if err != nil {
+				m.errorResponder(w, r, err)
+				return
+			}
+
+			verifyOptions := m.facts(r)
+			if m.verifyOptions != nil {
+				resolved, err := m.verifyOptions(r)
+				if err != nil {
+					m.errorResponder(w, r, err)
+					return
+				}
+				verifyOptions = append(verifyOptions, resolved...)
+			}
+
+			jwt, err := m.verifier.VerifyAccessTokenContext(r.Context(), token, verifyOptions...)
+			if err != nil {
+				m.errorResponder(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey, jwt)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClaimsFromContext returns the token verified by Middleware for the request
+// the context belongs to. Each call returns its own copy, so a handler may
+// modify it without affecting other readers of the context.
+func ClaimsFromContext(ctx context.Context) (*Jwt, bool) {
+	jwt, ok := ctx.Value(claimsContextKey).(*Jwt)
+	if !ok {
+		return nil, false
+	}
+	return jwt.Copy(), true
+}
+
+// BearerTokenExtractor reads the token from an `Authorization: Bearer`
+// header.
+func BearerTokenExtractor(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", fmt.Errorf("the request does not contain an Authorization header")
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", fmt.Errorf("the Authorization header is not a Bearer token")
+	}
+	return strings.TrimSpace(parts[1]), nil
+}
+
+// CookieTokenExtractor reads the token from the named cookie.
+func CookieTokenExtractor(name string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return "", fmt.Errorf("the request does not contain a %s cookie", name)
+		}
+		return cookie.Value, nil
+	}
+}
+
+// QueryTokenExtractor reads the token from the named query parameter.
+func QueryTokenExtractor(param string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		token := r.URL.Query().Get(param)
+		if token == "" {
+			return "", fmt.Errorf("the request does not contain a %s query parameter", param)
+		}
+		return token, nil
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,362 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func subjectHandler(w http.ResponseWriter, r *http.Request) {
+	jwt, ok := jwtverifier.ClaimsFromContext(r.Context())
+	if !ok {
+		fmt.Fprint(w, "anonymous")
+		return
+	}
+	sub, _ := jwt.Subject()
+	fmt.Fprint(w, sub)
+}
+
+func get(t *testing.T, req *http.Request) (int, string) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func Test_middleware_verifies_bearer_tokens(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	mw := jwtverifier.Middleware(jvs.New(), jwtverifier.WithSkipPaths("/health"))
+	server := httptest.NewServer(mw(http.HandlerFunc(subjectHandler)))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+issuer.Sign(issuer.Claims("api://default")))
+	if status, body := get(t, req); status != http.StatusOK || body != "user@example.com" {
+		t.Errorf("expected the verified subject, got %d %q", status, body)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+issuer.Sign(issuer.Claims("api://other")))
+	if status, _ := get(t, req); status != http.StatusUnauthorized {
+		t.Errorf("expected a 401 for a token for another audience, got %d", status)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/orders", nil)
+	if status, _ := get(t, req); status != http.StatusUnauthorized {
+		t.Errorf("expected a 401 without an Authorization header, got %d", status)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/health", nil)
+	if status, body := get(t, req); status != http.StatusOK || body != "anonymous" {
+		t.Errorf("expected skipped paths to pass through, got %d %q", status, body)
+	}
+}
+
+func Test_middleware_accepts_a_custom_extractor_and_responder(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	mw := jwtverifier.Middleware(jvs.New(),
+		jwtverifier.WithTokenExtractor(jwtverifier.CookieTokenExtractor("access_token")),
+		jwtverifier.WithErrorResponder(func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}),
+	)
+	server := httptest.NewServer(mw(http.HandlerFunc(subjectHandler)))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: issuer.Sign(issuer.Claims("api://default"))})
+	if status, body := get(t, req); status != http.StatusOK || body != "user@example.com" {
+		t.Errorf("expected the verified subject, got %d %q", status, body)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	req, _ = http.NewRequest("GET", server.URL+"/", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/login" {
+		t.Errorf("expected the custom responder to redirect, got %d", resp.StatusCode)
+	}
+}
+
+func Test_middleware_passes_per_request_verify_options(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	mw := jwtverifier.Middleware(jvs.New(),
+		jwtverifier.WithVerifyOptions(func(r *http.Request) ([]jwtverifier.VerifyOption, error) {
+			device := r.Header.Get("X-Device-Id")
+			if device == "" {
+				return nil, fmt.Errorf("the request does not contain an X-Device-Id header")
+			}
+			return []jwtverifier.VerifyOption{jwtverifier.WithExpectedClaim("did", device)}, nil
+		}),
+	)
+	server := httptest.NewServer(mw(http.HandlerFunc(subjectHandler)))
+	defer server.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["did"] = "device-a"
+	token := issuer.Sign(claims)
+
+	tests := []struct {
+		device string
+		status int
+	}{
+		{"device-a", http.StatusOK},
+		{"device-b", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+		{"device-a", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", server.URL+"/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if test.device != "" {
+			req.Header.Set("X-Device-Id", test.device)
+		}
+		if status, _ := get(t, req); status != test.status {
+			t.Errorf("expected %d for device %q, got %d", test.status, test.device, status)
+		}
+	}
+}
+
+func Test_query_token_extractor(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?token=abc", nil)
+	if token, err := jwtverifier.QueryTokenExtractor("token")(req); err != nil || token != "abc" {
+		t.Errorf("expected token abc, got %q %v", token, err)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	if _, err := jwtverifier.QueryTokenExtractor("token")(req); err == nil {
+		t.Errorf("expected an error for a missing query parameter")
+	}
+}
+
+func ExampleMiddleware() {
+	jwtVerifierSetup := jwtverifier.JwtVerifier{
+		Issuer:           "https://{yourOktaDomain}/oauth2/default",
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	authenticated := jwtverifier.Middleware(jwtVerifierSetup.New(), jwtverifier.WithSkipPaths("/health"))
+
+	http.Handle("/", authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := jwtverifier.ClaimsFromContext(r.Context())
+		sub, _ := token.Subject()
+		fmt.Fprintf(w, "hello %s", sub)
+	})))
+}
+
+func Test_middleware_attaches_standard_facts(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var got jwtverifier.Facts
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		ClaimValidators: map[string]jwtverifier.ClaimValidator{
+			"sub": func(value interface{}, facts jwtverifier.Facts) error {
+				got = facts
+				return nil
+			},
+		},
+	}
+
+	mw := jwtverifier.Middleware(jvs.New(),
+		jwtverifier.WithSourceIPFact(),
+		jwtverifier.WithTLSClientCertFact())
+	handler := mw(http.HandlerFunc(subjectHandler))
+
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.RemoteAddr = "10.1.2.3:51234"
+	req.Header.Set("Authorization", "Bearer "+issuer.Sign(issuer.Claims("api://default")))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the token to be accepted, got %d", rec.Code)
+	}
+	if ip, ok := got[jwtverifier.FactSourceIP].(net.IP); !ok || !ip.Equal(net.ParseIP("10.1.2.3")) {
+		t.Errorf("expected the source IP fact, got %#v", got[jwtverifier.FactSourceIP])
+	}
+	if got[jwtverifier.FactTLSClientCert] != false {
+		t.Errorf("expected no client certificate, got %#v", got[jwtverifier.FactTLSClientCert])
+	}
+}
+
+func Test_tokens_from_the_context_can_be_modified_while_others_read_them(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+
+	done := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+
+		// A would-be writer "cleans" its token in place, including a
+		// nested value.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				jwt, _ := jwtverifier.ClaimsFromContext(r.Context())
+				jwt.Claims["sub"] = "cleaned"
+				jwt.Claims["tenant"].(map[string]interface{})["id"] = "cleaned"
+				jwt.Claims["groups"].([]interface{})[0] = "cleaned"
+			}
+		}()
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					jwt, _ := jwtverifier.ClaimsFromContext(r.Context())
+					sub, _ := jwt.Subject()
+					tenant := jwt.Claims["tenant"].(map[string]interface{})["id"]
+					groups := jwt.Groups()
+					if sub != "user@example.com" || tenant != "acme" || groups[0] != "Admins" {
+						errs <- fmt.Errorf("a reader saw the writer's changes: %s %v %v", sub, tenant, groups)
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+		done <- <-errs
+	})
+
+	server := httptest.NewServer(jwtverifier.Middleware(jvs.New())(handler))
+	defer server.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["tenant"] = map[string]interface{}{"id": "acme"}
+	claims["groups"] = []string{"Admins", "Support"}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Authorization", "Bearer "+issuer.Sign(claims))
+	get(t, req)
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_middleware_passes_the_request_id_to_hooks(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var mu sync.Mutex
+	var ids []string
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Hooks: jwtverifier.Hooks{
+			OnVerification: func(e jwtverifier.VerificationEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				ids = append(ids, e.RequestID)
+			},
+		},
+	}
+	jv := jvs.New()
+
+	tests := []struct {
+		name   string
+		opts   []jwtverifier.MiddlewareOption
+		header string
+		aud    string
+		sent   string
+		id     string
+	}{
+		{"success", nil, "X-Request-ID", "api://default", "req-1", "req-1"},
+		{"failure", nil, "X-Request-ID", "api://other", "req-2", "req-2"},
+		{"custom header", []jwtverifier.MiddlewareOption{jwtverifier.WithRequestIDHeader("X-Correlation-ID")}, "X-Correlation-ID", "api://default", "req-3", "req-3"},
+		{"turned off", []jwtverifier.MiddlewareOption{jwtverifier.WithRequestIDHeader("")}, "X-Request-ID", "api://default", "req-4", ""},
+	}
+
+	for _, test := range tests {
+		var handled string
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handled, _ = jwtverifier.RequestIDFromContext(r.Context())
+		})
+		server := httptest.NewServer(jwtverifier.Middleware(jv, test.opts...)(handler))
+
+		mu.Lock()
+		ids = nil
+		mu.Unlock()
+
+		req, _ := http.NewRequest("GET", server.URL+"/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+issuer.Sign(issuer.Claims(test.aud)))
+		req.Header.Set(test.header, test.sent)
+		status, _ := get(t, req)
+		server.Close()
+
+		mu.Lock()
+		if len(ids) != 1 || ids[0] != test.id {
+			t.Errorf("%s: expected the hook to receive %q, got %q", test.name, test.id, ids)
+		}
+		mu.Unlock()
+		if status == http.StatusOK && handled != test.id {
+			t.Errorf("%s: expected the handler's context to carry %q, got %q", test.name, test.id, handled)
+		}
+	}
+}
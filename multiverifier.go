@@ -0,0 +1,146 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/segment"
+)
+
+// MultiVerifier verifies tokens from any of several issuers, such as one
+// authorization server per tenant. It reads the unverified iss claim to
+// choose the verifier for the token, then runs that verifier in full.
+// Tokens from other issuers are rejected before any network call.
+//
+// A MultiVerifier is safe for concurrent use under the same conditions as
+// the verifiers it was built from.
+type MultiVerifier struct {
+	verifiers map[string]*JwtVerifier
+
+	// maxTokenSize is the largest MaxTokenSize of the verifiers, or 0 if
+	// any of them has no limit.
+	maxTokenSize int
+}
+
+// NewMultiVerifier returns a MultiVerifier for the issuers of the given
+// verifiers, each of which must have been returned by New. If two
+// verifiers have the same issuer the last one is used.
+func NewMultiVerifier(verifiers ...*JwtVerifier) *MultiVerifier {
+	m := &MultiVerifier{verifiers: make(map[string]*JwtVerifier, len(verifiers))}
+	for _, v := range verifiers {
+		m.verifiers[normalizeIssuer(v.Issuer)] = v
+	}
+	for _, v := range m.verifiers {
+		if v.MaxTokenSize <= 0 {
+			m.maxTokenSize = 0
+			break
+		}
+		if v.MaxTokenSize > m.maxTokenSize {
+			m.maxTokenSize = v.MaxTokenSize
+		}
+	}
+	return m
+}
+
+// Issuers returns the issuers the MultiVerifier accepts tokens from.
+func (m *MultiVerifier) Issuers() []string {
+	issuers := make([]string, 0, len(m.verifiers))
+	for _, v := range m.verifiers {
+		issuers = append(issuers, v.Issuer)
+	}
+	return issuers
+}
+
+func (m *MultiVerifier) VerifyAccessToken(jwt string) (*Jwt, error) {
+	v, err := m.verifierFor(jwt)
+	if err != nil {
+		return nil, err
+	}
+	return v.VerifyAccessToken(jwt)
+}
+
+func (m *MultiVerifier) VerifyIdToken(jwt string) (*Jwt, error) {
+	v, err := m.verifierFor(jwt)
+	if err != nil {
+		return nil, err
+	}
+	return v.VerifyIdToken(jwt)
+}
+
+func (m *MultiVerifier) verifierFor(jwt string) (*JwtVerifier, error) {
+	if jwt == "" {
+		return nil, fmt.Errorf("token is not valid: %w", errors.JwtEmptyStringError())
+	}
+
+	// The token is routed before any verifier's limit is checked, so the
+	// most lenient limit is applied first.
+	if m.maxTokenSize > 0 && len(jwt) > m.maxTokenSize {
+		return nil, fmt.Errorf("token is not valid: %w", errors.JwtTooLargeError(len(jwt), m.maxTokenSize))
+	}
+
+	iss, err := unverifiedIssuer(jwt)
+	if err != nil {
+		return nil, fmt.Errorf("token is not valid: %w", err)
+	}
+
+	v, ok := m.verifiers[normalizeIssuer(iss)]
+	if !ok {
+		return nil, errors.IssuerNotAllowedError(iss)
+	}
+	return v, nil
+}
+
+// unverifiedIssuer reads the iss claim without verifying the token. It must
+// only be used to choose which verifier to trust.
+func unverifiedIssuer(jwt string) (string, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) == 5 {
+		return "", errors.JwtEncryptedError()
+	}
+	if len(parts) != 3 {
+		return "", fmt.Errorf("token must contain exactly 3 parts separated by periods ('.')")
+	}
+
+	if decoded, _, err := segment.DecodeLenient(parts[0]); err == nil {
+		var header map[string]interface{}
+		if json.Unmarshal(decoded, &header) == nil && isEncryptedHeader(header) {
+			return "", errors.JwtEncryptedError()
+		}
+	}
+
+	payload, _, err := segment.DecodeLenient(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("the tokens payload does not appear to be a base64 encoded string")
+	}
+
+	var claims struct {
+		Iss string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("the tokens payload is not a json object")
+	}
+
+	return claims.Iss, nil
+}
+
+func normalizeIssuer(issuer string) string {
+	return strings.TrimSuffix(issuer, "/")
+}
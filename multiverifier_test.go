@@ -0,0 +1,104 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier_test
+
+import (
+	goerrors "errors"
+	"strings"
+	"testing"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func tenantVerifier(issuer *testissuer.Issuer) *jwtverifier.JwtVerifier {
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+	}
+	return jvs.New()
+}
+
+func Test_multi_verifier_accepts_tokens_from_each_issuer(t *testing.T) {
+	tenantA := testissuer.New()
+	defer tenantA.Close()
+	tenantB := testissuer.New()
+	defer tenantB.Close()
+
+	mv := jwtverifier.NewMultiVerifier(tenantVerifier(tenantA), tenantVerifier(tenantB))
+
+	for _, issuer := range []*testissuer.Issuer{tenantA, tenantB} {
+		jwt, err := mv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+		if err != nil {
+			t.Fatalf("could not verify a token from %s: %s", issuer.URL, err)
+		}
+		if jwt.Issuer() != issuer.URL {
+			t.Errorf("expected iss %s, got %s", issuer.URL, jwt.Issuer())
+		}
+	}
+
+	if len(mv.Issuers()) != 2 {
+		t.Errorf("expected 2 issuers, got %v", mv.Issuers())
+	}
+}
+
+func Test_multi_verifier_rejects_unknown_issuers_without_a_network_call(t *testing.T) {
+	tenantA := testissuer.New()
+	defer tenantA.Close()
+	other := testissuer.New()
+	defer other.Close()
+
+	mv := jwtverifier.NewMultiVerifier(tenantVerifier(tenantA))
+
+	_, err := mv.VerifyAccessToken(other.Sign(other.Claims("api://default")))
+
+	var notAllowed *errors.IssuerNotAllowed
+	if !goerrors.As(err, &notAllowed) {
+		t.Fatalf("expected an IssuerNotAllowed error, got %v", err)
+	}
+
+	if notAllowed.Issuer != other.URL {
+		t.Errorf("expected the rejected issuer %s, got %s", other.URL, notAllowed.Issuer)
+	}
+
+	if other.MetadataRequests() != 0 || other.JWKSRequests() != 0 ||
+		tenantA.MetadataRequests() != 0 || tenantA.JWKSRequests() != 0 {
+		t.Errorf("a network call was made for a token from an unknown issuer")
+	}
+}
+
+func Test_multi_verifier_does_not_trust_the_routing_issuer(t *testing.T) {
+	tenantA := testissuer.New()
+	defer tenantA.Close()
+	tenantB := testissuer.New()
+	defer tenantB.Close()
+
+	mv := jwtverifier.NewMultiVerifier(tenantVerifier(tenantA), tenantVerifier(tenantB))
+
+	// Signed by tenant B but claiming to be from tenant A.
+	token := tenantB.Sign(tenantA.Claims("api://default"))
+
+	if _, err := mv.VerifyAccessToken(token); err == nil {
+		t.Errorf("a token signed by another tenant was accepted")
+	}
+
+	_, err := mv.VerifyIdToken("not-a-token")
+	if err == nil || !strings.HasPrefix(err.Error(), "token is not valid: ") {
+		t.Errorf("unexpected error for a malformed token: %v", err)
+	}
+}
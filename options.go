@@ -0,0 +1,960 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
+	"github.com/okta/okta-jwt-verifier-golang/discovery"
+	"github.com/okta/okta-jwt-verifier-golang/internal/fetch"
+	"github.com/okta/okta-jwt-verifier-golang/logger"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+// DefaultAllowedAlgorithms are the signing algorithms accepted unless
+// WithAllowedAlgorithms is used.
+var DefaultAllowedAlgorithms = []string{"RS256"}
+
+// supportedAlgorithms are the asymmetric algorithms the verifier can check
+// against a JWKS. Symmetric and "none" algorithms are never accepted.
+var supportedAlgorithms = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+}
+
+// Option configures a verifier built by NewVerifier.
+type Option func(*verifierOptions)
+
+type verifierOptions struct {
+	leeway     *time.Duration
+	maxSize    *int
+	maxAge     time.Duration
+	txnAge     time.Duration
+	allowHTTP  bool
+	claims     map[string]string
+	typed      map[string]interface{}
+	validators map[string]ClaimValidator
+	advisory   map[string]Strictness
+	adaptor    adaptors.Adaptor
+	discovery  discovery.Discovery
+	httpClient *http.Client
+	tlsConfig  *tls.Config
+	pins       []string
+	rootCAs    RootCAProvider
+	algorithms []string
+	logger     logger.Logger
+	cache      cache.Cache
+	refresh    time.Duration
+	retry      *fetch.Retry
+	rand       fetch.RandSource
+	timeout    time.Duration
+	now        func() time.Time
+	hooks      []Hooks
+	headers    map[string]string
+	lenient    bool
+	subject    bool
+	typ        string
+	forceLocal bool
+	keySetHook func(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool
+	introTTL   time.Duration
+	tokenCache int
+	tokenTTL   time.Duration
+	attestKeys []AttestationKey
+	secondary  []KeySource
+	legacy     []LegacyBehavior
+	sensitive  []string
+	attestTTL  time.Duration
+	minTTL     time.Duration
+	maxTTL     time.Duration
+	tracer     tracing.Tracer
+	kids       []string
+	keyPins    []string
+	x5cRoots   *x509.CertPool
+	coord      DistributedCoordinator
+	init       InitProfile
+	local      *lestrratGoJwx.LocalKeySet
+	breaker    *circuit.Breaker
+	leewayRate float64
+	leewayWin  time.Duration
+	maxBytes   int64
+	errs       []string
+}
+
+func (o *verifierOptions) fail(format string, args ...interface{}) {
+	o.errs = append(o.errs, fmt.Sprintf(format, args...))
+}
+
+// WithLeeway sets the allowed clock skew for exp and iat. It defaults to two
+// minutes.
+func WithLeeway(leeway time.Duration) Option {
+	return func(o *verifierOptions) {
+		if leeway < 0 {
+			o.fail("leeway must not be negative, got %s", leeway)
+			return
+		}
+		o.leeway = &leeway
+	}
+}
+
+// WithClaimToValidate adds an expected claim value, as ClaimsToValidate
+// does. Setting the same claim twice to different values is an error.
+func WithClaimToValidate(claim string, value string) Option {
+	return func(o *verifierOptions) {
+		if existing, ok := o.claims[claim]; ok && existing != value {
+			o.fail("claim %q is set to both %q and %q", claim, existing, value)
+			return
+		}
+		o.claims[claim] = value
+	}
+}
+
+// WithTypedClaimToValidate adds an expected claim value, as
+// TypedClaimsToValidate does. Setting the same claim twice to different
+// values is an error.
+func WithTypedClaimToValidate(claim string, value interface{}) Option {
+	return func(o *verifierOptions) {
+		if err := checkClaimValue(value); err != nil {
+			o.fail("claim %q: %s", claim, err)
+			return
+		}
+		if existing, ok := o.typed[claim]; ok && !claimValuesEqual(existing, value) {
+			o.fail("claim %q is set to both %s and %s", claim, describeClaimValue(existing), describeClaimValue(value))
+			return
+		}
+		o.typed[claim] = value
+	}
+}
+
+// WithClaimValidator checks claim with validator, which receives the
+// facts attached to each call. See JwtVerifier.ClaimValidators.
+func WithClaimValidator(claim string, validator ClaimValidator) Option {
+	return func(o *verifierOptions) {
+		if validator == nil {
+			o.fail("claim %q: the validator must not be nil", claim)
+			return
+		}
+		if _, ok := o.validators[claim]; ok {
+			o.fail("claim %q has more than one validator", claim)
+			return
+		}
+		o.validators[claim] = validator
+	}
+}
+
+// WithAdvisoryClaim marks claims as Advisory, so that a failure of their
+// WithTypedClaimToValidate or WithClaimValidator checks is recorded and
+// does not fail the verification. See JwtVerifier.ClaimStrictness. A
+// claim without such a check is an error.
+func WithAdvisoryClaim(claims ...string) Option {
+	return func(o *verifierOptions) {
+		for _, claim := range claims {
+			o.advisory[claim] = Advisory
+		}
+	}
+}
+
+// WithAllowHTTP accepts an http issuer on any host, not only on localhost
+// or a loopback address, for tests against a mock issuer. See
+// JwtVerifier.AllowHTTP.
+func WithAllowHTTP() Option {
+	return func(o *verifierOptions) {
+		o.allowHTTP = true
+	}
+}
+
+// DefaultMaxTokenSize is the MaxTokenSize of verifiers returned by
+// NewVerifier, unless WithMaxTokenSize sets another. Okta's tokens are a
+// few kilobytes even with many groups.
+const DefaultMaxTokenSize = 16 * 1024
+
+// WithMaxTokenSize rejects tokens longer than maxSize bytes before decoding
+// them. It defaults to DefaultMaxTokenSize; 0 removes the limit. See
+// JwtVerifier.MaxTokenSize.
+func WithMaxTokenSize(maxSize int) Option {
+	return func(o *verifierOptions) {
+		if maxSize < 0 {
+			o.fail("maximum token size must not be negative, got %d", maxSize)
+			return
+		}
+		o.maxSize = &maxSize
+	}
+}
+
+// WithMaxTokenAge rejects tokens issued longer than maxAge ago, whatever
+// their exp. See JwtVerifier.MaxTokenAge.
+func WithMaxTokenAge(maxAge time.Duration) Option {
+	return func(o *verifierOptions) {
+		if maxAge <= 0 {
+			o.fail("maximum token age must be positive, got %s", maxAge)
+			return
+		}
+		o.maxAge = maxAge
+	}
+}
+
+// WithLeewayWarning warns when more than rate, a fraction between 0 and 1,
+// of the tokens verified over window were accepted only thanks to the
+// leeway. A zero window uses DefaultLeewayWarningWindow. See
+// JwtVerifier.LeewayWarningRate.
+func WithLeewayWarning(rate float64, window time.Duration) Option {
+	return func(o *verifierOptions) {
+		if rate <= 0 || rate >= 1 {
+			o.fail("leeway warning rate must be between 0 and 1, got %v", rate)
+			return
+		}
+		if window < 0 {
+			o.fail("leeway warning window must not be negative, got %s", window)
+			return
+		}
+		o.leewayRate = rate
+		o.leewayWin = window
+	}
+}
+
+// WithTransactionMaxTokenAge sets the maximum age of tokens verified with
+// WithTransactionID. See JwtVerifier.TransactionMaxTokenAge.
+func WithTransactionMaxTokenAge(maxAge time.Duration) Option {
+	return func(o *verifierOptions) {
+		if maxAge <= 0 {
+			o.fail("maximum transaction token age must be positive, got %s", maxAge)
+			return
+		}
+		o.txnAge = maxAge
+	}
+}
+
+// WithAdaptor replaces the default lestrrat-go/jwx adaptor.
+func WithAdaptor(adaptor adaptors.Adaptor) Option {
+	return func(o *verifierOptions) {
+		o.adaptor = adaptor
+	}
+}
+
+// WithDiscovery replaces the default OIDC discovery.
+func WithDiscovery(d discovery.Discovery) Option {
+	return func(o *verifierOptions) {
+		o.discovery = d
+	}
+}
+
+// WithHTTPClient sets the client used to fetch the discovery document and
+// the key set. Combined with WithAdaptor, the adaptor must implement
+// adaptors.HTTPClientSetter.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *verifierOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithTLSConfig fetches the discovery document and the key set over a copy
+// of http.DefaultTransport using config, e.g. to trust a private root CA.
+// It cannot be combined with WithHTTPClient; set the TLS configuration on
+// that client's transport instead.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *verifierOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithRootCAProvider verifies the certificates of the issuer's servers
+// against the root CAs provider returns, asked again before each request
+// to them, so that a rotated CA, such as that of a TLS-intercepting
+// proxy, is trusted without a restart. A nil pool trusts the system's
+// roots. If provider fails, the pool it last returned, or at first the
+// client's own roots, is kept and a warning is logged. It should be
+// cheap, or cache what it reads.
+//
+// The provider applies to the TLS configuration from WithTLSConfig or the
+// client from WithHTTPClient, whose Transport must then be an
+// *http.Transport.
+func WithRootCAProvider(provider RootCAProvider) Option {
+	return func(o *verifierOptions) {
+		if provider == nil {
+			o.fail("the root CA provider must not be nil")
+			return
+		}
+		o.rootCAs = provider
+	}
+}
+
+// WithAllowedAlgorithms restricts the alg header to the given asymmetric
+// algorithms. It defaults to DefaultAllowedAlgorithms.
+func WithAllowedAlgorithms(algorithms ...string) Option {
+	return func(o *verifierOptions) {
+		if len(algorithms) == 0 {
+			o.fail("at least one algorithm must be allowed")
+			return
+		}
+		for _, alg := range algorithms {
+			if !supportedAlgorithms[alg] {
+				o.fail("algorithm %q is not supported", alg)
+				return
+			}
+		}
+		o.algorithms = append([]string(nil), algorithms...)
+	}
+}
+
+// WithLogger sets the logger, as the Logger field does.
+func WithLogger(l logger.Logger) Option {
+	return func(o *verifierOptions) {
+		o.logger = l
+	}
+}
+
+// WithHooks registers a set of hooks. Sets are called in the order they
+// were registered.
+func WithHooks(hooks Hooks) Option {
+	return func(o *verifierOptions) {
+		o.hooks = append(o.hooks, hooks)
+	}
+}
+
+// WithClock sets the function the verifier uses to tell the time, in place
+// of time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *verifierOptions) {
+		o.now = now
+	}
+}
+
+// WithCache stores the discovery document and, with the default adaptor,
+// the key set in c instead of the shared in-process cache.
+func WithCache(c cache.Cache) Option {
+	return func(o *verifierOptions) {
+		o.cache = c
+	}
+}
+
+// WithRetry sets how often the discovery document and, with the default
+// adaptor, the key set are requested when a request fails with a network
+// error, 429 or 5xx response. Retries back off exponentially from
+// baseDelay, with jitter. The default is 3 attempts from 100ms.
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return func(o *verifierOptions) {
+		if maxAttempts < 1 || baseDelay <= 0 {
+			o.fail("retry needs at least 1 attempt and a positive delay, got %d and %s", maxAttempts, baseDelay)
+			return
+		}
+		o.retry = &fetch.Retry{Attempts: maxAttempts, BaseDelay: baseDelay}
+	}
+}
+
+// WithRandSource jitters the delays between retries with src, such as
+// rand.NewSource(1), so that tests are reproducible. It is meant for tests:
+// by default the jitter is seeded from crypto/rand.
+func WithRandSource(src rand.Source) Option {
+	return func(o *verifierOptions) {
+		if src == nil {
+			o.fail("a rand source is required")
+			return
+		}
+		o.rand = fetch.NewRand(src)
+	}
+}
+
+// WithPinnedTLSKeys only lets the discovery document and key set be
+// fetched from servers presenting a certificate, leaf or intermediate, whose
+// public key has one of the given pins: the base64 encoded SHA-256 hash of
+// its SubjectPublicKeyInfo. List the current and next key to rotate without
+// an outage. Connections to other servers fail with errors.TLSPinMismatch.
+//
+// Pinning is added to the TLS configuration from WithTLSConfig or the
+// client from WithHTTPClient, whose Transport must then be an
+// *http.Transport.
+func WithPinnedTLSKeys(pins []string) Option {
+	return func(o *verifierOptions) {
+		if len(pins) == 0 {
+			o.fail("at least one pinned key is required")
+			return
+		}
+		for _, pin := range pins {
+			if !validPin(pin) {
+				o.fail("pinned key %q is not a base64 encoded SHA-256 hash", pin)
+				return
+			}
+		}
+		o.pins = append(o.pins, pins...)
+	}
+}
+
+// WithAllowedKIDs only accepts tokens signed with a key whose kid is one
+// of kids. See JwtVerifier.AllowedKIDs.
+func WithAllowedKIDs(kids ...string) Option {
+	return func(o *verifierOptions) {
+		if len(kids) == 0 {
+			o.fail("at least one allowed kid is required")
+			return
+		}
+		o.kids = append(o.kids, kids...)
+	}
+}
+
+// WithAllowedKeyThumbprints only accepts tokens signed with a key whose
+// RFC 7638 SHA-256 thumbprint, base64url encoded, is one of thumbprints.
+// It cannot be combined with WithAdaptor. See
+// JwtVerifier.AllowedKeyThumbprints.
+func WithAllowedKeyThumbprints(thumbprints ...string) Option {
+	return func(o *verifierOptions) {
+		if len(thumbprints) == 0 {
+			o.fail("at least one allowed key thumbprint is required")
+			return
+		}
+		for _, thumbprint := range thumbprints {
+			if b, err := base64.RawURLEncoding.DecodeString(thumbprint); err != nil || len(b) != sha256.Size {
+				o.fail("key thumbprint %q is not a base64url encoded SHA-256 hash", thumbprint)
+				return
+			}
+		}
+		o.keyPins = append(o.keyPins, thumbprints...)
+	}
+}
+
+// WithX5CValidation only trusts signing keys whose x5c certificate chain
+// verifies against roots, with a leaf certificate for the key; keys
+// without x5c are rejected. It cannot be combined with WithAdaptor. See
+// JwtVerifier.X5CRoots.
+func WithX5CValidation(roots *x509.CertPool) Option {
+	return func(o *verifierOptions) {
+		if roots == nil {
+			o.fail("x5c validation needs a pool of trusted roots")
+			return
+		}
+		o.x5cRoots = roots
+	}
+}
+
+// WithJWKSFile verifies tokens with the key set in the JWKS file at path
+// instead of fetching it from the issuer; the file is read again when it
+// changes. It cannot be combined with WithAdaptor. See
+// JwtVerifier.LocalKeys.
+func WithJWKSFile(path string) Option {
+	return func(o *verifierOptions) {
+		keys, err := lestrratGoJwx.NewLocalKeySetFromFile(path)
+		if err != nil {
+			o.fail("could not load the key set in %s: %s", path, err)
+			return
+		}
+		o.local = keys
+	}
+}
+
+// WithLocalKeys verifies tokens with keys instead of the key set fetched
+// from the issuer. It cannot be combined with WithAdaptor. See
+// JwtVerifier.LocalKeys.
+func WithLocalKeys(keys *lestrratGoJwx.LocalKeySet) Option {
+	return func(o *verifierOptions) {
+		o.local = keys
+	}
+}
+
+// WithCircuitBreaker opens a circuit breaker after threshold failed
+// requests to the issuer within window. While it is open, verifications
+// that need the discovery document or key set fail at once with
+// errors.ErrCircuitOpen; after cooldown a single request probes the issuer
+// and closes the breaker if it succeeds. See JwtVerifier.CircuitBreaker.
+func WithCircuitBreaker(threshold int, window time.Duration, cooldown time.Duration) Option {
+	return func(o *verifierOptions) {
+		if threshold <= 0 || window <= 0 || cooldown <= 0 {
+			o.fail("circuit breaker threshold, window and cooldown must be positive, got %d, %s and %s",
+				threshold, window, cooldown)
+			return
+		}
+		o.breaker = circuit.New(threshold, window, cooldown)
+	}
+}
+
+// WithRequestHeader adds a header to the discovery and key set requests.
+// Combined with WithAdaptor, set the header on that adaptor instead.
+func WithRequestHeader(name string, value string) Option {
+	return func(o *verifierOptions) {
+		if o.headers == nil {
+			o.headers = map[string]string{}
+		}
+		o.headers[name] = value
+	}
+}
+
+// WithNonCompliantBase64 accepts tokens whose segments are standard
+// base64 instead of base64url. See JwtVerifier.AllowNonCompliantBase64.
+func WithNonCompliantBase64() Option {
+	return func(o *verifierOptions) {
+		o.lenient = true
+	}
+}
+
+// WithRequireSubject rejects tokens without a sub claim. See
+// JwtVerifier.RequireSubject.
+func WithRequireSubject() Option {
+	return func(o *verifierOptions) {
+		o.subject = true
+	}
+}
+
+// WithExpectedTokenType requires access tokens to have the given typ
+// header, e.g. "at+jwt". See JwtVerifier.ExpectedTokenType.
+func WithExpectedTokenType(typ string) Option {
+	return func(o *verifierOptions) {
+		o.typ = typ
+	}
+}
+
+// WithForceLocalAccessTokenVerification verifies access tokens locally even
+// from an Okta org authorization server. See
+// JwtVerifier.ForceLocalAccessTokenVerification.
+func WithForceLocalAccessTokenVerification() Option {
+	return func(o *verifierOptions) {
+		o.forceLocal = true
+	}
+}
+
+// WithKeySetChangeHook sets JwtVerifier.OnKeySetChange, which approves
+// or vetoes key set changes. It cannot be combined with WithAdaptor.
+func WithKeySetChangeHook(hook func(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool) Option {
+	return func(o *verifierOptions) {
+		o.keySetHook = hook
+	}
+}
+
+// WithIntrospectionCacheTTL sets how long Introspect reuses an active
+// result. A negative ttl disables caching.
+func WithIntrospectionCacheTTL(ttl time.Duration) Option {
+	return func(o *verifierOptions) {
+		o.introTTL = ttl
+	}
+}
+
+// WithTokenCache caches the results of up to size successful signature
+// checks, so that verifying the same token again within ttl, and before
+// its exp, skips the check. A ttl of zero uses DefaultTokenCacheTTL. See
+// JwtVerifier.TokenCacheSize.
+func WithTokenCache(size int, ttl time.Duration) Option {
+	return func(o *verifierOptions) {
+		if size <= 0 {
+			o.fail("token cache size must be positive, got %d", size)
+			return
+		}
+		if ttl < 0 {
+			o.fail("token cache TTL must not be negative, got %s", ttl)
+			return
+		}
+		o.tokenCache = size
+		o.tokenTTL = ttl
+	}
+}
+
+// WithMaxCacheBytes bounds the memory of the verifier's document and token
+// caches together. See JwtVerifier.MaxCacheBytes.
+func WithMaxCacheBytes(n int64) Option {
+	return func(o *verifierOptions) {
+		if n <= 0 {
+			o.fail("maximum cache bytes must be positive, got %d", n)
+			return
+		}
+		o.maxBytes = n
+	}
+}
+
+// WithSensitiveClaims replaces the package's SensitiveClaims as the claims
+// the verifier's tokens mask in String and Redacted. With no claims, none
+// are masked.
+func WithSensitiveClaims(claims ...string) Option {
+	return func(o *verifierOptions) {
+		o.sensitive = append([]string{}, claims...)
+	}
+}
+
+// WithLegacyBehavior reverts the named behavior changes, such as
+// WithLegacyBehavior("header_std_encoding"), until their removal. See
+// LegacyBehavior for the behaviors that can be reverted; others are an
+// error.
+func WithLegacyBehavior(behaviors ...LegacyBehavior) Option {
+	return func(o *verifierOptions) {
+		for _, b := range behaviors {
+			if _, ok := legacyDeadlines[b]; !ok {
+				o.fail("unknown legacy behavior %q", b)
+				continue
+			}
+			o.legacy = append(o.legacy, b)
+		}
+	}
+}
+
+// WithSecondaryKeySets sets JwtVerifier.SecondaryKeySets, the key sets
+// consulted in order for tokens whose kid is not in the issuer's. Their
+// JWKS URIs must be absolute https URLs, as the issuer's must, and they
+// cannot be combined with WithJWKSFile or WithLocalKeys.
+func WithSecondaryKeySets(sources ...KeySource) Option {
+	return func(o *verifierOptions) {
+		o.secondary = append(o.secondary, sources...)
+	}
+}
+
+// WithAttestationKeys sets JwtVerifier.AttestationKeys, enabling
+// AttestSignature and VerifyWithAttestation. Each key must be valid, and
+// their IDs distinct.
+func WithAttestationKeys(keys ...AttestationKey) Option {
+	return func(o *verifierOptions) {
+		for _, key := range keys {
+			if err := key.validate(); err != nil {
+				o.fail("%s", err)
+				return
+			}
+			for _, existing := range o.attestKeys {
+				if existing.ID == key.ID {
+					o.fail("attestation key %q is set twice", key.ID)
+					return
+				}
+			}
+			o.attestKeys = append(o.attestKeys, key)
+		}
+	}
+}
+
+// WithAttestationTTL sets how long attestations signed by AttestSignature
+// are valid. It defaults to DefaultAttestationTTL.
+func WithAttestationTTL(ttl time.Duration) Option {
+	return func(o *verifierOptions) {
+		if ttl <= 0 {
+			o.fail("attestation TTL must be positive, got %s", ttl)
+			return
+		}
+		o.attestTTL = ttl
+	}
+}
+
+// WithRequestTimeout bounds the discovery and key set requests, retries
+// included. It defaults to 30 seconds.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *verifierOptions) {
+		if timeout <= 0 {
+			o.fail("request timeout must be positive, got %s", timeout)
+			return
+		}
+		o.timeout = timeout
+	}
+}
+
+// WithCacheLifetimeBounds bounds how long the discovery document and key
+// set are cached for. Within the bounds, the lifetime is taken from each
+// response's Cache-Control max-age or Expires header, or is five minutes if
+// it has neither; no-store and no-cache responses are cached for min. The
+// bounds default to cache.DefaultMinLifetime and cache.DefaultMaxLifetime.
+// With WithAdaptor they only apply to the discovery document.
+func WithCacheLifetimeBounds(min, max time.Duration) Option {
+	return func(o *verifierOptions) {
+		if min <= 0 || max < min {
+			o.fail("cache lifetime bounds must satisfy 0 < min <= max, got %s and %s", min, max)
+			return
+		}
+		o.minTTL, o.maxTTL = min, max
+	}
+}
+
+// WithTracer traces each verification, and the discovery and key set
+// fetches it makes, with t; see package tracing. Use oteltracing.New for
+// OpenTelemetry. With WithAdaptor, key set fetches are not traced.
+func WithTracer(t tracing.Tracer) Option {
+	return func(o *verifierOptions) {
+		o.tracer = t
+	}
+}
+
+// WithCoordinator consults c before each background refresh. It only has
+// an effect together with WithBackgroundRefresh and a shared WithCache.
+func WithCoordinator(c DistributedCoordinator) Option {
+	return func(o *verifierOptions) {
+		o.coord = c
+	}
+}
+
+// WithBackgroundRefresh fetches the discovery document and key set every
+// interval on a background goroutine, so verifications do not wait for
+// them when the cached copies expire. Failed refreshes are logged and the
+// cached copies kept. The interval must be shorter than the five minute
+// cache lifetime. Call Close to stop the goroutine.
+func WithBackgroundRefresh(interval time.Duration) Option {
+	return func(o *verifierOptions) {
+		if interval <= 0 || interval >= cacheLifetime {
+			o.fail("background refresh interval must be between 0 and %s, got %s", cacheLifetime, interval)
+			return
+		}
+		o.refresh = interval
+	}
+}
+
+// NewVerifier returns a verifier for issuer configured by opts. Unlike the
+// JwtVerifier literal and New, it validates its configuration: the issuer
+// must be an absolute https URL, except on a loopback host or with
+// WithAllowHTTP, and the options must not contradict each other. A
+// trailing slash on the issuer is removed.
+func NewVerifier(issuer string, opts ...Option) (*JwtVerifier, error) {
+	o := &verifierOptions{
+		claims:     map[string]string{},
+		typed:      map[string]interface{}{},
+		validators: map[string]ClaimValidator{},
+		advisory:   map[string]Strictness{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	advisory := make([]string, 0, len(o.advisory))
+	for claim := range o.advisory {
+		advisory = append(advisory, claim)
+	}
+	sort.Strings(advisory)
+	for _, claim := range advisory {
+		_, typed := o.typed[claim]
+		_, validated := o.validators[claim]
+		if !typed && !validated {
+			o.fail("advisory claim %q has no WithTypedClaimToValidate or WithClaimValidator check", claim)
+		}
+	}
+
+	if err := validateIssuerURL(issuer, o.allowHTTP); err != nil {
+		return nil, err
+	}
+	issuer = normalizeIssuer(issuer)
+
+	if o.tlsConfig != nil {
+		if o.httpClient != nil {
+			o.fail("WithTLSConfig cannot be combined with WithHTTPClient")
+		} else {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = o.tlsConfig
+			o.httpClient = &http.Client{Transport: transport}
+		}
+	}
+
+	if len(o.pins) > 0 {
+		if client, ok := pinnedClient(o.httpClient, o.pins); ok {
+			o.httpClient = client
+		} else {
+			o.fail("WithPinnedTLSKeys requires the client's Transport to be an *http.Transport")
+		}
+	}
+
+	if o.rootCAs != nil {
+		if client, ok := rootCAClient(o.httpClient, o.rootCAs, logger.OrNoOp(o.logger)); ok {
+			o.httpClient = client
+		} else {
+			o.fail("WithRootCAProvider requires the client's Transport to be an *http.Transport")
+		}
+	}
+
+	if o.httpClient != nil && o.adaptor != nil {
+		if setter, ok := o.adaptor.(adaptors.HTTPClientSetter); ok {
+			o.adaptor = setter.SetHTTPClient(o.httpClient)
+		} else {
+			o.fail("the adaptor does not support WithHTTPClient or WithTLSConfig; configure its client directly")
+		}
+	}
+
+	if len(o.keyPins) > 0 && o.adaptor != nil {
+		o.fail("WithAllowedKeyThumbprints requires the default adaptor")
+	}
+
+	if o.x5cRoots != nil && o.adaptor != nil {
+		o.fail("WithX5CValidation requires the default adaptor")
+	}
+
+	if o.keySetHook != nil && o.adaptor != nil {
+		o.fail("WithKeySetChangeHook requires the default adaptor")
+	}
+
+	if o.local != nil && o.adaptor != nil {
+		o.fail("WithJWKSFile and WithLocalKeys require the default adaptor")
+	}
+
+	if o.local != nil && len(o.secondary) > 0 {
+		o.fail("WithSecondaryKeySets cannot be combined with WithJWKSFile or WithLocalKeys")
+	}
+
+	for _, source := range o.secondary {
+		if err := validateKeySetURL(source.JWKSURI, o.allowHTTP); err != nil {
+			o.fail("%s", err)
+		}
+	}
+
+	if len(o.errs) > 0 {
+		return nil, fmt.Errorf("invalid verifier configuration: %s", strings.Join(o.errs, "; "))
+	}
+
+	jvs := &JwtVerifier{
+		Issuer:            issuer,
+		ClaimsToValidate:  o.claims,
+		Adaptor:           o.adaptor,
+		Discovery:         o.discovery,
+		httpClient:        o.httpClient,
+		allowedAlgorithms: o.algorithms,
+		Logger:            o.logger,
+		Cache:             o.cache,
+		Coordinator:       o.coord,
+		RequestTimeout:    o.timeout,
+		Now:               o.now,
+		RequestHeaders:    o.headers,
+		MinCacheLifetime:  o.minTTL,
+		MaxCacheLifetime:  o.maxTTL,
+		Tracer:            o.tracer,
+
+		AllowNonCompliantBase64:           o.lenient,
+		RequireSubject:                    o.subject,
+		ExpectedTokenType:                 o.typ,
+		ForceLocalAccessTokenVerification: o.forceLocal,
+		OnKeySetChange:                    o.keySetHook,
+		IntrospectionCacheTTL:             o.introTTL,
+		TokenCacheSize:                    o.tokenCache,
+		TokenCacheTTL:                     o.tokenTTL,
+		AttestationKeys:                   o.attestKeys,
+		SecondaryKeySets:                  o.secondary,
+		LegacyBehaviors:                   o.legacy,
+		SensitiveClaims:                   o.sensitive,
+		AttestationTTL:                    o.attestTTL,
+		AllowedKIDs:                       o.kids,
+		AllowedKeyThumbprints:             o.keyPins,
+		X5CRoots:                          o.x5cRoots,
+		TypedClaimsToValidate:             o.typed,
+		ClaimValidators:                   o.validators,
+		ClaimStrictness:                   o.advisory,
+		LocalKeys:                         o.local,
+		CircuitBreaker:                    o.breaker,
+		MaxTokenSize:                      DefaultMaxTokenSize,
+		MaxTokenAge:                       o.maxAge,
+		TransactionMaxTokenAge:            o.txnAge,
+		LeewayWarningRate:                 o.leewayRate,
+		LeewayWarningWindow:               o.leewayWin,
+		MaxCacheBytes:                     o.maxBytes,
+	}
+	if o.breaker != nil {
+		o.breaker.Now = o.now
+	}
+	if o.maxSize != nil {
+		jvs.MaxTokenSize = *o.maxSize
+	}
+	if o.retry != nil {
+		jvs.retry = *o.retry
+	}
+	jvs.retry.Rand = o.rand
+	if len(o.hooks) > 0 {
+		jvs.Hooks = o.hooks[0]
+		jvs.AdditionalHooks = o.hooks[1:]
+	}
+
+	j := jvs.New()
+	if o.leeway != nil {
+		j.leeway = int64(*o.leeway / time.Second)
+	}
+
+	j.initProfile = o.init
+	if err := j.initialize(); err != nil {
+		j.Close()
+		return nil, err
+	}
+
+	if o.refresh > 0 {
+		j.startBackgroundRefresh(o.refresh)
+	}
+
+	return j, nil
+}
+
+func validateIssuerURL(issuer string, allowHTTP bool) error {
+	if issuer == "" {
+		return fmt.Errorf("an issuer is required")
+	}
+
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("the issuer %q is not a valid URL", issuer)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("the issuer %q must not have a query or fragment", issuer)
+	}
+
+	if u.Scheme == "https" {
+		return nil
+	}
+
+	if u.Scheme == "http" && (allowHTTP || isLoopback(u.Hostname())) {
+		return nil
+	}
+
+	return fmt.Errorf("the issuer %q must use https", issuer)
+}
+
+// validateKeySetURL checks the JWKS URI of a secondary key set as
+// validateIssuerURL checks the issuer.
+func validateKeySetURL(jwksURI string, allowHTTP bool) error {
+	u, err := url.Parse(jwksURI)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("the key set %q is not a valid URL", jwksURI)
+	}
+
+	if u.Scheme == "https" || (u.Scheme == "http" && (allowHTTP || isLoopback(u.Hostname()))) {
+		return nil
+	}
+	return fmt.Errorf("the key set %q must use https", jwksURI)
+}
+
+// isOrgIssuer reports whether issuer is an Okta org authorization server,
+// whose URL, unlike that of a custom authorization server, has no /oauth2/
+// path segment.
+func isOrgIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return false
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "oauth2" {
+			return false
+		}
+	}
+	return true
+}
+
+// isPlaintextIssuer reports whether issuer is an http URL on a host other
+// than a loopback one.
+func isPlaintextIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	return err == nil && u.Scheme == "http" && !isLoopback(u.Hostname())
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
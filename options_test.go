@@ -0,0 +1,485 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/discovery/oidc"
+	jwterrors "github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_new_verifier_validates_the_issuer(t *testing.T) {
+	tests := []struct {
+		issuer  string
+		wantErr bool
+	}{
+		{"", true},
+		{"golang.oktapreview.com", true},
+		{"http://golang.oktapreview.com/oauth2/default", true},
+		{"ftp://golang.oktapreview.com", true},
+		{"https://golang.oktapreview.com/oauth2/default", false},
+		{"http://localhost:8080/oauth2/default", false},
+		{"http://127.0.0.1:8080/oauth2/default", false},
+		{"/oauth2/default", true},
+		{"https://golang.oktapreview.com/oauth2/default?tenant=a", true},
+		{"https://golang.oktapreview.com/oauth2/default#top", true},
+	}
+
+	for _, test := range tests {
+		_, err := jwtverifier.NewVerifier(test.issuer)
+		if test.wantErr && err == nil {
+			t.Errorf("expected an error for the issuer %q", test.issuer)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("unexpected error for the issuer %q: %s", test.issuer, err)
+		}
+	}
+
+	if _, err := jwtverifier.NewVerifier("http://okta-mock:8080/oauth2/default", jwtverifier.WithAllowHTTP()); err != nil {
+		t.Errorf("expected WithAllowHTTP to accept an http issuer: %s", err)
+	}
+	if _, err := jwtverifier.NewVerifier("ftp://golang.oktapreview.com", jwtverifier.WithAllowHTTP()); err == nil {
+		t.Errorf("expected WithAllowHTTP to accept only http")
+	}
+}
+
+func Test_a_trailing_slash_on_the_issuer_is_ignored(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL+"/",
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier.Issuer != issuer.URL {
+		t.Errorf("expected the issuer to be normalized to %q, got %q", issuer.URL, verifier.Issuer)
+	}
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify a token: %s", err)
+	}
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           issuer.URL + "/",
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Cache:            cache.NewMemory(),
+	}
+	if _, err := jvs.New().VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify a token with a trailing slash on the issuer: %s", err)
+	}
+}
+
+func Test_new_verifier_with_leeway(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["exp"] = time.Now().Unix() - 60
+	token := issuer.Sign(claims)
+
+	aud := jwtverifier.WithClaimToValidate("aud", "api://default")
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL, aud)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyAccessToken(token); err != nil {
+		t.Errorf("expected the default leeway to accept the token: %s", err)
+	}
+
+	verifier, err = jwtverifier.NewVerifier(issuer.URL, aud, jwtverifier.WithLeeway(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyAccessToken(token); err == nil {
+		t.Errorf("expected a zero leeway to reject the token")
+	}
+
+	if _, err := jwtverifier.NewVerifier(issuer.URL, jwtverifier.WithLeeway(-time.Second)); err == nil {
+		t.Errorf("expected an error for a negative leeway")
+	}
+}
+
+func Test_new_verifier_with_claim_to_validate(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL, jwtverifier.WithClaimToValidate("aud", "api://default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify access_token: %s", err)
+	}
+
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://other"))); err == nil {
+		t.Errorf("expected a token for another audience to be rejected")
+	}
+
+	_, err = jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithClaimToValidate("aud", "api://other"))
+	if err == nil || !strings.Contains(err.Error(), "claim \"aud\"") {
+		t.Errorf("expected an error for contradictory claims, got %v", err)
+	}
+}
+
+func Test_new_verifier_with_adaptor_and_discovery(t *testing.T) {
+	adaptor := lestrratGoJwx.LestrratGoJwx{MinRefreshInterval: time.Minute}.New()
+	disc := oidc.Oidc{}.New()
+
+	verifier, err := jwtverifier.NewVerifier("https://golang.oktapreview.com",
+		jwtverifier.WithAdaptor(adaptor),
+		jwtverifier.WithDiscovery(disc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a, ok := verifier.GetAdaptor().(lestrratGoJwx.LestrratGoJwx); !ok || a.MinRefreshInterval != time.Minute {
+		t.Errorf("the adaptor was not used")
+	}
+
+	if verifier.GetDiscovery() != disc {
+		t.Errorf("the discovery was not used")
+	}
+}
+
+type countingTransport struct {
+	requests int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func Test_new_verifier_with_http_client(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	transport := &countingTransport{}
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+
+	if got := atomic.LoadInt32(&transport.requests); got != 2 {
+		t.Errorf("expected the discovery and key set requests to use the client, got %d requests", got)
+	}
+
+	verifier, err = jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithHTTPClient(http.DefaultClient),
+		jwtverifier.WithAdaptor(lestrratGoJwx.LestrratGoJwx{MinRefreshInterval: time.Minute}.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := verifier.GetAdaptor().(lestrratGoJwx.LestrratGoJwx); !ok || a.HTTPClient != http.DefaultClient || a.MinRefreshInterval != time.Minute {
+		t.Errorf("the client was not passed to the adaptor")
+	}
+
+	_, err = jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithHTTPClient(http.DefaultClient),
+		jwtverifier.WithAdaptor(opaqueAdaptor{}))
+	if err == nil {
+		t.Errorf("expected an error when the adaptor cannot take a client")
+	}
+}
+
+type opaqueAdaptor struct{}
+
+func (a opaqueAdaptor) New() adaptors.Adaptor { return a }
+
+func (opaqueAdaptor) GetKey(jwkUri string) {}
+
+func (opaqueAdaptor) Decode(jwt string, jwkUri string) (interface{}, error) {
+	return nil, nil
+}
+
+func Test_new_verifier_with_tls_config(t *testing.T) {
+	issuer := testissuer.NewTLS()
+	defer issuer.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	untrusting, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithRetry(1, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusting.VerifyAccessToken(token); err == nil {
+		t.Fatalf("verified a token from an issuer with an untrusted certificate")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer.Server.Certificate())
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify access_token: %s", err)
+	}
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("expected the discovery and key set to be fetched over TLS, got %d and %d requests",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+
+	_, err = jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithTLSConfig(&tls.Config{RootCAs: roots}),
+		jwtverifier.WithHTTPClient(http.DefaultClient))
+	if err == nil {
+		t.Errorf("expected an error when combining WithTLSConfig and WithHTTPClient")
+	}
+}
+
+func Test_new_verifier_with_request_timeout(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	for _, hung := range []string{"/oauth2/default/.well-known/openid-configuration", "/oauth2/default/keys"} {
+		release := make(chan struct{})
+		var issuerURL string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == hung {
+				<-release
+				return
+			}
+			fmt.Fprintf(w, `{"issuer": %q, "jwks_uri": %q}`, issuerURL, issuerURL+"/keys")
+		}))
+		issuerURL = server.URL + "/oauth2/default"
+
+		verifier, err := jwtverifier.NewVerifier(issuerURL,
+			jwtverifier.WithClaimToValidate("aud", "api://default"),
+			jwtverifier.WithRequestTimeout(50*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		_, err = verifier.VerifyAccessToken(issuer.Sign(map[string]interface{}{"iss": issuerURL}))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected a deadline error, got %v", hung, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: verification took %s", hung, elapsed)
+		}
+
+		close(release)
+		server.Close()
+	}
+
+	if _, err := jwtverifier.NewVerifier("https://golang.oktapreview.com", jwtverifier.WithRequestTimeout(0)); err == nil {
+		t.Errorf("expected an error for a zero timeout")
+	}
+}
+
+func Test_new_verifier_with_cache_lifetime_bounds(t *testing.T) {
+	tests := []struct {
+		min, max time.Duration
+		valid    bool
+	}{
+		{time.Minute, time.Hour, true},
+		{time.Minute, time.Minute, true},
+		{0, time.Hour, false},
+		{time.Hour, time.Minute, false},
+	}
+
+	for _, test := range tests {
+		_, err := jwtverifier.NewVerifier("https://golang.oktapreview.com",
+			jwtverifier.WithCacheLifetimeBounds(test.min, test.max))
+		if (err == nil) != test.valid {
+			t.Errorf("bounds %s and %s: unexpected result %v", test.min, test.max, err)
+		}
+	}
+}
+
+func Test_new_verifier_with_allowed_algorithms(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	aud := jwtverifier.WithClaimToValidate("aud", "api://default")
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL, aud, jwtverifier.WithAllowedAlgorithms("ES256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyAccessToken(token); err == nil || !strings.Contains(err.Error(), "only supported alg is ES256") {
+		t.Errorf("expected an RS256 token to be rejected, got %v", err)
+	}
+
+	verifier, err = jwtverifier.NewVerifier(issuer.URL, aud, jwtverifier.WithAllowedAlgorithms("ES256", "RS256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyAccessToken(token); err != nil {
+		t.Errorf("could not verify access_token: %s", err)
+	}
+
+	for _, algs := range [][]string{{}, {"HS256"}, {"none"}} {
+		if _, err := jwtverifier.NewVerifier(issuer.URL, jwtverifier.WithAllowedAlgorithms(algs...)); err == nil {
+			t.Errorf("expected an error for the algorithms %v", algs)
+		}
+	}
+}
+
+func Test_new_verifier_with_retry(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.FailNext(2, http.StatusBadGateway)
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify access_token after transient failures: %s", err)
+	}
+
+	for _, opt := range []jwtverifier.Option{jwtverifier.WithRetry(0, time.Second), jwtverifier.WithRetry(3, 0)} {
+		if _, err := jwtverifier.NewVerifier(issuer.URL, opt); err == nil {
+			t.Errorf("expected an error for an invalid retry configuration")
+		}
+	}
+}
+
+// countingSource counts the numbers drawn from a fixed seed.
+type countingSource struct {
+	rand.Source
+	draws int
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.Source.Int63()
+}
+
+func Test_new_verifier_with_rand_source(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	src := &countingSource{Source: rand.NewSource(1)}
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithRetry(3, time.Millisecond),
+		jwtverifier.WithRandSource(src),
+		jwtverifier.WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The retry of the discovery document is jittered with the source.
+	issuer.FailNext(1, http.StatusBadGateway)
+	if _, err := verifier.Metadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if src.draws == 0 {
+		t.Fatalf("the discovery retry did not use the rand source")
+	}
+
+	// So is the retry of the key set, by the default adaptor.
+	draws := src.draws
+	issuer.FailNext(1, http.StatusBadGateway)
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatal(err)
+	}
+	if src.draws == draws {
+		t.Errorf("the key set retry did not use the rand source")
+	}
+
+	if _, err := jwtverifier.NewVerifier(issuer.URL, jwtverifier.WithRandSource(nil)); err == nil {
+		t.Errorf("expected an error for a nil rand source")
+	}
+}
+
+func ExampleNewVerifier() {
+	verifier, err := jwtverifier.NewVerifier("https://{yourOktaDomain}/oauth2/default",
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithLeeway(30*time.Second))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token, err := verifier.VerifyAccessToken("{JWT}")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sub, _ := token.Subject()
+	log.Printf("verified a token for %s", sub)
+}
+
+func Test_new_verifier_with_x5c_validation(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(cache.NewMemory()),
+		jwtverifier.WithX5CValidation(x509.NewCertPool()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+	var invalid *jwterrors.X5CInvalid
+	if !errors.As(err, &invalid) || invalid.Reason != jwterrors.X5CMissing {
+		t.Errorf("expected a key without x5c to be rejected, got %v", err)
+	}
+
+	if _, err := jwtverifier.NewVerifier(issuer.URL, jwtverifier.WithX5CValidation(nil)); err == nil {
+		t.Errorf("expected an error for x5c validation without roots")
+	}
+	if _, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithX5CValidation(x509.NewCertPool()),
+		jwtverifier.WithAdaptor(lestrratGoJwx.LestrratGoJwx{}.New())); err == nil {
+		t.Errorf("expected an error for x5c validation with a custom adaptor")
+	}
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_org_issuers_are_told_apart_by_their_path(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.okta.com":                           true,
+		"https://example.okta.com/":                          true,
+		"https://login.example.com":                          true,
+		"https://example.okta.com/oauth2/default":            false,
+		"https://example.okta.com/oauth2/aus1a2b3c4d5e6f7g8": false,
+		"https://example.okta.com/oauth2/default/":           false,
+	}
+
+	for issuer, org := range tests {
+		if isOrgIssuer(issuer) != org {
+			t.Errorf("isOrgIssuer(%q) returned %v", issuer, !org)
+		}
+	}
+}
+
+func Test_org_authorization_server_access_tokens_are_refused(t *testing.T) {
+	issuer := testissuer.NewOrg()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "client123"),
+		WithClaimToValidate("nonce", "abc123"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("client123")
+	claims["nonce"] = "abc123"
+	token := issuer.Sign(claims)
+
+	_, err = jv.VerifyAccessToken(token)
+	var org *errors.OrgAccessToken
+	if !goerrors.As(err, &org) || org.Issuer != issuer.URL {
+		t.Fatalf("expected an OrgAccessToken error, got %v", err)
+	}
+	if issuer.MetadataRequests() != 0 {
+		t.Errorf("the refused access token caused %d discovery requests", issuer.MetadataRequests())
+	}
+
+	if _, err := jv.VerifyIdToken(token); err != nil {
+		t.Errorf("could not verify an org authorization server id_token: %s", err)
+	}
+
+	forced, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "client123"),
+		WithForceLocalAccessTokenVerification(),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forced.VerifyAccessToken(token); err != nil {
+		t.Errorf("could not verify an access token with ForceLocalAccessTokenVerification: %s", err)
+	}
+}
+
+func Test_custom_authorization_server_access_tokens_are_verified(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify a custom authorization server access token: %s", err)
+	}
+}
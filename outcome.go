@@ -0,0 +1,153 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+// FailureReason classifies why a verification failed, for metrics. The
+// values are stable and never renamed, so they can be used as label
+// values.
+type FailureReason string
+
+const (
+	// FailureNone is the reason of a successful verification.
+	FailureNone FailureReason = ""
+
+	// FailureMalformed is a token that could not be parsed, or whose
+	// header was not acceptable.
+	FailureMalformed FailureReason = "malformed"
+
+	// FailureSignature is a token whose signature could not be verified,
+	// including one signed by an unknown or unpinned key.
+	FailureSignature FailureReason = "signature"
+
+	// FailureKeysUnavailable is a verification that could not fetch the
+	// discovery document or key set.
+	FailureKeysUnavailable FailureReason = "keys_unavailable"
+
+	FailureExpired         FailureReason = "expired"
+	FailureNotYetValid     FailureReason = "not_yet_valid"
+	FailurePredatesHorizon FailureReason = "predates_horizon"
+	FailureTooOld          FailureReason = "too_old"
+	FailureIssuer          FailureReason = "issuer"
+
+	// FailureAudience covers the aud, cid and azp claims.
+	FailureAudience FailureReason = "audience"
+
+	// FailureClaims covers every other claim, including the scopes,
+	// groups, nonce and ClaimRequirements.
+	FailureClaims FailureReason = "claims"
+
+	// FailureOther is a failure that fits none of the reasons above.
+	FailureOther FailureReason = "other"
+)
+
+type VerificationEvent struct {
+	// Method names the verifying method, e.g. "VerifyAccessToken".
+	Method string
+
+	// Duration is how long the verification took, including any fetches.
+	Duration time.Duration
+
+	// CacheHit is true when the verification fetched neither the
+	// discovery document nor the key set.
+	CacheHit bool
+
+	Success bool
+
+	// Failure is why the verification failed, or FailureNone. When
+	// several claims failed it is the reason of the first.
+	Failure FailureReason
+
+	// Degraded is set on a failure after which VerifyDegraded returned the
+	// token's claims unverified, so that tokens served unverified can be
+	// told apart from those rejected.
+	Degraded bool
+
+	// AdvisoryFailures names the claims marked Advisory whose checks failed
+	// on a successful verification.
+	AdvisoryFailures []string
+
+	// RequestID is the identifier set on the verification's context with
+	// WithRequestID, or empty.
+	RequestID string
+}
+
+// reasonedError is the error fmt.Errorf would return, along with the
+// FailureReason it is reported as.
+type reasonedError struct {
+	reason  FailureReason
+	message string
+	err     error
+}
+
+func (e *reasonedError) Error() string { return e.message }
+
+func (e *reasonedError) Unwrap() error { return e.err }
+
+// failedWith formats an error as fmt.Errorf does, noting reason as why the
+// verification failed.
+func failedWith(reason FailureReason, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	return &reasonedError{reason: reason, message: err.Error(), err: goerrors.Unwrap(err)}
+}
+
+// failureReason classifies the error returned by a verification.
+func failureReason(err error) FailureReason {
+	if err == nil {
+		return FailureNone
+	}
+	if errors.Category(err) == "keys" {
+		return FailureKeysUnavailable
+	}
+
+	var reasoned *reasonedError
+	if goerrors.As(err, &reasoned) {
+		return reasoned.reason
+	}
+
+	var mismatch *errors.ConfirmationMismatch
+	if goerrors.As(err, &mismatch) {
+		return FailureClaims
+	}
+	return FailureOther
+}
+
+func (j *JwtVerifier) observesVerifications() bool {
+	for _, h := range j.hookSets() {
+		if h.OnVerification != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *JwtVerifier) notifyVerification(event VerificationEvent) {
+	j.runHooks("OnVerification", func(h Hooks) func() {
+		if h.OnVerification == nil {
+			return nil
+		}
+		onVerification := h.OnVerification
+		return func() { onVerification(event) }
+	})
+}
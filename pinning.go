@@ -0,0 +1,114 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+// spkiHash returns the base64 SHA-256 hash of a certificate's public key,
+// the form used for pins.
+func spkiHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// validPin reports whether pin is a base64 SHA-256 hash.
+func validPin(pin string) bool {
+	b, err := base64.StdEncoding.DecodeString(pin)
+	return err == nil && len(b) == sha256.Size
+}
+
+// pinnedClient returns a copy of client, which defaults to one using
+// http.DefaultTransport, that only completes TLS handshakes when a
+// certificate in the chain has one of the pinned keys. The chain is checked
+// after, not instead of, the usual certificate verification. It returns
+// false if the client's transport is not an *http.Transport.
+func pinnedClient(client *http.Client, pins []string) (*http.Client, bool) {
+	pinned := &http.Client{}
+	if client != nil {
+		*pinned = *client
+	}
+
+	var transport *http.Transport
+	switch t := pinned.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, false
+	}
+
+	config := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		config = transport.TLSClientConfig.Clone()
+	}
+	config.VerifyPeerCertificate = verifyPins(pins, config.VerifyPeerCertificate)
+
+	transport.TLSClientConfig = config
+	pinned.Transport = transport
+	return pinned, true
+}
+
+func verifyPins(pins []string, next func([][]byte, [][]*x509.Certificate) error) func([][]byte, [][]*x509.Certificate) error {
+	allowed := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		allowed[pin] = true
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if next != nil {
+			if err := next(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+
+		// Verified chains are only missing when InsecureSkipVerify is set;
+		// then the presented certificates are all there is to check.
+		chains := verifiedChains
+		if len(chains) == 0 {
+			var presented []*x509.Certificate
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				presented = append(presented, cert)
+			}
+			chains = [][]*x509.Certificate{presented}
+		}
+
+		var hashes []string
+		for _, chain := range chains {
+			for _, cert := range chain {
+				hash := spkiHash(cert)
+				if allowed[hash] {
+					return nil
+				}
+				hashes = append(hashes, hash)
+			}
+		}
+		return errors.TLSPinMismatchError(hashes)
+	}
+}
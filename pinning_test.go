@@ -0,0 +1,83 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	goerrors "errors"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_pinned_tls_keys(t *testing.T) {
+	issuer := testissuer.NewTLS()
+	defer issuer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer.Server.Certificate())
+	pin := spkiHash(issuer.Server.Certificate())
+	other := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+
+	// The issuer's pin is second, as it would be while rotating to it.
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTLSConfig(&tls.Config{RootCAs: roots}),
+		WithPinnedTLSKeys([]string{other, pin}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify access_token with a matching pin: %s", err)
+	}
+	if issuer.JWKSRequests() != 1 {
+		t.Errorf("expected the key set to be fetched through the pinned client")
+	}
+
+	jv, err = NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTLSConfig(&tls.Config{RootCAs: roots}),
+		WithPinnedTLSKeys([]string{other}),
+		WithRetry(1, time.Millisecond),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jv.VerifyAccessToken(token)
+
+	var mismatch *errors.TLSPinMismatch
+	if !goerrors.As(err, &mismatch) {
+		t.Fatalf("expected a pin mismatch, got %v", err)
+	}
+	if len(mismatch.Presented) != 1 || mismatch.Presented[0] != pin {
+		t.Errorf("expected the presented key to be reported, got %v", mismatch.Presented)
+	}
+}
+
+func Test_pinned_tls_keys_are_validated(t *testing.T) {
+	for _, pins := range [][]string{nil, {"not base64!"}, {"c2hvcnQ="}} {
+		if _, err := NewVerifier("https://golang.oktapreview.com", WithPinnedTLSKeys(pins)); err == nil {
+			t.Errorf("expected an error for pins %v", pins)
+		}
+	}
+}
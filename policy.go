@@ -0,0 +1,187 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+// Policy is a set of requirements on the claims of an access token, for
+// EvaluatePolicies. Empty fields other than Audience impose no requirement.
+type Policy struct {
+	// Audience must be the token's aud, or one of them. If it is empty,
+	// the verifier's aud is required instead.
+	Audience string
+
+	// ClientID must be the token's cid, or its client_id if it has no cid.
+	ClientID string
+
+	RequiredScopes []string
+
+	// RequiredGroups, RequireAllGroups and GroupsClaim work as the
+	// JwtVerifier fields of the same names.
+	RequiredGroups   []string
+	RequireAllGroups bool
+	GroupsClaim      string
+
+	ClaimRequirements map[string]StructClaimRequirement
+}
+
+// PolicyResult is the outcome of one policy.
+type PolicyResult struct {
+	Name   string
+	Passed bool
+
+	// Reasons describe each requirement the token failed, in the order
+	// Policy declares them.
+	Reasons []string
+}
+
+// PolicyEvaluation is the result of EvaluatePolicies.
+type PolicyEvaluation struct {
+	Token *Jwt
+
+	// Results has one entry per policy, sorted by name.
+	Results []PolicyResult
+}
+
+// Passed returns the names of the policies the token satisfied, sorted.
+func (e PolicyEvaluation) Passed() []string {
+	var names []string
+	for _, result := range e.Results {
+		if result.Passed {
+			names = append(names, result.Name)
+		}
+	}
+	return names
+}
+
+// Result returns the result of the named policy.
+func (e PolicyEvaluation) Result(name string) (PolicyResult, bool) {
+	for _, result := range e.Results {
+		if result.Name == name {
+			return result, true
+		}
+	}
+	return PolicyResult{}, false
+}
+
+// EvaluatePolicies verifies an access token once and then evaluates every
+// policy against its claims, so callers can decide, for example, which is
+// the most privileged policy the token satisfies. Every policy is evaluated
+// in full, independently of the others.
+//
+// The token must pass every check VerifyAccessToken makes other than the
+// verifier's audience, client ID, scope, group and claim requirements, or
+// an error is returned; each policy states its own. A policy without an
+// Audience requires the verifier's aud, and one that has neither is an
+// error.
+func (j *JwtVerifier) EvaluatePolicies(ctx context.Context, jwt string, policies map[string]Policy) (PolicyEvaluation, error) {
+	if err := ctx.Err(); err != nil {
+		return PolicyEvaluation{}, err
+	}
+
+	names := make([]string, 0, len(policies))
+	resolved := make(map[string]Policy, len(policies))
+	for name, policy := range policies {
+		policy, err := j.resolvePolicy(policy)
+		if err != nil {
+			return PolicyEvaluation{}, fmt.Errorf("policy %q: %w", name, err)
+		}
+		names = append(names, name)
+		resolved[name] = policy
+	}
+	sort.Strings(names)
+
+	ctx, end := j.startVerification(ctx, tracing.SpanVerifyAccessToken, "EvaluatePolicies")
+	token, err := j.verifyAccessToken(ctx, jwt, verifyCall{policies: true})
+	end(token, err)
+	j.recordVerification(err)
+	if err != nil {
+		j.log().Debug("access token verification failed", "error", err.Error())
+		return PolicyEvaluation{}, err
+	}
+
+	evaluation := PolicyEvaluation{Token: token, Results: make([]PolicyResult, 0, len(names))}
+	for _, name := range names {
+		reasons := resolved[name].evaluate(token)
+		evaluation.Results = append(evaluation.Results, PolicyResult{
+			Name:    name,
+			Passed:  len(reasons) == 0,
+			Reasons: reasons,
+		})
+	}
+	return evaluation, nil
+}
+
+// resolvePolicy returns policy with the verifier's aud in place of an
+// empty Audience. A policy must never accept tokens for any audience.
+func (j *JwtVerifier) resolvePolicy(policy Policy) (Policy, error) {
+	if policy.Audience == "" {
+		policy.Audience = j.ClaimsToValidate["aud"]
+	}
+	if policy.Audience == "" {
+		return Policy{}, fmt.Errorf("the policy has no Audience, and the verifier has no aud to require instead")
+	}
+	return policy, nil
+}
+
+// evaluate returns the reasons token fails the policy.
+func (p Policy) evaluate(token *Jwt) []string {
+	var reasons []string
+	for _, err := range p.check(token) {
+		reasons = append(reasons, err.Error())
+	}
+	return reasons
+}
+
+// check returns an error for each requirement token fails. It reuses the
+// verifier's checks by expressing the policy as a verifier.
+func (p Policy) check(token *Jwt) []error {
+	v := &JwtVerifier{
+		ClaimsToValidate:  map[string]string{"aud": p.Audience},
+		RequiredGroups:    p.RequiredGroups,
+		RequireAllGroups:  p.RequireAllGroups,
+		GroupsClaim:       p.GroupsClaim,
+		ClaimRequirements: p.ClaimRequirements,
+	}
+	if p.ClientID != "" {
+		v.ClaimsToValidate["cid"] = p.ClientID
+	}
+
+	var errs []error
+	if err := v.validateAudience(token.Claims["aud"]); err != nil {
+		errs = append(errs, err)
+	}
+	if err := v.validateClientIdClaims(token.Claims); err != nil {
+		errs = append(errs, err)
+	}
+	if err := token.RequireScopes(p.RequiredScopes...); err != nil {
+		errs = append(errs, err)
+	}
+	if err := v.validateGroups(token); err != nil {
+		errs = append(errs, err)
+	}
+	if err := v.validateClaimRequirements(token.Claims); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
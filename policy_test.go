@@ -0,0 +1,230 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+var tieredPolicies = map[string]Policy{
+	"standard": {
+		Audience:       "api://default",
+		RequiredScopes: []string{"read"},
+	},
+	"sensitive": {
+		Audience:       "api://default",
+		RequiredScopes: []string{"read", "write"},
+		RequiredGroups: []string{"Admins"},
+	},
+	"partner": {
+		Audience: "api://partner",
+		ClientID: "partner-app",
+	},
+}
+
+func Test_evaluate_policies_reports_every_policy(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL, WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		passed []string
+	}{
+		{"none", map[string]interface{}{"aud": "api://other", "scp": []string{"read"}}, nil},
+		{"one", map[string]interface{}{"scp": []string{"read"}}, []string{"standard"}},
+		{"all", map[string]interface{}{
+			"aud":    []string{"api://default", "api://partner"},
+			"cid":    "partner-app",
+			"scp":    []string{"read", "write"},
+			"groups": []string{"Admins"},
+		}, []string{"partner", "sensitive", "standard"}},
+	}
+
+	for _, test := range tests {
+		claims := issuer.Claims("api://default")
+		for name, value := range test.claims {
+			claims[name] = value
+		}
+
+		evaluation, err := jv.EvaluatePolicies(context.Background(), issuer.Sign(claims), tieredPolicies)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if !reflect.DeepEqual(evaluation.Passed(), test.passed) {
+			t.Errorf("%s: expected %v to pass, got %v", test.name, test.passed, evaluation.Passed())
+		}
+
+		var names []string
+		for _, result := range evaluation.Results {
+			names = append(names, result.Name)
+			if result.Passed != (len(result.Reasons) == 0) {
+				t.Errorf("%s: %s passed is %v with reasons %v", test.name, result.Name, result.Passed, result.Reasons)
+			}
+		}
+		if !reflect.DeepEqual(names, []string{"partner", "sensitive", "standard"}) {
+			t.Errorf("%s: expected every policy in name order, got %v", test.name, names)
+		}
+	}
+}
+
+func Test_evaluate_policies_gives_every_reason(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL, WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://other")
+	claims["scp"] = []string{"read"}
+	evaluation, err := jv.EvaluatePolicies(context.Background(), issuer.Sign(claims), tieredPolicies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := evaluation.Result("sensitive")
+	if len(result.Reasons) != 3 ||
+		!strings.Contains(result.Reasons[0], "aud") ||
+		!strings.Contains(result.Reasons[1], "write") ||
+		!strings.Contains(result.Reasons[2], "groups") {
+		t.Errorf("expected the audience, scope and group failures, got %q", result.Reasons)
+	}
+}
+
+func Test_evaluate_policies_rejects_invalid_tokens(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL, WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["iss"] = "https://other.example.com"
+	claims["exp"] = 1
+	_, err = jv.EvaluatePolicies(context.Background(), issuer.Sign(claims), tieredPolicies)
+	if err == nil || !strings.Contains(err.Error(), "Issuer") || !strings.Contains(err.Error(), "Expiration") {
+		t.Errorf("expected the issuer and expiry failures, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := jv.EvaluatePolicies(ctx, issuer.Sign(issuer.Claims("api://default")), tieredPolicies); err != context.Canceled {
+		t.Errorf("expected a cancelled context to be reported, got %v", err)
+	}
+}
+
+func Test_evaluate_policies_applies_the_verifier_checks(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var events []VerificationEvent
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithClaimValidator("sub", func(value interface{}, facts Facts) error {
+			if value == "blocked@example.com" {
+				return fmt.Errorf("the subject is blocked")
+			}
+			return nil
+		}),
+		WithCache(cache.NewMemory()),
+		WithHooks(Hooks{OnVerification: func(e VerificationEvent) {
+			events = append(events, e)
+		}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies := map[string]Policy{"default": {}, "partner": {Audience: "api://partner"}}
+	evaluation, err := jv.EvaluatePolicies(context.Background(), issuer.Sign(issuer.Claims("api://partner")), policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(evaluation.Passed(), []string{"partner"}) {
+		t.Errorf("expected the policy without an audience to require the verifier's, got %v passed", evaluation.Passed())
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["sub"] = "blocked@example.com"
+	_, err = jv.EvaluatePolicies(context.Background(), issuer.Sign(claims), policies)
+	if failureReason(err) != FailureClaims || !strings.Contains(err.Error(), "blocked") {
+		t.Errorf("expected the claim validator to fail the token, got %v", err)
+	}
+
+	if len(events) != 2 || events[0].Method != "EvaluatePolicies" || !events[0].Success ||
+		events[1].Success || events[1].Failure != FailureClaims {
+		t.Errorf("expected a verification event for each evaluation, got %+v", events)
+	}
+	if stats := jv.Stats(); stats.Verified != 1 || stats.Rejected != 1 {
+		t.Errorf("expected both evaluations to be counted, got %+v", stats)
+	}
+}
+
+func Test_evaluate_policies_requires_an_audience(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL, WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	_, err = jv.EvaluatePolicies(context.Background(), token, map[string]Policy{"open": {RequiredScopes: []string{"read"}}})
+	if err == nil || !strings.Contains(err.Error(), `policy "open"`) {
+		t.Errorf("expected a policy without any audience to be refused, got %v", err)
+	}
+	if issuer.MetadataRequests() != 0 {
+		t.Errorf("the refused policies caused %d discovery requests", issuer.MetadataRequests())
+	}
+}
+
+func Test_evaluate_policies_refuses_org_authorization_server_tokens(t *testing.T) {
+	issuer := testissuer.NewOrg()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL, WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jv.EvaluatePolicies(context.Background(), issuer.Sign(issuer.Claims("client123")), map[string]Policy{
+		"client": {Audience: "client123"},
+	})
+	var org *errors.OrgAccessToken
+	if !goerrors.As(err, &org) {
+		t.Errorf("expected an OrgAccessToken error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+)
+
+// Prime loads the discovery document and key set into the cache and
+// checks them, so that a misconfigured verifier fails at startup or in a
+// readiness probe rather than on the first request. The discovery document
+// must have a jwks_uri and, unless SkipIssuerValidation is set, an issuer
+// matching the verifier's. With an adaptor that implements adaptors.Primer,
+// such as the default one, the key set must have a key that can verify
+// signatures. With LocalKeys, only the local key set is checked.
+//
+// Prime fetches only what is not already cached, so calling it often does
+// not add requests to the issuer, and the first verification after it
+// fetches nothing. It returns early with ctx's error if ctx ends first;
+// the fetches it started still complete and are cached.
+func (j *JwtVerifier) Prime(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	j.goroutines.Go("prime", func() {
+		done <- j.prime()
+	})
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Metadata returns a copy of the issuer's discovery document, from the
+// cache or fetched, for tools that check the issuer's configuration. It
+// is not checked against the verifier's issuer; Prime does that.
+func (j *JwtVerifier) Metadata(ctx context.Context) (map[string]interface{}, error) {
+	md, err := j.getMetaData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the discovery document for %s: %w", j.Issuer, err)
+	}
+	return copyValue(md).(map[string]interface{}), nil
+}
+
+func (j *JwtVerifier) prime() error {
+	if j.LocalKeys != nil {
+		return j.primeKeys(j.LocalKeys.Source())
+	}
+
+	md, err := j.getMetaData(context.Background())
+	if err != nil {
+		return fmt.Errorf("could not load the discovery document for %s: %w", j.Issuer, err)
+	}
+
+	if err := j.validateIss(md["issuer"]); err != nil {
+		return fmt.Errorf("the discovery document is for another issuer: %w", err)
+	}
+
+	return j.primeKeys(md["jwks_uri"].(string))
+}
+
+func (j *JwtVerifier) primeKeys(jwksUri string) error {
+	primer, ok := j.Adaptor.(adaptors.Primer)
+	if !ok {
+		return nil
+	}
+
+	if err := primer.Prime(jwksUri); err != nil {
+		return fmt.Errorf("could not load the key set for %s: %w", j.Issuer, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_prime_warms_the_caches(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := jv.Prime(context.Background()); err != nil {
+			t.Fatalf("Prime() returned an error: %s", err)
+		}
+	}
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if issuer.MetadataRequests() != 1 || issuer.JWKSRequests() != 1 {
+		t.Errorf("expected one fetch of each document, got %d and %d",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+}
+
+func Test_prime_describes_each_failure(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(issuer *testissuer.Issuer)
+		suffix   string
+		expected string
+	}{
+		{"issuer typo", func(*testissuer.Issuer) {}, "x", "could not load the discovery document"},
+		{"other issuer", func(issuer *testissuer.Issuer) {
+			issuer.SetBodyRewrite(func(path string, body []byte) []byte {
+				return bytes.Replace(body, []byte("/oauth2/default\""), []byte("/oauth2/other\""), 1)
+			})
+		}, "", "the discovery document is for another issuer"},
+		{"key set unavailable", func(issuer *testissuer.Issuer) { issuer.SetJWKSUnavailable(true) }, "", "could not load the key set"},
+		{"no signing keys", func(issuer *testissuer.Issuer) {
+			issuer.SetKeyParams(map[string]interface{}{"use": "enc"})
+		}, "", "no keys that can verify signatures"},
+	}
+
+	for _, test := range tests {
+		issuer := testissuer.New()
+		test.setup(issuer)
+
+		jv, err := NewVerifier(issuer.URL+test.suffix,
+			WithCache(cache.NewMemory()),
+			WithRetry(1, time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = jv.Prime(context.Background())
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+
+		issuer.Close()
+	}
+}
+
+func Test_prime_honours_the_context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	jv, err := NewVerifier("https://golang.oktapreview.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jv.Prime(ctx); err != context.Canceled {
+		t.Errorf("expected a cancelled context to be reported, got %v", err)
+	}
+}
+
+func Test_metadata_returns_a_copy_of_the_discovery_document(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL, WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := jv.Metadata(context.Background())
+	if err != nil || md["issuer"] != issuer.URL {
+		t.Fatalf("Metadata() returned %v, %v", md, err)
+	}
+	md["issuer"] = "https://other.example.com"
+
+	md, _ = jv.Metadata(context.Background())
+	if md["issuer"] != issuer.URL || issuer.MetadataRequests() != 1 {
+		t.Errorf("expected the cached document unchanged, got %v after %d requests", md["issuer"], issuer.MetadataRequests())
+	}
+}
@@ -0,0 +1,173 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+)
+
+// cacheLifetime is how long discovery documents are cached when the
+// response has neither a Cache-Control max-age nor an Expires header.
+const cacheLifetime = 5 * time.Minute
+
+// maxStale bounds how long after the last successful fetch a failing
+// background refresh keeps extending the cached discovery document.
+const maxStale = 15 * time.Minute
+
+// closeTimeout bounds how long Close waits for the verifier's goroutines
+// to exit.
+const closeTimeout = 5 * time.Second
+
+// metaDataFetched records when each discovery document was last fetched.
+var metaDataFetched sync.Map
+
+type backgroundRefresh struct {
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// startBackgroundRefresh fetches the discovery document and key set now and
+// then every interval, until Close is called.
+func (j *JwtVerifier) startBackgroundRefresh(interval time.Duration) {
+	j.background = &backgroundRefresh{interval: interval, stop: make(chan struct{})}
+	stop := j.background.stop
+	j.goroutines.Go("background refresh", func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			j.refresh(interval)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			// select picks at random when both are ready; a closed verifier
+			// must not refresh again.
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	})
+}
+
+// refresh replaces the cached discovery document and key set. When a fetch
+// fails the cached copy is kept, for up to maxStale after the last
+// successful fetch, so verifications continue with stale keys. If another
+// process holds the coordinator's lock for this interval, nothing is done.
+// With LocalKeys, the local key set is read again instead.
+func (j *JwtVerifier) refresh(interval time.Duration) {
+	if j.LocalKeys != nil {
+		if err := j.LocalKeys.Reload(); err != nil {
+			j.log().Warn("local key set reload failed", "url", j.LocalKeys.Source(), "error", err.Error())
+			j.recordRefresh(false)
+			return
+		}
+		j.recordRefresh(true)
+		return
+	}
+
+	metaDataUrl := j.metaDataUrl()
+
+	if j.Coordinator != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		acquired, err := j.Coordinator.TryAcquire(ctx, refreshLockKey(metaDataUrl), interval)
+		cancel()
+		if err != nil {
+			j.log().Warn("refresh coordinator failed, refreshing anyway", "url", metaDataUrl, "error", err.Error())
+		} else if !acquired {
+			j.log().Debug("refresh held by another process", "url", metaDataUrl)
+			return
+		}
+	}
+
+	failed := false
+	md, err := j.fetchMetaData(context.Background(), metaDataUrl)
+	if err != nil {
+		j.log().Warn("background metadata refresh failed", "url", metaDataUrl, "error", err.Error())
+		j.recordRefresh(false)
+		failed = true
+
+		c := j.documents()
+		body, found := c.Get(cache.MetadataKey(metaDataUrl))
+		if !found {
+			return
+		}
+		if md, err = decodeMetaData(metaDataUrl, body); err != nil {
+			return
+		}
+		if fetched, ok := metaDataFetched.Load(metaDataUrl); ok && time.Since(fetched.(time.Time)) < maxStale {
+			c.Set(cache.MetadataKey(metaDataUrl), body, cacheLifetime)
+		}
+	}
+
+	refresher, ok := j.Adaptor.(adaptors.Refresher)
+	if ok {
+		jwksUri := md["jwks_uri"].(string)
+		if err := refresher.Refresh(jwksUri); err != nil {
+			j.log().Warn("background key set refresh failed", "url", jwksUri, "error", err.Error())
+			if !failed {
+				j.recordRefresh(false)
+			}
+			return
+		}
+	}
+
+	if !failed {
+		j.recordRefresh(true)
+	}
+}
+
+// Close stops the background refresh started by WithBackgroundRefresh and
+// the goroutine running Async hooks; Async hook calls still queued are
+// discarded. It then waits up to closeTimeout for every goroutine the
+// verifier started to exit, including a refresh or Prime in progress, and
+// returns an error naming those still running. It is safe to call more
+// than once, and on verifiers without either. A verifier with a background
+// refresh or Async hooks is not garbage collected until it is closed.
+func (j *JwtVerifier) Close() error {
+	if j.background != nil {
+		j.background.once.Do(func() {
+			close(j.background.stop)
+		})
+	}
+	if j.hookQueue != nil {
+		j.hookQueue.shutdown()
+	}
+	if !j.goroutines.Wait(closeTimeout) {
+		return fmt.Errorf("goroutines still running %s after Close: %s",
+			closeTimeout, strings.Join(j.goroutines.Running(), ", "))
+	}
+	return nil
+}
+
+// DebugGoroutines names the goroutines the verifier started that are still
+// running, such as "background refresh", "hook queue" or "prime", for
+// diagnosing leaks. After Close returns nil, it is empty.
+func (j *JwtVerifier) DebugGoroutines() []string {
+	return j.goroutines.Running()
+}
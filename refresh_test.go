@@ -0,0 +1,168 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func Test_background_refresh_fetches_ahead_of_verification(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithBackgroundRefresh(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "repeated refreshes", func() bool {
+		return issuer.MetadataRequests() >= 3 && issuer.JWKSRequests() >= 3
+	})
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify access_token: %s", err)
+	}
+
+	jv.Close()
+	jv.Close()
+
+	// Close waits for a refresh that was in flight to finish.
+	requests := issuer.JWKSRequests()
+	time.Sleep(100 * time.Millisecond)
+
+	if issuer.JWKSRequests() != requests {
+		t.Errorf("the background refresh continued after Close")
+	}
+}
+
+func Test_background_refresh_failures_keep_the_cached_keys(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	log := &recordingLogger{}
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithLogger(log),
+		WithBackgroundRefresh(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	waitFor(t, "the first refresh", func() bool { return issuer.JWKSRequests() >= 1 })
+
+	issuer.SetJWKSUnavailable(true)
+
+	waitFor(t, "a failed refresh", func() bool { return log.contains("background key set refresh failed") })
+
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Errorf("could not verify access_token with the cached keys: %s", err)
+	}
+}
+
+func Test_background_refresh_interval_is_validated(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second, cacheLifetime, time.Hour} {
+		if _, err := NewVerifier("https://golang.oktapreview.com", WithBackgroundRefresh(interval)); err == nil {
+			t.Errorf("expected an error for the interval %s", interval)
+		}
+	}
+
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+	}
+	if err := jvs.New().Close(); err != nil {
+		t.Errorf("Close on a verifier without a background refresh returned %s", err)
+	}
+}
+
+func Test_close_leaves_no_goroutines_running(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+
+		// prime calls Prime with a context that ends before the slow
+		// issuer responds.
+		prime bool
+
+		// running are the goroutines expected before Close.
+		running []string
+	}{
+		{"lazy", nil, false, nil},
+		{"background refresh", []Option{WithBackgroundRefresh(10 * time.Millisecond)}, false, []string{"background refresh"}},
+		{"async hooks", []Option{WithHooks(Hooks{OnVerification: func(VerificationEvent) {}, Async: true})}, false, []string{"hook queue"}},
+		{"eager best effort", []Option{WithInitProfile(EagerBestEffort(10 * time.Millisecond))}, false, []string{"prime"}},
+		{"abandoned prime", nil, true, []string{"prime"}},
+		{"everything", []Option{
+			WithBackgroundRefresh(10 * time.Millisecond),
+			WithHooks(Hooks{OnVerification: func(VerificationEvent) {}, Async: true}),
+			WithInitProfile(EagerBestEffort(10 * time.Millisecond)),
+		}, true, []string{"background refresh", "hook queue", "prime", "prime"}},
+	}
+
+	for _, test := range tests {
+		issuer := testissuer.New()
+		issuer.SetDelay(100 * time.Millisecond)
+
+		opts := append([]Option{WithClaimToValidate("aud", "api://default"), WithCache(cache.NewMemory())}, test.opts...)
+		jv, err := NewVerifier(issuer.URL, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.prime {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			if err := jv.Prime(ctx); err == nil {
+				t.Errorf("%s: expected Prime to end with its context", test.name)
+			}
+			cancel()
+		}
+		// A malformed token is rejected without waiting for the issuer, but
+		// still reported to the hooks.
+		jv.VerifyAccessToken("not-a-token")
+
+		if running := jv.DebugGoroutines(); !reflect.DeepEqual(running, test.running) {
+			t.Errorf("%s: expected %v running before Close, got %v", test.name, test.running, running)
+		}
+
+		if err := jv.Close(); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		if running := jv.DebugGoroutines(); len(running) > 0 {
+			t.Errorf("%s: goroutines still running after Close: %v", test.name, running)
+		}
+		issuer.Close()
+	}
+}
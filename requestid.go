@@ -0,0 +1,43 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that carries id, the identifier of
+// the request a verification is made for. The hook events of
+// verifications made with the context report it as their RequestID, so
+// they can be correlated with the request's logs and audit records.
+// Middleware sets it from the request's X-Request-ID header.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request identifier set on ctx with
+// WithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// requestID returns the request identifier set on ctx, or empty.
+func requestID(ctx context.Context) string {
+	id, _ := RequestIDFromContext(ctx)
+	return id
+}
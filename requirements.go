@@ -0,0 +1,196 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// maxRequirementDepth bounds how deeply nested a StructClaimRequirement may
+// be evaluated.
+const maxRequirementDepth = 32
+
+// JSONType names the type of a JSON value.
+type JSONType string
+
+const (
+	TypeObject  JSONType = "object"
+	TypeArray   JSONType = "array"
+	TypeString  JSONType = "string"
+	TypeNumber  JSONType = "number"
+	TypeBoolean JSONType = "boolean"
+	TypeNull    JSONType = "null"
+)
+
+// StructClaimRequirement describes the shape a claim, or a value nested in
+// one, must have. Only the constraints that are set are checked.
+type StructClaimRequirement struct {
+	// Type is the JSON type the value must have.
+	Type JSONType `json:"type,omitempty"`
+
+	// Required makes the value's absence an error.
+	Required bool `json:"required,omitempty"`
+
+	// Fields are requirements for the members of an object.
+	Fields map[string]StructClaimRequirement `json:"fields,omitempty"`
+
+	// Items is the requirement for every element of an array.
+	Items *StructClaimRequirement `json:"items,omitempty"`
+
+	// Minimum and Maximum bound a number, inclusively.
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+}
+
+// MarshalJSON encodes the requirement with its json tags, except that a
+// Minimum or Maximum that is not a finite number, which JSON cannot hold,
+// is encoded as the string "+Inf", "-Inf" or "NaN". This keeps
+// DescribeConfig and ConfigFingerprint working for any requirement.
+func (r StructClaimRequirement) MarshalJSON() ([]byte, error) {
+	type plain StructClaimRequirement
+	return json.Marshal(struct {
+		plain
+		Minimum interface{} `json:"minimum,omitempty"`
+		Maximum interface{} `json:"maximum,omitempty"`
+	}{plain(r), jsonBound(r.Minimum), jsonBound(r.Maximum)})
+}
+
+// jsonBound returns bound as JSON can encode it, or nil if it is not set.
+func jsonBound(bound *float64) interface{} {
+	switch {
+	case bound == nil:
+		return nil
+	case math.IsNaN(*bound):
+		return "NaN"
+	case math.IsInf(*bound, 1):
+		return "+Inf"
+	case math.IsInf(*bound, -1):
+		return "-Inf"
+	}
+	return *bound
+}
+
+// validateClaimRequirements checks each claim in ClaimRequirements, except
+// those marked Advisory. Claims are checked in name order, and the first
+// failure is returned with the path to the offending value, e.g.
+// "entitlements.limits.api".
+func (j *JwtVerifier) validateClaimRequirements(claims map[string]interface{}) error {
+	names := make([]string, 0, len(j.ClaimRequirements))
+	for name := range j.ClaimRequirements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if j.ClaimStrictness[name] == Advisory {
+			continue
+		}
+		if err := validateClaimRequirement(name, j.ClaimRequirements[name], claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateClaimRequirement(name string, requirement StructClaimRequirement, claims map[string]interface{}) error {
+	value, ok := claims[name]
+	if !ok {
+		if requirement.Required {
+			return fmt.Errorf("%s: missing", name)
+		}
+		return nil
+	}
+	return requirement.validate(name, value, 1)
+}
+
+func (r StructClaimRequirement) validate(path string, value interface{}, depth int) error {
+	if depth > maxRequirementDepth {
+		return fmt.Errorf("%s: nested more than %d levels deep", path, maxRequirementDepth)
+	}
+
+	actual := jsonType(value)
+	if r.Type != "" && actual != r.Type {
+		return fmt.Errorf("%s: expected %s, got %s", path, r.Type, actual)
+	}
+
+	if r.Minimum != nil || r.Maximum != nil {
+		n, err := numericValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected number, got %s", path, actual)
+		}
+		if r.Minimum != nil && n < *r.Minimum {
+			return fmt.Errorf("%s: expected number ≥ %v, got %v", path, *r.Minimum, n)
+		}
+		if r.Maximum != nil && n > *r.Maximum {
+			return fmt.Errorf("%s: expected number ≤ %v, got %v", path, *r.Maximum, n)
+		}
+	}
+
+	if object, ok := value.(map[string]interface{}); ok && len(r.Fields) > 0 {
+		names := make([]string, 0, len(r.Fields))
+		for name := range r.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			field := r.Fields[name]
+			fieldValue, ok := object[name]
+			if !ok {
+				if field.Required {
+					return fmt.Errorf("%s.%s: missing", path, name)
+				}
+				continue
+			}
+			if err := field.validate(path+"."+name, fieldValue, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if array, ok := value.([]interface{}); ok && r.Items != nil {
+		for i, item := range array {
+			if err := r.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func jsonType(value interface{}) JSONType {
+	switch value.(type) {
+	case nil:
+		return TypeNull
+	case bool:
+		return TypeBoolean
+	case string:
+		return TypeString
+	case map[string]interface{}:
+		return TypeObject
+	case []interface{}:
+		return TypeArray
+	}
+	if _, err := numericValue(value); err == nil {
+		return TypeNumber
+	}
+	return JSONType(fmt.Sprintf("%T", value))
+}
@@ -0,0 +1,136 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+var entitlements = StructClaimRequirement{
+	Type:     TypeObject,
+	Required: true,
+	Fields: map[string]StructClaimRequirement{
+		"tier": {Type: TypeString, Required: true},
+		"limits": {
+			Type:     TypeObject,
+			Required: true,
+			Fields: map[string]StructClaimRequirement{
+				"api": {Type: TypeNumber, Required: true, Minimum: float(0), Maximum: float(10000)},
+			},
+		},
+		"regions": {Type: TypeArray, Items: &StructClaimRequirement{Type: TypeString}},
+	},
+}
+
+func Test_struct_claim_requirements_report_the_failing_path(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer:            "https://golang.oktapreview.com",
+		ClaimRequirements: map[string]StructClaimRequirement{"entitlements": entitlements},
+	}
+
+	jv := jvs.New()
+
+	tests := []struct {
+		name         string
+		entitlements interface{}
+		expected     string
+	}{
+		{"valid", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": 1000.0}}, ""},
+		{"minimum", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": 0.0}}, ""},
+		{"maximum", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": 10000.0}}, ""},
+		{"below minimum", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": -1.0}},
+			"entitlements.limits.api: expected number ≥ 0, got -1"},
+		{"above maximum", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": 10000.5}},
+			"entitlements.limits.api: expected number ≤ 10000, got 10000.5"},
+		{"missing nested field", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{}},
+			"entitlements.limits.api: missing"},
+		{"missing field", map[string]interface{}{"limits": map[string]interface{}{"api": 1.0}},
+			"entitlements.tier: missing"},
+		{"wrong nested type", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": "1000"}},
+			"entitlements.limits.api: expected number, got string"},
+		{"wrong type", "gold", "entitlements: expected object, got string"},
+		{"wrong array item", map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": 1.0},
+			"regions": []interface{}{"us", 1.0}}, "entitlements.regions[1]: expected string, got number"},
+		{"missing claim", nil, "entitlements: missing"},
+	}
+
+	for _, test := range tests {
+		claims := map[string]interface{}{}
+		if test.entitlements != nil {
+			claims["entitlements"] = test.entitlements
+		}
+
+		err := jv.validateClaimRequirements(claims)
+		if test.expected == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+		if test.expected != "" && (err == nil || err.Error() != test.expected) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func Test_struct_claim_requirements_are_depth_limited(t *testing.T) {
+	requirement := StructClaimRequirement{Type: TypeObject}
+	value := map[string]interface{}{}
+	for i := 0; i < maxRequirementDepth+1; i++ {
+		requirement = StructClaimRequirement{Fields: map[string]StructClaimRequirement{"a": requirement}}
+		value = map[string]interface{}{"a": value}
+	}
+
+	jvs := JwtVerifier{
+		Issuer:            "https://golang.oktapreview.com",
+		ClaimRequirements: map[string]StructClaimRequirement{"deep": requirement},
+	}
+
+	err := jvs.New().validateClaimRequirements(map[string]interface{}{"deep": value})
+	if err == nil || !strings.Contains(err.Error(), "levels deep") {
+		t.Errorf("expected a depth error, got %v", err)
+	}
+}
+
+func Test_struct_claim_requirements_are_checked_during_verification(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jvs := JwtVerifier{
+		Issuer:            issuer.URL,
+		ClaimsToValidate:  map[string]string{"aud": "api://default"},
+		ClaimRequirements: map[string]StructClaimRequirement{"entitlements": entitlements},
+	}
+
+	jv := jvs.New()
+
+	claims := issuer.Claims("api://default")
+	claims["entitlements"] = map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": 1000}}
+	if _, err := jv.VerifyAccessToken(issuer.Sign(claims)); err != nil {
+		t.Errorf("could not verify access_token: %s", err)
+	}
+
+	claims["entitlements"] = map[string]interface{}{"tier": "gold", "limits": map[string]interface{}{"api": -5}}
+	_, err := jv.VerifyIdToken(issuer.Sign(claims))
+	if err == nil || !strings.Contains(err.Error(), "entitlements.limits.api: expected number ≥ 0") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
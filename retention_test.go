@@ -0,0 +1,108 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+// retains reports whether v, or anything reachable from it, holds a string
+// or byte slice containing s.
+func retains(v reflect.Value, s string, seen map[uintptr]bool) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.Contains(v.String(), s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return bytes.Contains(v.Bytes(), []byte(s))
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if retains(v.Index(i), s, seen) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if retains(iter.Key(), s, seen) || retains(iter.Value(), s, seen) {
+				return true
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return false
+		}
+		seen[v.Pointer()] = true
+		return retains(v.Elem(), s, seen)
+	case reflect.Interface:
+		return !v.IsNil() && retains(v.Elem(), s, seen)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if retains(v.Field(i), s, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func Test_verifiers_do_not_retain_raw_tokens(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithTokenCache(10, time.Minute),
+		WithHooks(Hooks{
+			OnNearExpiry:   func(NearExpiryEvent) {},
+			OnVerification: func(VerificationEvent) {},
+			Async:          true,
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+	jv.NearExpiryThreshold = time.Minute
+
+	token := nearExpiryToken(issuer)
+	signature := token[strings.LastIndex(token, ".")+1:]
+
+	// The second verification is answered from the token cache.
+	for i := 0; i < 2; i++ {
+		jwt, err := jv.VerifyAccessToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if retains(reflect.ValueOf(jwt), signature, map[uintptr]bool{}) {
+			t.Errorf("the verified token retains the raw token")
+		}
+	}
+
+	if retains(reflect.ValueOf(jv), signature, map[uintptr]bool{}) {
+		t.Errorf("the verifier retains the raw token")
+	}
+}
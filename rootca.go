@@ -0,0 +1,112 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"sync"
+
+	"github.com/okta/okta-jwt-verifier-golang/logger"
+)
+
+// RootCAProvider returns the root CAs to trust for connections to the
+// issuer. See WithRootCAProvider.
+type RootCAProvider func() (*x509.CertPool, error)
+
+// rootCATransport makes each request over a copy of base that trusts the
+// pool its provider returns at the time. The copy is only replaced when the
+// pool changes, so connections are reused until then.
+type rootCATransport struct {
+	base     *http.Transport
+	provider RootCAProvider
+	log      logger.Logger
+
+	mu        sync.Mutex
+	pool      *x509.CertPool
+	transport *http.Transport
+}
+
+// rootCAClient returns a copy of client, which defaults to one using
+// http.DefaultTransport, that trusts the root CAs provider returns for
+// each request, instead of a pool fixed when the client was made. It
+// returns false if the client's transport is not an *http.Transport.
+func rootCAClient(client *http.Client, provider RootCAProvider, log logger.Logger) (*http.Client, bool) {
+	c := &http.Client{}
+	if client != nil {
+		*c = *client
+	}
+
+	var base *http.Transport
+	switch t := c.Transport.(type) {
+	case nil:
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		base = t.Clone()
+	default:
+		return nil, false
+	}
+
+	// Until the provider first succeeds, the transport's own roots are
+	// trusted.
+	t := &rootCATransport{base: base, provider: provider, log: log, transport: base}
+	if base.TLSClientConfig != nil {
+		t.pool = base.TLSClientConfig.RootCAs
+	}
+	c.Transport = t
+	return c, true
+}
+
+func (t *rootCATransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current().RoundTrip(req)
+}
+
+// CloseIdleConnections is called by http.Client.CloseIdleConnections.
+func (t *rootCATransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transport.CloseIdleConnections()
+}
+
+// current returns the transport trusting the provider's pool. If the
+// provider fails, the transport in use is kept.
+func (t *rootCATransport) current() *http.Transport {
+	pool, err := t.provider()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.log.Warn("could not load the root CAs, keeping the previous ones", "error", err.Error())
+		return t.transport
+	}
+	if pool.Equal(t.pool) {
+		return t.transport
+	}
+
+	transport := t.base.Clone()
+	config := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		config = transport.TLSClientConfig.Clone()
+	}
+	config.RootCAs = pool
+	transport.TLSClientConfig = config
+
+	t.transport.CloseIdleConnections()
+	t.pool, t.transport = pool, transport
+	return transport
+}
@@ -0,0 +1,99 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_root_cas_can_change_without_a_restart(t *testing.T) {
+	issuer := testissuer.NewTLS()
+	defer issuer.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(issuer.Server.Certificate())
+
+	var mu sync.Mutex
+	pool, failure := x509.NewCertPool(), error(nil)
+	provider := func() (*x509.CertPool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return pool, failure
+	}
+
+	log := &recordingLogger{}
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithRootCAProvider(provider),
+		WithLogger(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := jv.Prime(context.Background()); err == nil {
+		t.Fatal("the issuer was trusted before its CA was provided")
+	}
+
+	mu.Lock()
+	pool = trusted
+	mu.Unlock()
+	if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+		t.Fatalf("the issuer was not trusted after its CA was provided: %s", err)
+	}
+
+	mu.Lock()
+	failure = fmt.Errorf("the CA file is being rewritten")
+	mu.Unlock()
+	jv.httpClient.CloseIdleConnections()
+	resp, err := jv.httpClient.Get(issuer.URL + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatalf("the previous CAs were not kept when the provider failed: %s", err)
+	}
+	resp.Body.Close()
+	if !log.contains("could not load the root CAs") {
+		t.Errorf("the provider's failure was not logged: %v", log.events)
+	}
+}
+
+func Test_root_ca_provider_checks_the_server_name(t *testing.T) {
+	issuer := testissuer.NewTLS()
+	defer issuer.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(issuer.Server.Certificate())
+
+	// The test server's certificate is for 127.0.0.1 and example.com.
+	other := strings.Replace(issuer.URL, "127.0.0.1", "localhost", 1)
+	jv, err := NewVerifier(other,
+		WithCache(cache.NewMemory()),
+		WithRootCAProvider(func() (*x509.CertPool, error) { return trusted, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jv.Prime(context.Background()); err == nil {
+		t.Errorf("a certificate for another name was accepted")
+	}
+}
@@ -0,0 +1,198 @@
+//go:build integration
+// +build integration
+
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+package jwtverifier_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+// The scenario runs the middleware, a verifier with a background refresh and
+// an in-process issuer through a key rotation and an outage. It takes over
+// ten seconds and is only built with the integration tag:
+//
+//     go test -tags integration -run Test_scenario .
+
+const (
+	scenarioRefresh  = 100 * time.Millisecond
+	scenarioCacheTTL = time.Second
+	scenarioOutage   = 10 * time.Second
+)
+
+// shortLivedCache caps the lifetime of every entry, so that cached documents
+// expire during the outage unless the background refresh extends them.
+type shortLivedCache struct {
+	cache.Cache
+	maxTTL time.Duration
+}
+
+func (c shortLivedCache) Set(key string, value []byte, ttl time.Duration) {
+	if ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	c.Cache.Set(key, value, ttl)
+}
+
+type scenario struct {
+	t        *testing.T
+	issuer   *testissuer.Issuer
+	verifier *jwtverifier.JwtVerifier
+	server   *httptest.Server
+
+	mu       sync.Mutex
+	verified uint64
+	rejected uint64
+}
+
+// request sends token to the protected endpoint and checks the status.
+func (s *scenario) request(phase string, token string, status int) {
+	s.t.Helper()
+	req, _ := http.NewRequest("GET", s.server.URL+"/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	got, body := get(s.t, req)
+	if got != status {
+		s.t.Fatalf("%s: expected status %d, got %d: %s", phase, status, got, body)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == http.StatusOK {
+		s.verified++
+	} else {
+		s.rejected++
+	}
+}
+
+func (s *scenario) validToken() string {
+	return s.issuer.Sign(s.issuer.Claims("api://default"))
+}
+
+func (s *scenario) waitFor(what string, condition func(jwtverifier.Stats) bool) {
+	s.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition(s.verifier.Stats()) {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timed out waiting for %s, stats: %+v", what, s.verifier.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_scenario_rotation_and_outage(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	// Boot.
+	jv, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(shortLivedCache{Cache: cache.NewMemory(), maxTTL: scenarioCacheTTL}),
+		jwtverifier.WithBackgroundRefresh(scenarioRefresh))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	server := httptest.NewServer(jwtverifier.Middleware(jv)(http.HandlerFunc(subjectHandler)))
+	defer server.Close()
+
+	s := &scenario{t: t, issuer: issuer, verifier: jv, server: server}
+
+	// Warm up: the background refresh fetches before the first request.
+	s.waitFor("the first refresh", func(stats jwtverifier.Stats) bool {
+		return stats.Refreshes >= 1
+	})
+	if issuer.JWKSRequests() == 0 {
+		t.Fatalf("warmup did not fetch the key set")
+	}
+
+	// Serve authenticated traffic, and reject a forged token.
+	for n := 0; n < 20; n++ {
+		s.request("serving", s.validToken(), http.StatusOK)
+	}
+	forged := s.validToken()
+	forged = forged[:len(forged)-4] + "AAAA"
+	s.request("serving", forged, http.StatusUnauthorized)
+
+	// Rotate: tokens from the new key verify, and so do those from the old
+	// key, which is still published.
+	oldKeyToken := s.validToken()
+	issuer.Rotate()
+	for n := 0; n < 20; n++ {
+		s.request("rotation", s.validToken(), http.StatusOK)
+	}
+	s.request("rotation", oldKeyToken, http.StatusOK)
+
+	before := jv.Stats()
+	if before.RefreshFailures != 0 {
+		t.Fatalf("refreshes failed before the outage: %+v", before)
+	}
+
+	// Outage: the cached documents outlive their lifetime because the
+	// failing refreshes keep extending them, so traffic keeps flowing.
+	issuer.SetUnavailable(true)
+	outageEnds := time.Now().Add(scenarioOutage)
+	for time.Now().Before(outageEnds) {
+		s.request("outage", s.validToken(), http.StatusOK)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// A refresh in flight when the outage started may still have succeeded.
+	// Failing refreshes retry, so they take longer than the interval.
+	during := jv.Stats()
+	if during.Refreshes > before.Refreshes+1 {
+		t.Errorf("refreshes succeeded during the outage: %+v", during)
+	}
+	if minimum := uint64(scenarioOutage / time.Second); during.RefreshFailures < minimum {
+		t.Errorf("expected at least %d failed refreshes during the outage, got %d", minimum, during.RefreshFailures)
+	}
+
+	// Recover: the next refresh succeeds, and a key published after the
+	// outage is picked up by the refresh after that. Fetches for unknown
+	// kids are rate limited, and the first rotation used one.
+	issuer.SetUnavailable(false)
+	recovered := time.Now()
+	s.waitFor("a refresh after the outage", func(stats jwtverifier.Stats) bool {
+		return stats.LastRefresh.After(recovered)
+	})
+	issuer.Rotate()
+	rotated := time.Now()
+	s.waitFor("a refresh after the rotation", func(stats jwtverifier.Stats) bool {
+		return stats.LastRefresh.After(rotated)
+	})
+	for n := 0; n < 20; n++ {
+		s.request("recovery", s.validToken(), http.StatusOK)
+	}
+
+	after := jv.Stats()
+	if after.Verified != s.verified || after.Rejected != s.rejected {
+		t.Errorf("expected %d verified and %d rejected, stats: %+v", s.verified, s.rejected, after)
+	}
+	// A refresh in flight when the outage ended may still have failed.
+	if after.RefreshFailures > during.RefreshFailures+1 {
+		t.Errorf("refreshes kept failing after the outage: %d then %d", during.RefreshFailures, after.RefreshFailures)
+	}
+}
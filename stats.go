@@ -0,0 +1,236 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/circuit"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+// Stats are counts of a verifier's work since it was created.
+type Stats struct {
+	// Verified and Rejected count the tokens passed to VerifyAccessToken,
+	// VerifyIdToken, VerifyDegraded, EvaluatePolicies and
+	// VerifyWithAttestation that were accepted and rejected. Tokens
+	// VerifyDegraded returns unverified are counted as rejected, and also
+	// as Degraded.
+	Verified uint64
+	Rejected uint64
+	Degraded uint64
+
+	// NotIssuedBefore is the horizon set by SetNotIssuedBefore, or the
+	// zero time, and PredatedHorizon counts the rejected tokens that were
+	// issued before it.
+	NotIssuedBefore time.Time
+	PredatedHorizon uint64
+
+	// NearExpiry counts the tokens verified with less of their lifetime
+	// left than NearExpiryThreshold, for which OnNearExpiry is called.
+	NearExpiry uint64
+
+	// LeewayMasked counts the verified tokens that were accepted only
+	// thanks to the leeway: their exp had passed. Divided by Verified, it
+	// is the fraction of tokens a clock problem, ours or the issuer's,
+	// would otherwise have rejected. With LeewayWarningRate set,
+	// LeewayMaskedRate is that fraction over the LeewayWarningWindow
+	// ending now.
+	LeewayMasked     uint64
+	LeewayMaskedRate float64
+
+	// SecondaryKeySetVerifications counts the tokens verified with a key
+	// from one of SecondaryKeySets, for which OnSecondaryKeySet is called.
+	SecondaryKeySetVerifications uint64
+
+	// DocumentBytes is the size of the discovery documents and, with the
+	// default adaptor, key sets the verifier stored in its Cache, and TokenCacheEntries and
+	// TokenCacheBytes the number and size of the tokens in the token cache:
+	// what MaxCacheBytes bounds. TokenCacheEvictions counts the cached
+	// tokens evicted to stay within MaxCacheBytes.
+	DocumentBytes       uint64
+	TokenCacheEntries   uint64
+	TokenCacheBytes     uint64
+	TokenCacheEvictions uint64
+
+	// Refreshes counts the background refreshes that fetched both the
+	// discovery document and the key set, and RefreshFailures those that
+	// failed to fetch either. Refreshes skipped because another process
+	// held the coordinator's lock are not counted.
+	Refreshes       uint64
+	RefreshFailures uint64
+
+	// KeySetChanges and KeySetChangesVetoed count the key set changes
+	// OnKeySetChange accepted and vetoed. A change vetoed repeatedly is
+	// counted each time it is proposed.
+	KeySetChanges       uint64
+	KeySetChangesVetoed uint64
+
+	// LastRefresh is when a background refresh last succeeded, or the zero
+	// time.
+	LastRefresh time.Time
+
+	// CircuitState is the state of the CircuitBreaker, or empty without
+	// one, and CircuitOpens counts the times it opened.
+	CircuitState circuit.State
+	CircuitOpens uint64
+}
+
+type verifierStats struct {
+	mu     sync.Mutex
+	stats  Stats
+	leeway leewayWindow
+}
+
+// Stats returns a snapshot of the verifier's counts.
+func (j *JwtVerifier) Stats() Stats {
+	j.stats.mu.Lock()
+	stats := j.stats.stats
+	if j.LeewayWarningRate > 0 {
+		stats.LeewayMaskedRate, _ = j.stats.leeway.rate(j.now(), j.leewayWindow())
+	}
+	j.stats.mu.Unlock()
+
+	stats.NotIssuedBefore = j.NotIssuedBefore()
+	if j.documentCache != nil {
+		stats.DocumentBytes = uint64(j.documentCache.bytes())
+	}
+	if j.tokens != nil {
+		entries, bytes := j.tokens.usage()
+		stats.TokenCacheEntries, stats.TokenCacheBytes = uint64(entries), uint64(bytes)
+	}
+	if j.CircuitBreaker != nil {
+		stats.CircuitState = j.CircuitBreaker.State()
+	}
+	return stats
+}
+
+func (j *JwtVerifier) recordVerification(err error) {
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	if err == nil {
+		j.stats.stats.Verified++
+		return
+	}
+	j.stats.stats.Rejected++
+
+	var predates *errors.TokenPredatesHorizon
+	if goerrors.As(err, &predates) {
+		j.stats.stats.PredatedHorizon++
+	}
+}
+
+func (j *JwtVerifier) recordDegraded() {
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	j.stats.stats.Degraded++
+}
+
+func (j *JwtVerifier) recordNearExpiry() {
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	j.stats.stats.NearExpiry++
+}
+
+func (j *JwtVerifier) recordSecondaryKeySet() {
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	j.stats.stats.SecondaryKeySetVerifications++
+}
+
+func (j *JwtVerifier) recordTokenCacheEvictions(n uint64) {
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	j.stats.stats.TokenCacheEvictions += n
+}
+
+func (j *JwtVerifier) recordRefresh(ok bool) {
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	if ok {
+		j.stats.stats.Refreshes++
+		j.stats.stats.LastRefresh = j.now()
+	} else {
+		j.stats.stats.RefreshFailures++
+	}
+}
+
+func (j *JwtVerifier) recordCircuitOpen() {
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	j.stats.stats.CircuitOpens++
+}
+
+func (j *JwtVerifier) approveKeySetChange(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool {
+	accept := j.OnKeySetChange(old, new)
+	j.stats.mu.Lock()
+	defer j.stats.mu.Unlock()
+	if accept {
+		j.stats.stats.KeySetChanges++
+	} else {
+		j.stats.stats.KeySetChangesVetoed++
+	}
+	return accept
+}
+
+// KeySetInfo describes the key set tokens are verified with: each key's
+// size and the average time verifying a signature with it has taken, so
+// that the cost of a move to larger keys shows up before it is felt. It
+// needs an adaptor that implements adaptors.KeySetInspector, such as the
+// default one, and fails if the key set has not been loaded yet; call
+// Prime first. It may fetch the discovery document.
+func (j *JwtVerifier) KeySetInfo(ctx context.Context) (adaptors.KeySetInfo, error) {
+	inspector, ok := j.Adaptor.(adaptors.KeySetInspector)
+	if !ok {
+		return adaptors.KeySetInfo{}, fmt.Errorf("the adaptor cannot describe its key set")
+	}
+
+	jwksUri, err := j.jwksUri(ctx)
+	if err != nil {
+		return adaptors.KeySetInfo{}, err
+	}
+
+	info, ok := inspector.KeySetInfo(jwksUri)
+	if !ok {
+		return adaptors.KeySetInfo{}, fmt.Errorf("the key set at %s has not been loaded", jwksUri)
+	}
+	return info, nil
+}
+
+// SecondaryKeySetInfo describes, in order, each of SecondaryKeySets that
+// has been loaded, as KeySetInfo describes the issuer's: the Verifications
+// of their keys show whether tokens are still verified with them during a
+// migration. Key sets not loaded yet are left out; it never fetches them.
+func (j *JwtVerifier) SecondaryKeySetInfo() ([]adaptors.KeySetInfo, error) {
+	inspector, ok := j.Adaptor.(adaptors.KeySetInspector)
+	if !ok {
+		return nil, fmt.Errorf("the adaptor cannot describe its key sets")
+	}
+
+	var infos []adaptors.KeySetInfo
+	for _, source := range j.SecondaryKeySets {
+		if info, ok := inspector.KeySetInfo(source.JWKSURI); ok {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
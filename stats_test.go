@@ -0,0 +1,165 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/adaptors/lestrratGoJwx"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_stats_count_verifications(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default")))
+	jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://other")))
+	jv.VerifyIdToken("not a token")
+
+	stats := jv.Stats()
+	if stats.Verified != 1 || stats.Rejected != 2 {
+		t.Errorf("expected 1 verified and 2 rejected, got %+v", stats)
+	}
+	if stats.Refreshes != 0 || !stats.LastRefresh.IsZero() {
+		t.Errorf("counted refreshes without a background refresh: %+v", stats)
+	}
+}
+
+func Test_stats_count_background_refreshes(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithRetry(1, time.Millisecond),
+		WithBackgroundRefresh(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	waitFor(t, "a refresh", func() bool { return jv.Stats().Refreshes > 0 })
+	if jv.Stats().LastRefresh.IsZero() {
+		t.Errorf("LastRefresh was not set")
+	}
+
+	issuer.SetUnavailable(true)
+	waitFor(t, "failed refreshes", func() bool { return jv.Stats().RefreshFailures >= 2 })
+
+	issuer.SetUnavailable(false)
+	refreshes := jv.Stats().Refreshes
+	waitFor(t, "a refresh after the outage", func() bool { return jv.Stats().Refreshes > refreshes })
+
+	issuer.SetJWKSUnavailable(true)
+	failures := jv.Stats().RefreshFailures
+	waitFor(t, "a failed key set refresh", func() bool { return jv.Stats().RefreshFailures > failures })
+}
+
+func Test_stats_count_key_set_change_decisions(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var accept int32
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithBackgroundRefresh(10*time.Millisecond),
+		WithKeySetChangeHook(func(old adaptors.KeySetInfo, new adaptors.KeySetInfo) bool {
+			return atomic.LoadInt32(&accept) == 1
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	waitFor(t, "a refresh", func() bool { return jv.Stats().Refreshes > 0 })
+
+	issuer.Rotate()
+	rotated := issuer.Sign(issuer.Claims("api://default"))
+	waitFor(t, "a vetoed change", func() bool { return jv.Stats().KeySetChangesVetoed > 0 })
+	if _, err := jv.VerifyAccessToken(rotated); err == nil {
+		t.Errorf("expected a token signed with a vetoed key to be rejected")
+	}
+
+	atomic.StoreInt32(&accept, 1)
+	waitFor(t, "an accepted change", func() bool { return jv.Stats().KeySetChanges > 0 })
+	if _, err := jv.VerifyAccessToken(rotated); err != nil {
+		t.Errorf("expected the rotated key to be used once the change was accepted: %s", err)
+	}
+}
+
+func Test_key_set_change_hook_requires_the_default_adaptor(t *testing.T) {
+	_, err := NewVerifier("https://golang.oktapreview.com",
+		WithAdaptor(lestrratGoJwx.LestrratGoJwx{}.New()),
+		WithKeySetChangeHook(func(adaptors.KeySetInfo, adaptors.KeySetInfo) bool { return true }))
+	if err == nil {
+		t.Errorf("expected WithKeySetChangeHook to be rejected with a custom adaptor")
+	}
+}
+
+func Test_key_set_info_reports_key_sizes_and_verification_cost(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jv.KeySetInfo(context.Background()); err == nil {
+		t.Errorf("expected an error before the key set was loaded")
+	}
+
+	issuer.RotateToSize("large", 4096)
+	for i := 0; i < 3; i++ {
+		if _, err := jv.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := jv.KeySetInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %+v", info.Keys)
+	}
+
+	small, large := info.Keys[0], info.Keys[1]
+	if small.Size != 2048 || small.Type != "RSA" || small.Verifications != 0 {
+		t.Errorf("unexpected info for the unused 2048-bit key: %+v", small)
+	}
+	if large.KeyID != "large" || large.Size != 4096 || large.Verifications != 3 || large.AverageVerifyDuration <= 0 {
+		t.Errorf("unexpected info for the 4096-bit key: %+v", large)
+	}
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import "sort"
+
+// Strictness decides whether a failed check of a claim fails the
+// verification. See JwtVerifier.ClaimStrictness.
+type Strictness int
+
+const (
+	// Required fails the verification when a check of the claim fails. It
+	// is the default.
+	Required Strictness = iota
+
+	// Advisory records a failed check of the claim and accepts the token,
+	// e.g. while rolling out a new ClaimValidator.
+	Advisory
+)
+
+func (s Strictness) String() string {
+	if s == Advisory {
+		return "advisory"
+	}
+	return "required"
+}
+
+// AdvisoryFailure is a failed check of a claim marked Advisory.
+type AdvisoryFailure struct {
+	Claim string
+	Err   error
+}
+
+// advisoryClaims returns the claims marked Advisory, in name order.
+func (j *JwtVerifier) advisoryClaims() []string {
+	var names []string
+	for name, strictness := range j.ClaimStrictness {
+		if strictness == Advisory {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checksClaim reports whether the verifier has a check that ClaimStrictness
+// applies to for claim.
+func (j *JwtVerifier) checksClaim(claim string) bool {
+	_, typed := j.TypedClaimsToValidate[claim]
+	_, validated := j.ClaimValidators[claim]
+	_, required := j.ClaimRequirements[claim]
+	return typed || validated || required
+}
+
+// advisoryFailures runs the checks of the claims marked Advisory, and
+// returns those that failed in name order. Each failure is logged, so that
+// it is never silently dropped.
+func (j *JwtVerifier) advisoryFailures(claims map[string]interface{}, facts Facts) []AdvisoryFailure {
+	var failures []AdvisoryFailure
+	for _, name := range j.advisoryClaims() {
+		if err := j.checkClaim(name, claims, facts); err != nil {
+			j.log().Warn("advisory claim check failed", "claim", name, "error", err.Error())
+			failures = append(failures, AdvisoryFailure{Claim: name, Err: err})
+		}
+	}
+	return failures
+}
+
+// checkClaim runs the ClaimRequirements, TypedClaimsToValidate and
+// ClaimValidators checks of claim, and returns the first failure.
+func (j *JwtVerifier) checkClaim(name string, claims map[string]interface{}, facts Facts) error {
+	if requirement, ok := j.ClaimRequirements[name]; ok {
+		if err := validateClaimRequirement(name, requirement, claims); err != nil {
+			return err
+		}
+	}
+	if expected, ok := j.TypedClaimsToValidate[name]; ok {
+		if err := validateClaimValue(name, expected, claims); err != nil {
+			return err
+		}
+	}
+	if validator, ok := j.ClaimValidators[name]; ok {
+		return runClaimValidator(name, validator, claims, facts)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func advisoryVerifier(t *testing.T, issuer *testissuer.Issuer, events *[]VerificationEvent) *JwtVerifier {
+	var mu sync.Mutex
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTypedClaimToValidate("tenant_id", "acme"),
+		WithTypedClaimToValidate("tenant_region", "eu"),
+		WithClaimValidator("network_zone", internalZoneOnly),
+		WithAdvisoryClaim("network_zone", "tenant_region"),
+		WithHooks(Hooks{OnVerification: func(e VerificationEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			*events = append(*events, e)
+		}}),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jv
+}
+
+func Test_advisory_failures_are_recorded_without_failing_the_token(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var events []VerificationEvent
+	jv := advisoryVerifier(t, issuer, &events)
+
+	// The required tenant_id passes; the advisory network_zone fails for
+	// lack of a source IP, and tenant_region is missing.
+	claims := issuer.Claims("api://default")
+	claims["tenant_id"] = "acme"
+	claims["network_zone"] = "internal"
+
+	result, err := jv.VerifyAccessTokenDetailed(context.Background(), issuer.Sign(claims))
+	if err != nil {
+		t.Fatalf("an advisory failure failed the token: %s", err)
+	}
+
+	failures := result.Token.Info.AdvisoryFailures
+	if len(failures) != 2 || failures[0].Claim != "network_zone" || failures[1].Claim != "tenant_region" ||
+		!strings.Contains(failures[1].Err.Error(), "tenant_region: missing") {
+		t.Errorf("unexpected advisory failures %v", failures)
+	}
+	if !result.HasWarning(WarningAdvisoryFailure) {
+		t.Errorf("expected advisory warnings, got %v", result.Warnings)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0].AdvisoryFailures, []string{"network_zone", "tenant_region"}) {
+		t.Errorf("expected the hook to see the advisory failures, got %+v", events)
+	}
+
+	claims["tenant_region"] = "eu"
+	token, err := jv.VerifyAccessTokenContext(context.Background(), issuer.Sign(claims),
+		WithFact(FactSourceIP, net.ParseIP("10.1.2.3")))
+	if err != nil || len(token.Info.AdvisoryFailures) != 0 {
+		t.Errorf("expected no advisory failures, got %v, %v", token, err)
+	}
+}
+
+func Test_required_failures_fail_alongside_passing_advisories(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var events []VerificationEvent
+	jv := advisoryVerifier(t, issuer, &events)
+
+	claims := issuer.Claims("api://default")
+	claims["tenant_id"] = "other"
+	claims["tenant_region"] = "eu"
+
+	_, err := jv.VerifyIdToken(issuer.Sign(claims))
+	if err == nil || !strings.Contains(err.Error(), "tenant_id") {
+		t.Fatalf("expected the required tenant_id to fail, got %v", err)
+	}
+	if len(events) != 1 || events[0].Success || len(events[0].AdvisoryFailures) != 0 {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func Test_advisory_claims_need_a_check(t *testing.T) {
+	_, err := NewVerifier("https://golang.oktapreview.com",
+		WithTypedClaimToValidate("tenant_id", "acme"),
+		WithAdvisoryClaim("tenant"))
+	if err == nil || !strings.Contains(err.Error(), `advisory claim "tenant" has no`) {
+		t.Errorf("expected an error for an advisory claim without a check, got %v", err)
+	}
+}
+
+func Test_advisory_claim_requirements_are_recorded(t *testing.T) {
+	jvs := JwtVerifier{
+		Issuer: "https://golang.oktapreview.com",
+		ClaimRequirements: map[string]StructClaimRequirement{
+			"entitlements": {Type: TypeObject, Required: true},
+		},
+		ClaimStrictness: map[string]Strictness{"entitlements": Advisory},
+	}
+	jv := jvs.New()
+
+	claims := map[string]interface{}{}
+	if err := jv.validateClaimRequirements(claims); err != nil {
+		t.Errorf("an advisory requirement failed the claims: %s", err)
+	}
+	failures := jv.advisoryFailures(claims, nil)
+	if len(failures) != 1 || failures[0].Err.Error() != "entitlements: missing" {
+		t.Errorf("unexpected advisory failures %v", failures)
+	}
+}
@@ -0,0 +1,150 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// DefaultTokenCacheTTL is how long a verified token's result is reused when
+// TokenCacheSize is set and TokenCacheTTL is zero.
+const DefaultTokenCacheTTL = 5 * time.Minute
+
+// tokenCache holds the results of successful signature verifications, so
+// that a token verified again is not checked again. When it is full, or
+// over its byte budget, the least recently used results are evicted.
+type tokenCache struct {
+	mu   sync.Mutex
+	size int
+
+	// bytes is the sum of the sizes of the cached results.
+	bytes int64
+
+	// order has the most recently used result at the front.
+	order   *list.List
+	results map[[sha256.Size]byte]*list.Element
+}
+
+type cachedToken struct {
+	key     [sha256.Size]byte
+	claims  interface{}
+	source  *KeySource
+	expires time.Time
+	size    int64
+}
+
+// newTokenCache returns a cache of size results, or nil if size is not
+// positive.
+func newTokenCache(size int) *tokenCache {
+	if size <= 0 {
+		return nil
+	}
+	return &tokenCache{
+		size:    size,
+		order:   list.New(),
+		results: map[[sha256.Size]byte]*list.Element{},
+	}
+}
+
+// get returns a copy of the claims cached for key, and the key set they
+// were verified with, unless the result has expired.
+func (c *tokenCache) get(key [sha256.Size]byte, now time.Time) (interface{}, *KeySource, bool) {
+	c.mu.Lock()
+	elem, ok := c.results[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, nil, false
+	}
+	cached := elem.Value.(*cachedToken)
+	if !now.Before(cached.expires) {
+		c.remove(elem)
+		c.mu.Unlock()
+		return nil, nil, false
+	}
+	c.order.MoveToFront(elem)
+	c.mu.Unlock()
+
+	// Cached claims are never modified, so they can be copied unlocked.
+	return copyClaims(cached.claims), cached.source, true
+}
+
+// put caches a copy of claims, taking size bytes, until expires. If budget
+// is not negative, the least recently used results are evicted until the
+// cache holds at most budget bytes, and a result larger than budget is not
+// cached; put returns how many results it evicted for the budget.
+func (c *tokenCache) put(key [sha256.Size]byte, claims interface{}, source *KeySource, now time.Time, expires time.Time, size int64, budget int64) uint64 {
+	if !now.Before(expires) || budget >= 0 && size > budget {
+		return 0
+	}
+	cached := &cachedToken{key: key, claims: copyClaims(claims), source: source, expires: expires, size: size}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.results[key]; ok {
+		c.remove(elem)
+	}
+	if c.order.Len() >= c.size {
+		c.remove(c.order.Back())
+	}
+	var evicted uint64
+	for budget >= 0 && c.bytes+size > budget {
+		c.remove(c.order.Back())
+		evicted++
+	}
+	c.results[key] = c.order.PushFront(cached)
+	c.bytes += size
+	return evicted
+}
+
+// remove drops a cached result. c.mu must be held.
+func (c *tokenCache) remove(elem *list.Element) {
+	cached := c.order.Remove(elem).(*cachedToken)
+	delete(c.results, cached.key)
+	c.bytes -= cached.size
+}
+
+// usage returns how many results the cache holds and their size.
+func (c *tokenCache) usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.bytes
+}
+
+// tokenCacheExpiry is when the cached result for a token with claims must
+// be discarded: after TokenCacheTTL, but never past the token's exp.
+func (j *JwtVerifier) tokenCacheExpiry(claims map[string]interface{}) time.Time {
+	expires := j.now().Add(j.tokenCacheTTL())
+	if exp, err := (&Jwt{Claims: claims}).Expiry(); err == nil && exp.Before(expires) {
+		expires = exp
+	}
+	return expires
+}
+
+// tokenCacheTTL returns TokenCacheTTL or its default, or 0 when the cache
+// is disabled.
+func (j *JwtVerifier) tokenCacheTTL() time.Duration {
+	if j.TokenCacheSize <= 0 {
+		return 0
+	}
+	if j.TokenCacheTTL <= 0 {
+		return DefaultTokenCacheTTL
+	}
+	return j.TokenCacheTTL
+}
@@ -0,0 +1,317 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+// tokenCacheVerifier returns a verifier whose signature checks are counted
+// in calls, with the given options.
+func tokenCacheVerifier(t *testing.T, issuer *testissuer.Issuer, calls *int32, opts ...Option) *JwtVerifier {
+	t.Helper()
+	release := make(chan struct{})
+	close(release)
+	claims := issuer.Claims("api://default")
+	claims["exp"] = float64(time.Now().Add(time.Hour).Unix())
+	claims["iat"] = float64(time.Now().Unix())
+	adaptor := countingAdaptor{calls: calls, release: release, claims: claims}
+
+	opts = append([]Option{
+		WithClaimToValidate("aud", "api://default"),
+		WithAdaptor(adaptor),
+		WithCache(cache.NewMemory()),
+	}, opts...)
+	jv, err := NewVerifier(issuer.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jv
+}
+
+func Test_token_cache_skips_the_signature_check(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var calls int32
+	jv := tokenCacheVerifier(t, issuer, &calls, WithTokenCache(10, time.Minute))
+	defer jv.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	for i := 0; i < 3; i++ {
+		if _, err := jv.VerifyAccessToken(token); err != nil {
+			t.Fatalf("could not verify the access_token: %s", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected one signature check, got %d", calls)
+	}
+
+	// Claims are checked on every verification, and each caller gets its
+	// own copy of them.
+	verified, err := jv.VerifyAccessToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified.Claims["sub"] = "someone else"
+	verified, err = jv.VerifyAccessToken(token)
+	if err != nil {
+		t.Fatalf("could not verify the cached token: %s", err)
+	}
+	if verified.Claims["sub"] != "user@example.com" {
+		t.Errorf("a caller's change to the claims was cached: %v", verified.Claims["sub"])
+	}
+
+	if _, err := jv.VerifyAccessTokenContext(context.Background(), token, WithExpectedClaim("sub", "someone else")); err == nil {
+		t.Errorf("expected the claims of a cached token to be checked")
+	}
+
+	other := issuer.Sign(issuer.Claims("api://other"))
+	if _, err := jv.VerifyAccessToken(other); err != nil {
+		t.Fatalf("could not verify another access_token: %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected another token to have its signature checked, got %d checks", calls)
+	}
+}
+
+func Test_token_cache_is_off_by_default(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	var calls int32
+	jv := tokenCacheVerifier(t, issuer, &calls)
+	defer jv.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	for i := 0; i < 3; i++ {
+		if _, err := jv.VerifyAccessToken(token); err != nil {
+			t.Fatalf("could not verify the access_token: %s", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected every verification to check the signature, got %d checks", calls)
+	}
+}
+
+func Test_cached_token_is_rejected_once_it_expires(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	token := issuer.Sign(claims)
+	now := time.Now()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTokenCache(10, 24*time.Hour),
+		WithClock(func() time.Time { return now }),
+		WithCache(cache.NewMemory()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify the access_token: %s", err)
+	}
+
+	// Past its exp and the leeway, but well within the cache TTL.
+	exp := time.Unix(claims["exp"].(int64), 0)
+	now = exp.Add(3 * time.Minute)
+
+	_, err = jv.VerifyAccessToken(token)
+	if reason := failureReason(err); reason != FailureExpired {
+		t.Errorf("expected the cached token to have expired, got %v", err)
+	}
+	if n := len(jv.tokens.results); n != 0 {
+		t.Errorf("expected the expired result to be dropped, %d are cached", n)
+	}
+}
+
+func Test_token_cache_ttl_limits_reuse(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	now := time.Now()
+	var calls int32
+	jv := tokenCacheVerifier(t, issuer, &calls,
+		WithTokenCache(10, 30*time.Second),
+		WithClock(func() time.Time { return now }))
+	defer jv.Close()
+
+	token := issuer.Sign(issuer.Claims("api://default"))
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify the access_token: %s", err)
+	}
+
+	now = now.Add(29 * time.Second)
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify the cached token: %s", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected the cached result within the TTL, got %d checks", calls)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := jv.VerifyAccessToken(token); err != nil {
+		t.Fatalf("could not verify the access_token: %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the signature to be checked again after the TTL, got %d checks", calls)
+	}
+}
+
+func Test_token_cache_evicts_the_least_recently_used_result(t *testing.T) {
+	c := newTokenCache(2)
+	now := time.Now()
+	expires := now.Add(time.Minute)
+
+	a := sha256.Sum256([]byte("a"))
+	b := sha256.Sum256([]byte("b"))
+	d := sha256.Sum256([]byte("d"))
+
+	c.put(a, map[string]interface{}{"sub": "a"}, nil, now, expires, 1, -1)
+	c.put(b, map[string]interface{}{"sub": "b"}, nil, now, expires, 1, -1)
+	if _, _, ok := c.get(a, now); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	c.put(d, map[string]interface{}{"sub": "d"}, nil, now, expires, 1, -1)
+
+	if _, _, ok := c.get(b, now); ok {
+		t.Errorf("expected b, the least recently used, to be evicted")
+	}
+	for name, key := range map[string][sha256.Size]byte{"a": a, "d": d} {
+		claims, _, ok := c.get(key, now)
+		if !ok || claims.(map[string]interface{})["sub"] != name {
+			t.Errorf("expected %s to be cached, got %v", name, claims)
+		}
+	}
+	if len(c.results) != 2 || c.order.Len() != 2 {
+		t.Errorf("expected 2 cached results, got %d and %d", len(c.results), c.order.Len())
+	}
+
+	if _, _, ok := c.get(a, expires); ok {
+		t.Errorf("expected an expired result to be a miss")
+	}
+	if _, ok := c.results[a]; ok {
+		t.Errorf("expected an expired result to be dropped")
+	}
+}
+
+func Test_token_cache_is_safe_for_concurrent_use(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithTokenCache(4, time.Minute),
+		WithCache(cache.NewMemory()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jv.Close()
+
+	tokens := make([]string, 8)
+	for i := range tokens {
+		claims := issuer.Claims("api://default")
+		claims["jti"] = i
+		tokens[i] = issuer.Sign(claims)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				token := tokens[(g+i)%len(tokens)]
+				if _, err := jv.VerifyAccessToken(token); err != nil {
+					t.Errorf("could not verify an access_token: %s", err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := jv.tokens.order.Len(); n > 4 {
+		t.Errorf("expected at most 4 cached results, got %d", n)
+	}
+}
+
+func Test_with_token_cache_validates_its_arguments(t *testing.T) {
+	for _, test := range []struct {
+		size int
+		ttl  time.Duration
+	}{
+		{0, time.Minute},
+		{-1, time.Minute},
+		{10, -time.Second},
+	} {
+		if _, err := NewVerifier("https://golang.oktapreview.com", WithTokenCache(test.size, test.ttl)); err == nil {
+			t.Errorf("expected WithTokenCache(%d, %s) to fail", test.size, test.ttl)
+		}
+	}
+
+	jv, err := NewVerifier("https://golang.oktapreview.com", WithTokenCache(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jv.tokenCacheTTL() != DefaultTokenCacheTTL {
+		t.Errorf("expected the default TTL, got %s", jv.tokenCacheTTL())
+	}
+}
+
+func Test_token_cache_evicts_to_stay_within_its_budget(t *testing.T) {
+	c := newTokenCache(10)
+	now := time.Now()
+	expires := now.Add(time.Minute)
+
+	a := sha256.Sum256([]byte("a"))
+	b := sha256.Sum256([]byte("b"))
+	d := sha256.Sum256([]byte("d"))
+	claims := map[string]interface{}{"sub": "user@example.com"}
+
+	c.put(a, claims, nil, now, expires, 40, 100)
+	c.put(b, claims, nil, now, expires, 40, 100)
+	if evicted := c.put(d, claims, nil, now, expires, 40, 100); evicted != 1 {
+		t.Errorf("expected 1 result to be evicted for the budget, got %d", evicted)
+	}
+	if _, _, ok := c.get(a, now); ok {
+		t.Errorf("expected a, the least recently used, to be evicted")
+	}
+	if entries, bytes := c.usage(); entries != 2 || bytes != 80 {
+		t.Errorf("expected 2 results of 80 bytes, got %d of %d", entries, bytes)
+	}
+
+	if evicted := c.put(a, claims, nil, now, expires, 200, 100); evicted != 0 {
+		t.Errorf("a result larger than the budget evicted %d others", evicted)
+	}
+	if _, _, ok := c.get(a, now); ok {
+		t.Errorf("a result larger than the budget was cached")
+	}
+}
@@ -0,0 +1,123 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_oversized_tokens_are_rejected_before_decoding(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jv.MaxTokenSize != DefaultMaxTokenSize {
+		t.Errorf("expected the default maximum size, got %d", jv.MaxTokenSize)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["padding"] = strings.Repeat("a", DefaultMaxTokenSize)
+	oversized := issuer.Sign(claims)
+
+	_, err = jv.VerifyAccessToken(oversized)
+	var tooLarge *errors.JwtTooLarge
+	if !goerrors.As(err, &tooLarge) || tooLarge.Size != len(oversized) || tooLarge.MaxSize != DefaultMaxTokenSize {
+		t.Fatalf("expected a JwtTooLarge error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "token exceeds maximum size") {
+		t.Errorf("unexpected message %q", err)
+	}
+	if failureReason(err) != FailureMalformed {
+		t.Errorf("expected a malformed failure, got %q", failureReason(err))
+	}
+
+	// Garbage is rejected for its size, not its contents.
+	if _, err := jv.VerifyIdToken(strings.Repeat("!", DefaultMaxTokenSize+1)); !goerrors.As(err, &tooLarge) {
+		t.Errorf("expected a JwtTooLarge error for an oversized non-token, got %v", err)
+	}
+
+	if issuer.MetadataRequests() != 0 || issuer.JWKSRequests() != 0 {
+		t.Errorf("oversized tokens caused %d discovery and %d key set requests",
+			issuer.MetadataRequests(), issuer.JWKSRequests())
+	}
+
+	unlimited, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()),
+		WithMaxTokenSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unlimited.VerifyAccessToken(oversized); err != nil {
+		t.Errorf("expected no limit with WithMaxTokenSize(0): %s", err)
+	}
+
+	if _, err := NewVerifier(issuer.URL, WithMaxTokenSize(-1)); err == nil {
+		t.Errorf("expected a negative maximum size to be rejected")
+	}
+}
+
+func Test_multi_verifier_rejects_tokens_larger_than_every_limit(t *testing.T) {
+	small := (&JwtVerifier{Issuer: "https://a.example.com", MaxTokenSize: 1024}).New()
+	large := (&JwtVerifier{Issuer: "https://b.example.com", MaxTokenSize: 4096}).New()
+	mv := NewMultiVerifier(small, large)
+
+	_, err := mv.VerifyAccessToken(strings.Repeat("a", 4097))
+	var tooLarge *errors.JwtTooLarge
+	if !goerrors.As(err, &tooLarge) || tooLarge.MaxSize != 4096 {
+		t.Errorf("expected a JwtTooLarge error with the largest limit, got %v", err)
+	}
+
+	unlimited := (&JwtVerifier{Issuer: "https://c.example.com"}).New()
+	_, err = NewMultiVerifier(small, unlimited).VerifyAccessToken(strings.Repeat("a", 4097))
+	if goerrors.As(err, &tooLarge) {
+		t.Errorf("expected no limit when a verifier has none, got %v", err)
+	}
+}
+
+// BenchmarkOversizedTokenRejection shows that rejecting an oversized token
+// takes the same time whatever its size.
+func BenchmarkOversizedTokenRejection(b *testing.B) {
+	jv, err := NewVerifier("https://golang.oktapreview.com")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range []int{64 << 10, 1 << 20, 16 << 20} {
+		jwt := strings.Repeat("a", size/3) + "." + strings.Repeat("b", size/3) + "." + strings.Repeat("c", size/3)
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := jv.VerifyAccessToken(jwt); err == nil {
+					b.Fatal("an oversized token was accepted")
+				}
+			}
+		})
+	}
+}
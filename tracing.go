@@ -0,0 +1,128 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+// fetchRecord notes whether a traced or observed verification fetched a
+// document.
+type fetchRecord struct {
+	fetched atomic.Bool
+}
+
+type fetchRecordKey struct{}
+
+// fetchTracer starts fetch spans, noting the fetch on the fetchRecord of
+// the verification they are made for.
+type fetchTracer struct {
+	tracing.Tracer
+}
+
+func (t fetchTracer) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+	if record, ok := ctx.Value(fetchRecordKey{}).(*fetchRecord); ok {
+		record.fetched.Store(true)
+	}
+	done := detailFrom(ctx).noteFetch(name)
+	ctx, span := t.Tracer.Start(ctx, name)
+	return ctx, notedSpan{span, done}
+}
+
+// notedSpan notes the end of a fetch for a detailed verification.
+type notedSpan struct {
+	tracing.Span
+	done func()
+}
+
+func (s notedSpan) End(err error) {
+	s.done()
+	s.Span.End(err)
+}
+
+func endNothing(error) {}
+
+func endNoVerification(*Jwt, error) {}
+
+// startVerification starts a verification span named name, for the
+// method named method. The function it returns records the outcome, ends
+// the span and calls the OnVerification hooks. Without a Tracer or
+// OnVerification hook it does nothing.
+func (j *JwtVerifier) startVerification(ctx context.Context, name string, method string) (context.Context, func(*Jwt, error)) {
+	observed := j.observesVerifications()
+	if j.Tracer == nil && !observed {
+		return ctx, endNoVerification
+	}
+
+	start := time.Now()
+	id := requestID(ctx)
+	record := &fetchRecord{}
+	ctx, span := tracing.OrNoOp(j.Tracer).Start(context.WithValue(ctx, fetchRecordKey{}, record), name)
+	span.SetAttribute(tracing.AttributeIssuer, j.Issuer)
+
+	return ctx, func(token *Jwt, err error) {
+		cacheHit := !record.fetched.Load()
+		span.SetAttribute(tracing.AttributeCacheHit, cacheHit)
+		if err != nil {
+			category := errors.Category(err)
+			if category == "" {
+				category = "invalid"
+			}
+			span.SetAttribute(tracing.AttributeFailureCategory, category)
+		}
+		span.End(err)
+
+		if observed {
+			event := VerificationEvent{
+				Method:    method,
+				Duration:  time.Since(start),
+				CacheHit:  cacheHit,
+				Success:   err == nil,
+				Failure:   failureReason(err),
+				Degraded:  err != nil && token != nil && token.Unverified,
+				RequestID: id,
+			}
+			if err == nil && token != nil {
+				for _, failure := range token.Info.AdvisoryFailures {
+					event.AdvisoryFailures = append(event.AdvisoryFailures, failure.Claim)
+				}
+			}
+			j.notifyVerification(event)
+		}
+	}
+}
+
+// startFetch starts a span for a fetch of url. Without a Tracer it only
+// notes the fetch for the verification it is made for.
+func (j *JwtVerifier) startFetch(ctx context.Context, name string, url string) (context.Context, func(error)) {
+	if j.Tracer == nil {
+		if record, ok := ctx.Value(fetchRecordKey{}).(*fetchRecord); ok {
+			record.fetched.Store(true)
+		}
+		detailFrom(ctx).noteFetch(name)
+		return ctx, endNothing
+	}
+
+	ctx, span := fetchTracer{j.Tracer}.Start(ctx, name)
+	span.SetAttribute(tracing.AttributeURL, tracing.URL(url))
+	return ctx, span.End
+}
@@ -0,0 +1,96 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package oteltracing reports the verifier's spans to OpenTelemetry. It is
+// kept apart from package tracing so that only programs that use it depend
+// on OpenTelemetry.
+package oteltracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the OpenTelemetry tracer the spans
+// are recorded with.
+const InstrumentationName = "github.com/okta/okta-jwt-verifier-golang"
+
+// New returns a tracing.Tracer that records spans with tp, or with the
+// global TracerProvider if tp is nil. Until a TracerProvider is installed,
+// spans are not recorded and cost next to nothing.
+func New(tp trace.TracerProvider) tracing.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tracer{tp.Tracer(InstrumentationName)}
+}
+
+var (
+	internal = []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindInternal)}
+	client   = []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindClient)}
+)
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+func (t tracer) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+	options := internal
+	if name == tracing.SpanFetchMetadata || name == tracing.SpanFetchKeySet {
+		options = client
+	}
+	ctx, s := t.tracer.Start(ctx, name, options...)
+	if !s.IsRecording() {
+		// The span is still in ctx, so that its context propagates, but
+		// there is nothing to record on it.
+		_, noOp := tracing.NoOp().Start(ctx, name)
+		return ctx, noOp
+	}
+	return ctx, span{s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+func (s span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
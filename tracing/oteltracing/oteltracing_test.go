@@ -0,0 +1,88 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package oteltracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+	"github.com/okta/okta-jwt-verifier-golang/tracing/oteltracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func Test_spans_are_recorded_with_their_attributes_and_errors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := oteltracing.New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, verify := tracer.Start(context.Background(), tracing.SpanVerifyAccessToken)
+	verify.SetAttribute(tracing.AttributeIssuer, "https://golang.oktapreview.com")
+	verify.SetAttribute(tracing.AttributeCacheHit, false)
+
+	_, fetch := tracer.Start(ctx, tracing.SpanFetchKeySet)
+	fetch.End(nil)
+
+	verify.SetAttribute(tracing.AttributeFailureCategory, "keys")
+	verify.End(errors.New("keys unavailable"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	fetched, verified := spans[0], spans[1]
+	if fetched.Name() != tracing.SpanFetchKeySet || fetched.SpanKind() != trace.SpanKindClient {
+		t.Errorf("unexpected fetch span %s of kind %s", fetched.Name(), fetched.SpanKind())
+	}
+	if fetched.Parent().SpanID() != verified.SpanContext().SpanID() {
+		t.Errorf("the fetch span is not a child of the verification span")
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range verified.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	if attributes[tracing.AttributeIssuer].AsString() != "https://golang.oktapreview.com" ||
+		attributes[tracing.AttributeCacheHit].Type() != attribute.BOOL ||
+		attributes[tracing.AttributeFailureCategory].AsString() != "keys" {
+		t.Errorf("unexpected attributes %v", verified.Attributes())
+	}
+	if verified.Status().Code != codes.Error || len(verified.Events()) != 1 {
+		t.Errorf("expected the error to be recorded, got %v and %v", verified.Status(), verified.Events())
+	}
+}
+
+func Test_spans_that_are_not_recorded_are_cheap(t *testing.T) {
+	tracer := oteltracing.New(noop.NewTracerProvider())
+	ctx := context.Background()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := tracer.Start(ctx, tracing.SpanVerifyAccessToken)
+		span.SetAttribute(tracing.AttributeCacheHit, true)
+		span.End(nil)
+	})
+	// The one allocation is the context carrying the span.
+	if allocs > 1 {
+		t.Errorf("expected at most 1 allocation, got %v", allocs)
+	}
+}
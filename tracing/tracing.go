@@ -0,0 +1,102 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package tracing lets the verifier report the time spent verifying tokens
+// and fetching the documents they are verified against. It has no
+// dependencies; package oteltracing adapts it to OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"net/url"
+)
+
+// Span names used by the verifier and the default adaptor.
+const (
+	SpanVerifyAccessToken = "jwtverifier.VerifyAccessToken"
+	SpanVerifyIdToken     = "jwtverifier.VerifyIdToken"
+	SpanFetchMetadata     = "jwtverifier.fetch_metadata"
+	SpanFetchKeySet       = "jwtverifier.fetch_key_set"
+)
+
+// Attribute keys set on the spans.
+const (
+	// AttributeIssuer is the verifier's issuer, on the verification spans.
+	AttributeIssuer = "jwtverifier.issuer"
+
+	// AttributeCacheHit is true on a verification span if neither the
+	// discovery document nor the key set had to be fetched.
+	AttributeCacheHit = "jwtverifier.cache_hit"
+
+	// AttributeFailureCategory is the category of a failed verification:
+	// token, claims or keys, as returned by errors.Category, or invalid for
+	// failures without one.
+	AttributeFailureCategory = "jwtverifier.failure_category"
+
+	// AttributeURL is the URL requested, on the fetch spans. Its query
+	// string is removed.
+	AttributeURL = "url.full"
+)
+
+// Tracer starts spans. Start returns a context carrying the new span, as a
+// child of any span in ctx, for the work done within it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation being traced. SetAttribute values are strings,
+// bools or ints. End is called once, with the error the operation failed
+// with or nil.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End(err error)
+}
+
+type noOp struct{}
+
+func (noOp) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noOp{}
+}
+
+func (noOp) SetAttribute(key string, value interface{}) {}
+
+func (noOp) End(err error) {}
+
+// NoOp returns a Tracer whose spans record nothing.
+func NoOp() Tracer {
+	return noOp{}
+}
+
+// OrNoOp returns t, or a Tracer whose spans record nothing if t is nil.
+func OrNoOp(t Tracer) Tracer {
+	if t == nil {
+		return noOp{}
+	}
+	return t
+}
+
+// URL returns raw without its credentials, query string and fragment, for
+// AttributeURL.
+func URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
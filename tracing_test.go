@@ -0,0 +1,187 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/tracing"
+)
+
+type recordedSpan struct {
+	name       string
+	parent     string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type spanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+	span := &recordingSpan{tracer: t, span: &recordedSpan{name: name, attributes: map[string]interface{}{}}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.span.parent = parent.name
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span.span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span.span), span
+}
+
+func (t *recordingTracer) recorded() []recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]recordedSpan, len(t.spans))
+	for i, span := range t.spans {
+		spans[i] = *span
+	}
+	return spans
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   *recordedSpan
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.attributes[key] = value
+}
+
+func (s *recordingSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.err, s.span.ended = err, true
+}
+
+func Test_verifications_and_fetches_are_traced(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	tracer := &recordingTracer{}
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(cache.NewMemory()),
+		jwtverifier.WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, _ := tracer.Start(context.Background(), "request")
+	token := issuer.Sign(issuer.Claims("api://default"))
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.VerifyAccessTokenContext(ctx, token); err != nil {
+			t.Fatalf("could not verify access_token: %s", err)
+		}
+	}
+
+	spans := tracer.recorded()
+	if len(spans) != 5 {
+		t.Fatalf("expected 5 spans, got %+v", spans)
+	}
+
+	expected := []struct {
+		name   string
+		parent string
+	}{
+		{"request", ""},
+		{tracing.SpanVerifyAccessToken, "request"},
+		{tracing.SpanFetchMetadata, tracing.SpanVerifyAccessToken},
+		{tracing.SpanFetchKeySet, tracing.SpanVerifyAccessToken},
+		{tracing.SpanVerifyAccessToken, "request"},
+	}
+	for i, e := range expected {
+		if spans[i].name != e.name || spans[i].parent != e.parent {
+			t.Errorf("span %d: expected %s under %q, got %s under %q", i, e.name, e.parent, spans[i].name, spans[i].parent)
+		}
+	}
+
+	first, second := spans[1], spans[4]
+	if first.attributes[tracing.AttributeIssuer] != issuer.URL || !first.ended || first.err != nil {
+		t.Errorf("unexpected verification span %+v", first)
+	}
+	if first.attributes[tracing.AttributeCacheHit] != false || second.attributes[tracing.AttributeCacheHit] != true {
+		t.Errorf("expected a miss and then a hit, got %v and %v",
+			first.attributes[tracing.AttributeCacheHit], second.attributes[tracing.AttributeCacheHit])
+	}
+	if spans[3].attributes[tracing.AttributeURL] != issuer.URL+"/v1/keys" || !spans[3].ended {
+		t.Errorf("unexpected key set span %+v", spans[3])
+	}
+}
+
+func Test_failed_verifications_are_traced_with_their_category(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	tracer := &recordingTracer{}
+	verifier, err := jwtverifier.NewVerifier(issuer.URL,
+		jwtverifier.WithClaimToValidate("aud", "api://default"),
+		jwtverifier.WithCache(cache.NewMemory()),
+		jwtverifier.WithRetry(1, time.Millisecond),
+		jwtverifier.WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.VerifyIdToken(""); err == nil {
+		t.Fatal("expected an empty token to fail")
+	}
+
+	issuer.SetJWKSUnavailable(true)
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://default"))); err == nil {
+		t.Fatal("expected verification to fail without a key set")
+	}
+
+	issuer.SetJWKSUnavailable(false)
+	if _, err := verifier.VerifyAccessToken(issuer.Sign(issuer.Claims("api://other"))); err == nil {
+		t.Fatal("expected verification to fail for another audience")
+	}
+
+	var categories []interface{}
+	for _, span := range verifierSpans(tracer.recorded()) {
+		if span.err == nil {
+			t.Errorf("expected span %s to end with the error", span.name)
+		}
+		categories = append(categories, span.attributes[tracing.AttributeFailureCategory])
+	}
+	if len(categories) != 3 || categories[0] != "token" || categories[1] != "keys" || categories[2] != "invalid" {
+		t.Errorf("unexpected failure categories %v", categories)
+	}
+}
+
+func verifierSpans(spans []recordedSpan) []recordedSpan {
+	var verifications []recordedSpan
+	for _, span := range spans {
+		if span.name == tracing.SpanVerifyAccessToken || span.name == tracing.SpanVerifyIdToken {
+			verifications = append(verifications, span)
+		}
+	}
+	return verifications
+}
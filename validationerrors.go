@@ -0,0 +1,104 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ValidationErrors is the error returned when one or more of a token's
+// claims fail validation, holding a failure for each claim. Like an error
+// from errors.Join, it unwraps to its members, so errors.Is and errors.As
+// find any of them.
+//
+// Error, and the %v and %s verbs, give a single line: the members'
+// messages in the order the checks run, separated by "; ". The line is the
+// same for the same failures, so it can be used to group alerts. %+v gives
+// a line for each member, for people.
+type ValidationErrors struct {
+	errs []error
+}
+
+// joinValidationErrors returns the non-nil errors in errs as a
+// *ValidationErrors, or nil if there are none.
+func joinValidationErrors(errs []error) error {
+	var members []error
+	for _, err := range errs {
+		if err != nil {
+			members = append(members, err)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return &ValidationErrors{errs: members}
+}
+
+// Errors returns the member errors, in the order the checks ran.
+func (e *ValidationErrors) Errors() []error {
+	return append([]error(nil), e.errs...)
+}
+
+// Unwrap returns the member errors, for errors.Is and errors.As.
+func (e *ValidationErrors) Unwrap() []error {
+	return e.errs
+}
+
+func (e *ValidationErrors) Error() string {
+	messages := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		messages[i] = singleLine(err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Format implements fmt.Formatter: %+v writes "N claim validation
+// errors:" followed by each member on its own line; other verbs format
+// Error as a string would be.
+func (e *ValidationErrors) Format(s fmt.State, verb rune) {
+	if verb != 'v' || !s.Flag('+') {
+		fmt.Fprintf(s, fmt.FormatString(s, verb), e.Error())
+		return
+	}
+
+	if len(e.errs) == 1 {
+		io.WriteString(s, "1 claim validation error:")
+	} else {
+		fmt.Fprintf(s, "%d claim validation errors:", len(e.errs))
+	}
+	for _, err := range e.errs {
+		io.WriteString(s, "\n  - ")
+		io.WriteString(s, strings.Replace(err.Error(), "\n", "\n    ", -1))
+	}
+}
+
+// singleLine joins the lines of a message, such as one from errors.Join,
+// with "; ".
+func singleLine(message string) string {
+	if !strings.Contains(message, "\n") {
+		return message
+	}
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "; ")
+}
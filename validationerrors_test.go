@@ -0,0 +1,116 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_validation_errors_format_as_one_line_or_one_per_member(t *testing.T) {
+	audience := goerrors.New("aud: api://other does not match api://default")
+	joined := goerrors.Join(goerrors.New("scp: missing"), goerrors.New("groups: missing"))
+	err := joinValidationErrors([]error{nil, audience, joined})
+
+	line := "aud: api://other does not match api://default; scp: missing; groups: missing"
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"%v", line},
+		{"%s", line},
+		{"%q", fmt.Sprintf("%q", line)},
+		{"%+v", "2 claim validation errors:\n" +
+			"  - aud: api://other does not match api://default\n" +
+			"  - scp: missing\n" +
+			"    groups: missing"},
+	}
+
+	for _, test := range tests {
+		if got := fmt.Sprintf(test.format, err); got != test.expected {
+			t.Errorf("%s formatted as %q, expected %q", test.format, got, test.expected)
+		}
+	}
+	if err.Error() != line {
+		t.Errorf("Error() returned %q", err.Error())
+	}
+
+	if joinValidationErrors([]error{nil}) != nil {
+		t.Errorf("expected no error without members")
+	}
+	if got := fmt.Sprintf("%+v", joinValidationErrors([]error{audience})); got != "1 claim validation error:\n  - "+audience.Error() {
+		t.Errorf("unexpected format of a single member: %q", got)
+	}
+}
+
+func Test_validation_errors_unwrap_to_their_members(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://other")
+	claims["nbf"] = time.Now().Add(time.Hour).Unix()
+	_, err = jv.VerifyAccessToken(issuer.Sign(claims))
+
+	var aggregate *ValidationErrors
+	if !goerrors.As(err, &aggregate) || len(aggregate.Errors()) != 2 {
+		t.Fatalf("expected two validation errors, got %v", err)
+	}
+	if strings.Contains(err.Error(), "\n") {
+		t.Errorf("expected a single line, got %q", err.Error())
+	}
+
+	var notYetValid *errors.TokenNotYetValid
+	if !goerrors.As(err, &notYetValid) {
+		t.Errorf("errors.As did not find the nbf failure in %v", err)
+	}
+	if !goerrors.Is(err, notYetValid) {
+		t.Errorf("errors.Is did not find the nbf failure in %v", err)
+	}
+	if failureReason(err) != FailureAudience {
+		t.Errorf("expected the first member's reason, got %q", failureReason(err))
+	}
+
+	// The aggregate joins with other errors like any error.
+	other := goerrors.New("the request was rejected")
+	combined := goerrors.Join(err, other)
+	if !goerrors.Is(combined, other) || !goerrors.As(combined, &notYetValid) || !goerrors.As(combined, &aggregate) {
+		t.Errorf("the members cannot be found once joined with other errors: %v", combined)
+	}
+	if wrapped := fmt.Errorf("could not authorize: %w", err); !goerrors.As(wrapped, &notYetValid) {
+		t.Errorf("the members cannot be found through a wrapping error")
+	}
+
+	// The single line is stable, so it can fingerprint alerts.
+	_, again := jv.VerifyAccessToken(issuer.Sign(claims))
+	if again.Error() != err.Error() {
+		t.Errorf("the message changed between identical failures:\n%s\n%s", err, again)
+	}
+}
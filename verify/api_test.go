@@ -0,0 +1,139 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package verify
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/api.golden")
+
+// exportedAPI lists the exported declarations of the package in dir, one
+// per entry, without comments or function bodies.
+func exportedAPI(t *testing.T, dir string) []string {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	format := func(node interface{}) string {
+		var b bytes.Buffer
+		if err := printer.Fprint(&b, fset, node); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	var api []string
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					if !d.Name.IsExported() || (d.Recv != nil && !exportedReceiver(d.Recv)) {
+						continue
+					}
+					d.Doc, d.Body = nil, nil
+					if d.Recv != nil {
+						d.Recv.List[0].Names = nil
+					}
+					api = append(api, format(d))
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						switch s := spec.(type) {
+						case *ast.TypeSpec:
+							if s.Name.IsExported() {
+								api = append(api, "type "+format(stripComments(s)))
+							}
+						case *ast.ValueSpec:
+							for i, name := range s.Names {
+								if !name.IsExported() {
+									continue
+								}
+								entry := d.Tok.String() + " " + name.Name
+								if s.Type != nil {
+									entry += " " + format(s.Type)
+								}
+								if i < len(s.Values) {
+									entry += " = " + format(s.Values[i])
+								}
+								api = append(api, entry)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(api)
+	return api
+}
+
+func exportedReceiver(recv *ast.FieldList) bool {
+	typ := recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	ident, ok := typ.(*ast.Ident)
+	return ok && ident.IsExported()
+}
+
+func stripComments(spec *ast.TypeSpec) *ast.TypeSpec {
+	spec.Doc, spec.Comment = nil, nil
+	ast.Inspect(spec, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok {
+			field.Doc, field.Comment = nil, nil
+		}
+		return true
+	})
+	return spec
+}
+
+// Test_exported_api_is_unchanged fails when the exported API of this
+// package differs from testdata/api.golden. Changes must be backwards
+// compatible; after making one, run go test -update and commit the golden
+// file with it.
+func Test_exported_api_is_unchanged(t *testing.T) {
+	got := strings.Join(exportedAPI(t, "."), "\n") + "\n"
+
+	if *update {
+		if err := ioutil.WriteFile("testdata/api.golden", []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile("testdata/api.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("the exported API changed.\n\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
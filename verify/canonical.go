@@ -0,0 +1,239 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CanonicalJSON encodes the claims named by keys, or every claim if no key
+// is given, as canonical JSON (RFC 8785), suitable for hashing. Named
+// claims the token does not have are left out.
+//
+// Object members are sorted by the UTF-16 code units of their names, and
+// numbers, including json.Number values, are written in their shortest
+// ECMAScript form, so 1.0, 1 and json.Number("1e0") are all written as 1.
+// As in RFC 8785, numbers are IEEE 754 doubles: integers beyond 2^53 lose
+// precision. Strings are written as they are, without Unicode
+// normalization, escaping only what JSON requires; a string that is not
+// valid UTF-8 is an error, as is a NaN or infinite number.
+func (c Claims) CanonicalJSON(keys ...string) ([]byte, error) {
+	claims := map[string]interface{}(c)
+	if len(keys) > 0 {
+		claims = make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			if value, ok := c[key]; ok {
+				claims[key] = value
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := writeCanonical(&b, claims); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeCanonical(b *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case string:
+		return writeCanonicalString(b, v)
+	case json.Number:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v.String())
+		}
+		return writeCanonicalNumber(b, f)
+	case float64:
+		return writeCanonicalNumber(b, v)
+	case float32:
+		return writeCanonicalNumber(b, float64(v))
+	case int:
+		return writeCanonicalNumber(b, float64(v))
+	case int64:
+		return writeCanonicalNumber(b, float64(v))
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, k int) bool { return lessUTF16(names[i], names[k]) })
+
+		b.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonicalString(b, name); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := writeCanonical(b, v[name]); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		b.WriteByte('}')
+	case []interface{}:
+		b.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, element); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		b.WriteByte(']')
+	case []string:
+		b.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonicalString(b, element); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		b.WriteByte(']')
+	default:
+		// Anything else did not come from decoding JSON; encode it and
+		// canonicalize the result.
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.UseNumber()
+		var decoded interface{}
+		if err := decoder.Decode(&decoded); err != nil {
+			return err
+		}
+		return writeCanonical(b, decoded)
+	}
+	return nil
+}
+
+// writeCanonicalString escapes only '"', '\' and control characters, using
+// the short escapes where JSON has them.
+func writeCanonicalString(b *bytes.Buffer, s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("%q is not valid UTF-8", s)
+	}
+
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return nil
+}
+
+// writeCanonicalNumber writes f as ECMAScript's Number.prototype.toString
+// does.
+func writeCanonicalNumber(b *bytes.Buffer, f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("%v is not a JSON number", f)
+	}
+	if f == 0 {
+		b.WriteByte('0')
+		return nil
+	}
+	if f < 0 {
+		b.WriteByte('-')
+		f = -f
+	}
+
+	// The shortest digits that round trip, and the exponent n such that
+	// f is 0.digits × 10^n.
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	e, _ := strconv.Atoi(exponent)
+	n := e + 1
+	k := len(digits)
+
+	switch {
+	case k <= n && n <= 21:
+		b.WriteString(digits)
+		b.WriteString(strings.Repeat("0", n-k))
+	case 0 < n && n <= 21:
+		b.WriteString(digits[:n])
+		b.WriteByte('.')
+		b.WriteString(digits[n:])
+	case -6 < n && n <= 0:
+		b.WriteString("0.")
+		b.WriteString(strings.Repeat("0", -n))
+		b.WriteString(digits)
+	default:
+		b.WriteString(digits[:1])
+		if k > 1 {
+			b.WriteByte('.')
+			b.WriteString(digits[1:])
+		}
+		b.WriteByte('e')
+		if n-1 >= 0 {
+			b.WriteByte('+')
+		}
+		b.WriteString(strconv.Itoa(n - 1))
+	}
+	return nil
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as RFC 8785
+// requires; this differs from byte order for characters beyond U+FFFF.
+func lessUTF16(a string, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
@@ -0,0 +1,181 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_canonical_json_numbers(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{0.0, "0"},
+		{math.Copysign(0, -1), "0"},
+		{1.0, "1"},
+		{json.Number("1e0"), "1"},
+		{json.Number("1600000000"), "1600000000"},
+		{int64(1600000000), "1600000000"},
+		{-2.5, "-2.5"},
+		{0.000001, "0.000001"},
+		{1e-7, "1e-7"},
+		{1e21, "1e+21"},
+		{1e20, "100000000000000000000"},
+		{123456789012345680000.0, "123456789012345680000"},
+		{9007199254740992.0, "9007199254740992"},
+		{5e-324, "5e-324"},
+		{1.7976931348623157e308, "1.7976931348623157e+308"},
+		{333333333.3333333, "333333333.3333333"},
+	}
+
+	for _, test := range tests {
+		got, err := Claims{"n": test.value}.CanonicalJSON()
+		if err != nil {
+			t.Errorf("CanonicalJSON() returned an error for %v: %s", test.value, err)
+			continue
+		}
+		if expected := `{"n":` + test.expected + `}`; string(got) != expected {
+			t.Errorf("CanonicalJSON() for %v returned %s, expected %s", test.value, got, expected)
+		}
+	}
+}
+
+func Test_canonical_json_objects_and_strings(t *testing.T) {
+	claims := Claims{
+		"sub":        "user@example.com",
+		"\uff21":     "fullwidth",
+		"\U0001f600": "emoji",
+		"\r":         "control",
+		"1":          "digit",
+		"groups":     []interface{}{"Admins", "<Everyone>"},
+		"aud":        []string{"api://default"},
+		"address": map[string]interface{}{
+			"lines":   []interface{}{},
+			"country": "NZ\t\"\\\u0001 ",
+		},
+		"email_verified": true,
+		"middle_name":    nil,
+	}
+
+	got, err := claims.CanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The emoji is encoded as a surrogate pair, which sorts before U+FF21 in
+	// UTF-16 though not in UTF-8.
+	expected := `{"\r":"control","1":"digit",` +
+		`"address":{"country":"NZ\t\"\\\u0001` + " " + `","lines":[]},` +
+		`"aud":["api://default"],"email_verified":true,"groups":["Admins","<Everyone>"],` +
+		`"middle_name":null,"sub":"user@example.com",` +
+		`"` + "\U0001f600" + `":"emoji","` + "\uff21" + `":"fullwidth"}`
+	if string(got) != expected {
+		t.Errorf("CanonicalJSON() returned\n%s\nexpected\n%s", got, expected)
+	}
+
+	subset, err := claims.CanonicalJSON("sub", "email_verified", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(subset) != `{"email_verified":true,"sub":"user@example.com"}` {
+		t.Errorf("CanonicalJSON() for a subset returned %s", subset)
+	}
+}
+
+func Test_canonical_json_rejects_what_json_cannot_carry(t *testing.T) {
+	for _, claims := range []Claims{
+		{"n": math.NaN()},
+		{"n": []interface{}{math.Inf(1)}},
+		{"s": "\xff"},
+		{"n": json.Number("twelve")},
+	} {
+		if got, err := claims.CanonicalJSON(); err == nil {
+			t.Errorf("expected an error, got %s", got)
+		}
+	}
+}
+
+// reinserted copies value, inserting the members of every object in
+// reverse order.
+func reinserted(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Claims:
+		return Claims(reinserted(map[string]interface{}(v)).(map[string]interface{}))
+	case map[string]interface{}:
+		names := sortedKeys(v)
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+		copied := make(map[string]interface{}, len(v))
+		for _, name := range names {
+			copied[name] = reinserted(v[name])
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, element := range v {
+			copied[i] = reinserted(element)
+		}
+		return copied
+	}
+	return value
+}
+
+func Test_canonical_json_is_deterministic(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		claims := randomClaims(r)
+
+		first, err := claims.CanonicalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < 3; n++ {
+			again, err := claims.CanonicalJSON()
+			if err != nil || !bytes.Equal(first, again) {
+				t.Fatalf("CanonicalJSON() is not deterministic:\n%s\n%s", first, again)
+			}
+		}
+
+		copied := reinserted(claims).(Claims)
+		if second, err := copied.CanonicalJSON(); err != nil || !bytes.Equal(first, second) {
+			t.Fatalf("CanonicalJSON() depends on insertion order:\n%s\n%s", first, second)
+		}
+
+		// Decoding with json.Number must not change the numbers.
+		decoder := json.NewDecoder(bytes.NewReader(first))
+		decoder.UseNumber()
+		var numbers Claims
+		if err := decoder.Decode(&numbers); err != nil {
+			t.Fatalf("CanonicalJSON() returned invalid JSON %s: %s", first, err)
+		}
+		if second, err := numbers.CanonicalJSON(); err != nil || !bytes.Equal(first, second) {
+			t.Fatalf("CanonicalJSON() changed with json.Number values:\n%s\n%s", first, second)
+		}
+
+		var decoded Claims
+		if err := json.Unmarshal(first, &decoded); err != nil || !reflect.DeepEqual(decoded, claims) {
+			t.Fatalf("CanonicalJSON() lost information: %s", first)
+		}
+	}
+}
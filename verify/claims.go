@@ -0,0 +1,167 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Claims are the decoded claims of a token.
+type Claims map[string]interface{}
+
+// redactedClaims are claims whose values Flatten never emits.
+var redactedClaims = map[string]bool{
+	"nonce": true,
+}
+
+const (
+	// maxFlattenedValue is the longest value Flatten emits; longer values
+	// are cut and end in flattenTruncated.
+	maxFlattenedValue = 256
+
+	// maxFlattenedSize caps the total length of the keys and values Flatten
+	// emits. Entries beyond it are dropped and counted under the
+	// "_truncated" key.
+	maxFlattenedSize = 8192
+
+	flattenTruncated = "...[truncated]"
+	flattenRedacted  = "[redacted]"
+)
+
+// Flatten returns the claims as flat key/value pairs for logging systems
+// that do not accept nested JSON. Nested keys are joined with sep and array
+// elements are indexed, so {"address": {"country": "NZ"}} becomes
+// "address.country" = "NZ" for sep ".". Keys are prefixed with prefix and
+// sep, if prefix is not empty.
+//
+// The output is deterministic. Numbers keep their JSON form, secret claims
+// such as the nonce are replaced by "[redacted]", and long values and large
+// outputs are truncated.
+func (c Claims) Flatten(prefix string, sep string) map[string]string {
+	f := &flattener{sep: sep, out: map[string]string{}}
+
+	for _, name := range sortedKeys(c) {
+		key := name
+		if prefix != "" {
+			key = prefix + sep + name
+		}
+		if redactedClaims[name] {
+			f.emit(key, flattenRedacted)
+			continue
+		}
+		f.flatten(key, c[name])
+	}
+
+	if f.dropped > 0 {
+		key := "_truncated"
+		if prefix != "" {
+			key = prefix + sep + key
+		}
+		f.out[key] = strconv.Itoa(f.dropped)
+	}
+	return f.out
+}
+
+type flattener struct {
+	sep     string
+	out     map[string]string
+	size    int
+	dropped int
+}
+
+func (f *flattener) flatten(key string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			f.emit(key, "{}")
+		}
+		for _, name := range sortedKeys(v) {
+			f.flatten(key+f.sep+name, v[name])
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			f.emit(key, "[]")
+		}
+		for i, element := range v {
+			f.flatten(key+f.sep+strconv.Itoa(i), element)
+		}
+	case []string:
+		if len(v) == 0 {
+			f.emit(key, "[]")
+		}
+		for i, element := range v {
+			f.emit(key+f.sep+strconv.Itoa(i), element)
+		}
+	default:
+		f.emit(key, flattenScalar(v))
+	}
+}
+
+func (f *flattener) emit(key string, value string) {
+	if len(value) > maxFlattenedValue {
+		value = value[:maxFlattenedValue-len(flattenTruncated)] + flattenTruncated
+	}
+	if f.size+len(key)+len(value) > maxFlattenedSize {
+		f.dropped++
+		return
+	}
+	f.size += len(key) + len(value)
+	f.out[key] = value
+}
+
+// flattenScalar formats a decoded JSON value. Numbers are written without
+// an exponent, so 1600000000 stays 1600000000.
+func flattenScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+
+	// Anything else did not come from decoding JSON; encode it so the
+	// result is at least stable.
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
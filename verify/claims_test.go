@@ -0,0 +1,171 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_flatten_nested_claims(t *testing.T) {
+	var claims Claims
+	err := json.Unmarshal([]byte(`{
+		"sub": "user@example.com",
+		"exp": 1600000000,
+		"email_verified": true,
+		"middle_name": null,
+		"groups": ["Everyone", "Admins"],
+		"address": {"country": "NZ", "lines": []},
+		"entitlements": {"seats": 2.5, "features": [{"name": "sso"}], "limits": {}}
+	}`), &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"token.sub":                          "user@example.com",
+		"token.exp":                          "1600000000",
+		"token.email_verified":               "true",
+		"token.middle_name":                  "null",
+		"token.groups.0":                     "Everyone",
+		"token.groups.1":                     "Admins",
+		"token.address.country":              "NZ",
+		"token.address.lines":                "[]",
+		"token.entitlements.seats":           "2.5",
+		"token.entitlements.features.0.name": "sso",
+		"token.entitlements.limits":          "{}",
+	}
+
+	if got := claims.Flatten("token", "."); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Flatten() returned %v, expected %v", got, expected)
+	}
+
+	if got := claims.Flatten("", "_"); got["address_country"] != "NZ" {
+		t.Errorf("Flatten() without a prefix returned %v", got)
+	}
+}
+
+func Test_flatten_keeps_json_numbers(t *testing.T) {
+	decoder := json.NewDecoder(strings.NewReader(`{"exp": 1600000000, "ratio": 0.10}`))
+	decoder.UseNumber()
+
+	var claims Claims
+	if err := decoder.Decode(&claims); err != nil {
+		t.Fatal(err)
+	}
+
+	got := claims.Flatten("", ".")
+	if got["exp"] != "1600000000" || got["ratio"] != "0.10" {
+		t.Errorf("Flatten() reformatted numbers: %v", got)
+	}
+}
+
+func Test_flatten_truncates(t *testing.T) {
+	claims := Claims{"a_long": strings.Repeat("a", 1000)}
+	for i := 0; i < 1000; i++ {
+		claims[fmt.Sprintf("claim%04d", i)] = "value"
+	}
+
+	got := claims.Flatten("", ".")
+
+	if len(got["a_long"]) != maxFlattenedValue || !strings.HasSuffix(got["a_long"], flattenTruncated) {
+		t.Errorf("a long value was not truncated: %q", got["a_long"])
+	}
+
+	size := 0
+	for key, value := range got {
+		size += len(key) + len(value)
+	}
+	if size > maxFlattenedSize+len("_truncated")+4 {
+		t.Errorf("the output was not capped, got %d bytes", size)
+	}
+	if got["_truncated"] == "" {
+		t.Errorf("the dropped entries were not counted")
+	}
+}
+
+// randomClaims builds nested claims from r, always including a nonce.
+func randomClaims(r *rand.Rand) Claims {
+	var value func(depth int) interface{}
+	value = func(depth int) interface{} {
+		switch n := r.Intn(7); {
+		case n == 0 && depth < 4:
+			m := map[string]interface{}{}
+			for i := r.Intn(4); i > 0; i-- {
+				m[fmt.Sprintf("k%d", r.Intn(10))] = value(depth + 1)
+			}
+			return m
+		case n == 1 && depth < 4:
+			a := make([]interface{}, r.Intn(4))
+			for i := range a {
+				a[i] = value(depth + 1)
+			}
+			return a
+		case n == 2:
+			return r.Float64() * 1e6
+		case n == 3:
+			return r.Intn(2) == 0
+		case n == 4:
+			return nil
+		}
+		return fmt.Sprintf("s%d", r.Int63())
+	}
+
+	claims := Claims{"nonce": fmt.Sprintf("secret-nonce-%d", r.Int63())}
+	for i := r.Intn(8); i > 0; i-- {
+		claims[fmt.Sprintf("c%d", r.Intn(20))] = value(0)
+	}
+	return claims
+}
+
+func Test_flatten_is_deterministic_and_redacts(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		claims := randomClaims(r)
+
+		// Round-trip through JSON so the second copy has fresh maps,
+		// iterated in a different order.
+		b, err := json.Marshal(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var copied Claims
+		if err := json.Unmarshal(b, &copied); err != nil {
+			t.Fatal(err)
+		}
+
+		first, second := claims.Flatten("p", "."), copied.Flatten("p", ".")
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("Flatten() is not deterministic for %s:\n%v\n%v", b, first, second)
+		}
+
+		nonce := claims["nonce"].(string)
+		for key, value := range first {
+			if strings.Contains(value, nonce) {
+				t.Fatalf("the nonce appeared under %s", key)
+			}
+		}
+		if first["p.nonce"] != flattenRedacted {
+			t.Fatalf("the nonce was not marked as redacted: %v", first)
+		}
+	}
+}
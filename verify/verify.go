@@ -0,0 +1,100 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+// Package verify is the stable API of the verifier for SDKs and
+// applications that wrap it. The exported API of this package only changes
+// in backwards compatible ways; the jwtverifier package may change faster.
+//
+// Obtain a Verifier from jwtverifier.JwtVerifier.Facade or
+// jwtverifier.MultiVerifier.Facade.
+package verify
+
+import (
+	"net/http"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+// Verifier verifies Okta access and ID tokens.
+type Verifier interface {
+	// VerifyAccessToken returns the claims of a valid access token.
+	VerifyAccessToken(token string) (Claims, error)
+
+	// VerifyIdToken returns the claims of a valid ID token.
+	VerifyIdToken(token string) (Claims, error)
+}
+
+// Code classifies why a token was not verified. Codes are never renamed or
+// reused; new codes may be added.
+type Code string
+
+const (
+	// CodeNone is the code of a nil error.
+	CodeNone Code = ""
+
+	// CodeInvalid is the code of failures without a more specific code,
+	// such as a malformed token, a bad signature or a failed claim.
+	CodeInvalid Code = "TOKEN_INVALID"
+
+	CodeEmpty                Code = "JWT_EMPTY"
+	CodeEncrypted            Code = "JWT_ENCRYPTED"
+	CodeTooLarge             Code = "JWT_TOO_LARGE"
+	CodePredatesHorizon      Code = "TOKEN_PREDATES_HORIZON"
+	CodeTooOld               Code = "TOKEN_TOO_OLD"
+	CodeNotYetValid          Code = "TOKEN_NOT_YET_VALID"
+	CodeConfirmationMismatch Code = "CONFIRMATION_MISMATCH"
+	CodeHeaderRejected       Code = "HEADER_REJECTED"
+	CodeKeyNotPinned         Code = "KEY_NOT_PINNED"
+	CodeKeyNotFound          Code = "KEY_NOT_FOUND"
+	CodeAttestationInvalid   Code = "ATTESTATION_INVALID"
+	CodeX5CInvalid           Code = "X5C_INVALID"
+	CodeOrgAccessToken       Code = "ORG_ACCESS_TOKEN"
+	CodeIssuerNotAllowed     Code = "ISSUER_NOT_ALLOWED"
+	CodeKeysUnavailable      Code = "KEYS_UNAVAILABLE"
+	CodeDiscoveryMalformed   Code = "DISCOVERY_MALFORMED"
+	CodeTLSPinMismatch       Code = "TLS_PIN_MISMATCH"
+	CodeCircuitOpen          Code = "CIRCUIT_OPEN"
+)
+
+// CodeOf returns the code of an error returned by a Verifier. When several
+// claims failed, it is the code of the first failure that has one.
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeNone
+	}
+	if code := errors.Code(err); code != "" {
+		return Code(code)
+	}
+	return CodeInvalid
+}
+
+// StatusForError returns the HTTP status a server should answer with when
+// verification failed with err: 503 Service Unavailable when the issuer's
+// keys could not be obtained, which is not the client's fault, and 401
+// Unauthorized otherwise. It returns 200 OK for a nil error. Errors decoded
+// from a newer release with a code this one does not know are classified
+// by their category.
+func StatusForError(err error) int {
+	switch CodeOf(err) {
+	case CodeNone:
+		return http.StatusOK
+	case CodeKeysUnavailable, CodeDiscoveryMalformed, CodeTLSPinMismatch, CodeCircuitOpen:
+		return http.StatusServiceUnavailable
+	}
+	if errors.Category(err) == "keys" {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,82 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package verify
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+)
+
+func Test_every_typed_error_has_a_code(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   Code
+		status int
+	}{
+		{nil, CodeNone, http.StatusOK},
+		{fmt.Errorf("the token is expired"), CodeInvalid, http.StatusUnauthorized},
+		{errors.JwtEmptyStringError(), CodeEmpty, http.StatusUnauthorized},
+		{errors.JwtEncryptedError(), CodeEncrypted, http.StatusUnauthorized},
+		{errors.JwtTooLargeError(20000, 16384), CodeTooLarge, http.StatusUnauthorized},
+		{errors.TokenPredatesHorizonError(time.Unix(0, 0), time.Now()), CodePredatesHorizon, http.StatusUnauthorized},
+		{errors.TokenTooOldError(time.Unix(0, 0), 15*time.Minute), CodeTooOld, http.StatusUnauthorized},
+		{errors.TokenNotYetValidError(time.Now().Add(time.Hour)), CodeNotYetValid, http.StatusUnauthorized},
+		{errors.ConfirmationMismatchError("cnf: missing"), CodeConfirmationMismatch, http.StatusUnauthorized},
+		{errors.KeyNotPinnedError("kid \"key2\" is not allowed"), CodeKeyNotPinned, http.StatusUnauthorized},
+		{errors.AttestationInvalidError("gateway-1", errors.AttestationForged), CodeAttestationInvalid, http.StatusUnauthorized},
+		{errors.X5CInvalidError("key1", errors.X5CMissing, ""), CodeX5CInvalid, http.StatusUnauthorized},
+		{errors.IssuerNotAllowedError("https://evil.example.com"), CodeIssuerNotAllowed, http.StatusUnauthorized},
+		{errors.OrgAccessTokenError("https://example.okta.com"), CodeOrgAccessToken, http.StatusUnauthorized},
+		{errors.HeaderRejectedError("crit", "no extensions are supported"), CodeHeaderRejected, http.StatusUnauthorized},
+		{errors.KeyNotFoundError("key1", []string{"key2"}), CodeKeyNotFound, http.StatusUnauthorized},
+		{errors.KeysUnavailableError(fmt.Errorf("503")), CodeKeysUnavailable, http.StatusServiceUnavailable},
+		{errors.DiscoveryMalformedError("https://example.com", "<html>", "not json"), CodeDiscoveryMalformed, http.StatusServiceUnavailable},
+		{errors.TLSPinMismatchError(nil), CodeTLSPinMismatch, http.StatusServiceUnavailable},
+		{errors.CircuitOpenError(), CodeCircuitOpen, http.StatusServiceUnavailable},
+		{&errors.Unrecognized{Code: "TOKEN_REPLAYED", Category: "claims"}, Code("TOKEN_REPLAYED"), http.StatusUnauthorized},
+		{&errors.Unrecognized{Code: "ISSUER_DOWN", Category: "keys"}, Code("ISSUER_DOWN"), http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		if code := CodeOf(test.err); code != test.code {
+			t.Errorf("CodeOf(%v) = %q, expected %q", test.err, code, test.code)
+		}
+		if status := StatusForError(test.err); status != test.status {
+			t.Errorf("StatusForError(%v) = %d, expected %d", test.err, status, test.status)
+		}
+	}
+}
+
+func Test_codes_are_found_in_wrapped_and_joined_errors(t *testing.T) {
+	wrapped := fmt.Errorf("could not decode token: %w", errors.KeysUnavailableError(fmt.Errorf("503")))
+	if code := CodeOf(wrapped); code != CodeKeysUnavailable {
+		t.Errorf("CodeOf a wrapped error = %q", code)
+	}
+
+	joined := goerrors.Join(
+		fmt.Errorf("the `Audience` was not able to be validated. aud: mismatch"),
+		fmt.Errorf("the `Issued At` was not able to be validated. %w",
+			errors.TokenPredatesHorizonError(time.Unix(0, 0), time.Now())))
+	if code := CodeOf(joined); code != CodePredatesHorizon {
+		t.Errorf("CodeOf a joined error = %q", code)
+	}
+}
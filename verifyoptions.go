@@ -0,0 +1,89 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import "time"
+
+// DefaultTransactionMaxTokenAge is the MaxTokenAge of verifications made
+// with WithTransactionID when TransactionMaxTokenAge is zero.
+const DefaultTransactionMaxTokenAge = 5 * time.Minute
+
+// VerifyOption configures a single call to VerifyAccessTokenContext or
+// VerifyIdTokenContext.
+type VerifyOption func(*verifyCall)
+
+type verifyCall struct {
+	claims map[string]interface{}
+	facts  Facts
+
+	// transaction is set by WithTransactionID.
+	transaction bool
+
+	// policies is set by EvaluatePolicies and VerifyWithAttestation, whose
+	// policies take the place of the verifier's audience, client ID, scope,
+	// group and claim requirements. policy, if set, is checked with the
+	// token's other claims.
+	policies bool
+	policy   *Policy
+}
+
+// WithExpectedClaim requires the token to carry claim with the given value
+// for this verification only, such as a device id taken from the request.
+// Values are compared as TypedClaimsToValidate compares them, and a missing
+// claim is a failure. The check is made on every call: concurrent calls for
+// the same token share the signature check, never the outcome.
+func WithExpectedClaim(claim string, value interface{}) VerifyOption {
+	return func(c *verifyCall) {
+		if c.claims == nil {
+			c.claims = map[string]interface{}{}
+		}
+		c.claims[claim] = value
+	}
+}
+
+// WithTransactionID binds this verification to a transaction, such as a
+// payment minted at checkout: the token's txn claim must equal txn, as
+// WithExpectedClaim requires, and the token must have been issued within
+// the verifier's TransactionMaxTokenAge, or its MaxTokenAge if that is
+// shorter. As with WithExpectedClaim, verifications of the same token for
+// different transactions never share an outcome.
+func WithTransactionID(txn string) VerifyOption {
+	return func(c *verifyCall) {
+		WithExpectedClaim("txn", txn)(c)
+		c.transaction = true
+	}
+}
+
+// WithFact attaches a fact about this verification, such as the request's
+// source IP, for the verifier's ClaimValidators. A later fact with the same
+// name replaces an earlier one.
+func WithFact(name string, value interface{}) VerifyOption {
+	return func(c *verifyCall) {
+		if c.facts == nil {
+			c.facts = Facts{}
+		}
+		c.facts[name] = value
+	}
+}
+
+func newVerifyCall(opts []VerifyOption) verifyCall {
+	var call verifyCall
+	for _, opt := range opts {
+		opt(&call)
+	}
+	return call
+}
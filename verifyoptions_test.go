@@ -0,0 +1,218 @@
+/*******************************************************************************
+ * Copyright 2018 Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	goerrors "errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/cache"
+	"github.com/okta/okta-jwt-verifier-golang/errors"
+	"github.com/okta/okta-jwt-verifier-golang/internal/testissuer"
+)
+
+func Test_expected_claims_apply_to_a_single_call(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithClaimToValidate("nonce", "abc123"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["nonce"] = "abc123"
+	claims["did"] = "device-a"
+	token := issuer.Sign(claims)
+
+	delete(claims, "did")
+	withoutDevice := issuer.Sign(claims)
+
+	ctx := context.Background()
+	if _, err := jv.VerifyIdTokenContext(ctx, token, WithExpectedClaim("did", "device-a")); err != nil {
+		t.Errorf("could not verify id_token for its device: %s", err)
+	}
+	if _, err := jv.VerifyAccessTokenContext(ctx, token, WithExpectedClaim("did", "device-a")); err != nil {
+		t.Errorf("could not verify access_token for its device: %s", err)
+	}
+
+	_, err = jv.VerifyIdTokenContext(ctx, token, WithExpectedClaim("did", "device-b"))
+	if err == nil || !strings.Contains(err.Error(), `did: "device-a" (string) does not match "device-b" (string)`) {
+		t.Errorf("expected a did mismatch, got %v", err)
+	}
+
+	_, err = jv.VerifyIdTokenContext(ctx, withoutDevice, WithExpectedClaim("did", "device-a"))
+	if err == nil || !strings.Contains(err.Error(), "did: missing") {
+		t.Errorf("expected the did to be missing, got %v", err)
+	}
+
+	if _, err := jv.VerifyIdToken(withoutDevice); err != nil {
+		t.Errorf("an expected claim leaked into a later call: %s", err)
+	}
+}
+
+func Test_expected_claims_are_never_shared_between_calls(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["did"] = "device-a"
+	token := issuer.Sign(claims)
+
+	// Concurrent calls for the same token share one signature check; each
+	// must still see the outcome for its own device.
+	var wg sync.WaitGroup
+	errs := make([]error, 40)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			device := "device-a"
+			if i%2 == 1 {
+				device = "device-b"
+			}
+			_, errs[i] = jv.VerifyAccessTokenContext(context.Background(), token, WithExpectedClaim("did", device))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i%2 == 0 && err != nil {
+			t.Errorf("call %d for device-a failed: %s", i, err)
+		}
+		if i%2 == 1 && err == nil {
+			t.Errorf("call %d for device-b was accepted", i)
+		}
+	}
+}
+
+func Test_transaction_ids_must_match_the_txn_claim(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	jv, err := NewVerifier(issuer.URL,
+		WithClaimToValidate("aud", "api://default"),
+		WithCache(cache.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("api://default")
+	claims["txn"] = "txn-123"
+	token := issuer.Sign(claims)
+
+	delete(claims, "txn")
+	withoutTxn := issuer.Sign(claims)
+
+	ctx := context.Background()
+	if _, err := jv.VerifyAccessTokenContext(ctx, token, WithTransactionID("txn-123")); err != nil {
+		t.Errorf("could not verify access_token for its transaction: %s", err)
+	}
+
+	_, err = jv.VerifyAccessTokenContext(ctx, token, WithTransactionID("txn-456"))
+	if err == nil || !strings.Contains(err.Error(), `txn: "txn-123" (string) does not match "txn-456" (string)`) {
+		t.Errorf("expected a txn mismatch, got %v", err)
+	}
+
+	_, err = jv.VerifyIdTokenContext(ctx, withoutTxn, WithTransactionID("txn-123"))
+	if err == nil || !strings.Contains(err.Error(), "txn: missing") {
+		t.Errorf("expected the txn to be missing, got %v", err)
+	}
+
+	// Concurrent calls for the same token share one signature check; each
+	// must still see the outcome for its own transaction.
+	var wg sync.WaitGroup
+	errs := make([]error, 40)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			txn := "txn-123"
+			if i%2 == 1 {
+				txn = "txn-456"
+			}
+			_, errs[i] = jv.VerifyAccessTokenContext(ctx, token, WithTransactionID(txn))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if (err == nil) != (i%2 == 0) {
+			t.Errorf("call %d: unexpected outcome %v", i, err)
+		}
+	}
+}
+
+func Test_transaction_ids_tighten_the_maximum_token_age(t *testing.T) {
+	issuer := testissuer.New()
+	defer issuer.Close()
+
+	claims := issuer.Claims("api://default")
+	claims["txn"] = "txn-123"
+	claims["iat"] = time.Now().Add(-10 * time.Minute).Unix()
+	token := issuer.Sign(claims)
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		accepted bool
+		maxAge   time.Duration
+	}{
+		{"default transaction max age", nil, false, DefaultTransactionMaxTokenAge},
+		{"longer transaction max age", []Option{WithTransactionMaxTokenAge(time.Hour)}, true, 0},
+		{"shorter max token age", []Option{WithTransactionMaxTokenAge(time.Hour), WithMaxTokenAge(time.Minute)}, false, time.Minute},
+	}
+
+	for _, test := range tests {
+		opts := append([]Option{WithClaimToValidate("aud", "api://default"), WithCache(cache.NewMemory())}, test.opts...)
+		jv, err := NewVerifier(issuer.URL, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = jv.VerifyAccessTokenContext(context.Background(), token, WithTransactionID("txn-123"))
+		var tooOld *errors.TokenTooOld
+		switch {
+		case test.accepted && err != nil:
+			t.Errorf("%s: could not verify access_token: %s", test.name, err)
+		case !test.accepted && !goerrors.As(err, &tooOld):
+			t.Errorf("%s: expected a TokenTooOld error, got %v", test.name, err)
+		case !test.accepted && tooOld.MaxAge != test.maxAge:
+			t.Errorf("%s: expected a maximum age of %s, got %s", test.name, test.maxAge, tooOld.MaxAge)
+		}
+
+		if jv.MaxTokenAge == 0 {
+			if _, err := jv.VerifyAccessToken(token); err != nil {
+				t.Errorf("the transaction max age applied without a transaction: %s", err)
+			}
+		}
+	}
+}